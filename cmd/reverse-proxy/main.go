@@ -1,74 +1,307 @@
 package main
 
 import (
-	"log"
-	"time"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log/slog"
+	"net"
+	"os"
 
 	"github.com/gofiber/fiber/v3"
+	"google.golang.org/grpc"
 
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/admin"
 	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/balancer"
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/configwatch"
 	"reverseProxy/internal/egressconfig"
 	"reverseProxy/internal/egressproxy"
+	"reverseProxy/internal/extauthz"
+	"reverseProxy/internal/grpcproxy"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/ipfilter"
 	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/loadshed"
+	"reverseProxy/internal/logging"
+	"reverseProxy/internal/maintenance"
+	"reverseProxy/internal/plugins"
 	"reverseProxy/internal/proxyhandler"
+	"reverseProxy/internal/revocation"
+	"reverseProxy/internal/sidecarconfig"
 	"reverseProxy/internal/tokenmanager"
+	"reverseProxy/internal/tracing"
 )
 
 func main() {
-	// Replace with the correct JWKS URL from Okta or Keycloak
-	jwksURL := "http://localhost:8080/realms/baeldung-keycloak/protocol/openid-connect/certs" // Keycloak JWKS URL
+	// reverse-proxy validate checks the configuration and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
 
-	// Fetch the public keys once when the server starts
-	if err := jwtauth.FetchPublicKeys(jwksURL); err != nil {
-		log.Fatalf("Error fetching public keys: %v", err)
+	// Listen addresses, config paths and refresh intervals come from flags or SIDECAR_* environment variables
+	opts, err := parseOptions(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	// Structured logging configured from LOG_LEVEL (or -log-level), LOG_FORMAT and LOG_REDACT
+	logOpts := logging.OptionsFromEnv()
+	if opts.LogLevel != "" {
+		_ = logOpts.Level.UnmarshalText([]byte(opts.LogLevel))
+	}
+	logging.Init(logOpts)
+
+	// Configure OpenTelemetry tracing from the standard OTEL_* environment variables
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		fatal("error initialising tracing", err)
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	// A unified config file (-config, or sidecar.yaml when present) carries the ingress, authorization
+	// and egress configs in one strictly checked file; a file with errors stops the sidecar. Otherwise load
+	// upstream routing, per-route ingress options and token issuers from YAML (ingress-config.yaml by default)
+	configFile := opts.unifiedFile()
+	unified := configFile != ""
+	if unified {
+		if err := sidecarconfig.Load(configFile); err != nil {
+			fatal("invalid "+configFile, err)
+		}
+	} else if err := ingressconfig.Load(opts.IngressConfig); err != nil {
+		slog.Warn("ingress config not loaded; no upstream configured, requests will fail with 502", slog.Any("error", err))
+	}
+
+	// Token issuers come from authn.issuers in ingress-config.yaml; keys are located through OIDC discovery
+	// unless an issuer pins its jwks-url
+	if !jwtauth.IssuersConfigured() {
+		fatal("no token issuers configured", errors.New("set authn.issuers in ingress-config.yaml"))
+	}
+	// Discover the issuers and fetch their keys in the background, retrying with backoff so an identity
+	// provider booting slower than the sidecar does not crash it; /readyz reports not-ready until then
+	go jwtauth.LoadKeys(context.Background())
+
+	// Load the plugins listed in ingress-config.yaml; a plugin that fails to load stops the sidecar
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		if err := plugins.Load(context.Background(), conf.Plugins); err != nil {
+			fatal("error loading plugins", err)
+		}
 	}
 
 	// Load authorization rules from YAML (authorization.yaml at project root by default)
-	if err := authorization.Load("authorization.yaml"); err != nil {
-		// Not fatal: allow running without external authorization during local dev
-		log.Printf("authorization config not loaded: %v (authorization checks may be skipped)", err)
-	}
-
-	// Start a goroutine to periodically refresh the public keys (optional)
-	// This can be used to refresh keys if they rotate over time.
-	go func() {
-		for {
-			// Refresh the keys every hour (you can adjust the interval)
-			err := jwtauth.FetchPublicKeys(jwksURL)
-			if err != nil {
-				log.Printf("Error refreshing public keys: %v", err)
-			}
-			// Sleep for 24 hour before refreshing again
-			time.Sleep(24 * time.Hour)
+	if !unified {
+		if err := authorization.Load(opts.AuthorizationConfig); err != nil {
+			// Not fatal: allow running without external authorization during local dev
+			slog.Warn("authorization config not loaded; authorization checks may be skipped", slog.Any("error", err))
 		}
-	}()
+	} else if authorization.ConfigOrNil() == nil {
+		slog.Warn("no authorization section in " + configFile + "; authorization checks may be skipped")
+	}
 
-	go egressProxy()
+	// Refresh the public keys (daily by default) and re-resolve discovered issuers so key rotations and
+	// endpoint or jwks_uri changes are picked up
+	jwtauth.KeyRefreshInterval = opts.KeyRefresh
+	go jwtauth.RunRefresh(context.Background())
 
-	app := fiber.New()
+	// Re-read the revocation denylist file and poll its URL, when revocation is enabled
+	go revocation.Run(context.Background())
+
+	// Probe the upstreams of routes with a health-check and keep failing endpoints out of rotation
+	go balancer.RunHealthChecks()
+
+	go egressProxy(opts, unified)
+
+	go adminAPI(opts, configFile)
+
+	// Reload authorization.yaml and egress-config.yaml when a ConfigMap or Secret update swaps them on disk
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.ConfigWatch != nil && conf.ConfigWatch.Enabled {
+		watchConfigs(*conf.ConfigWatch, opts, configFile)
+	}
+
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.ExtAuthz != nil && conf.ExtAuthz.Enabled {
+		go extAuthz(*conf.ExtAuthz)
+	}
+
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.GRPC != nil && conf.GRPC.Enabled {
+		go grpcProxy(*conf.GRPC)
+	}
+
+	// Refuse bodies over the global max-body-bytes while reading them
+	// and write refusals in the configured error-responses format
+	app := fiber.New(fiber.Config{
+		BodyLimit:    ingressconfig.ConfigOrNil().BodyLimit(nil),
+		ErrorHandler: proxyhandler.ErrorHandler,
+	})
+
+	// Correlate logs, traces and upstream calls with a request ID
+	app.Use(logging.RequestID)
+
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		useAccessLog(app, "ingress", conf.AccessLog)
+	}
+
+	// Set the configured security headers on every response, including refusals
+	app.Use(proxyhandler.SecurityHeaders)
+
+	// Answer CORS preflights, which carry no token, before authentication
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.CORS != nil && conf.CORS.Enabled {
+		app.Use(proxyhandler.CORS(*conf.CORS))
+	}
+
+	// Refuse denied clients, maintenance and overload before authenticating
+	for _, h := range admission {
+		app.Use(h)
+	}
+
+	// Batch pre-authorization, answered by the sidecar instead of being proxied
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.BatchAuthz != nil && conf.BatchAuthz.Enabled {
+		app.Post(conf.BatchAuthz.EndpointPath(), proxyhandler.BatchHandler)
+	}
 
 	// Reverse proxy handler
 	app.All("/*", proxyhandler.Handler)
 
-	log.Fatal(app.Listen(":3001"))
+	fatal("ingress listener stopped", app.Listen(opts.IngressAddr, ingressListenConfig()))
+}
+
+// admission refuses requests before they are authenticated, on the ingress listener as on the gRPC
+// and ext_authz servers, which run the pipeline without it
+var admission = []fiber.Handler{
+	// Decode the path once, refusing dot segments and encoded slashes, so every check matches what the upstream serves
+	canonpath.Middleware,
+	// Refuse clients outside the ip-access lists before authenticating them
+	ipfilter.Middleware,
+	// Answer 503 without reaching the upstream while maintenance is switched on through the admin API
+	maintenance.Middleware,
+	// Refuse requests beyond the global and per-route max-in-flight
+	loadshed.ConcurrencyLimit,
+	// Shed low-priority traffic on routes running over their latency budget
+	loadshed.Middleware,
 }
 
-func egressProxy() {
-	// Load egress configuration from YAML (egress-config.yaml at project root by default)
-	if err := egressconfig.Load("egress-config.yaml"); err != nil {
-		log.Printf("egress config not loaded: %v (egress proxy will operate in noIdp mode only)", err)
+// ingressListenConfig serves HTTPS, verifying client certificates, when ingress tls is configured
+func ingressListenConfig() fiber.ListenConfig {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil || conf.TLS == nil {
+		return fiber.ListenConfig{}
 	}
+	t := conf.TLS
+	lc := fiber.ListenConfig{CertFile: t.CertFile, CertKeyFile: t.KeyFile, CertClientFile: t.ClientCAFile}
+	if t.ClientCAFile != "" && t.ClientAuth != ingressconfig.ClientAuthRequire {
+		// JWT-only routes must stay reachable without a certificate
+		lc.TLSConfigFunc = func(tc *tls.Config) { tc.ClientAuth = tls.VerifyClientCertIfGiven }
+	}
+	return lc
+}
 
-	// Start token refresh manager (10-minute interval)
+func egressProxy(opts *options, unified bool) {
+	// Load egress configuration from YAML (egress-config.yaml by default); the unified file's egress
+	// section is already loaded
+	if !unified {
+		if err := egressconfig.Load(opts.EgressConfig); err != nil {
+			slog.Warn("egress config not loaded; egress proxy will operate in noIdp mode only", slog.Any("error", err))
+		}
+	}
+
+	// Start token refresh manager (10-minute interval by default)
 	tokenMgr := tokenmanager.GetInstance()
-	if err := tokenMgr.StartTokenRefresh(10 * time.Minute); err != nil {
-		log.Printf("Failed to start token refresh manager: %v", err)
+	if err := tokenMgr.StartTokenRefresh(opts.TokenRefresh); err != nil {
+		slog.Error("failed to start token refresh manager", slog.Any("error", err))
 	}
 
 	app := fiber.New()
 
+	app.Use(logging.RequestID)
+
+	useAccessLog(app, "egress", egressconfig.AccessLogConfig())
+
 	// Egress proxy handler
 	app.All("/*", egressproxy.Handler)
 
-	log.Fatal(app.Listen(":3002"))
+	fatal("egress listener stopped", app.Listen(opts.EgressAddr))
+}
+
+// extAuthz serves the Envoy ext_authz API, running the same authn and authz pipeline as the proxy
+func extAuthz(conf extauthz.Config) {
+	lis, err := net.Listen("tcp", conf.ListenAddress())
+	if err != nil {
+		fatal("ext_authz listener failed", err)
+	}
+	server := grpc.NewServer()
+	extauthz.New(proxyhandler.Check, admission...).Register(server)
+	fatal("ext_authz listener stopped", server.Serve(lis))
+}
+
+// grpcProxy serves gRPC calls over h2c, running the same authn and authz pipeline as the proxy
+func grpcProxy(conf ingressconfig.GRPCConfig) {
+	server := grpcproxy.New(proxyhandler.Check, admission...).HTTPServer(conf.ListenAddress())
+	fatal("grpc listener stopped", server.ListenAndServe())
+}
+
+func adminAPI(opts *options, configFile string) {
+	paths := admin.ConfigPaths{
+		Authorization: opts.AuthorizationConfig,
+		Egress:        opts.EgressConfig,
+		Ingress:       opts.IngressConfig,
+		File:          configFile,
+	}
+	app := admin.New(paths)
+
+	// Admin endpoints can reload configuration, so they listen on loopback unless -admin-addr says otherwise
+	fatal("admin listener stopped", app.Listen(opts.AdminAddr))
+}
+
+// watchConfigs reloads the authorization and egress configs, and the secret files they read, when they
+// change; with a unified config file both sections are reloaded from it
+func watchConfigs(conf configwatch.Config, opts *options, configFile string) {
+	authzFile, egressFile := opts.AuthorizationConfig, opts.EgressConfig
+	loadAuthz := func() error { return authorization.Load(authzFile) }
+	loadEgress := func() error { return egressconfig.Load(egressFile) }
+	if configFile != "" {
+		authzFile, egressFile = configFile, configFile
+		loadAuthz = func() error { return sidecarconfig.Load(configFile, sidecarconfig.SectionAuthorization) }
+		loadEgress = func() error { return sidecarconfig.Load(configFile, sidecarconfig.SectionEgress) }
+	}
+	go configwatch.Watch(context.Background(), "authorization", conf.PollInterval(),
+		func() []string { return append([]string{authzFile}, authorization.SecretFiles()...) },
+		loadAuthz)
+	go configwatch.Watch(context.Background(), "egress", conf.PollInterval(),
+		func() []string { return append([]string{egressFile}, egressconfig.SecretFiles()...) },
+		func() error {
+			if err := loadEgress(); err != nil {
+				return err
+			}
+			return tokenmanager.GetInstance().Reload()
+		})
+}
+
+// useAccessLog installs the access log middleware when the listener's config enables it
+func useAccessLog(app *fiber.App, listener string, conf *accesslog.Config) {
+	if conf == nil || !conf.Enabled {
+		return
+	}
+	handler, _, err := accesslog.New(*conf)
+	if err != nil {
+		slog.Warn("access log disabled", slog.String("listener", listener), slog.Any("error", err))
+		return
+	}
+	app.Use(handler)
+}
+
+// fileExists reports whether path names an existing file
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// fatal logs err and exits the process
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("error", err))
+	os.Exit(1)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultUnifiedConfig is the unified config file used instead of the separate ones when it exists
+// and no -config is given
+const defaultUnifiedConfig = "sidecar.yaml"
+
+// options are the process settings. Each flag falls back to the SIDECAR_ environment variable named
+// after it (e.g. -ingress-addr to SIDECAR_INGRESS_ADDR), then to its default.
+type options struct {
+	IngressAddr string
+	EgressAddr  string
+	AdminAddr   string
+
+	// ConfigFile is the unified config file; empty uses defaultUnifiedConfig when it exists
+	ConfigFile          string
+	IngressConfig       string
+	AuthorizationConfig string
+	EgressConfig        string
+
+	// LogLevel overrides LOG_LEVEL when set
+	LogLevel string
+	// KeyRefresh is how often issuer keys are refetched when authn.key-refresh sets no interval
+	KeyRefresh time.Duration
+	// TokenRefresh is how often egress client-credentials tokens are checked for refresh
+	TokenRefresh time.Duration
+}
+
+// addConfigFlags registers the config file flags, shared by serving and the validate subcommand
+func (o *options) addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, "config", "", "unified config file replacing the separate ones (default "+defaultUnifiedConfig+" when it exists)")
+	fs.StringVar(&o.IngressConfig, "ingress-config", "ingress-config.yaml", "ingress config file, without a unified config")
+	fs.StringVar(&o.AuthorizationConfig, "authorization-config", "authorization.yaml", "authorization config file, without a unified config")
+	fs.StringVar(&o.EgressConfig, "egress-config", "egress-config.yaml", "egress config file, without a unified config")
+}
+
+// parseOptions reads the serving options from args and the environment
+func parseOptions(args []string) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("reverse-proxy", flag.ContinueOnError)
+	fs.StringVar(&o.IngressAddr, "ingress-addr", ":3001", "ingress listener address")
+	fs.StringVar(&o.EgressAddr, "egress-addr", ":3002", "egress listener address")
+	// Admin endpoints can reload configuration, so only listen on loopback by default
+	fs.StringVar(&o.AdminAddr, "admin-addr", "127.0.0.1:3003", "admin listener address")
+	o.addConfigFlags(fs)
+	fs.StringVar(&o.LogLevel, "log-level", "", "log level: debug, info, warn or error (default from LOG_LEVEL, else info)")
+	fs.DurationVar(&o.KeyRefresh, "key-refresh-interval", 24*time.Hour, "how often issuer keys are refetched, unless authn.key-refresh.interval is set")
+	fs.DurationVar(&o.TokenRefresh, "token-refresh-interval", 10*time.Minute, "how often egress tokens are checked for refresh")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: reverse-proxy [flags]\n       reverse-proxy validate [flags]")
+		fs.PrintDefaults()
+	}
+	if err := parseWithEnv(fs, args); err != nil {
+		return nil, err
+	}
+	if err := o.validate(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+	return o, nil
+}
+
+// validate rejects intervals and a log level the sidecar cannot run with
+func (o *options) validate() error {
+	if o.KeyRefresh <= 0 || o.TokenRefresh <= 0 {
+		return fmt.Errorf("refresh intervals must be positive")
+	}
+	if o.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(o.LogLevel)); err != nil {
+			return fmt.Errorf("log-level: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseWithEnv applies the SIDECAR_ environment variable of each flag, then parses args over them.
+// -log-level is left to LOG_LEVEL, which logging reads itself. Errors are printed to the flag set's output.
+func parseWithEnv(fs *flag.FlagSet, args []string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "log-level" {
+			return
+		}
+		name := envName(f.Name)
+		f.Usage += " (env " + name + ")"
+		if v, ok := os.LookupEnv(name); ok && err == nil {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("%s: %w", name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return err
+	}
+	return fs.Parse(args)
+}
+
+// envName is the environment variable a flag falls back to
+func envName(flagName string) string {
+	return "SIDECAR_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// unifiedFile returns the unified config file to load, or "" to load the separate files
+func (o *options) unifiedFile() string {
+	if o.ConfigFile != "" {
+		return o.ConfigFile
+	}
+	if fileExists(defaultUnifiedConfig) {
+		return defaultUnifiedConfig
+	}
+	return ""
+}
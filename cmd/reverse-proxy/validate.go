@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"reverseProxy/internal/configcheck"
+)
+
+// runValidate implements "reverse-proxy validate": it checks the configuration as the sidecar would
+// load it, prints a report and returns the exit code, non-zero when a check failed
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	var o options
+	o.addConfigFlags(fs)
+	var ping bool
+	var timeout time.Duration
+	fs.BoolVar(&ping, "ping", false, "check that validation services and egress token endpoints answer")
+	fs.DurationVar(&timeout, "timeout", configcheck.DefaultTimeout, "timeout of each ping")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: reverse-proxy validate [flags]")
+		fs.PrintDefaults()
+	}
+	if err := parseWithEnv(fs, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	opts := configcheck.Options{
+		File:          o.unifiedFile(),
+		Ingress:       o.IngressConfig,
+		Authorization: o.AuthorizationConfig,
+		Egress:        o.EgressConfig,
+		Ping:          ping,
+		Timeout:       timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	report := configcheck.Run(ctx, opts)
+	report.Write(os.Stdout)
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
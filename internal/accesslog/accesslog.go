@@ -0,0 +1,207 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/logging"
+	"reverseProxy/internal/metrics"
+)
+
+// Config configures the access log of one listener
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Format is "json" (default) or "combined" (Apache combined log format)
+	Format string `yaml:"format"`
+	// Output is "stdout" (default) or a file path
+	Output string `yaml:"output"`
+	// Fields selects the JSON fields to emit; empty means all of AllFields
+	Fields   []string       `yaml:"fields"`
+	Rotation RotationConfig `yaml:"rotation"`
+}
+
+// RotationConfig controls size-based rotation when Output is a file
+type RotationConfig struct {
+	MaxSizeMB  int  `yaml:"max-size-mb"`
+	MaxBackups int  `yaml:"max-backups"`
+	MaxAgeDays int  `yaml:"max-age-days"`
+	Compress   bool `yaml:"compress"`
+}
+
+// AllFields lists the JSON fields available for selection
+var AllFields = []string{
+	"time", "request_id", "remote_ip", "method", "path", "query", "status", "bytes",
+	"latency_ms", "user_agent", "referer", "user_id", "decision", "upstream_status", "idp_type",
+}
+
+// Locals keys handlers use to enrich the access log entry
+const (
+	decisionKey       = "AccessLogDecision"
+	upstreamStatusKey = "AccessLogUpstreamStatus"
+	clientIPKey       = "AccessLogClientIP"
+)
+
+// SetDecision records the authorization decision of the current request
+func SetDecision(c fiber.Ctx, decision string) { c.Locals(decisionKey, decision) }
+
+// SetUpstreamStatus records the status code returned by the upstream or backend
+func SetUpstreamStatus(c fiber.Ctx, status int) { c.Locals(upstreamStatusKey, status) }
+
+// SetClientIP records the client IP derived behind trusted proxies, logged instead of the peer address
+func SetClientIP(c fiber.Ctx, ip string) { c.Locals(clientIPKey, ip) }
+
+func clientIP(c fiber.Ctx) string {
+	if ip, ok := c.Locals(clientIPKey).(string); ok {
+		return ip
+	}
+	return c.IP()
+}
+
+// New builds the access log middleware. The returned closer releases the output file, if any.
+func New(conf Config) (fiber.Handler, io.Closer, error) {
+	if conf.Format != "" && conf.Format != "json" && conf.Format != "combined" {
+		return nil, nil, fmt.Errorf("unsupported access log format %q", conf.Format)
+	}
+	fields, err := selectFields(conf.Fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, closer := openOutput(conf)
+	l := &logger{out: out, combined: conf.Format == "combined", fields: fields}
+	return l.handle, closer, nil
+}
+
+func selectFields(selected []string) ([]string, error) {
+	if len(selected) == 0 {
+		return AllFields, nil
+	}
+	known := make(map[string]bool, len(AllFields))
+	for _, f := range AllFields {
+		known[f] = true
+	}
+	for _, f := range selected {
+		if !known[f] {
+			return nil, fmt.Errorf("unknown access log field %q", f)
+		}
+	}
+	return selected, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func openOutput(conf Config) (io.Writer, io.Closer) {
+	if conf.Output == "" || conf.Output == "stdout" {
+		return os.Stdout, nopCloser{}
+	}
+	w := &lumberjack.Logger{
+		Filename:   conf.Output,
+		MaxSize:    conf.Rotation.MaxSizeMB,
+		MaxBackups: conf.Rotation.MaxBackups,
+		MaxAge:     conf.Rotation.MaxAgeDays,
+		Compress:   conf.Rotation.Compress,
+	}
+	return w, w
+}
+
+type logger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	combined bool
+	fields   []string
+}
+
+func (l *logger) handle(c fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	status := metrics.StatusOf(c, err)
+
+	var line []byte
+	if l.combined {
+		line = l.combinedLine(c, start, status)
+	} else {
+		line = l.jsonLine(c, start, status)
+	}
+
+	l.mu.Lock()
+	_, _ = l.out.Write(line)
+	l.mu.Unlock()
+	return err
+}
+
+func (l *logger) jsonLine(c fiber.Ctx, start time.Time, status int) []byte {
+	entry := make(map[string]any, len(l.fields))
+	for _, f := range l.fields {
+		if v, ok := fieldValue(c, f, start, status); ok {
+			entry[f] = v
+		}
+	}
+	b, _ := json.Marshal(entry)
+	return append(b, '\n')
+}
+
+func fieldValue(c fiber.Ctx, field string, start time.Time, status int) (any, bool) {
+	switch field {
+	case "time":
+		return start.UTC().Format(time.RFC3339Nano), true
+	case "request_id":
+		return logging.RequestIDFrom(c), true
+	case "remote_ip":
+		return clientIP(c), true
+	case "method":
+		return c.Method(), true
+	case "path":
+		return c.Path(), true
+	case "query":
+		return string(c.Request().URI().QueryString()), true
+	case "status":
+		return status, true
+	case "bytes":
+		return len(c.Response().Body()), true
+	case "latency_ms":
+		return float64(time.Since(start).Microseconds()) / 1000, true
+	case "user_agent":
+		return c.Get(fiber.HeaderUserAgent), true
+	case "referer":
+		return c.Get(fiber.HeaderReferer), true
+	case "user_id":
+		p, ok := c.Locals("Principal").(jwtauth.Principal)
+		return p.UserID, ok
+	case "decision":
+		d, ok := c.Locals(decisionKey).(string)
+		return d, ok
+	case "upstream_status":
+		s, ok := c.Locals(upstreamStatusKey).(int)
+		return s, ok
+	case "idp_type":
+		v := c.Get("X-Idp-Type")
+		return v, v != ""
+	}
+	return nil, false
+}
+
+// combinedLine renders the Apache combined log format
+func (l *logger) combinedLine(c fiber.Ctx, start time.Time, status int) []byte {
+	user := "-"
+	if p, ok := c.Locals("Principal").(jwtauth.Principal); ok && p.UserID != "" {
+		user = p.UserID
+	}
+	size := "-"
+	if n := len(c.Response().Body()); n > 0 {
+		size = strconv.Itoa(n)
+	}
+	return fmt.Appendf(nil, "%s - %s [%s] \"%s %s %s\" %d %s %q %q\n",
+		clientIP(c), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		c.Method(), c.OriginalURL(), c.Protocol(), status, size,
+		c.Get(fiber.HeaderReferer), c.Get(fiber.HeaderUserAgent))
+}
@@ -0,0 +1,86 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func newTestApp(l *logger) *fiber.App {
+	app := fiber.New()
+	app.Use(l.handle)
+	app.Get("/items", func(c fiber.Ctx) error {
+		c.Locals("Principal", jwtauth.Principal{UserID: "u-1"})
+		SetDecision(c, "allowed")
+		SetUpstreamStatus(c, fiber.StatusCreated)
+		return c.Status(fiber.StatusCreated).SendString("ok")
+	})
+	return app
+}
+
+func TestJSONSelectedFields(t *testing.T) {
+	var buf bytes.Buffer
+	fields, err := selectFields([]string{"method", "path", "status", "user_id", "decision", "upstream_status"})
+	if err != nil {
+		t.Fatalf("selectFields: %v", err)
+	}
+	app := newTestApp(&logger{out: &buf, fields: fields})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items?page=2", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	resp.Body.Close()
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"method": "GET", "path": "/items", "status": float64(201),
+		"user_id": "u-1", "decision": "allowed", "upstream_status": float64(201),
+	}
+	if len(entry) != len(want) {
+		t.Fatalf("entry = %v, want only %v", entry, want)
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s = %v, want %v", k, entry[k], v)
+		}
+	}
+}
+
+func TestCombinedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp(&logger{out: &buf, combined: true})
+
+	req := httptest.NewRequest("GET", "/items?page=2", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	resp.Body.Close()
+
+	line := buf.String()
+	for _, part := range []string{" - u-1 [", `"GET /items?page=2 HTTP/1.1" 201 2 "" "test-agent"`} {
+		if !strings.Contains(line, part) {
+			t.Errorf("line %q does not contain %q", line, part)
+		}
+	}
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, _, err := New(Config{Format: "xml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, _, err := New(Config{Fields: []string{"password"}}); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
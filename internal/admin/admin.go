@@ -0,0 +1,302 @@
+package admin
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/balancer"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/maintenance"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/revocation"
+	"reverseProxy/internal/sidecarconfig"
+	"reverseProxy/internal/tokenmanager"
+	"reverseProxy/internal/tokenstorage"
+)
+
+// ConfigPaths tells the admin API which files to re-read on reload
+type ConfigPaths struct {
+	Authorization string
+	Egress        string
+	Ingress       string
+	// File is the unified config file; when set, reloads re-read their section of it instead
+	File string
+}
+
+// load re-reads a section from the unified file, or the section's own file with loadFile
+func (p ConfigPaths) load(section string, loadFile func(string) error, path string) error {
+	if p.File != "" {
+		return sidecarconfig.Load(p.File, section)
+	}
+	return loadFile(path)
+}
+
+// redacted replaces configured secrets in admin responses
+const redacted = "***"
+
+// New builds the admin app exposing runtime status and config reload endpoints
+func New(paths ConfigPaths) *fiber.App {
+	app := fiber.New()
+
+	app.Get("/metrics", metrics.Handler())
+
+	// Probes: the sidecar is live once serving and ready once it can verify tokens
+	app.Get("/healthz", func(c fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	app.Get("/readyz", func(c fiber.Ctx) error {
+		if !jwtauth.Ready() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"ready": false, "reason": "issuer keys not loaded"})
+		}
+		return c.JSON(fiber.Map{"ready": true})
+	})
+
+	app.Get("/admin/status", func(c fiber.Ctx) error {
+		running, idps := tokenmanager.GetInstance().Status()
+		return c.JSON(fiber.Map{
+			"authorization_loaded": authorization.ConfigOrNil() != nil,
+			"ingress_loaded":       ingressconfig.ConfigOrNil() != nil,
+			"egress_idp_types":     sortedIDPTypes(),
+			"jwks_kids":            jwtauth.CachedKids(),
+			"ready":                jwtauth.Ready(),
+			"token_refresh":        fiber.Map{"running": running, "idps": len(idps)},
+		})
+	})
+
+	app.Get("/admin/jwks", func(c fiber.Ctx) error {
+		issuers := fiber.Map{}
+		for _, is := range jwtauth.Issuers() {
+			issuers[is.Issuer] = fiber.Map{"jwks_url": is.Keys.URL(), "kids": is.Keys.Kids(), "metadata": is.Metadata()}
+		}
+		return c.JSON(fiber.Map{"kids": jwtauth.CachedKids(), "issuers": issuers})
+	})
+
+	// Backends verify X-Forwarded-Identity assertions against this key set
+	app.Get("/admin/identity/jwks", func(c fiber.Ctx) error {
+		return c.JSON(assertion.JWKS())
+	})
+
+	// Balancing and health state of routes with several upstreams
+	app.Get("/admin/upstreams", func(c fiber.Ctx) error {
+		return c.JSON(balancer.Status())
+	})
+
+	// Maintenance mode answers ingress requests with 503, globally or per route key, until switched off
+	app.Get("/admin/maintenance", func(c fiber.Ctx) error {
+		return c.JSON(maintenanceStatus())
+	})
+	app.Post("/admin/maintenance", func(c fiber.Ctx) error {
+		maintenance.Set("", true)
+		return c.JSON(maintenanceStatus())
+	})
+	app.Delete("/admin/maintenance", func(c fiber.Ctx) error {
+		maintenance.Set("", false)
+		return c.JSON(maintenanceStatus())
+	})
+	app.Post("/admin/maintenance/routes/*", func(c fiber.Ctx) error {
+		return setRouteMaintenance(c, true)
+	})
+	app.Delete("/admin/maintenance/routes/*", func(c fiber.Ctx) error {
+		return setRouteMaintenance(c, false)
+	})
+
+	// Denylist size and refresh state; 404 when revocation is off
+	app.Get("/admin/revocation", func(c fiber.Ctx) error {
+		st, ok := revocation.CurrentStatus()
+		if !ok {
+			return fiber.NewError(fiber.StatusNotFound, "revocation not enabled")
+		}
+		return c.JSON(st)
+	})
+	// Re-read the denylist now, e.g. right after revoking a token
+	app.Post("/admin/revocation/refresh", func(c fiber.Ctx) error {
+		if !revocation.Enabled() {
+			return fiber.NewError(fiber.StatusNotFound, "revocation not enabled")
+		}
+		return reloadResult(c, revocation.Refresh(c.Context()))
+	})
+
+	app.Get("/admin/tokens", func(c fiber.Ctx) error {
+		return c.JSON(tokenStatus())
+	})
+
+	app.Get("/admin/config/authorization", func(c fiber.Ctx) error {
+		conf := authorization.ConfigOrNil()
+		if conf == nil {
+			return fiber.NewError(fiber.StatusNotFound, "authorization config not loaded")
+		}
+		return sendYAML(c, authorizationView(conf))
+	})
+
+	app.Get("/admin/config/egress", func(c fiber.Ctx) error {
+		return sendYAML(c, egressView())
+	})
+
+	app.Get("/admin/config/ingress", func(c fiber.Ctx) error {
+		conf := ingressconfig.ConfigOrNil()
+		if conf == nil {
+			return fiber.NewError(fiber.StatusNotFound, "ingress config not loaded")
+		}
+		return sendYAML(c, ingressView(conf))
+	})
+
+	app.Post("/admin/reload/authorization", func(c fiber.Ctx) error {
+		return reloadResult(c, paths.load(sidecarconfig.SectionAuthorization, authorization.Load, paths.Authorization))
+	})
+
+	app.Post("/admin/reload/egress", func(c fiber.Ctx) error {
+		if err := paths.load(sidecarconfig.SectionEgress, egressconfig.Load, paths.Egress); err != nil {
+			return reloadResult(c, err)
+		}
+		return reloadResult(c, tokenmanager.GetInstance().Reload())
+	})
+
+	app.Post("/admin/reload/ingress", func(c fiber.Ctx) error {
+		return reloadResult(c, paths.load(sidecarconfig.SectionIngress, ingressconfig.Load, paths.Ingress))
+	})
+
+	return app
+}
+
+// reloadResult reports a reload outcome; a failed reload keeps the previous config active
+func reloadResult(c fiber.Ctx, err error) error {
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"reloaded": false, "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"reloaded": true})
+}
+
+func maintenanceStatus() fiber.Map {
+	global, routes := maintenance.State()
+	return fiber.Map{"global": global, "routes": routes}
+}
+
+// setRouteMaintenance switches maintenance for the route key in the path, which must name a configured route
+func setRouteMaintenance(c fiber.Ctx, on bool) error {
+	key := c.Params("*")
+	conf := ingressconfig.ConfigOrNil()
+	known := false
+	if conf != nil {
+		for i := range conf.Routes {
+			known = known || conf.Routes[i].Key() == key
+		}
+	}
+	if !known && on {
+		return fiber.NewError(fiber.StatusNotFound, "no route "+key)
+	}
+	maintenance.Set(key, on)
+	return c.JSON(maintenanceStatus())
+}
+
+type idpTokenStatus struct {
+	tokenmanager.IDPStatus
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
+func tokenStatus() fiber.Map {
+	running, statuses := tokenmanager.GetInstance().Status()
+	storage := tokenstorage.GetInstance()
+	idps := make(map[string]idpTokenStatus, len(statuses))
+	for _, idpType := range sortedIDPTypes() {
+		st := idpTokenStatus{IDPStatus: statuses[idpType]}
+		if expiresAt, ok := storage.ExpiresAt(idpType); ok {
+			st.TokenExpiresAt = &expiresAt
+		}
+		idps[idpType] = st
+	}
+	return fiber.Map{"running": running, "idps": idps}
+}
+
+func sortedIDPTypes() []string {
+	idpTypes := egressconfig.GetAllIDPTypes()
+	sort.Strings(idpTypes)
+	return idpTypes
+}
+
+// sendYAML renders a config snapshot in the same format as its source file
+func sendYAML(c fiber.Ctx, v any) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, "application/yaml")
+	return c.Send(b)
+}
+
+// authorizationView copies the config with client secrets redacted
+func authorizationView(conf *authorization.Config) authorization.Config {
+	view := *conf
+	view.Coarse.ClientSecret = redact(view.Coarse.ClientSecret)
+	view.FineGrain.ClientSecret = redact(view.FineGrain.ClientSecret)
+	if conf.Audit != nil {
+		// webhook headers typically carry credentials
+		auditView := *conf.Audit
+		auditView.Headers = make(map[string]string, len(conf.Audit.Headers))
+		for k, v := range conf.Audit.Headers {
+			auditView.Headers[k] = redact(v)
+		}
+		view.Audit = &auditView
+	}
+	return view
+}
+
+// ingressView copies the config with the introspection and token exchange client secrets and the
+// Redis passwords redacted
+func ingressView(conf *ingressconfig.IngressConfig) ingressconfig.IngressConfig {
+	view := *conf
+	if conf.TokenExchange != nil {
+		exchange := *conf.TokenExchange
+		exchange.ClientSecret = redact(exchange.ClientSecret)
+		view.TokenExchange = &exchange
+	}
+	if conf.ReplayProtection != nil && conf.ReplayProtection.Redis != nil {
+		replayView := *conf.ReplayProtection
+		redisView := *conf.ReplayProtection.Redis
+		redisView.Password = redact(redisView.Password)
+		replayView.Redis = &redisView
+		view.ReplayProtection = &replayView
+	}
+	if conf.Revocation != nil && conf.Revocation.Redis != nil {
+		revocationView := *conf.Revocation
+		redisView := *conf.Revocation.Redis
+		redisView.Password = redact(redisView.Password)
+		revocationView.Redis = &redisView
+		view.Revocation = &revocationView
+	}
+	if conf.Authn != nil && conf.Authn.Introspection != nil {
+		authn := *conf.Authn
+		introspection := *conf.Authn.Introspection
+		introspection.ClientSecret = redact(introspection.ClientSecret)
+		authn.Introspection = &introspection
+		view.Authn = &authn
+	}
+	return view
+}
+
+// egressView rebuilds the egress config with client secrets redacted
+func egressView() egressconfig.EgressConfig {
+	view := egressconfig.EgressConfig{MultiOAuthClientConfig: make(map[string]egressconfig.OAuthClientConfig)}
+	for _, idpType := range egressconfig.GetAllIDPTypes() {
+		conf, err := egressconfig.GetOAuthConfig(idpType)
+		if err != nil {
+			continue
+		}
+		conf.ClientSecret = redact(conf.ClientSecret)
+		view.MultiOAuthClientConfig[idpType] = conf
+	}
+	return view
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/maintenance"
+	"reverseProxy/internal/metrics"
+)
+
+func TestStatusAndJWKS(t *testing.T) {
+	jwtauth.SetPublicKeyForTest("admin-kid", nil)
+	app := New(ConfigPaths{})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/jwks", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Kids []string `json:"kids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, kid := range body.Kids {
+		found = found || kid == "admin-kid"
+	}
+	if !found {
+		t.Fatalf("expected admin-kid in %v", body.Kids)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/admin/status", nil))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("status endpoint failed: %v %v", err, resp)
+	}
+}
+
+func TestAuthorizationConfigIsRedacted(t *testing.T) {
+	authorization.SetConfigForTest(&authorization.Config{Coarse: authorization.CoarseConfig{
+		Enabled: true, ValidationURL: "http://pdp/coarse", ClientID: "plt", ClientSecret: "s3cr3t",
+		ResourceMap: map[string]authorization.CoarseResource{"[/api/**]": {Resource: "/api/accesscheck"}},
+	}})
+	t.Cleanup(func() { authorization.SetConfigForTest(nil) })
+
+	resp, err := New(ConfigPaths{}).Test(httptest.NewRequest("GET", "/admin/config/authorization", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(b), "s3cr3t") {
+		t.Fatalf("client secret leaked: %s", b)
+	}
+	if !strings.Contains(string(b), "/api/accesscheck") || !strings.Contains(string(b), redacted) {
+		t.Fatalf("expected rules and redacted secret, got: %s", b)
+	}
+}
+
+func TestReloadIngress(t *testing.T) {
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	p := filepath.Join(t.TempDir(), "ingress-config.yaml")
+	app := New(ConfigPaths{Ingress: p})
+
+	if err := os.WriteFile(p, []byte("default-upstream: \"not a url\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/reload/ingress", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 422 {
+		t.Fatalf("expected 422 for invalid config, got %d", resp.StatusCode)
+	}
+
+	if err := os.WriteFile(p, []byte("default-upstream: \"http://app:8080\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = app.Test(httptest.NewRequest("POST", "/admin/reload/ingress", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if c := ingressconfig.ConfigOrNil(); c == nil || c.DefaultUpstream != "http://app:8080" {
+		t.Fatalf("expected reloaded ingress config, got %+v", c)
+	}
+}
+
+func TestUpstreamsStatus(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{Routes: []ingressconfig.Route{{
+		Name: "orders", PathPrefix: "/orders", Upstreams: []ingressconfig.Endpoint{{URL: "http://orders-1:8080/"}},
+	}}})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	resp, err := New(ConfigPaths{}).Test(httptest.NewRequest("GET", "/admin/upstreams", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string][]struct {
+		URL     string `json:"url"`
+		Healthy bool   `json:"healthy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if eps := body["orders"]; len(eps) != 1 || eps[0].URL != "http://orders-1:8080" || !eps[0].Healthy {
+		t.Fatalf("expected the healthy orders endpoint, got %v", body)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{Routes: []ingressconfig.Route{{Name: "orders", PathPrefix: "/orders"}}})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		maintenance.Set("orders", false)
+	})
+	app := New(ConfigPaths{})
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/admin/maintenance/routes/unknown", nil))
+	if err != nil || resp.StatusCode != 404 {
+		t.Fatalf("expected 404 for an unknown route, got %v %v", resp, err)
+	}
+	resp, err = app.Test(httptest.NewRequest("POST", "/admin/maintenance/routes/orders", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Global bool     `json:"global"`
+		Routes []string `json:"routes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Global || len(body.Routes) != 1 || body.Routes[0] != "orders" {
+		t.Fatalf("expected orders under maintenance, got %+v", body)
+	}
+	if _, err := app.Test(httptest.NewRequest("DELETE", "/admin/maintenance/routes/orders", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, routes := maintenance.State(); len(routes) != 0 {
+		t.Fatalf("expected maintenance switched off, got %v", routes)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	metrics.IngressRequests.WithLabelValues("admin-test", "200").Inc()
+	resp, err := New(ConfigPaths{}).Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(b), `sidecar_ingress_requests_total{code="200",route="admin-test"} 1`) {
+		t.Fatalf("expected ingress counter in exposition, got:\n%s", b)
+	}
+}
+
+func TestReadyzReportsIssuerKeys(t *testing.T) {
+	t.Cleanup(func() { _ = jwtauth.Configure(nil) })
+	if err := jwtauth.Configure(&jwtauth.Config{Issuers: []jwtauth.IssuerConfig{{Issuer: "https://idp.test", JWKSURL: "http://127.0.0.1:1/keys"}}}); err != nil {
+		t.Fatal(err)
+	}
+	app := New(ConfigPaths{})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/healthz", nil))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected live, got %v %v", err, resp)
+	}
+	resp, err = app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	if err != nil || resp.StatusCode != 503 {
+		t.Fatalf("expected not ready before the issuer keys load, got %v %v", err, resp)
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	if err := jwtauth.Configure(&jwtauth.Config{Issuers: []jwtauth.IssuerConfig{{Issuer: "https://idp.test", JWKSURL: jwks.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jwtauth.FetchIssuerKeys(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = app.Test(httptest.NewRequest("GET", "/readyz", nil))
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected ready once the issuer keys load, got %v %v", err, resp)
+	}
+}
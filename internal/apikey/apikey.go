@@ -0,0 +1,243 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/tracing"
+)
+
+// Config enables API key authentication for routes with authn: api-key
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Header carries the key (default X-Api-Key); it is removed before proxying
+	Header string `yaml:"header"`
+	// File is a YAML list of keys stored as SHA-256 hashes; read on each config load
+	File string `yaml:"file"`
+	// ValidationURL is asked about keys not found in File
+	ValidationURL string `yaml:"validation-url"`
+	// CacheTTL bounds how long a key accepted by ValidationURL is reused (default 60s)
+	CacheTTL time.Duration `yaml:"cache-ttl"`
+}
+
+// Entry is one key in the keys file
+type Entry struct {
+	// ID is the service identity; it becomes the principal's user ID
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	// Hash is "sha256:" followed by the hex SHA-256 of the key
+	Hash string `yaml:"hash"`
+}
+
+// DefaultHeader is used when the config does not name a header
+const DefaultHeader = "X-Api-Key"
+
+const (
+	defaultCacheTTL = time.Minute
+	maxCacheEntries = 10000
+)
+
+// ErrInvalidKey is returned for keys neither the file nor the validation service accept
+var ErrInvalidKey = errors.New("invalid API key")
+
+type store struct {
+	conf Config
+	// keys maps the SHA-256 of a key to its entry
+	keys map[[sha256.Size]byte]Entry
+}
+
+var current atomic.Pointer[store]
+
+var client = &http.Client{Timeout: 5 * time.Second}
+
+type cacheEntry struct {
+	principal jwtauth.Principal
+	expires   time.Time
+}
+
+var cacheMu sync.Mutex
+var cache = make(map[[sha256.Size]byte]cacheEntry)
+
+// Configure installs the API key config, reading the keys file; nil disables API keys
+func Configure(conf *Config) error {
+	if conf == nil || !conf.Enabled {
+		current.Store(nil)
+		purgeCache()
+		return nil
+	}
+	if conf.File == "" && conf.ValidationURL == "" {
+		return errors.New("api-keys: file or validation-url is required")
+	}
+	s := &store{conf: *conf, keys: make(map[[sha256.Size]byte]Entry)}
+	if conf.File != "" {
+		entries, err := readKeys(conf.File)
+		if err != nil {
+			return fmt.Errorf("api-keys: %w", err)
+		}
+		for i, e := range entries {
+			if e.ID == "" {
+				return fmt.Errorf("api-keys: %s: entry %d: id is required", conf.File, i)
+			}
+			sum, err := parseHash(e.Hash)
+			if err != nil {
+				return fmt.Errorf("api-keys: %s: entry %q: %w", conf.File, e.ID, err)
+			}
+			s.keys[sum] = e
+		}
+	}
+	current.Store(s)
+	purgeCache()
+	return nil
+}
+
+// Header returns the header API keys are read from, reporting false when API keys are disabled
+func Header() (string, bool) {
+	s := current.Load()
+	if s == nil {
+		return "", false
+	}
+	if s.conf.Header != "" {
+		return s.conf.Header, true
+	}
+	return DefaultHeader, true
+}
+
+// Validate resolves an API key to the principal of the service it belongs to
+func Validate(ctx context.Context, key string) (jwtauth.Principal, error) {
+	s := current.Load()
+	if s == nil {
+		return jwtauth.Principal{}, errors.New("API keys are not enabled")
+	}
+	sum := sha256.Sum256([]byte(key))
+	if e, ok := s.keys[sum]; ok {
+		return jwtauth.Principal{UserID: e.ID, Username: e.Name}, nil
+	}
+	if s.conf.ValidationURL == "" {
+		return jwtauth.Principal{}, ErrInvalidKey
+	}
+	if p, ok := cached(sum); ok {
+		return p, nil
+	}
+	p, err := postValidation(ctx, s.conf.ValidationURL, key)
+	if err != nil {
+		return jwtauth.Principal{}, err
+	}
+	ttl := s.conf.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	storeCached(sum, cacheEntry{principal: p, expires: time.Now().Add(ttl)})
+	return p, nil
+}
+
+type validationResponse struct {
+	Valid     bool   `json:"valid"`
+	ServiceID string `json:"service_id"`
+	Name      string `json:"name"`
+}
+
+func postValidation(ctx context.Context, url, key string) (jwtauth.Principal, error) {
+	body, err := json.Marshal(map[string]string{"api_key": key})
+	if err != nil {
+		return jwtauth.Principal{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return jwtauth.Principal{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.InjectHTTP(ctx, req.Header)
+	resp, err := client.Do(req)
+	if err != nil {
+		return jwtauth.Principal{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jwtauth.Principal{}, fmt.Errorf("API key validation service returned %s", resp.Status)
+	}
+	var vr validationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		return jwtauth.Principal{}, fmt.Errorf("decoding API key validation response: %w", err)
+	}
+	if !vr.Valid || vr.ServiceID == "" {
+		return jwtauth.Principal{}, ErrInvalidKey
+	}
+	return jwtauth.Principal{UserID: vr.ServiceID, Username: vr.Name}, nil
+}
+
+func readKeys(path string) ([]Entry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := yaml.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseHash decodes a "sha256:<hex>" key hash
+func parseHash(h string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	hexSum, ok := strings.CutPrefix(h, "sha256:")
+	if !ok {
+		return sum, errors.New(`hash must start with "sha256:"`)
+	}
+	b, err := hex.DecodeString(hexSum)
+	if err != nil || len(b) != sha256.Size {
+		return sum, errors.New("hash is not a hex SHA-256 digest")
+	}
+	copy(sum[:], b)
+	return sum, nil
+}
+
+func cached(key [sha256.Size]byte) (jwtauth.Principal, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	e, ok := cache[key]
+	if !ok {
+		return jwtauth.Principal{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(cache, key)
+		return jwtauth.Principal{}, false
+	}
+	return e.principal, true
+}
+
+func storeCached(key [sha256.Size]byte, e cacheEntry) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if len(cache) >= maxCacheEntries {
+		now := time.Now()
+		for k, old := range cache {
+			if now.After(old.expires) {
+				delete(cache, k)
+			}
+		}
+	}
+	if len(cache) < maxCacheEntries {
+		cache[key] = e
+	}
+}
+
+func purgeCache() {
+	cacheMu.Lock()
+	cache = make(map[[sha256.Size]byte]cacheEntry)
+	cacheMu.Unlock()
+}
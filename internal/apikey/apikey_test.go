@@ -0,0 +1,88 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func hashOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writeKeys(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "api-keys.yaml")
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestValidateFromFile(t *testing.T) {
+	p := writeKeys(t, "- id: orders-service\n  name: Orders\n  hash: "+hashOf("k-orders")+"\n")
+	if err := Configure(&Config{Enabled: true, File: p}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	if header, ok := Header(); !ok || header != DefaultHeader {
+		t.Errorf("expected default header, got %q %v", header, ok)
+	}
+	got, err := Validate(context.Background(), "k-orders")
+	if err != nil || got.UserID != "orders-service" || got.Username != "Orders" {
+		t.Fatalf("expected orders-service principal, got %+v %v", got, err)
+	}
+	if _, err := Validate(context.Background(), "k-unknown"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestValidateRemoteCachesAcceptedKeys(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_ = json.NewEncoder(w).Encode(map[string]any{"valid": body["api_key"] == "k-remote", "service_id": "billing"})
+	}))
+	defer srv.Close()
+	if err := Configure(&Config{Enabled: true, ValidationURL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	for i := 0; i < 2; i++ {
+		if got, err := Validate(context.Background(), "k-remote"); err != nil || got.UserID != "billing" {
+			t.Fatalf("expected billing principal, got %+v %v", got, err)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the accepted key to be cached, got %d calls", calls.Load())
+	}
+	if _, err := Validate(context.Background(), "k-bad"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestConfigureRejectsInvalidStores(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true}); err == nil {
+		t.Errorf("expected an error without file or validation-url")
+	}
+	if err := Configure(&Config{Enabled: true, File: writeKeys(t, "- id: a\n  hash: plain-text-key\n")}); err == nil {
+		t.Errorf("expected an error for an unhashed key")
+	}
+	if err := Configure(&Config{Enabled: true, File: writeKeys(t, "- hash: "+hashOf("k")+"\n")}); err == nil {
+		t.Errorf("expected an error for an entry without id")
+	}
+}
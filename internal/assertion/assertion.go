@@ -0,0 +1,231 @@
+package assertion
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// Config enables a short-lived JWT asserting the authenticated principal, forwarded to the upstream
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Header carries the assertion (default X-Forwarded-Identity)
+	Header string `yaml:"header"`
+	// Issuer and Audience become the iss and aud claims (issuer defaults to authn-sidecar)
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// TTL is the assertion lifetime (default 60s)
+	TTL time.Duration `yaml:"ttl"`
+	// KeyFile is a PEM private key (RSA, EC or Ed25519). When empty an ephemeral P-256 key is
+	// generated at startup; backends must then fetch the JWKS from the admin port.
+	KeyFile string `yaml:"key-file"`
+}
+
+// Defaults applied when the config leaves a field empty
+const (
+	DefaultHeader = "X-Forwarded-Identity"
+	DefaultIssuer = "authn-sidecar"
+	DefaultTTL    = time.Minute
+)
+
+// HeaderName returns the configured header or DefaultHeader
+func (c Config) HeaderName() string {
+	if c.Header != "" {
+		return c.Header
+	}
+	return DefaultHeader
+}
+
+type signer struct {
+	conf   Config
+	key    crypto.Signer
+	kid    string
+	method jwt.SigningMethod
+}
+
+var current atomic.Pointer[signer]
+
+// ephemeral is generated once and reused across reloads so backends keep verifying
+var ephemeral atomic.Pointer[ecdsa.PrivateKey]
+
+// Configure installs the assertion config, loading or generating the signing key; nil disables assertions
+func Configure(conf *Config) error {
+	if conf == nil || !conf.Enabled {
+		current.Store(nil)
+		return nil
+	}
+	key, err := loadKey(conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("identity-assertion: %w", err)
+	}
+	method, err := methodFor(key)
+	if err != nil {
+		return fmt.Errorf("identity-assertion: %w", err)
+	}
+	kid, err := keyID(key.Public())
+	if err != nil {
+		return fmt.Errorf("identity-assertion: %w", err)
+	}
+	current.Store(&signer{conf: *conf, key: key, kid: kid, method: method})
+	return nil
+}
+
+// Enabled reports whether assertions are minted, returning the header they travel in
+func Enabled() (header string, ok bool) {
+	s := current.Load()
+	if s == nil {
+		return "", false
+	}
+	return s.conf.HeaderName(), true
+}
+
+// Mint signs a short-lived assertion for the principal
+func Mint(p jwtauth.Principal) (string, error) {
+	s := current.Load()
+	if s == nil {
+		return "", errors.New("identity assertions are not enabled")
+	}
+	ttl := s.conf.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	issuer := s.conf.Issuer
+	if issuer == "" {
+		issuer = DefaultIssuer
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":      issuer,
+		"sub":      p.UserID,
+		"iat":      now.Unix(),
+		"nbf":      now.Unix(),
+		"exp":      now.Add(ttl).Unix(),
+		"user_id":  p.UserID,
+		"username": p.Username,
+		"email":    p.Email,
+	}
+	if s.conf.Audience != "" {
+		claims["aud"] = s.conf.Audience
+	}
+	tok := jwt.NewWithClaims(s.method, claims)
+	tok.Header["kid"] = s.kid
+	return tok.SignedString(s.key)
+}
+
+// JWKS returns the public key set backends use to verify assertions; empty when disabled
+func JWKS() map[string][]map[string]string {
+	keys := []map[string]string{}
+	if s := current.Load(); s != nil {
+		if jwk, err := publicJWK(s.key.Public(), s.kid, s.method.Alg()); err == nil {
+			keys = append(keys, jwk)
+		}
+	}
+	return map[string][]map[string]string{"keys": keys}
+}
+
+func loadKey(path string) (crypto.Signer, error) {
+	if path == "" {
+		if k := ephemeral.Load(); k != nil {
+			return k, nil
+		}
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if !ephemeral.CompareAndSwap(nil, k) {
+			return ephemeral.Load(), nil
+		}
+		return k, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if s, ok := k.(crypto.Signer); ok {
+			return s, nil
+		}
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key", path)
+}
+
+func methodFor(key crypto.Signer) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, errors.New("unsupported EC curve")
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
+
+// keyID derives a stable kid from the public key
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+func publicJWK(pub crypto.PublicKey, kid, alg string) (map[string]string, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]string{"kid": kid, "alg": alg, "use": "sig"}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = b64(k.N.Bytes())
+		jwk["e"] = b64(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk["kty"] = "EC"
+		jwk["crv"] = k.Curve.Params().Name
+		jwk["x"] = b64(k.X.FillBytes(make([]byte, size)))
+		jwk["y"] = b64(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = b64(k)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+	return jwk, nil
+}
@@ -0,0 +1,103 @@
+package assertion
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// verify checks an assertion against the published JWKS, as a backend would
+func verify(t *testing.T, signed string) jwt.MapClaims {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(JWKS())
+	}))
+	defer srv.Close()
+	keys := jwtauth.NewKeySet(srv.URL)
+	if err := keys.Fetch(); err != nil {
+		t.Fatalf("fetch JWKS: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(signed, claims, func(tok *jwt.Token) (interface{}, error) {
+		pk, ok := keys.Get(tok.Header["kid"].(string))
+		if !ok {
+			t.Fatalf("kid %v not in JWKS", tok.Header["kid"])
+		}
+		return pk, nil
+	}, jwt.WithIssuer("sidecar-test"), jwt.WithAudience("orders"), jwt.WithExpirationRequired())
+	if err != nil {
+		t.Fatalf("assertion does not verify: %v", err)
+	}
+	return claims
+}
+
+func TestMintEphemeralKey(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, Issuer: "sidecar-test", Audience: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Mint(jwtauth.Principal{UserID: "u1", Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verify(t, signed)
+	if claims["sub"] != "u1" || claims["username"] != "alice" {
+		t.Fatalf("unexpected claims %v", claims)
+	}
+
+	// a reload keeps the ephemeral key, so assertions minted before still verify
+	if err := Configure(&Config{Enabled: true, Issuer: "sidecar-test", Audience: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	verify(t, signed)
+}
+
+func TestMintWithKeyFile(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "assertion.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, Issuer: "sidecar-test", Audience: "orders", KeyFile: path}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Mint(jwtauth.Principal{UserID: "u2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil || tok.Method.Alg() != "RS256" {
+		t.Fatalf("expected RS256 assertion, got %v (%v)", tok, err)
+	}
+	verify(t, signed)
+}
+
+func TestConfigureRejectsBadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure(&Config{Enabled: true, KeyFile: path}); err == nil {
+		t.Fatalf("expected error for invalid key file")
+	}
+}
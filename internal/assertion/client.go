@@ -0,0 +1,90 @@
+package assertion
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClientAuthPrivateKeyJWT is the client auth method value for RFC 7523 client assertions
+const ClientAuthPrivateKeyJWT = "private_key_jwt"
+
+// ClientAssertionType is sent as client_assertion_type alongside a client assertion
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientAssertionTTL is the client assertion lifetime; assertions are reused until a minute before expiry
+const ClientAssertionTTL = 5 * time.Minute
+
+// ClientSigner signs client assertions (private_key_jwt, RFC 7523 section 2.2) for one client and key
+type ClientSigner struct {
+	ClientID string
+	KeyFile  string
+
+	key    crypto.Signer
+	kid    string
+	method jwt.SigningMethod
+
+	mu     sync.Mutex
+	cached map[string]cachedAssertion
+}
+
+type cachedAssertion struct {
+	token   string
+	expires time.Time
+}
+
+// NewClientSigner loads the PEM private key (RSA, EC or Ed25519) used to sign clientID's assertions
+func NewClientSigner(clientID, keyFile string) (*ClientSigner, error) {
+	if clientID == "" || keyFile == "" {
+		return nil, errors.New("private_key_jwt requires a client id and a private key file")
+	}
+	key, err := loadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	method, err := methodFor(key)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := keyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &ClientSigner{ClientID: clientID, KeyFile: keyFile, key: key, kid: kid, method: method, cached: map[string]cachedAssertion{}}, nil
+}
+
+// Assertion returns a client assertion for audience (the token endpoint or service URL),
+// reusing the previous one while it has more than a minute left
+func (s *ClientSigner) Assertion(audience string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if c, ok := s.cached[audience]; ok && now.Add(time.Minute).Before(c.expires) {
+		return c.token, nil
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	expires := now.Add(ClientAssertionTTL)
+	tok := jwt.NewWithClaims(s.method, jwt.MapClaims{
+		"iss": s.ClientID,
+		"sub": s.ClientID,
+		"aud": audience,
+		"jti": base64.RawURLEncoding.EncodeToString(jti),
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	})
+	tok.Header["kid"] = s.kid
+	signed, err := tok.SignedString(s.key)
+	if err != nil {
+		return "", err
+	}
+	s.cached[audience] = cachedAssertion{token: signed, expires: expires}
+	return signed, nil
+}
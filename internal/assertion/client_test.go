@@ -0,0 +1,61 @@
+package assertion
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestClientSignerAssertion(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "client.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewClientSigner("sidecar", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := s.Assertion("https://idp/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil },
+		jwt.WithIssuer("sidecar"), jwt.WithSubject("sidecar"), jwt.WithAudience("https://idp/token"), jwt.WithExpirationRequired())
+	if err != nil {
+		t.Fatalf("assertion does not verify: %v", err)
+	}
+	if claims["jti"] == "" {
+		t.Fatalf("expected a jti claim, got %v", claims)
+	}
+
+	// cached per audience
+	if again, _ := s.Assertion("https://idp/token"); again != signed {
+		t.Fatalf("expected the cached assertion to be reused")
+	}
+	if other, _ := s.Assertion("https://pdp/check"); other == signed {
+		t.Fatalf("expected a separate assertion per audience")
+	}
+}
+
+func TestNewClientSignerRequiresKey(t *testing.T) {
+	if _, err := NewClientSigner("sidecar", ""); err == nil {
+		t.Fatalf("expected an error without a key file")
+	}
+}
@@ -0,0 +1,258 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"reverseProxy/internal/metrics"
+)
+
+// Config selects where authorization decisions are recorded; it lives under audit: in authorization.yaml
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Sink is "stdout" (default), "file" or "webhook"
+	Sink string `yaml:"sink"`
+	// Path is the file appended to by the file sink
+	Path string `yaml:"path"`
+	// URL receives a JSON array of events per batch from the webhook sink
+	URL string `yaml:"url"`
+	// Headers are added to every webhook request, e.g. an Authorization header
+	Headers map[string]string `yaml:"headers"`
+	// BufferSize bounds the queue between the request path and the sink; events are dropped when full
+	BufferSize int `yaml:"buffer-size"`
+	// BatchSize caps how many queued events are written at once
+	BatchSize int `yaml:"batch-size"`
+	// Timeout bounds a single webhook delivery
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+const (
+	defaultBufferSize = 1024
+	defaultBatchSize  = 100
+	defaultTimeout    = 5 * time.Second
+)
+
+// Event is one authorization decision
+type Event struct {
+	Time      time.Time `json:"time"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	Check     string    `json:"check"`
+	UserID    string    `json:"user_id,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Rule      string    `json:"rule,omitempty"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+}
+
+// sink persists a batch of events
+type sink interface {
+	write(batch []Event) error
+	io.Closer
+}
+
+type auditor struct {
+	// mu guards sends against close; Record holds it shared, close exclusively
+	mu        sync.RWMutex
+	closed    bool
+	events    chan Event
+	sink      sink
+	batchSize int
+	done      chan struct{}
+}
+
+var current atomic.Pointer[auditor]
+
+// closeMu serialises Configure so two reloads cannot close the same auditor
+var closeMu sync.Mutex
+
+// Configure replaces the active audit sink. A nil or disabled config turns auditing off.
+// Events queued for the previous sink are flushed before it is closed.
+func Configure(conf *Config) error {
+	var next *auditor
+	if conf != nil && conf.Enabled {
+		s, err := newSink(*conf)
+		if err != nil {
+			return err
+		}
+		next = start(s, *conf)
+	}
+
+	closeMu.Lock()
+	defer closeMu.Unlock()
+	if prev := current.Swap(next); prev != nil {
+		prev.close()
+	}
+	return nil
+}
+
+// Record queues an event without blocking; it is a no-op when auditing is off
+func Record(e Event) {
+	a := current.Load()
+	if a == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		// replaced by a concurrent Configure
+		return
+	}
+	select {
+	case a.events <- e:
+	default:
+		metrics.AuditEvents.WithLabelValues("dropped").Inc()
+	}
+}
+
+func newSink(conf Config) (sink, error) {
+	switch conf.Sink {
+	case "", "stdout":
+		return &writerSink{w: bufio.NewWriter(os.Stdout)}, nil
+	case "file":
+		if conf.Path == "" {
+			return nil, fmt.Errorf("audit: file sink requires path")
+		}
+		f, err := os.OpenFile(conf.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("audit: %w", err)
+		}
+		return &writerSink{w: bufio.NewWriter(f), c: f}, nil
+	case "webhook":
+		if conf.URL == "" {
+			return nil, fmt.Errorf("audit: webhook sink requires url")
+		}
+		timeout := conf.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		return &webhookSink{url: conf.URL, headers: conf.Headers, client: &http.Client{Timeout: timeout}}, nil
+	}
+	return nil, fmt.Errorf("audit: unsupported sink %q", conf.Sink)
+}
+
+func start(s sink, conf Config) *auditor {
+	size := conf.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	batch := conf.BatchSize
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	a := &auditor{events: make(chan Event, size), sink: s, batchSize: batch, done: make(chan struct{})}
+	go a.run()
+	return a
+}
+
+// run drains the queue, writing whatever has accumulated up to batchSize in one go
+func (a *auditor) run() {
+	defer close(a.done)
+	batch := make([]Event, 0, a.batchSize)
+	for e := range a.events {
+		batch = append(batch[:0], e)
+	fill:
+		for len(batch) < a.batchSize {
+			select {
+			case next, ok := <-a.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		if err := a.sink.write(batch); err != nil {
+			metrics.AuditEvents.WithLabelValues("failed").Add(float64(len(batch)))
+			slog.Warn("audit sink write failed", slog.Int("events", len(batch)), slog.Any("error", err))
+			continue
+		}
+		metrics.AuditEvents.WithLabelValues("written").Add(float64(len(batch)))
+	}
+}
+
+func (a *auditor) close() {
+	a.mu.Lock()
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+	<-a.done
+	if err := a.sink.Close(); err != nil {
+		slog.Warn("closing audit sink", slog.Any("error", err))
+	}
+}
+
+// writerSink writes one JSON object per line
+type writerSink struct {
+	w *bufio.Writer
+	c io.Closer
+}
+
+func (s *writerSink) write(batch []Event) error {
+	enc := json.NewEncoder(s.w)
+	for _, e := range batch {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+func (s *writerSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.c != nil {
+		return s.c.Close()
+	}
+	return nil
+}
+
+// webhookSink POSTs each batch as a JSON array
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (s *webhookSink) write(batch []Event) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error { return nil }
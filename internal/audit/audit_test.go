@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := Configure(&Config{Enabled: true, Sink: "file", Path: path}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	Record(Event{Check: "coarse", UserID: "u1", Method: "GET", Path: "/x", Rule: "[/x]", Decision: "allow"})
+	Record(Event{Check: "fine-grain", UserID: "u1", Method: "GET", Path: "/x", Decision: "skip"})
+	// turning auditing off flushes and closes the file
+	if err := Configure(nil); err != nil {
+		t.Fatalf("Configure(nil): %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	var events []Event
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].Rule != "[/x]" || events[0].Decision != "allow" || events[0].Time.IsZero() {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+	if events[1].Check != "fine-grain" || events[1].Decision != "skip" {
+		t.Errorf("unexpected second event %+v", events[1])
+	}
+}
+
+func TestWebhookSinkPostsBatches(t *testing.T) {
+	received := make(chan []Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer t" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var batch []Event
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		received <- batch
+	}))
+	defer srv.Close()
+
+	if err := Configure(&Config{Enabled: true, Sink: "webhook", URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer t"}}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+	Record(Event{Check: "coarse", Decision: "deny", Reason: "nope"})
+
+	select {
+	case batch := <-received:
+		if len(batch) != 1 || batch[0].Decision != "deny" || batch[0].Reason != "nope" {
+			t.Errorf("unexpected batch %+v", batch)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestRecordDropsWhenBufferFull(t *testing.T) {
+	block := make(chan struct{})
+	s := &blockingSink{release: block}
+	a := start(s, Config{BufferSize: 1, BatchSize: 1})
+	current.Store(a)
+	t.Cleanup(func() {
+		close(block)
+		_ = Configure(nil)
+	})
+
+	// the first event is taken by the worker and blocks in write; the second fills the buffer
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			Record(Event{Check: "coarse"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Record blocked on a full buffer")
+	}
+}
+
+type blockingSink struct{ release chan struct{} }
+
+func (s *blockingSink) write([]Event) error {
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestConfigureRejectsInvalidSink(t *testing.T) {
+	for _, conf := range []Config{
+		{Enabled: true, Sink: "kafka"},
+		{Enabled: true, Sink: "file"},
+		{Enabled: true, Sink: "webhook"},
+	} {
+		if err := Configure(&conf); err == nil {
+			t.Errorf("expected error for %+v", conf)
+		}
+	}
+}
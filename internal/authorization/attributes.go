@@ -0,0 +1,60 @@
+package authorization
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// ClaimMapping forwards selected principal claims to a validation service, so policies can use
+// identity attributes (tenant, groups, ...) without re-parsing the token
+type ClaimMapping struct {
+	// Attributes maps payload attribute names to claim paths (dotted for nested claims); sent as "attributes"
+	Attributes map[string]string `yaml:"attributes"`
+	// Headers maps request header names to claim paths; list claims are joined with commas
+	Headers map[string]string `yaml:"headers"`
+}
+
+// resolve looks the mapped claims up; absent claims are left out
+func (m *ClaimMapping) resolve(claims map[string]any) (attributes map[string]any, headers http.Header) {
+	if m == nil || len(claims) == 0 {
+		return nil, nil
+	}
+	for name, path := range m.Attributes {
+		if v := jwtauth.ClaimAt(claims, path); v != nil {
+			if attributes == nil {
+				attributes = make(map[string]any, len(m.Attributes))
+			}
+			attributes[name] = v
+		}
+	}
+	for name, path := range m.Headers {
+		if v := headerClaim(jwtauth.ClaimAt(claims, path)); v != "" {
+			if headers == nil {
+				headers = make(http.Header, len(m.Headers))
+			}
+			headers.Set(name, v)
+		}
+	}
+	return attributes, headers
+}
+
+// headerClaim renders a claim as a header value
+func headerClaim(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
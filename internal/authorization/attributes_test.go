@@ -0,0 +1,60 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClaimMapping_Resolve(t *testing.T) {
+	m := &ClaimMapping{
+		Attributes: map[string]string{"sub": "sub", "tenant": "org.tenant", "groups": "groups", "missing": "nope"},
+		Headers:    map[string]string{"X-Tenant": "org.tenant", "X-Groups": "groups", "X-Missing": "nope"},
+	}
+	claims := map[string]any{
+		"sub":    "u1",
+		"groups": []any{"ops", "admins"},
+		"org":    map[string]any{"tenant": "acme"},
+	}
+	attrs, headers := m.resolve(claims)
+	want := map[string]any{"sub": "u1", "tenant": "acme", "groups": []any{"ops", "admins"}}
+	if !reflect.DeepEqual(attrs, want) {
+		t.Fatalf("unexpected attributes %v", attrs)
+	}
+	if headers.Get("X-Tenant") != "acme" || headers.Get("X-Groups") != "ops,admins" || len(headers) != 2 {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+	var none *ClaimMapping
+	if attrs, headers := none.resolve(claims); attrs != nil || headers != nil {
+		t.Fatal("expected nothing from a nil mapping")
+	}
+}
+
+func TestCheckCoarse_ForwardsPrincipalClaims(t *testing.T) {
+	var seen coarsePayload
+	var tenantHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantHeader = r.Header.Get("X-Tenant")
+		_ = json.NewDecoder(r.Body).Decode(&seen)
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{
+		Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{"[/**]": {Resource: "/api"}},
+		PrincipalClaims: &ClaimMapping{Attributes: map[string]string{"tenant": "tenant"}, Headers: map[string]string{"X-Tenant": "tenant"}},
+	}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	req := RequestInfo{Method: "GET", Path: "/x", Claims: map[string]any{"tenant": "acme", "secret": "s"}}
+	if allow, _, err := CheckCoarseAccess(context.Background(), req, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Fatalf("expected allow, got %v %v", allow, err)
+	}
+	if !reflect.DeepEqual(seen.Attributes, map[string]any{"tenant": "acme"}) || tenantHeader != "acme" {
+		t.Fatalf("expected only the mapped claim, got attributes=%v header=%q", seen.Attributes, tenantHeader)
+	}
+}
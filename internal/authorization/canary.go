@@ -0,0 +1,174 @@
+package authorization
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+
+	"reverseProxy/internal/circuitbreaker"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+)
+
+// Variants a canary splits traffic into, as recorded in metrics
+const (
+	VariantStable = "stable"
+	VariantCanary = "canary"
+)
+
+// CoarseCanary sends a share of principals to a new validation URL and/or resource-map entries,
+// which are merged over the section's own
+type CoarseCanary struct {
+	// Percent of principals (0-100) in the canary, chosen by a hash of the user ID
+	Percent       int                       `yaml:"percent"`
+	ValidationURL string                    `yaml:"validation-url"`
+	ResourceMap   map[string]CoarseResource `yaml:"resource-map"`
+}
+
+// FineGrainCanary sends a share of principals to a new validation URL and/or rules, which are
+// merged over the section's own
+type FineGrainCanary struct {
+	// Percent of principals (0-100) in the canary, chosen by a hash of the user ID
+	Percent       int                 `yaml:"percent"`
+	ValidationURL string              `yaml:"validation-url"`
+	ResourceMap   map[string]FineRule `yaml:"resource-map"`
+}
+
+func validateCanary(check string, percent int, url string, entries int) error {
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("%s: canary: percent must be between 0 and 100", check)
+	}
+	if url == "" && entries == 0 {
+		return fmt.Errorf("%s: canary: validation-url or resource-map is required", check)
+	}
+	return nil
+}
+
+// inCanary reports whether the principal falls in the canary share; a principal always lands in
+// the same bucket, so it sees one variant consistently
+func inCanary(p jwtauth.Principal, percent int) bool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(p.UserID))
+	return int(h.Sum32()%100) < percent
+}
+
+// prepareCanary builds the canary variant of the section, or nil when none is configured
+func (c *CoarseConfig) prepareCanary(prev *CoarseConfig) error {
+	c.canary = nil
+	if c.Canary == nil {
+		return nil
+	}
+	if err := validateCanary(checkCoarse, c.Canary.Percent, c.Canary.ValidationURL, len(c.Canary.ResourceMap)); err != nil {
+		return err
+	}
+	if err := validateRegexKeys(checkCoarse+" canary", c.Canary.ResourceMap); err != nil {
+		return err
+	}
+	v := *c
+	v.Canary = nil
+	v.ResourceMap = maps.Clone(c.ResourceMap)
+	if v.ResourceMap == nil {
+		v.ResourceMap = map[string]CoarseResource{}
+	}
+	maps.Copy(v.ResourceMap, c.Canary.ResourceMap)
+	if c.Canary.ValidationURL != "" && c.Canary.ValidationURL != c.ValidationURL {
+		v.ValidationURL = c.Canary.ValidationURL
+		var err error
+		if v.breaker, err = newBreaker(checkCoarse+"-canary", c.CircuitBreaker, prev.canaryBreaker(), prev.breakerConf()); err != nil {
+			return err
+		}
+	}
+	c.canary = &v
+	return nil
+}
+
+func (c *FineGrainConfig) prepareCanary(prev *FineGrainConfig) error {
+	c.canary = nil
+	if c.Canary == nil {
+		return nil
+	}
+	if err := validateCanary(checkFineGrain, c.Canary.Percent, c.Canary.ValidationURL, len(c.Canary.ResourceMap)); err != nil {
+		return err
+	}
+	if err := validateRegexKeys(checkFineGrain+" canary", c.Canary.ResourceMap); err != nil {
+		return err
+	}
+	v := *c
+	v.Canary = nil
+	v.ResourceMap = maps.Clone(c.ResourceMap)
+	if v.ResourceMap == nil {
+		v.ResourceMap = map[string]FineRule{}
+	}
+	maps.Copy(v.ResourceMap, c.Canary.ResourceMap)
+	if err := v.compileExpressions(); err != nil {
+		return err
+	}
+	if err := v.compileBodyPaths(); err != nil {
+		return err
+	}
+	if c.Canary.ValidationURL != "" && c.Canary.ValidationURL != c.ValidationURL {
+		v.ValidationURL = c.Canary.ValidationURL
+		var err error
+		if v.breaker, err = newBreaker(checkFineGrain+"-canary", c.CircuitBreaker, prev.canaryBreaker(), prev.breakerConf()); err != nil {
+			return err
+		}
+	}
+	c.canary = &v
+	return nil
+}
+
+// variant returns the section to apply for the principal and its metrics label ("" without a canary)
+func (c CoarseConfig) variant(p jwtauth.Principal) (CoarseConfig, string) {
+	if c.canary == nil {
+		return c, ""
+	}
+	if inCanary(p, c.Canary.Percent) {
+		return *c.canary, VariantCanary
+	}
+	return c, VariantStable
+}
+
+func (f FineGrainConfig) variant(p jwtauth.Principal) (FineGrainConfig, string) {
+	if f.canary == nil {
+		return f, ""
+	}
+	if inCanary(p, f.Canary.Percent) {
+		return *f.canary, VariantCanary
+	}
+	return f, VariantStable
+}
+
+func (c *CoarseConfig) canaryBreaker() *circuitbreaker.Breaker {
+	if c == nil || c.canary == nil {
+		return nil
+	}
+	return c.canary.breaker
+}
+
+func (c *CoarseConfig) breakerConf() *circuitbreaker.Config {
+	if c == nil {
+		return nil
+	}
+	return c.CircuitBreaker
+}
+
+func (f *FineGrainConfig) canaryBreaker() *circuitbreaker.Breaker {
+	if f == nil || f.canary == nil {
+		return nil
+	}
+	return f.canary.breaker
+}
+
+func (f *FineGrainConfig) breakerConf() *circuitbreaker.Config {
+	if f == nil {
+		return nil
+	}
+	return f.CircuitBreaker
+}
+
+// observeVariant records a check decision per canary variant
+func observeVariant(check, variant, decision string) {
+	if variant != "" {
+		metrics.AuthzVariantDecisions.WithLabelValues(check, variant, decision).Inc()
+	}
+}
@@ -0,0 +1,72 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestFineGrainCanary(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	pdp := func(allow bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, `{"allow":%v}`, allow)
+		}))
+	}
+	stable, canary := pdp(true), pdp(false)
+	defer stable.Close()
+	defer canary.Close()
+
+	y := "finegrain-check:\n  enabled: true\n  validation-url: " + stable.URL + "\n  resource-map:\n    \"[/orders/**]\": {}\n" +
+		"  canary:\n    percent: 30\n    validation-url: " + canary.URL + "\n    resource-map:\n" +
+		"      \"[/reports/**]\":\n        expression: \"false\"\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var inCanaryUsers, stableUsers int
+	for i := 0; i < 200; i++ {
+		p := jwtauth.Principal{UserID: fmt.Sprintf("user-%d", i)}
+		allow, _, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/orders/1"}, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same principal always gets the same variant
+		again, _, _ := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/orders/1"}, p)
+		if again != allow {
+			t.Fatalf("principal %s switched variants", p.UserID)
+		}
+		// canary rules apply only to canary principals
+		reports, _, _ := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/reports/q1"}, p)
+		if allow == !reports {
+			t.Fatalf("principal %s saw rules from both variants", p.UserID)
+		}
+		if allow {
+			stableUsers++
+		} else {
+			inCanaryUsers++
+		}
+	}
+	if inCanaryUsers < 30 || inCanaryUsers > 90 {
+		t.Fatalf("expected about 30%% of principals in the canary, got %d of 200", inCanaryUsers)
+	}
+	if stableUsers == 0 {
+		t.Fatalf("expected principals outside the canary")
+	}
+}
+
+func TestLoad_RejectsBadCanary(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	for _, y := range []string{
+		"coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  canary:\n    percent: 120\n    validation-url: http://new\n",
+		"coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  canary:\n    percent: 10\n",
+	} {
+		if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err == nil {
+			t.Errorf("expected an error for %q", y)
+		}
+	}
+}
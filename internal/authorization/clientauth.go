@@ -0,0 +1,188 @@
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/oauthclient"
+	"reverseProxy/internal/tokenstorage"
+	"reverseProxy/internal/tracing"
+)
+
+// Values for client-auth-method
+const (
+	ClientAuthBasic         = "client_secret_basic"
+	ClientAuthBearer        = "bearer"
+	ClientAuthPrivateKeyJWT = assertion.ClientAuthPrivateKeyJWT
+)
+
+// clientAuth identifies the sidecar to a validation service
+type clientAuth struct {
+	method       string
+	clientID     string
+	clientSecret string
+	// tokenIDP names the egress-config IDP whose client-credentials token is sent as a bearer token
+	tokenIDP string
+	// keyFile is the private_key_jwt key; Load loads it into signer
+	keyFile string
+	signer  *assertion.ClientSigner
+	// client carries the section's tls settings, including any client certificate
+	client *http.Client
+}
+
+func (c CoarseConfig) clientAuth() clientAuth {
+	return clientAuth{method: c.ClientAuthMethod, clientID: c.ClientID, clientSecret: c.ClientSecret, tokenIDP: c.TokenIDP, keyFile: c.PrivateKeyFile, signer: c.signer, client: c.client}
+}
+
+func (f FineGrainConfig) clientAuth() clientAuth {
+	return clientAuth{method: f.ClientAuthMethod, clientID: f.ClientID, clientSecret: f.ClientSecret, tokenIDP: f.TokenIDP, keyFile: f.PrivateKeyFile, signer: f.signer, client: f.client}
+}
+
+// prepareClientAuth checks a section's client authentication settings, loading the private_key_jwt signing key
+func prepareClientAuth(check string, a clientAuth) (*assertion.ClientSigner, error) {
+	switch a.method {
+	case ClientAuthBearer:
+		if a.tokenIDP == "" {
+			return nil, fmt.Errorf("%s: client-auth-method bearer requires token-idp", check)
+		}
+	case ClientAuthPrivateKeyJWT:
+		signer, err := assertion.NewClientSigner(a.clientID, a.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", check, err)
+		}
+		return signer, nil
+	}
+	return nil, nil
+}
+
+// apply authenticates req; refresh forces a new bearer token instead of the stored one
+func (a clientAuth) apply(req *http.Request, refresh bool) error {
+	switch a.method {
+	case "":
+		return nil
+	case ClientAuthBasic:
+		if a.clientID != "" {
+			req.SetBasicAuth(a.clientID, a.clientSecret)
+		}
+		return nil
+	case ClientAuthBearer:
+		token, err := bearerToken(a.tokenIDP, refresh)
+		if err != nil {
+			return fmt.Errorf("validation service token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	case ClientAuthPrivateKeyJWT:
+		if a.signer == nil {
+			return errors.New("private_key_jwt signing key not loaded")
+		}
+		// the assertion, audienced to the validation URL, is presented as a bearer token
+		token, err := a.signer.Assertion(req.URL.String())
+		if err != nil {
+			return fmt.Errorf("client assertion: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	return fmt.Errorf("unsupported client auth method: %s", a.method)
+}
+
+// bearerFetches collapses concurrent token fetches for the same IDP
+var bearerFetches singleflight.Group
+
+// bearerToken returns the stored client-credentials token for idp, fetching one through the egress
+// OAuth client when none is stored, it has expired, or refresh is set
+func bearerToken(idp string, refresh bool) (string, error) {
+	storage := tokenstorage.GetInstance()
+	if !refresh {
+		expiresAt, inMemory := storage.ExpiresAt(idp)
+		if inMemory && time.Now().Before(expiresAt) {
+			return storage.GetToken(idp)
+		}
+	}
+	token, err, _ := bearerFetches.Do(idp, func() (any, error) {
+		if err := fetchBearerToken(idp); err != nil {
+			return "", err
+		}
+		return storage.GetToken(idp)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.(string), nil
+}
+
+// fetchBearerToken fetches and stores a new token for idp; a variable so tests can stub it
+var fetchBearerToken = func(idp string) error {
+	if _, err := egressconfig.GetOAuthConfig(idp); err != nil {
+		return err
+	}
+	client, err := oauthclient.NewOAuthClient(idp)
+	if err != nil {
+		return err
+	}
+	return client.RefreshToken()
+}
+
+// postValidation posts payload to a validation service and decodes its decision. A 401 to a bearer
+// token is retried once with a freshly fetched token, since the stored one may have been revoked.
+func postValidation(ctx context.Context, url string, auth clientAuth, payload any, headers http.Header) (validationResponse, error) {
+	var vr validationResponse
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return vr, err
+	}
+	resp, err := sendValidation(ctx, url, auth, body, headers, false)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized && auth.method == ClientAuthBearer {
+		resp.Body.Close()
+		resp, err = sendValidation(ctx, url, auth, body, headers, true)
+	}
+	if err != nil {
+		return vr, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return vr, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&vr)
+	return vr, err
+}
+
+func sendValidation(ctx context.Context, url string, auth clientAuth, body []byte, headers http.Header, refresh bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.InjectHTTP(ctx, req.Header)
+	if err := auth.apply(req, refresh); err != nil {
+		return nil, err
+	}
+	client := auth.client
+	if client == nil {
+		client = httpClient
+	}
+	return client.Do(req)
+}
+
+// failureReason is the decision reason reported for a failed validation call
+func failureReason(err error) string {
+	var se *statusError
+	if errors.As(err, &se) {
+		return "non-2xx from validation service"
+	}
+	return ""
+}
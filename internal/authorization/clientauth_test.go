@@ -0,0 +1,139 @@
+package authorization
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/tokenstorage"
+)
+
+func TestPostCoarseCheck_BearerRefreshesOn401(t *testing.T) {
+	var issued atomic.Int32
+	idpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "client_credentials" {
+			t.Errorf("unexpected grant_type %q", r.FormValue("grant_type"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"tok-%d","expires_in":300}`, issued.Add(1))
+	}))
+	defer idpSrv.Close()
+
+	configPath := filepath.Join(t.TempDir(), "egress-config.yaml")
+	content := "multi-oauth-client-config:\n  pdp-idp:\n    tokenUrl: " + idpSrv.URL + "\n    clientId: sidecar\n    clientSecret: s3cret\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := egressconfig.Load(configPath); err != nil {
+		t.Fatalf("egress config: %v", err)
+	}
+	t.Cleanup(func() { _ = tokenstorage.GetInstance().ClearToken("pdp-idp") })
+
+	var seen []string
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		seen = append(seen, auth)
+		if auth != "Bearer tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"allow":true}`))
+	}))
+	defer pdp.Close()
+
+	conf := CoarseConfig{ValidationURL: pdp.URL, ClientAuthMethod: ClientAuthBearer, TokenIDP: "pdp-idp"}
+	allow, _, err := postCoarseCheck(context.Background(), conf, coarsePayload{}, nil)
+	if err != nil || !allow {
+		t.Fatalf("expected allow after refreshing the token, got allow=%v err=%v", allow, err)
+	}
+	if len(seen) != 2 || seen[0] != "Bearer tok-1" {
+		t.Fatalf("expected tok-1 then tok-2, got %v", seen)
+	}
+
+	// the refreshed token is reused without another fetch
+	if _, _, err := postCoarseCheck(context.Background(), conf, coarsePayload{}, nil); err != nil {
+		t.Fatalf("second check: %v", err)
+	}
+	if n := issued.Load(); n != 2 {
+		t.Fatalf("expected 2 token fetches, got %d", n)
+	}
+}
+
+func TestPostFineGrainCheck_BearerTokenError(t *testing.T) {
+	old := fetchBearerToken
+	fetchBearerToken = func(string) error { return fmt.Errorf("idp down") }
+	t.Cleanup(func() { fetchBearerToken = old })
+
+	conf := FineGrainConfig{ValidationURL: "http://127.0.0.1:0", ClientAuthMethod: ClientAuthBearer, TokenIDP: "missing-idp"}
+	if allow, _, err := postFineGrainCheck(context.Background(), conf, finePayload{}, nil); err == nil || allow {
+		t.Fatalf("expected an error when no token can be fetched, got allow=%v err=%v", allow, err)
+	}
+}
+
+func TestLoad_BearerRequiresTokenIDP(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	p := writeTempFile(t, t.TempDir(), "auth-*.yaml", "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  client-auth-method: bearer\n")
+	if err := Load(p); err == nil {
+		t.Fatalf("expected an error for bearer without token-idp")
+	}
+}
+
+func TestLoad_PrivateKeyJWT(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "pdp-client.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var pdpURL string
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		_, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil },
+			jwt.WithIssuer("plt-client"), jwt.WithAudience(pdpURL))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"allow":true}`))
+	}))
+	defer pdp.Close()
+	pdpURL = pdp.URL + "/coarse"
+
+	y := "coarse-check:\n  enabled: true\n  validation-url: " + pdpURL + "\n  client-id: plt-client\n" +
+		"  client-auth-method: private_key_jwt\n  private-key-file: " + keyPath + "\n"
+	if err := Load(writeTempFile(t, dir, "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	allow, _, err := postCoarseCheck(context.Background(), ConfigOrNil().Coarse, coarsePayload{}, nil)
+	if err != nil || !allow {
+		t.Fatalf("expected the signed assertion to be accepted, got allow=%v err=%v", allow, err)
+	}
+
+	missing := "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  client-id: plt-client\n  client-auth-method: private_key_jwt\n"
+	if err := Load(writeTempFile(t, dir, "auth-*.yaml", missing)); err == nil {
+		t.Fatalf("expected an error for private_key_jwt without private-key-file")
+	}
+}
@@ -1,21 +1,39 @@
 package authorization
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"reverseProxy/internal/audit"
+	"reverseProxy/internal/circuitbreaker"
 	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/tracing"
 )
 
-// RequestInfo captures minimal request context sent to validation services
+// RequestInfo captures the request context sent to validation services
 type RequestInfo struct {
-	Method  string            `json:"method"`
-	Path    string            `json:"path"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Host is the request's Host (or :authority), selecting host-bound resource-map keys
+	Host string `json:"host,omitempty"`
+	// FullURL is the URL as the client requested it, including scheme, host and query
+	FullURL string            `json:"full_url,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
+	// Body is the JSON request body, or a form body as a JSON object of its fields, forwarded when within max-body-bytes
+	Body json.RawMessage `json:"body,omitempty"`
+	// XMLBody is an XML request body within max-body-bytes, read by fine-grain XPath selectors but not forwarded
+	XMLBody []byte `json:"-"`
+	// Claims are the principal's token claims, available to local expressions but not sent to validation services
+	Claims map[string]any `json:"-"`
+	// Tenant is the tenant the ingress selected for the request; it selects the tenant's resource maps
+	Tenant string `json:"tenant,omitempty"`
 }
 
 // coarsePayload is sent to the coarse validation-url
@@ -24,11 +42,18 @@ type coarsePayload struct {
 	Request         RequestInfo       `json:"request"`
 	Resource        string            `json:"resource"`
 	AnonymousAccess bool              `json:"anonymous_access"`
+	// Attributes holds the claims selected by principal-claims
+	Attributes map[string]any `json:"attributes,omitempty"`
 }
 
 type validationResponse struct {
 	Allow  bool   `json:"allow"`
 	Reason string `json:"reason,omitempty"`
+	// Obligations must be fulfilled by the sidecar for an allow to stand; Advice is best effort
+	Obligations []Obligation `json:"obligations,omitempty"`
+	Advice      []Obligation `json:"advice,omitempty"`
+	// ResponseFilter, honoured on fine-grain responses, redacts the upstream JSON response
+	ResponseFilter *ResponseFilter `json:"response_filter,omitempty"`
 }
 
 var httpClient = &http.Client{
@@ -37,66 +62,136 @@ var httpClient = &http.Client{
 
 // CheckCoarseAccess performs coarse authorization using config.coarse-check from authorization.yaml.
 // Returns (allow, reason, error). If section disabled or URL is not set, it returns allow=true.
-func CheckCoarseAccess(req RequestInfo, p jwtauth.Principal) (bool, string, error) {
+// The call to the validation service is abandoned when ctx is cancelled.
+func CheckCoarseAccess(ctx context.Context, req RequestInfo, p jwtauth.Principal) (allow bool, reason string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "authz."+checkCoarse)
+	checkStart := time.Now()
+	var rule, variant string
+	skipped := false
+	defer func() {
+		span.SetAttributes(attribute.String("authz.decision", metrics.Decision(allow, err)), attribute.String("authz.reason", reason))
+		tracing.End(span, err)
+		recordAudit(ctx, checkCoarse, req, p, rule, auditDecision(skipped, allow, err), reason, checkStart)
+		noteSkipped(ctx, skipped)
+		observeVariant(checkCoarse, variant, auditDecision(skipped, allow, err))
+	}()
+
 	c := ConfigOrNil()
 	if c == nil || !c.Coarse.Enabled || c.Coarse.ValidationURL == "" {
+		metrics.AuthzDecisions.WithLabelValues(checkCoarse, "skip").Inc()
+		skipped = true
 		return true, "coarse check skipped (no config)", nil
 	}
-	resource, ok := c.Coarse.MatchResource(req.Path)
+	// a tenant's requests see its rules; principals in a canary see its validation URL and rules
+	conf, variant := c.Coarse.forTenant(req.Tenant).variant(p)
+	rule, resource, ok := conf.matchResource(req.Host, req.Method, req.Path)
 	if !ok {
-		if c.Coarse.AnonymousAccess {
+		metrics.AuthzDecisions.WithLabelValues(checkCoarse, metrics.Decision(conf.AnonymousAccess, nil)).Inc()
+		if conf.AnonymousAccess {
 			return true, "coarse check allowed (no matching resource; anonymous-access=true)", nil
 		}
 		return false, "coarse check denied (no matching resource)", nil
 	}
+	noteDenyResponse(ctx, conf.ResourceMap[rule].DenyResponse)
+	attributes, headers := conf.PrincipalClaims.resolve(req.Claims)
 	payload := coarsePayload{
 		Principal:       p,
 		Request:         req,
 		Resource:        resource,
-		AnonymousAccess: c.Coarse.AnonymousAccess,
+		AnonymousAccess: conf.AnonymousAccess,
+		Attributes:      attributes,
 	}
-	return postCoarseCheck(c.Coarse, payload)
+	return callValidation(ctx, checkCoarse, conf.policy(), func(ctx context.Context) (bool, string, error) {
+		return postCoarseCheck(ctx, conf, payload, headers)
+	})
 }
 
-func postCoarseCheck(conf CoarseConfig, payload coarsePayload) (bool, string, error) {
-	contentByteArray, marshalErr := json.Marshal(payload)
+// check labels used in metrics
+const (
+	checkCoarse    = "coarse"
+	checkFineGrain = "fine-grain"
+)
 
-	if marshalErr != nil {
-		return false, "", marshalErr
+// auditDecision maps a check outcome to the decision recorded in the audit trail
+func auditDecision(skipped, allow bool, err error) string {
+	if skipped {
+		return "skip"
 	}
+	return metrics.Decision(allow, err)
+}
 
-	newHttpReq, netWorkErr := http.NewRequest(http.MethodPost, conf.ValidationURL, bytes.NewReader(contentByteArray))
-
-	if netWorkErr != nil {
-		return false, "", marshalErr
+// recordAudit queues an audit event for a finished check; it never blocks the request
+func recordAudit(ctx context.Context, check string, req RequestInfo, p jwtauth.Principal, rule, decision, reason string, start time.Time) {
+	e := audit.Event{
+		Time:      start,
+		Check:     check,
+		UserID:    p.UserID,
+		Method:    req.Method,
+		Path:      req.Path,
+		Rule:      rule,
+		Decision:  decision,
+		Reason:    reason,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		e.TraceID = sc.TraceID().String()
 	}
+	audit.Record(e)
+}
 
-	newHttpReq.Header.Set("Content-Type", "application/json")
-	// client_secret_basic support
+// validationPolicy is how a check calls its validation service
+type validationPolicy struct {
+	breaker  *circuitbreaker.Breaker
+	retry    *RetryConfig
+	failOpen bool
+}
 
-	if conf.ClientAuthMethod == "client_secret_basic" && conf.ClientID != "" {
-		newHttpReq.SetBasicAuth(conf.ClientID, conf.ClientSecret)
-	} else if conf.ClientAuthMethod != "" && conf.ClientAuthMethod != "client_secret_basic" {
-		// unsupported method configured
-		return false, "", fmt.Errorf("unsupported client auth method: %s", conf.ClientAuthMethod)
+// callValidation calls a validation service through the check's circuit breaker, if any, retrying
+// per the retry config. A call that still fails, or is skipped by an open circuit, allows the
+// request only when the check fails open.
+func callValidation(ctx context.Context, check string, p validationPolicy, call func(context.Context) (bool, string, error)) (bool, string, error) {
+	if !p.breaker.Allow() {
+		if p.breaker.Config().FailOpen() || (p.breaker.Config().WhenOpen == "" && p.failOpen) {
+			metrics.AuthzDecisions.WithLabelValues(check, "allow").Inc()
+			return true, check + " check allowed (circuit open; failing open)", nil
+		}
+		metrics.AuthzDecisions.WithLabelValues(check, "error").Inc()
+		return false, check + " check denied (circuit open)", circuitbreaker.ErrOpen
 	}
-	resp, netWorkErr := httpClient.Do(newHttpReq)
-
-	if netWorkErr != nil {
-		return false, "", netWorkErr
+	callCtx := ctx
+	if p.retry != nil && p.retry.Deadline > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, p.retry.Deadline)
+		defer cancel()
 	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return false, "non-2xx from validation service", errors.New(resp.Status)
+	start := time.Now()
+	allow, reason, err := withRetry(callCtx, p.retry, call)
+	observeValidation(check, start, allow, err)
+	if err != nil && ctx.Err() != nil {
+		// abandoned because the request ended or the other check denied; says nothing about the service
+		p.breaker.Abandon()
+		return allow, reason, err
 	}
+	p.breaker.Record(err == nil)
+	if err != nil && p.failOpen {
+		slog.WarnContext(ctx, "validation service failed; failing open", slog.String("check", check), slog.Any("error", err))
+		return true, check + " check allowed (validation service error; failure-mode=open)", nil
+	}
+	return allow, reason, err
+}
 
-	var vr validationResponse
+// observeValidation records the outcome and latency of a validation service call
+func observeValidation(check string, start time.Time, allow bool, err error) {
+	metrics.AuthzLatency.WithLabelValues(check).Observe(metrics.Since(start))
+	metrics.AuthzDecisions.WithLabelValues(check, metrics.Decision(allow, err)).Inc()
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
-		return false, "", err
+func postCoarseCheck(ctx context.Context, conf CoarseConfig, payload coarsePayload, headers http.Header) (bool, string, error) {
+	vr, err := postValidation(ctx, conf.ValidationURL, conf.clientAuth(), payload, headers)
+	if err != nil {
+		return false, failureReason(err), err
 	}
+	collectObligations(ctx, vr)
 
 	return vr.Allow, vr.Reason, nil
 }
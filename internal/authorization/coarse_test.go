@@ -1,20 +1,24 @@
 package authorization
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"reverseProxy/internal/audit"
 	"reverseProxy/internal/jwtauth"
 )
 
 func TestCheckCoarse_SkipWhenNoConfig(t *testing.T) {
-	old := cfg
-	cfg = nil
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckCoarseAccess(RequestInfo{Method: "GET", Path: "/x"}, jwtauth.Principal{UserID: "u1", Username: "alice", Email: "a@example.com"})
+	allow, reason, err := CheckCoarseAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauth.Principal{UserID: "u1", Username: "alice", Email: "a@example.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -48,15 +52,15 @@ func TestCheckCoarse_AllowAndPayload(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]string{
-		"[/x]": "/target",
-	}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{
+		"[/x]": {Resource: "/target"},
+	}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
 	req := RequestInfo{Method: "GET", Path: "/x"}
 	p := jwtauthPrincipalForTest()
-	allow, reason, err := CheckCoarseAccess(req, p)
+	allow, reason, err := CheckCoarseAccess(context.Background(), req, p)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -80,11 +84,11 @@ func TestCheckCoarse_Deny(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]string{"[/]": "/res"}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{"[/]": {Resource: "/res"}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckCoarseAccess(RequestInfo{}, jwtauthPrincipalForTest())
+	allow, reason, err := CheckCoarseAccess(context.Background(), RequestInfo{}, jwtauthPrincipalForTest())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -99,11 +103,11 @@ func TestCheckCoarse_Non2xx(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]string{"[/]": "/res"}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{"[/]": {Resource: "/res"}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckCoarseAccess(RequestInfo{}, jwtauthPrincipalForTest())
+	allow, reason, err := CheckCoarseAccess(context.Background(), RequestInfo{}, jwtauthPrincipalForTest())
 	if err == nil {
 		t.Fatalf("expected error for non-2xx response")
 	}
@@ -122,14 +126,119 @@ func TestCheckCoarse_BadJSON(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]string{"[/]": "/res"}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{"[/]": {Resource: "/res"}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, _, err := CheckCoarseAccess(RequestInfo{}, jwtauthPrincipalForTest())
+	allow, _, err := CheckCoarseAccess(context.Background(), RequestInfo{}, jwtauthPrincipalForTest())
 	if err == nil || allow {
 		t.Fatalf("expected decode error and allow=false")
 	}
 }
 
 // no extra aliasing needed when importing jwtauth in tests
+
+func TestCheckCoarse_RecordsAuditEvent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: false, Reason: "not yours"})
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{
+		"[/x/**]": {Resource: "/target"},
+	}}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := audit.Configure(&audit.Config{Enabled: true, Sink: "file", Path: path}); err != nil {
+		t.Fatalf("audit.Configure: %v", err)
+	}
+	if _, _, err := CheckCoarseAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x/1"}, jwtauthPrincipalForTest()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := audit.Configure(nil); err != nil {
+		t.Fatalf("audit.Configure(nil): %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	var e audit.Event
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatalf("unmarshal %q: %v", b, err)
+	}
+	if e.Check != "coarse" || e.UserID != "u1" || e.Rule != "[/x/**]" || e.Decision != "deny" || e.Reason != "not yours" {
+		t.Errorf("unexpected audit event %+v", e)
+	}
+}
+
+func TestCheckCoarse_CircuitBreaker(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "authorization.yaml")
+	y := "coarse-check:\n" +
+		"  enabled: true\n" +
+		"  validation-url: " + srv.URL + "\n" +
+		"  resource-map:\n" +
+		"    \"[/x]\": \"/target\"\n" +
+		"  circuit-breaker:\n" +
+		"    enabled: true\n" +
+		"    failure-threshold: 2\n" +
+		"    open-duration: 1m\n" +
+		"    when-open: open\n"
+	if err := os.WriteFile(p, []byte(y), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(p); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	breaker := ConfigOrNil().Coarse.breaker
+
+	req := RequestInfo{Method: "GET", Path: "/x"}
+	for i := 0; i < 2; i++ {
+		if _, _, err := CheckCoarseAccess(context.Background(), req, jwtauthPrincipalForTest()); err == nil {
+			t.Fatalf("expected an error from the failing service")
+		}
+	}
+	allow, _, err := CheckCoarseAccess(context.Background(), req, jwtauthPrincipalForTest())
+	if !allow || err != nil || calls != 2 {
+		t.Fatalf("expected the open circuit to fail open without calling the service, got allow=%v err=%v calls=%d", allow, err, calls)
+	}
+
+	if err := Load(p); err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if ConfigOrNil().Coarse.breaker != breaker {
+		t.Errorf("expected an unchanged circuit-breaker to keep its state across reloads")
+	}
+}
+
+func TestCheckCoarse_FailureMode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+
+	for mode, wantAllow := range map[string]bool{"": false, FailureModeClosed: false, FailureModeOpen: true} {
+		cfg.Store(&Config{Coarse: CoarseConfig{
+			Enabled: true, ValidationURL: srv.URL, FailureMode: mode,
+			ResourceMap: map[string]CoarseResource{"[/x]": {Resource: "/target"}},
+		}})
+		allow, _, err := CheckCoarseAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauthPrincipalForTest())
+		if allow != wantAllow || (err == nil) != wantAllow {
+			t.Errorf("failure-mode %q: expected allow=%v, got allow=%v err=%v", mode, wantAllow, allow, err)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+)
+
+// Authorization providers that can be combined
+const (
+	ProviderCoarse    = checkCoarse
+	ProviderFineGrain = checkFineGrain
+	ProviderPolicy    = checkPolicy
+)
+
+// Combining algorithms
+const (
+	// DenyOverrides allows only when no provider denies (the default)
+	DenyOverrides = "deny-overrides"
+	// PermitOverrides allows when any applicable provider allows
+	PermitOverrides = "permit-overrides"
+	// FirstApplicable asks providers in order; the first that applies decides
+	FirstApplicable = "first-applicable"
+)
+
+// defaultProviders are combined when the config does not list any
+var defaultProviders = []string{ProviderCoarse, ProviderFineGrain, ProviderPolicy}
+
+var providers = map[string]func(context.Context, RequestInfo, jwtauth.Principal) (bool, string, error){
+	ProviderCoarse:    CheckCoarseAccess,
+	ProviderFineGrain: CheckFineGrainAccess,
+	ProviderPolicy:    CheckPolicy,
+}
+
+// CombiningConfig selects the authorization providers and how their decisions combine
+type CombiningConfig struct {
+	CombiningRule `yaml:",inline"`
+	// Routes overrides the algorithm and providers for requests matching resource-map style keys
+	Routes map[string]CombiningRule `yaml:"routes"`
+}
+
+// CombiningRule is a combining algorithm and the providers it combines
+type CombiningRule struct {
+	// Algorithm is deny-overrides (default), permit-overrides or first-applicable
+	Algorithm string `yaml:"algorithm"`
+	// Providers lists coarse, fine-grain and policy, in the order first-applicable asks them (default all three)
+	Providers []string `yaml:"providers"`
+	// Priority ranks route keys before specificity; higher wins (default 0)
+	Priority int `yaml:"priority"`
+}
+
+func (r CombiningRule) validate(where string) error {
+	switch r.Algorithm {
+	case "", DenyOverrides, PermitOverrides, FirstApplicable:
+	default:
+		return fmt.Errorf("%s: unknown algorithm %q", where, r.Algorithm)
+	}
+	seen := map[string]bool{}
+	for _, name := range r.Providers {
+		if _, ok := providers[name]; !ok {
+			return fmt.Errorf("%s: unknown provider %q", where, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%s: provider %q listed twice", where, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+func (c *CombiningConfig) validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.CombiningRule.validate("combining"); err != nil {
+		return err
+	}
+	for key, r := range c.Routes {
+		if err := r.validate(fmt.Sprintf("combining: route %q", key)); err != nil {
+			return err
+		}
+	}
+	return validateRegexKeys("combining", c.Routes)
+}
+
+// ruleFor returns the combining rule for a request, falling back to the section's own
+func (c *CombiningConfig) ruleFor(host, method, path string) CombiningRule {
+	if c == nil {
+		return CombiningRule{}
+	}
+	var best rank
+	for k, r := range c.Routes {
+		if matched, spec := keyMatch(k, host, method, path); matched {
+			best = best.max(rank{key: k, priority: r.Priority, specificity: spec, ok: true})
+		}
+	}
+	if best.ok {
+		return c.Routes[best.key]
+	}
+	return c.CombiningRule
+}
+
+// Outcome is an authorization decision and the provider that made it
+type Outcome struct {
+	Provider string
+	Allow    bool
+	Reason   string
+	Err      error
+	// Applicable is false when the provider skipped the request (no config or no matching rule)
+	Applicable bool
+	// DenyResponse replaces the 403 of a denial: the matched rule's, else the global one (nil for neither)
+	DenyResponse *DenyResponse
+}
+
+// denies reports whether the outcome blocks the request
+func (o Outcome) denies() bool {
+	return o.Err != nil || !o.Allow
+}
+
+// Authorize runs the providers configured for the request and combines their decisions.
+// Concurrent algorithms cancel the remaining providers as soon as the outcome is settled.
+func Authorize(ctx context.Context, req RequestInfo, p jwtauth.Principal) Outcome {
+	var rule CombiningRule
+	if c := ConfigOrNil(); c != nil {
+		rule = c.Combining.ruleFor(req.Host, req.Method, req.Path)
+	}
+	names := rule.Providers
+	if len(names) == 0 {
+		names = defaultProviders
+	}
+	switch rule.Algorithm {
+	case FirstApplicable:
+		for _, name := range names {
+			if o := runProvider(ctx, name, req, p); o.Applicable {
+				return o
+			}
+		}
+		return Outcome{Allow: true, Reason: "no applicable authorization provider"}
+	case PermitOverrides:
+		outcomes := concurrently(ctx, names, req, p, func(o Outcome) bool { return o.Applicable && !o.denies() })
+		for _, o := range outcomes {
+			if o.Applicable && !o.denies() {
+				return o
+			}
+		}
+		for _, o := range outcomes {
+			if o.Applicable {
+				return o
+			}
+		}
+		return Outcome{Allow: true, Reason: "no applicable authorization provider"}
+	default:
+		outcomes := concurrently(ctx, names, req, p, Outcome.denies)
+		for _, o := range outcomes {
+			if o.denies() {
+				return o
+			}
+		}
+		return Outcome{Allow: true}
+	}
+}
+
+// concurrently runs the providers in parallel until one returns a decisive outcome, which is
+// returned alone; otherwise every outcome is returned in provider order
+func concurrently(parent context.Context, names []string, req RequestInfo, p jwtauth.Principal, decisive func(Outcome) bool) []Outcome {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	type indexed struct {
+		i int
+		o Outcome
+	}
+	// buffered so a provider finishing after an early return never blocks
+	results := make(chan indexed, len(names))
+	for i, name := range names {
+		go func() { results <- indexed{i, runProvider(ctx, name, req, p)} }()
+	}
+	outcomes := make([]Outcome, len(names))
+	for range names {
+		r := <-results
+		if decisive(r.o) {
+			return []Outcome{r.o}
+		}
+		outcomes[r.i] = r.o
+	}
+	return outcomes
+}
+
+func runProvider(ctx context.Context, name string, req RequestInfo, p jwtauth.Principal) Outcome {
+	c := ConfigOrNil()
+	monitored := c != nil && c.monitored(name)
+	if monitored {
+		// a monitored check must not change the request through obligations either
+		ctx = context.WithValue(ctx, obligationsKey{}, (*obligationSet)(nil))
+	}
+	ctx, skipped := withApplicability(ctx)
+	ctx, deny := withDenyResponse(ctx)
+	allow, reason, err := providers[name](ctx, req, p)
+	o := Outcome{Provider: name, Allow: allow, Reason: reason, Err: err, Applicable: !*skipped}
+	if monitored && o.Applicable {
+		return monitor(ctx, o, req)
+	}
+	if !allow && err == nil {
+		o.DenyResponse = *deny
+		if o.DenyResponse == nil && c != nil {
+			o.DenyResponse = c.DenyResponse
+		}
+	}
+	return o
+}
+
+// monitor records the decision of a check in monitor mode and replaces it with one that neither
+// blocks nor grants: the check counts as not applicable to the request
+func monitor(ctx context.Context, o Outcome, req RequestInfo) Outcome {
+	decision := metrics.Decision(o.Allow, o.Err)
+	metrics.AuthzMonitored.WithLabelValues(o.Provider, decision).Inc()
+	if o.denies() {
+		slog.InfoContext(ctx, "monitor mode: check would have denied",
+			slog.String("check", o.Provider), slog.String("decision", decision), slog.String("reason", o.Reason),
+			slog.String("method", req.Method), slog.String("path", req.Path), slog.Any("error", o.Err))
+	}
+	return Outcome{Provider: o.Provider, Allow: true, Reason: o.Provider + " check monitored (" + decision + ")"}
+}
+
+type applicabilityKey struct{}
+
+// withApplicability returns a context in which a check records whether it skipped the request
+func withApplicability(ctx context.Context) (context.Context, *bool) {
+	skipped := new(bool)
+	return context.WithValue(ctx, applicabilityKey{}, skipped), skipped
+}
+
+// noteSkipped records a check's skip for runProvider; a no-op outside Authorize
+func noteSkipped(ctx context.Context, skipped bool) {
+	if p, ok := ctx.Value(applicabilityKey{}).(*bool); ok {
+		*p = skipped
+	}
+}
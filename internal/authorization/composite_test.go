@@ -0,0 +1,91 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestAuthorize_CombiningAlgorithms(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	coarse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"allow":false,"reason":"coarse says no"}`))
+	}))
+	defer coarse.Close()
+
+	base := "coarse-check:\n  enabled: true\n  validation-url: " + coarse.URL + "\n  resource-map:\n    \"[/**]\": /any\n" +
+		"finegrain-check:\n  enabled: true\n  resource-map:\n    \"[/a]\":\n      expression: \"true\"\n"
+	load := func(combining string) {
+		t.Helper()
+		if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", base+combining)); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+	}
+	decide := func(path string) Outcome {
+		return Authorize(context.Background(), RequestInfo{Method: "GET", Path: path}, jwtauth.Principal{})
+	}
+
+	load("")
+	if o := decide("/a"); o.Allow || o.Provider != ProviderCoarse || o.Reason != "coarse says no" {
+		t.Fatalf("deny-overrides: expected the coarse deny, got %+v", o)
+	}
+
+	load("combining:\n  algorithm: permit-overrides\n")
+	if o := decide("/a"); !o.Allow || o.Provider != ProviderFineGrain {
+		t.Fatalf("permit-overrides: expected the fine-grain allow, got %+v", o)
+	}
+	// fine-grain skips /b, so the coarse deny is the only applicable decision
+	if o := decide("/b"); o.Allow || o.Provider != ProviderCoarse {
+		t.Fatalf("permit-overrides: expected the coarse deny, got %+v", o)
+	}
+
+	load("combining:\n  routes:\n    \"[/**:GET]\":\n      algorithm: first-applicable\n      providers: [fine-grain, coarse]\n")
+	if o := decide("/a"); !o.Allow || o.Provider != ProviderFineGrain {
+		t.Fatalf("first-applicable: expected fine-grain to decide, got %+v", o)
+	}
+	if o := decide("/b"); o.Allow || o.Provider != ProviderCoarse {
+		t.Fatalf("first-applicable: expected coarse to decide after fine-grain skipped, got %+v", o)
+	}
+}
+
+func TestLoad_RejectsBadCombining(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	base := "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n"
+	for _, combining := range []string{
+		"combining:\n  algorithm: majority\n",
+		"combining:\n  providers: [coarse, plainid]\n",
+		"combining:\n  routes:\n    \"[/x]\":\n      providers: [policy, policy]\n",
+	} {
+		if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", base+combining)); err == nil {
+			t.Errorf("expected an error for %q", combining)
+		}
+	}
+}
+
+func TestAuthorize_MonitorMode(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"allow":false,"reason":"new ruleset says no"}`))
+	}))
+	defer pdp.Close()
+
+	y := "finegrain-check:\n  enabled: true\n  mode: monitor\n  validation-url: " + pdp.URL + "\n  resource-map:\n    \"[/**]\": {}\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	req := RequestInfo{Method: "GET", Path: "/orders"}
+	if o := Authorize(context.Background(), req, jwtauth.Principal{}); !o.Allow || o.Err != nil {
+		t.Fatalf("expected the monitored deny not to block, got %+v", o)
+	}
+	if o := runProvider(context.Background(), ProviderFineGrain, req, jwtauth.Principal{}); o.Applicable || o.Reason != "fine-grain check monitored (deny)" {
+		t.Fatalf("expected the monitored check to be reported as not applicable, got %+v", o)
+	}
+
+	bad := "finegrain-check:\n  enabled: true\n  mode: shadow\n  validation-url: http://pdp\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", bad)); err == nil {
+		t.Fatalf("expected an error for an unknown mode")
+	}
+}
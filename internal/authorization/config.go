@@ -2,33 +2,132 @@ package authorization
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/cel-go/cel"
 	yaml "gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/audit"
+	"reverseProxy/internal/circuitbreaker"
+	"reverseProxy/internal/configwatch"
+	"reverseProxy/internal/envsubst"
 )
 
 // Config is the root authorization configuration loaded from authorization.yaml
 type Config struct {
 	Coarse    CoarseConfig    `yaml:"coarse-check"`
 	FineGrain FineGrainConfig `yaml:"finegrain-check"`
+	// Audit records every coarse and fine-grain decision to a sink; reconfigured on each Load
+	Audit *audit.Config `yaml:"audit"`
+	// Policy evaluates local Rego policies alongside the validation services
+	Policy *PolicyConfig `yaml:"policy"`
+	// MaxBodyBytes caps the JSON or form request body forwarded to validation services
+	// (default DefaultMaxBodyBytes; negative never forwards the body)
+	MaxBodyBytes int `yaml:"max-body-bytes"`
+	// Combining chooses which providers decide a request and how their decisions combine
+	// (default: coarse, fine-grain and policy must all allow)
+	Combining *CombiningConfig `yaml:"combining"`
+	// DenyResponse replaces the 403 of denials whose rule sets no deny-response of its own
+	DenyResponse *DenyResponse `yaml:"deny-response"`
+}
+
+// DefaultMaxBodyBytes is used when max-body-bytes is not configured
+const DefaultMaxBodyBytes = 64 << 10
+
+// BodyLimit returns the largest request body forwarded to validation services; negative disables forwarding
+func (c *Config) BodyLimit() int {
+	if c == nil || c.MaxBodyBytes == 0 {
+		return DefaultMaxBodyBytes
+	}
+	return c.MaxBodyBytes
 }
 
 type CoarseConfig struct {
-	Enabled          bool              `yaml:"enabled"`
-	AnonymousAccess  bool              `yaml:"anonymous-access"`
-	ValidationURL    string            `yaml:"validation-url"`
-	ClientID         string            `yaml:"client-id"`
-	ClientSecret     string            `yaml:"client-secret"`
-	ClientAuthMethod string            `yaml:"client-auth-method"`
-	ResourceMap      map[string]string `yaml:"resource-map"`
+	Enabled          bool                      `yaml:"enabled"`
+	AnonymousAccess  bool                      `yaml:"anonymous-access"`
+	ValidationURL    string                    `yaml:"validation-url"`
+	ClientID         string                    `yaml:"client-id"`
+	ClientSecret     string                    `yaml:"client-secret"`
+	ClientAuthMethod string                    `yaml:"client-auth-method"`
+	ResourceMap      map[string]CoarseResource `yaml:"resource-map"`
+	// ClientSecretFile reads the client secret from a file, such as a mounted Kubernetes Secret, instead of client-secret
+	ClientSecretFile string `yaml:"client-secret-file"`
+	// TokenIDP names the egress-config IDP whose client-credentials token is sent with client-auth-method bearer
+	TokenIDP string `yaml:"token-idp"`
+	// PrivateKeyFile is the PEM key signing client assertions with client-auth-method private_key_jwt
+	PrivateKeyFile string `yaml:"private-key-file"`
+	// TLS sets the CA bundle and client certificate for calls to the validation service
+	TLS *ClientTLSConfig `yaml:"tls"`
+	// Timeout bounds each call to the validation service (default 5s); retry.deadline bounds them all
+	Timeout time.Duration `yaml:"timeout"`
+	// CircuitBreaker stops calling the validation service after repeated failures
+	CircuitBreaker *circuitbreaker.Config `yaml:"circuit-breaker"`
+	// Retry repeats failed validation calls with backoff
+	Retry *RetryConfig `yaml:"retry"`
+	// PrincipalClaims forwards selected token claims as payload attributes or request headers
+	PrincipalClaims *ClaimMapping `yaml:"principal-claims"`
+	// FailureMode decides requests when the validation service cannot be reached: closed (default, deny) or open (allow)
+	FailureMode string `yaml:"failure-mode"`
+	// Mode is enforce (default) or monitor, which logs and meters decisions without blocking
+	Mode string `yaml:"mode"`
+	// Canary applies a new validation URL or resource-map entries to a share of principals
+	Canary *CoarseCanary `yaml:"canary"`
+	// Tenants replace the resource-map for the requests of a tenant (see the ingress tenancy)
+	Tenants map[string]CoarseTenant `yaml:"tenants"`
+
+	breaker *circuitbreaker.Breaker
+	signer  *assertion.ClientSigner
+	client  *http.Client
+	// canary is the section with the canary overrides applied
+	canary *CoarseConfig
+	// tenants holds the section of each tenant by ID
+	tenants map[string]*CoarseConfig
+}
+
+// CoarseResource is the resource a coarse resource-map key maps to. In YAML it is either the
+// resource string or a mapping with resource and priority.
+type CoarseResource struct {
+	Resource string `yaml:"resource"`
+	// Priority ranks keys before specificity; higher wins (default 0)
+	Priority int `yaml:"priority"`
+	// DenyResponse replaces the 403 when the check denies a request matching this key
+	DenyResponse *DenyResponse `yaml:"deny-response"`
+}
+
+// UnmarshalYAML accepts the plain resource string form
+func (r *CoarseResource) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&r.Resource)
+	}
+	type plain CoarseResource
+	return node.Decode((*plain)(r))
 }
 
 type FineRule struct {
-	Roles       []string          `yaml:"roles"`
-	RulesetName string            `yaml:"ruleset-name"`
-	RulesetID   string            `yaml:"ruleset-id"`
-	Body        map[string]string `yaml:"body"`
+	// Priority ranks keys before specificity; higher wins (default 0)
+	Priority int `yaml:"priority"`
+	// Roles, when set, requires the principal to hold at least one of them; checked before the rule is evaluated
+	Roles       []string `yaml:"roles"`
+	RulesetName string   `yaml:"ruleset-name"`
+	RulesetID   string   `yaml:"ruleset-id"`
+	// Body maps field names to JSONPaths evaluated against the JSON (or form) request body, or XPaths
+	// against an XML body; the results are sent to the validation service as values. exists(<path>)
+	// sends whether the path matches instead.
+	Body map[string]string `yaml:"body"`
+	// Expression is a CEL boolean evaluated locally; when set it decides the rule without calling
+	// the validation service. It can use principal, claims, method, path, headers, query and body.
+	Expression string `yaml:"expression"`
+	// Meta is sent to the validation service as meta, merged over the section's meta
+	Meta map[string]any `yaml:"meta" json:"-"`
+	// DenyResponse replaces the 403 when the check denies a request matching this rule
+	DenyResponse *DenyResponse `yaml:"deny-response" json:"-"`
 }
 
 type FineGrainConfig struct {
@@ -38,9 +137,124 @@ type FineGrainConfig struct {
 	ClientSecret     string              `yaml:"client-secret"`
 	ClientAuthMethod string              `yaml:"client-auth-method"`
 	ResourceMap      map[string]FineRule `yaml:"resource-map"`
+	// ClientSecretFile reads the client secret from a file, such as a mounted Kubernetes Secret, instead of client-secret
+	ClientSecretFile string `yaml:"client-secret-file"`
+	// DefaultAction decides requests no resource-map key matches: allow (default) or deny
+	DefaultAction string `yaml:"default-action"`
+	// Meta holds deployment-specific fields the validation service expects with every request (e.g.
+	// runtime tuning flags or an entity type ID), sent as meta; rules may override keys
+	Meta map[string]any `yaml:"meta"`
+	// QueryValues is how $query.<name> extracts a repeated parameter: first (default), all (always an
+	// array) or join (the values joined with QuerySeparator, default ",")
+	QueryValues    string `yaml:"query-values"`
+	QuerySeparator string `yaml:"query-separator"`
+	// TokenIDP names the egress-config IDP whose client-credentials token is sent with client-auth-method bearer
+	TokenIDP string `yaml:"token-idp"`
+	// PrivateKeyFile is the PEM key signing client assertions with client-auth-method private_key_jwt
+	PrivateKeyFile string `yaml:"private-key-file"`
+	// TLS sets the CA bundle and client certificate for calls to the validation service
+	TLS *ClientTLSConfig `yaml:"tls"`
+	// Timeout bounds each call to the validation service (default 5s); retry.deadline bounds them all
+	Timeout time.Duration `yaml:"timeout"`
+	// CircuitBreaker stops calling the validation service after repeated failures
+	CircuitBreaker *circuitbreaker.Config `yaml:"circuit-breaker"`
+	// Retry repeats failed validation calls with backoff
+	Retry *RetryConfig `yaml:"retry"`
+	// PrincipalClaims forwards selected token claims as payload attributes or request headers
+	PrincipalClaims *ClaimMapping `yaml:"principal-claims"`
+	// FailureMode decides requests when the validation service cannot be reached: closed (default, deny) or open (allow)
+	FailureMode string `yaml:"failure-mode"`
+	// Mode is enforce (default) or monitor, which logs and meters decisions without blocking
+	Mode string `yaml:"mode"`
+	// Canary applies a new validation URL or rules to a share of principals
+	Canary *FineGrainCanary `yaml:"canary"`
+	// DecisionCache reuses validation service decisions for identical requests
+	DecisionCache *DecisionCacheConfig `yaml:"decision-cache"`
+	// Tenants replace the resource-map for the requests of a tenant (see the ingress tenancy)
+	Tenants map[string]FineGrainTenant `yaml:"tenants"`
+
+	breaker *circuitbreaker.Breaker
+	// decisions caches validation responses; nil without decision-cache
+	decisions *decisionCache
+	signer    *assertion.ClientSigner
+	client    *http.Client
+	// canary is the section with the canary overrides applied
+	canary *FineGrainConfig
+	// tenants holds the section of each tenant by ID
+	tenants map[string]*FineGrainConfig
+	// programs holds the compiled rule expressions by resource-map key
+	programs map[string]cel.Program
+	// paths holds the compiled rule body paths by resource-map key and field
+	paths map[string]map[string]bodyPath
 }
 
-var cfg *Config
+// Values for failure-mode
+const (
+	FailureModeClosed = "closed"
+	FailureModeOpen   = "open"
+)
+
+// Values for mode
+const (
+	ModeEnforce = "enforce"
+	ModeMonitor = "monitor"
+)
+
+// validateMode checks a section's mode value
+func validateMode(check, mode string) error {
+	switch mode {
+	case "", ModeEnforce, ModeMonitor:
+		return nil
+	}
+	return fmt.Errorf("%s: mode must be enforce or monitor, got %q", check, mode)
+}
+
+// monitored reports whether a check runs in monitor mode
+func (c *Config) monitored(check string) bool {
+	switch check {
+	case checkCoarse:
+		return c.Coarse.Mode == ModeMonitor
+	case checkFineGrain:
+		return c.FineGrain.Mode == ModeMonitor
+	case checkPolicy:
+		return c.Policy != nil && c.Policy.Mode == ModeMonitor
+	}
+	return false
+}
+
+// Values for default-action
+const (
+	DefaultActionAllow = "allow"
+	DefaultActionDeny  = "deny"
+)
+
+// Values for query-values
+const (
+	QueryValuesFirst = "first"
+	QueryValuesAll   = "all"
+	QueryValuesJoin  = "join"
+)
+
+func (c CoarseConfig) policy() validationPolicy {
+	return validationPolicy{breaker: c.breaker, retry: c.Retry, failOpen: c.FailureMode == FailureModeOpen}
+}
+
+func (f FineGrainConfig) policy() validationPolicy {
+	return validationPolicy{breaker: f.breaker, retry: f.Retry, failOpen: f.FailureMode == FailureModeOpen}
+}
+
+// validateFailureMode checks a section's failure-mode value
+func validateFailureMode(check, mode string) error {
+	switch mode {
+	case "", FailureModeClosed, FailureModeOpen:
+		return nil
+	}
+	return fmt.Errorf("%s: failure-mode must be open or closed, got %q", check, mode)
+}
+
+// cfg holds the current immutable config snapshot; Load swaps it atomically so
+// readers on the request path never race with a reload
+var cfg atomic.Pointer[Config]
 
 // Load reads YAML config from the given path and stores it globally for use by checks
 func Load(path string) error {
@@ -49,67 +263,348 @@ func Load(path string) error {
 		return err
 	}
 	var c Config
-	if err := yaml.Unmarshal(b, &c); err != nil {
+	if err := envsubst.Unmarshal(b, &c); err != nil {
 		return err
 	}
-	// Validate at least one section enabled with a URL
+	return install(&c)
+}
+
+// LoadNode loads authorization rules from a parsed YAML node, such as the authorization section of
+// the unified config file
+func LoadNode(n *yaml.Node) error {
+	var c Config
+	if err := n.Decode(&c); err != nil {
+		return err
+	}
+	return install(&c)
+}
+
+// install validates and prepares c, carrying over the breakers and canary state of the current
+// config, and makes it the current config
+func install(c *Config) (err error) {
+	if c.Coarse.ClientSecret, err = configwatch.ResolveSecret(c.Coarse.ClientSecret, c.Coarse.ClientSecretFile); err != nil {
+		return fmt.Errorf("%s: %w", checkCoarse, err)
+	}
+	if c.FineGrain.ClientSecret, err = configwatch.ResolveSecret(c.FineGrain.ClientSecret, c.FineGrain.ClientSecretFile); err != nil {
+		return fmt.Errorf("%s: %w", checkFineGrain, err)
+	}
+	// Validate at least one section enabled with a URL or rule expressions, or a local policy
 	coarseOK := c.Coarse.Enabled && strings.TrimSpace(c.Coarse.ValidationURL) != ""
-	fineOK := c.FineGrain.Enabled && strings.TrimSpace(c.FineGrain.ValidationURL) != ""
-	if !coarseOK && !fineOK {
-		return errors.New("authorization: at least one enabled section with validation-url is required")
+	if err := c.FineGrain.compileExpressions(); err != nil {
+		return err
+	}
+	if err := c.FineGrain.compileBodyPaths(); err != nil {
+		return err
+	}
+	fineOK := c.FineGrain.Enabled && (strings.TrimSpace(c.FineGrain.ValidationURL) != "" || len(c.FineGrain.programs) > 0)
+	policyOK := c.Policy != nil && c.Policy.Enabled
+	if !coarseOK && !fineOK && !policyOK {
+		return errors.New("authorization: at least one enabled section with validation-url (or fine-grain expressions), or an enabled policy, is required")
+	}
+	if policyOK {
+		if err := c.Policy.prepare(); err != nil {
+			return err
+		}
+	}
+	if err := validateFailureMode(checkCoarse, c.Coarse.FailureMode); err != nil {
+		return err
+	}
+	if err := validateFailureMode(checkFineGrain, c.FineGrain.FailureMode); err != nil {
+		return err
+	}
+	if err := validateMode(checkCoarse, c.Coarse.Mode); err != nil {
+		return err
+	}
+	if err := validateMode(checkFineGrain, c.FineGrain.Mode); err != nil {
+		return err
+	}
+	if c.Policy != nil {
+		if err := validateMode(checkPolicy, c.Policy.Mode); err != nil {
+			return err
+		}
+	}
+	switch c.FineGrain.DefaultAction {
+	case "", DefaultActionAllow, DefaultActionDeny:
+	default:
+		return fmt.Errorf("%s: default-action must be allow or deny, got %q", checkFineGrain, c.FineGrain.DefaultAction)
+	}
+	if err := c.Combining.validate(); err != nil {
+		return err
+	}
+	if err := validateRegexKeys(checkCoarse, c.Coarse.ResourceMap); err != nil {
+		return err
+	}
+	if err := c.compileDenyResponses(); err != nil {
+		return err
+	}
+	if err := validateRegexKeys(checkFineGrain, c.FineGrain.ResourceMap); err != nil {
+		return err
+	}
+	if c.Coarse.signer, err = prepareClientAuth(checkCoarse, c.Coarse.clientAuth()); err != nil {
+		return err
+	}
+	if c.FineGrain.signer, err = prepareClientAuth(checkFineGrain, c.FineGrain.clientAuth()); err != nil {
+		return err
+	}
+	if c.Coarse.client, err = newValidationClient(checkCoarse, c.Coarse.TLS, c.Coarse.Timeout); err != nil {
+		return err
+	}
+	if c.FineGrain.client, err = newValidationClient(checkFineGrain, c.FineGrain.TLS, c.FineGrain.Timeout); err != nil {
+		return err
+	}
+	if err := c.Coarse.Retry.validate(); err != nil {
+		return fmt.Errorf("%s: %w", checkCoarse, err)
+	}
+	if err := c.FineGrain.Retry.validate(); err != nil {
+		return fmt.Errorf("%s: %w", checkFineGrain, err)
+	}
+	prev := cfg.Load()
+	var prevCoarse, prevFine *circuitbreaker.Breaker
+	var prevCoarseConf, prevFineConf *circuitbreaker.Config
+	if prev != nil {
+		prevCoarse, prevCoarseConf = prev.Coarse.breaker, prev.Coarse.CircuitBreaker
+		prevFine, prevFineConf = prev.FineGrain.breaker, prev.FineGrain.CircuitBreaker
 	}
-	cfg = &c
+	if c.Coarse.breaker, err = newBreaker(checkCoarse, c.Coarse.CircuitBreaker, prevCoarse, prevCoarseConf); err != nil {
+		return err
+	}
+	if c.FineGrain.breaker, err = newBreaker(checkFineGrain, c.FineGrain.CircuitBreaker, prevFine, prevFineConf); err != nil {
+		return err
+	}
+	if c.FineGrain.decisions, err = newDecisionCache(checkFineGrain, c.FineGrain.DecisionCache); err != nil {
+		return err
+	}
+	var prevCoarseSection *CoarseConfig
+	var prevFineSection *FineGrainConfig
+	if prev != nil {
+		prevCoarseSection, prevFineSection = &prev.Coarse, &prev.FineGrain
+	}
+	if err := c.Coarse.prepareCanary(prevCoarseSection); err != nil {
+		return err
+	}
+	if err := c.FineGrain.prepareCanary(prevFineSection); err != nil {
+		return err
+	}
+	if err := c.Coarse.prepareTenants(); err != nil {
+		return err
+	}
+	if err := c.FineGrain.prepareTenants(); err != nil {
+		return err
+	}
+	if err := audit.Configure(c.Audit); err != nil {
+		return err
+	}
+	cfg.Store(c)
 	return nil
 }
 
+// newBreaker builds the circuit breaker for a check, keeping the previous one (and its state)
+// when a reload leaves the circuit-breaker settings unchanged
+func newBreaker(check string, conf *circuitbreaker.Config, prev *circuitbreaker.Breaker, prevConf *circuitbreaker.Config) (*circuitbreaker.Breaker, error) {
+	if conf == nil || !conf.Enabled {
+		return nil, nil
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", check, err)
+	}
+	if prev != nil && prevConf != nil && *prevConf == *conf {
+		return prev, nil
+	}
+	return circuitbreaker.New(check, *conf), nil
+}
+
+// ValidationEndpoint is a validation service the loaded config calls
+type ValidationEndpoint struct {
+	Check string
+	URL   string
+	// Client is the client the check calls the service with, carrying its TLS settings and timeout
+	Client *http.Client
+}
+
+// ValidationEndpoints lists the validation services of the enabled checks, for reachability checks
+func ValidationEndpoints() []ValidationEndpoint {
+	c := cfg.Load()
+	if c == nil {
+		return nil
+	}
+	var eps []ValidationEndpoint
+	add := func(check string, enabled bool, url string, client *http.Client) {
+		if !enabled || strings.TrimSpace(url) == "" {
+			return
+		}
+		if client == nil {
+			client = httpClient
+		}
+		eps = append(eps, ValidationEndpoint{Check: check, URL: url, Client: client})
+	}
+	add(checkCoarse, c.Coarse.Enabled, c.Coarse.ValidationURL, c.Coarse.client)
+	add(checkFineGrain, c.FineGrain.Enabled, c.FineGrain.ValidationURL, c.FineGrain.client)
+	return eps
+}
+
+// SecretFiles lists the files the loaded config reads secrets and keys from, so a watcher can
+// reload it when they change
+func SecretFiles() []string {
+	c := cfg.Load()
+	if c == nil {
+		return nil
+	}
+	var files []string
+	for _, f := range []string{c.Coarse.ClientSecretFile, c.Coarse.PrivateKeyFile, c.FineGrain.ClientSecretFile, c.FineGrain.PrivateKeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
 // ConfigOrNil returns the loaded config or nil if not loaded.
-func ConfigOrNil() *Config { return cfg }
-
-// helper: match coarse resource-map key against a path and return the mapped resource
-func (c CoarseConfig) MatchResource(path string) (string, bool) {
-	bestKey := ""
-	bestSpecificity := -1
-	for k := range c.ResourceMap {
-		pattern := normalizePattern(k)
-		if pm, has := splitMethod(pattern); has {
-			// coarse patterns ignore method suffix
-			pattern = pm.pattern
-		}
-		if matched, spec := pathMatch(pattern, path); matched {
-			if spec > bestSpecificity {
-				bestSpecificity = spec
-				bestKey = k
-			}
+func ConfigOrNil() *Config { return cfg.Load() }
+
+// SetConfigForTest allows tests in other packages to install a config. Do not use in production code paths.
+func SetConfigForTest(c *Config) { cfg.Store(c) }
+
+// helper: match coarse resource-map key against a host, method and path and return the mapped resource
+func (c CoarseConfig) MatchResource(host, method, path string) (string, bool) {
+	_, resource, ok := c.matchResource(host, method, path)
+	return resource, ok
+}
+
+// matchResource also returns the resource-map key that matched, for auditing
+func (c CoarseConfig) matchResource(host, method, path string) (key, resource string, ok bool) {
+	var best rank
+	for k, r := range c.ResourceMap {
+		if matched, spec := keyMatch(k, host, method, path); matched {
+			best = best.max(rank{key: k, priority: r.Priority, specificity: spec, ok: true})
+		}
+	}
+	if !best.ok {
+		return "", "", false
+	}
+	return best.key, c.ResourceMap[best.key].Resource, true
+}
+
+// helper: match fine-grain rule by host, method and path
+func (f FineGrainConfig) MatchRule(host, method, path string) (FineRule, bool) {
+	_, rule, ok := f.matchRule(host, method, path)
+	return rule, ok
+}
+
+// matchRule also returns the resource-map key that matched, for auditing
+func (f FineGrainConfig) matchRule(host, method, path string) (key string, rule FineRule, ok bool) {
+	var best rank
+	for k, r := range f.ResourceMap {
+		if matched, spec := keyMatch(k, host, method, path); matched {
+			best = best.max(rank{key: k, priority: r.Priority, specificity: spec, ok: true})
 		}
 	}
-	if bestKey == "" {
-		return "", false
+	if !best.ok {
+		return "", FineRule{}, false
+	}
+	return best.key, f.ResourceMap[best.key], true
+}
+
+// rank orders matching resource-map keys: priority first, then specificity, then the key itself
+// so ties never depend on map iteration order
+type rank struct {
+	key         string
+	priority    int
+	specificity int
+	ok          bool
+}
+
+// max returns the higher ranked of r and o
+func (r rank) max(o rank) rank {
+	switch {
+	case !r.ok:
+		return o
+	case o.priority != r.priority:
+		if o.priority > r.priority {
+			return o
+		}
+	case o.specificity != r.specificity:
+		if o.specificity > r.specificity {
+			return o
+		}
+	case o.key < r.key:
+		return o
 	}
-	return c.ResourceMap[bestKey], true
+	return r
 }
 
-// helper: match fine-grain rule by method and path
-func (f FineGrainConfig) MatchRule(method, path string) (FineRule, bool) {
-	method = strings.ToUpper(method)
-	bestKey := ""
-	bestSpecificity := -1
-	for k := range f.ResourceMap {
-		p := normalizePattern(k)
-		pm, hasMethod := splitMethod(p)
-		if hasMethod && pm.method != method {
-			continue
+// isPathParam reports whether a pattern segment is a {name} parameter
+func isPathParam(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// pathParams returns the values of the {name} segments, or regex named groups, of a resource-map key
+// for a path it matches. A query string is not part of the path, so it never ends up in a value.
+func pathParams(key, path string) map[string]string {
+	path, _, _ = strings.Cut(path, "?")
+	pm, _ := splitMethod(normalizePattern(key))
+	if isRegexPattern(pm.pattern) {
+		return regexParams(pm.pattern, path)
+	}
+	ps := strings.Split(strings.TrimPrefix(pm.pattern, "/"), "/")
+	ss := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	var params map[string]string
+	for i, segment := range ps {
+		if segment == "**" || i >= len(ss) {
+			break
 		}
-		if matched, spec := pathMatch(pm.pattern, path); matched {
-			if spec > bestSpecificity {
-				bestSpecificity = spec
-				bestKey = k
+		if isPathParam(segment) {
+			if params == nil {
+				params = make(map[string]string)
 			}
+			params[segment[1:len(segment)-1]] = ss[i]
 		}
 	}
-	if bestKey == "" {
-		return FineRule{}, false
+	return params
+}
+
+// MatchPattern reports whether a resource-map style pattern matches a request. Patterns use the
+// '*' and '{name}' (one segment) and '**' (rest of path) wildcards, may start with a host to bind
+// them to it (api.example.com/docs/**) and may end in :METHOD to restrict the method.
+func MatchPattern(pattern, host, method, path string) bool {
+	matched, _ := keyMatch(pattern, host, method, path)
+	return matched
+}
+
+// keyMatch matches a resource-map key against a request. A :METHOD suffix restricts the key to
+// that method; it may list several (:GET,HEAD) or be * for any. A key bound to the request host
+// beats host-less keys, then path specificity decides, and for the same path a key naming the
+// method beats one that does not.
+func keyMatch(key, host, method, path string) (bool, int) {
+	pm, hasMethod := splitMethod(normalizePattern(key))
+	if pm.host != "" && !MatchHost(pm.host, host) {
+		return false, 0
+	}
+	explicit := hasMethod && pm.method != "*"
+	if explicit && !methodListed(pm.method, strings.ToUpper(method)) {
+		return false, 0
+	}
+	matched, spec := pathMatch(pm.pattern, path)
+	if !matched {
+		return false, 0
+	}
+	spec *= 2
+	if explicit {
+		spec++
+	}
+	if pm.host != "" {
+		spec += hostBound
 	}
-	return f.ResourceMap[bestKey], true
+	return true, spec
+}
+
+// methodListed reports whether method is in a comma-separated method list
+func methodListed(list, method string) bool {
+	for _, m := range strings.Split(list, ",") {
+		if strings.TrimSpace(m) == method {
+			return true
+		}
+	}
+	return false
 }
 
 // normalizePattern trims surrounding [ ] if present
@@ -123,20 +618,34 @@ func normalizePattern(raw string) string {
 }
 
 type patternMethod struct {
+	// host is the host the pattern is bound to, or "" for any
+	host    string
 	pattern string
 	method  string
 }
 
 func splitMethod(p string) (patternMethod, bool) {
+	host, p := splitHost(p)
 	// pattern may be like /path/**:POST
 	if i := strings.LastIndex(p, ":"); i != -1 {
-		return patternMethod{pattern: p[:i], method: strings.ToUpper(strings.TrimSpace(p[i+1:]))}, true
+		method := strings.TrimSpace(p[i+1:])
+		// a regex may contain ':' itself, e.g. (?:a|b), so only a method list ends one
+		if isRegexPattern(p) && !methodSuffix.MatchString(method) {
+			return patternMethod{host: host, pattern: p}, false
+		}
+		return patternMethod{host: host, pattern: p[:i], method: strings.ToUpper(method)}, true
 	}
-	return patternMethod{pattern: p}, false
+	return patternMethod{host: host, pattern: p}, false
 }
 
-// pathMatch supports '*', '**' wildcards. Returns matched and a specificity score (higher is more specific)
+// methodSuffix matches a :METHOD suffix: a comma-separated method list or *
+var methodSuffix = regexp.MustCompile(`^(\*|[A-Za-z]+(,\s*[A-Za-z]+)*)$`)
+
+// pathMatch supports '*', '**' wildcards and '{name}' parameters. Returns matched and a specificity score (higher is more specific)
 func pathMatch(pattern, path string) (bool, int) {
+	if isRegexPattern(pattern) {
+		return regexMatch(pattern, path)
+	}
 	// quick exact match
 	if pattern == path {
 		return true, len(path) + 1000
@@ -155,12 +664,17 @@ func pathMatch(pattern, path string) (bool, int) {
 		if j >= len(ss) {
 			return false, 0
 		}
-		switch ps[i] {
-		case "*":
+		switch {
+		case ps[i] == "*":
 			// matches exactly one segment, low specificity
 			specificity += 1
 			i++
 			j++
+		case isPathParam(ps[i]):
+			// a named segment is a wildcard, but more specific than '*'
+			specificity += 2
+			i++
+			j++
 		default:
 			if ps[i] != ss[j] {
 				return false, 0
@@ -22,8 +22,8 @@ func writeTempFile(t *testing.T, dir, pattern, content string) string {
 
 func TestLoad_ValidYAML(t *testing.T) {
 	// ensure clean state
-	cfg = nil
-	t.Cleanup(func() { cfg = nil })
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(nil) })
 
 	dir := t.TempDir()
 	y := "" +
@@ -55,8 +55,8 @@ func TestLoad_ValidYAML(t *testing.T) {
 }
 
 func TestLoad_FileNotFound(t *testing.T) {
-	cfg = nil
-	t.Cleanup(func() { cfg = nil })
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(nil) })
 
 	err := Load(filepath.Join(t.TempDir(), "not-exists.yaml"))
 	if err == nil {
@@ -68,8 +68,8 @@ func TestLoad_FileNotFound(t *testing.T) {
 }
 
 func TestLoad_InvalidYAML(t *testing.T) {
-	cfg = nil
-	t.Cleanup(func() { cfg = nil })
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(nil) })
 	p := writeTempFile(t, t.TempDir(), "bad-*.yaml", "::: not yaml :::")
 	if err := Load(p); err == nil {
 		t.Fatalf("expected unmarshal error for invalid yaml")
@@ -77,8 +77,8 @@ func TestLoad_InvalidYAML(t *testing.T) {
 }
 
 func TestLoad_NoValidationURLs(t *testing.T) {
-	cfg = nil
-	t.Cleanup(func() { cfg = nil })
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(nil) })
 	y := "coarse-check:\n  enabled: true\n  validation-url: \"\"\n\n" +
 		"finegrain-check:\n  enabled: true\n  validation-url: \"\"\n"
 	p := writeTempFile(t, t.TempDir(), "empty-*.yaml", y)
@@ -89,15 +89,158 @@ func TestLoad_NoValidationURLs(t *testing.T) {
 
 func TestConfigOrNil_DefaultNilAndSet(t *testing.T) {
 	// default nil
-	old := cfg
-	cfg = nil
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(old) })
 	if ConfigOrNil() != nil {
 		t.Fatalf("expected nil config by default")
 	}
 	tmp := &Config{}
-	cfg = tmp
+	cfg.Store(tmp)
 	if ConfigOrNil() != tmp {
 		t.Fatalf("expected ConfigOrNil to return the same pointer that was set")
 	}
 }
+
+func TestLoad_ConcurrentReadersDuringReload(t *testing.T) {
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	y := "coarse-check:\n  enabled: true\n  validation-url: \"http://example.org/coarse\"\n"
+	p := writeTempFile(t, t.TempDir(), "auth-*.yaml", y)
+
+	// run with -race: readers on the request path must not race with Load
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if c := ConfigOrNil(); c != nil {
+				_ = c.Coarse.ValidationURL
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := Load(p); err != nil {
+			t.Fatalf("Load error: %v", err)
+		}
+	}
+	<-done
+}
+
+func TestMatchPattern(t *testing.T) {
+	cases := []struct {
+		pattern, method, path string
+		want                  bool
+	}{
+		{"/health", "GET", "/health", true},
+		{"/.well-known/*", "GET", "/.well-known/openid-configuration", true},
+		{"/.well-known/*", "GET", "/.well-known/a/b", false},
+		{"[/docs/**]", "GET", "/docs/api/v1", true},
+		{"/docs/**:GET", "POST", "/docs/x", false},
+		{"/docs/**:get", "GET", "/docs/x", true},
+		{"/health", "GET", "/healthz", false},
+		{"[/api/accounts/{accountId}/transfers:POST]", "POST", "/api/accounts/a1/transfers", true},
+		{"/api/accounts/{accountId}/transfers", "GET", "/api/accounts/transfers", false},
+	}
+	for _, tc := range cases {
+		if got := MatchPattern(tc.pattern, "", tc.method, tc.path); got != tc.want {
+			t.Errorf("MatchPattern(%q, %q, %q) = %v, want %v", tc.pattern, tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestFineGrainPathParams(t *testing.T) {
+	f := FineGrainConfig{ResourceMap: map[string]FineRule{
+		"[/api/accounts/*/transfers:POST]":           {RulesetID: "wildcard"},
+		"[/api/accounts/{accountId}/transfers:POST]": {RulesetID: "param"},
+	}}
+	key, rule, ok := f.matchRule("", "POST", "/api/accounts/a1/transfers")
+	if !ok || rule.RulesetID != "param" {
+		t.Fatalf("expected the {accountId} rule to win over '*', got %q", key)
+	}
+	params := pathParams(key, "/api/accounts/a1/transfers")
+	if len(params) != 1 || params["accountId"] != "a1" {
+		t.Fatalf("unexpected path params %v", params)
+	}
+	if params := pathParams("[/users/{id}/**]", "/users/u7/roles/admin"); params["id"] != "u7" {
+		t.Fatalf("unexpected path params %v", params)
+	}
+}
+
+func TestPathParams_IgnoresQuery(t *testing.T) {
+	if params := pathParams("[/api/accounts/{id}]", "/api/accounts/7?debug=1"); params["id"] != "7" {
+		t.Fatalf("expected the query to be left out of {id}, got %v", params)
+	}
+	if params := pathParams(`[~^/api/accounts/(?P<id>[^/]+)$]`, "/api/accounts/7?debug=1"); params["id"] != "7" {
+		t.Fatalf("expected the query to be left out of the regex group, got %v", params)
+	}
+}
+
+func TestLoad_RejectsUnknownFailureMode(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	p := writeTempFile(t, t.TempDir(), "auth-*.yaml", "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  failure-mode: maybe\n")
+	if err := Load(p); err == nil {
+		t.Fatalf("expected an error for an unknown failure-mode")
+	}
+}
+
+func TestCoarseMatchResource_Method(t *testing.T) {
+	c := CoarseConfig{ResourceMap: map[string]CoarseResource{
+		"[/admin/**]":          {Resource: "/admin/any"},
+		"[/admin/**:DELETE]":   {Resource: "/admin/delete"},
+		"[/admin/**:GET,HEAD]": {Resource: "/admin/read"},
+		"[/admin/users/**:*]":  {Resource: "/admin/users"},
+		"[/reports/**:post]":   {Resource: "/reports/write"},
+		// gRPC full method names
+		"[/orders.v1.OrderService/*:POST]":      {Resource: "orders"},
+		"[/orders.v1.OrderService/Delete:POST]": {Resource: "orders/delete"},
+	}}
+	cases := []struct{ method, path, want string }{
+		{"DELETE", "/admin/x", "/admin/delete"},
+		{"GET", "/admin/x", "/admin/read"},
+		{"HEAD", "/admin/x", "/admin/read"},
+		{"PUT", "/admin/x", "/admin/any"},
+		{"DELETE", "/admin/users/7", "/admin/users"},
+		{"POST", "/reports/q1", "/reports/write"},
+		{"GET", "/reports/q1", ""},
+		{"POST", "/orders.v1.OrderService/Get", "orders"},
+		{"POST", "/orders.v1.OrderService/Delete", "orders/delete"},
+	}
+	for _, tc := range cases {
+		got, _ := c.MatchResource("", tc.method, tc.path)
+		if got != tc.want {
+			t.Errorf("MatchResource(%s %s) = %q, want %q", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestLoad_RejectsUnknownDefaultAction(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	p := writeTempFile(t, t.TempDir(), "auth-*.yaml", "finegrain-check:\n  enabled: true\n  validation-url: http://pdp\n  default-action: maybe\n")
+	if err := Load(p); err == nil {
+		t.Fatalf("expected an error for an unknown default-action")
+	}
+}
+
+func TestMatchPriorityAndTieBreak(t *testing.T) {
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(nil) })
+	y := "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n  resource-map:\n" +
+		"    \"[/api/orders/**]\": /orders\n" +
+		"    \"[/api/**]\":\n      resource: /api\n      priority: 10\n" +
+		"finegrain-check:\n  enabled: true\n  validation-url: http://pdp\n  resource-map:\n" +
+		"    \"[/r/{a}/x]\":\n      ruleset-id: a\n" +
+		"    \"[/r/{b}/x]\":\n      ruleset-id: b\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	c := ConfigOrNil()
+	if got, _ := c.Coarse.MatchResource("", "GET", "/api/orders/1"); got != "/api" {
+		t.Fatalf("expected priority to win over specificity, got %q", got)
+	}
+	// equal priority and specificity: the lowest key wins, whatever the map order
+	for i := 0; i < 20; i++ {
+		if key, _, _ := c.FineGrain.matchRule("", "GET", "/r/1/x"); key != "[/r/{a}/x]" {
+			t.Fatalf("expected a deterministic tie-break, got %q", key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package authorization
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"reverseProxy/internal/metrics"
+)
+
+// Defaults for decision-cache
+const (
+	DefaultDecisionCacheTTL  = 30 * time.Second
+	DefaultDecisionCacheSize = 10000
+)
+
+// DecisionCacheConfig reuses fine-grain validation service decisions for identical requests
+type DecisionCacheConfig struct {
+	// TTL is how long a decision is reused (default 30s)
+	TTL time.Duration `yaml:"ttl"`
+	// Size bounds the number of cached decisions; the least recently used are evicted (default 10000)
+	Size int `yaml:"size"`
+}
+
+type decisionKey [sha256.Size]byte
+
+type decisionEntry struct {
+	key     decisionKey
+	vr      validationResponse
+	expires time.Time
+}
+
+// decisionCache is a bounded least-recently-used cache of validation responses; a nil cache
+// caches nothing
+type decisionCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[decisionKey]*list.Element
+}
+
+func newDecisionCache(check string, conf *DecisionCacheConfig) (*decisionCache, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if conf.TTL < 0 || conf.Size < 0 {
+		return nil, errors.New(check + ": decision-cache: ttl and size must not be negative")
+	}
+	d := &decisionCache{ttl: conf.TTL, size: conf.Size, order: list.New(), entries: make(map[decisionKey]*list.Element)}
+	if d.ttl == 0 {
+		d.ttl = DefaultDecisionCacheTTL
+	}
+	if d.size == 0 {
+		d.size = DefaultDecisionCacheSize
+	}
+	return d, nil
+}
+
+// decisionRequest is what makes two fine-grain validation calls identical: the whole payload the
+// validation service receives, the token's issuer and subject, and the headers sent with the call
+type decisionRequest struct {
+	URL     string      `json:"url"`
+	Issuer  any         `json:"iss"`
+	Subject any         `json:"sub"`
+	Payload finePayload `json:"payload"`
+	Headers http.Header `json:"headers"`
+}
+
+// correlationHeaders identify one request rather than what is asked, so they are left out of the
+// key; every other forwarded header is part of it
+var correlationHeaders = []string{"X-Request-Id", "Traceparent", "Tracestate"}
+
+// decisionKey hashes everything a validation call sends, so a decision is only reused for a call
+// the validation service could not tell apart
+func (f FineGrainConfig) decisionKey(payload finePayload, headers http.Header) (decisionKey, error) {
+	if len(payload.Request.Headers) > 0 {
+		forwarded := make(map[string]string, len(payload.Request.Headers))
+		for k, v := range payload.Request.Headers {
+			if !slices.ContainsFunc(correlationHeaders, func(h string) bool { return strings.EqualFold(h, k) }) {
+				forwarded[k] = v
+			}
+		}
+		payload.Request.Headers = forwarded
+	}
+	b, err := json.Marshal(decisionRequest{
+		URL:     f.ValidationURL,
+		Issuer:  payload.Request.Claims["iss"],
+		Subject: payload.Request.Claims["sub"],
+		Payload: payload,
+		Headers: headers,
+	})
+	if err != nil {
+		return decisionKey{}, fmt.Errorf("decision cache key: %w", err)
+	}
+	return sha256.Sum256(b), nil
+}
+
+// lookup returns an unexpired cached response
+func (d *decisionCache) lookup(check string, key decisionKey) (validationResponse, bool) {
+	if d == nil {
+		return validationResponse{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	el, ok := d.entries[key]
+	if ok && time.Now().After(el.Value.(*decisionEntry).expires) {
+		d.remove(el)
+		ok = false
+	}
+	if !ok {
+		metrics.AuthzDecisionCache.WithLabelValues(check, "miss").Inc()
+		return validationResponse{}, false
+	}
+	metrics.AuthzDecisionCache.WithLabelValues(check, "hit").Inc()
+	d.order.MoveToFront(el)
+	return el.Value.(*decisionEntry).vr, true
+}
+
+// store remembers a response for the cache's TTL
+func (d *decisionCache) store(key decisionKey, vr validationResponse) {
+	if d == nil {
+		return
+	}
+	e := &decisionEntry{key: key, vr: vr, expires: time.Now().Add(d.ttl)}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.entries[key]; ok {
+		el.Value = e
+		d.order.MoveToFront(el)
+		return
+	}
+	d.entries[key] = d.order.PushFront(e)
+	for d.order.Len() > d.size {
+		d.remove(d.order.Back())
+	}
+}
+
+func (d *decisionCache) remove(el *list.Element) {
+	d.order.Remove(el)
+	delete(d.entries, el.Value.(*decisionEntry).key)
+}
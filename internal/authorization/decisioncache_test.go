@@ -0,0 +1,113 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestCheckFineGrain_DecisionCache(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	var calls atomic.Int32
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"allow":true}`))
+	}))
+	defer pdp.Close()
+
+	y := "finegrain-check:\n  enabled: true\n  validation-url: " + pdp.URL + "\n  decision-cache:\n    ttl: 50ms\n" +
+		"  resource-map:\n    \"[/orders/{id}]\":\n      body:\n        orderId: $path.id\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	check := func(user, path string) {
+		t.Helper()
+		req := RequestInfo{Method: "GET", Path: path, Headers: map[string]string{"X-Request-Id": user + path}}
+		if allow, _, err := CheckFineGrainAccess(context.Background(), req, jwtauth.Principal{UserID: user}); err != nil || !allow {
+			t.Fatalf("expected allow, got %v %v", allow, err)
+		}
+	}
+
+	check("alice", "/orders/1")
+	check("alice", "/orders/1")
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the second decision from the cache, got %d calls", n)
+	}
+	check("bob", "/orders/1")
+	check("alice", "/orders/2")
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("expected other principals and values to miss the cache, got %d calls", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	check("alice", "/orders/1")
+	if n := calls.Load(); n != 4 {
+		t.Fatalf("expected an expired decision to be fetched again, got %d calls", n)
+	}
+}
+
+func TestDecisionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	d, err := newDecisionCache(checkFineGrain, &DecisionCacheConfig{Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := decisionKey{1}, decisionKey{2}, decisionKey{3}
+	d.store(a, validationResponse{Allow: true})
+	d.store(b, validationResponse{Allow: true})
+	d.lookup(checkFineGrain, a)
+	d.store(c, validationResponse{Allow: true})
+	if _, ok := d.lookup(checkFineGrain, b); ok {
+		t.Fatalf("expected the least recently used decision to be evicted")
+	}
+	if _, ok := d.lookup(checkFineGrain, a); !ok {
+		t.Fatalf("expected a recently used decision to stay cached")
+	}
+
+	if _, err := newDecisionCache(checkFineGrain, &DecisionCacheConfig{TTL: -time.Second}); err == nil {
+		t.Fatalf("expected an error for a negative ttl")
+	}
+}
+
+func TestDecisionKey_CoversThePayload(t *testing.T) {
+	conf := FineGrainConfig{ValidationURL: "http://pdp/check"}
+	key := func(p finePayload) decisionKey {
+		t.Helper()
+		k, err := conf.decisionKey(p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	base := func() finePayload {
+		return finePayload{
+			Principal: jwtauth.Principal{Roles: []string{"viewer"}},
+			Request: RequestInfo{Method: "GET", Path: "/orders", FullURL: "https://api/orders?owner=alice",
+				Headers: map[string]string{"X-Request-Id": "1"}, Claims: map[string]any{"iss": "https://idp", "sub": "alice"}},
+		}
+	}
+
+	admin := base()
+	admin.Principal.Roles = []string{"admin"}
+	if key(base()) == key(admin) {
+		t.Errorf("expected principals differing only in roles to get different keys")
+	}
+	query := base()
+	query.Request.FullURL = "https://api/orders?owner=bob"
+	if key(base()) == key(query) {
+		t.Errorf("expected requests differing only in the query to get different keys")
+	}
+	subject := base()
+	subject.Request.Claims = map[string]any{"iss": "https://idp", "sub": "bob"}
+	if key(base()) == key(subject) {
+		t.Errorf("expected tokens of other subjects to get different keys")
+	}
+	retry := base()
+	retry.Request.Headers = map[string]string{"X-Request-Id": "2"}
+	if key(base()) != key(retry) {
+		t.Errorf("expected the request ID to be left out of the key")
+	}
+}
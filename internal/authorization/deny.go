@@ -0,0 +1,128 @@
+package authorization
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// DenyResponse replaces the 403 returned when a check denies a request, e.g. with a branded body,
+// or with 404 so that denied resources cannot be told apart from missing ones
+type DenyResponse struct {
+	// Status is the HTTP status returned (default 403)
+	Status int `yaml:"status"`
+	// ContentType of the body (default application/json)
+	ContentType string `yaml:"content-type"`
+	// Body is a text/template over DenyData; the json function quotes a value for a JSON body
+	Body    string            `yaml:"body"`
+	Headers map[string]string `yaml:"headers"`
+	body    *template.Template
+}
+
+// DenyData is what a deny response body template can use
+type DenyData struct {
+	Check     string
+	Reason    string
+	RequestID string
+	Method    string
+	Path      string
+}
+
+var denyFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// compile checks the response and parses its body template
+func (d *DenyResponse) compile(where string) error {
+	if d == nil {
+		return nil
+	}
+	if d.Status != 0 && (d.Status < 400 || d.Status > 599) {
+		return fmt.Errorf("%s: deny-response: status must be 4xx or 5xx, got %d", where, d.Status)
+	}
+	t, err := template.New("deny").Funcs(denyFuncs).Option("missingkey=error").Parse(d.Body)
+	if err != nil {
+		return fmt.Errorf("%s: deny-response: body: %w", where, err)
+	}
+	d.body = t
+	return nil
+}
+
+// StatusCode returns the configured status or 403
+func (d *DenyResponse) StatusCode() int {
+	if d.Status == 0 {
+		return http.StatusForbidden
+	}
+	return d.Status
+}
+
+// MediaType returns the configured content type or application/json
+func (d *DenyResponse) MediaType() string {
+	if d.ContentType == "" {
+		return "application/json"
+	}
+	return d.ContentType
+}
+
+// Render executes the body template
+func (d *DenyResponse) Render(data DenyData) ([]byte, error) {
+	if d.body == nil {
+		return []byte(d.Body), nil
+	}
+	var buf bytes.Buffer
+	if err := d.body.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compileDenyResponses parses the global and per-rule deny responses, including canary rules
+func (c *Config) compileDenyResponses() error {
+	if err := c.DenyResponse.compile("authorization"); err != nil {
+		return err
+	}
+	coarse := []map[string]CoarseResource{c.Coarse.ResourceMap}
+	if c.Coarse.Canary != nil {
+		coarse = append(coarse, c.Coarse.Canary.ResourceMap)
+	}
+	for _, m := range coarse {
+		for key, r := range m {
+			if err := r.DenyResponse.compile(fmt.Sprintf("%s: %q", checkCoarse, key)); err != nil {
+				return err
+			}
+		}
+	}
+	fine := []map[string]FineRule{c.FineGrain.ResourceMap}
+	if c.FineGrain.Canary != nil {
+		fine = append(fine, c.FineGrain.Canary.ResourceMap)
+	}
+	for _, m := range fine {
+		for key, r := range m {
+			if err := r.DenyResponse.compile(fmt.Sprintf("%s: %q", checkFineGrain, key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type denyResponseKey struct{}
+
+// withDenyResponse returns a context in which a check records the deny response of the rule it matched
+func withDenyResponse(ctx context.Context) (context.Context, **DenyResponse) {
+	slot := new(*DenyResponse)
+	return context.WithValue(ctx, denyResponseKey{}, slot), slot
+}
+
+// noteDenyResponse records the matched rule's deny response for runProvider; a no-op outside Authorize
+func noteDenyResponse(ctx context.Context, d *DenyResponse) {
+	if slot, ok := ctx.Value(denyResponseKey{}).(**DenyResponse); ok {
+		*slot = d
+	}
+}
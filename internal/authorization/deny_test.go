@@ -0,0 +1,64 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestAuthorize_DenyResponse(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	y := `deny-response:
+  body: '{"error":"forbidden","reason":{{json .Reason}},"request":{{json .RequestID}}}'
+finegrain-check:
+  enabled: true
+  resource-map:
+    "[/secret/**]":
+      expression: "false"
+      deny-response:
+        status: 404
+        content-type: text/plain
+        body: not found
+    "[/orders/**]":
+      expression: "false"
+`
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	decide := func(path string) Outcome {
+		return Authorize(context.Background(), RequestInfo{Method: "GET", Path: path}, jwtauth.Principal{})
+	}
+
+	o := decide("/secret/plans")
+	if o.Allow || o.DenyResponse == nil || o.DenyResponse.StatusCode() != 404 || o.DenyResponse.MediaType() != "text/plain" {
+		t.Fatalf("expected the rule's deny response, got %+v", o)
+	}
+
+	o = decide("/orders/1")
+	if o.Allow || o.DenyResponse == nil || o.DenyResponse.StatusCode() != 403 || o.DenyResponse.MediaType() != "application/json" {
+		t.Fatalf("expected the global deny response, got %+v", o)
+	}
+	body, err := o.DenyResponse.Render(DenyData{Reason: `say "no"`, RequestID: "req-1"})
+	if err != nil || string(body) != `{"error":"forbidden","reason":"say \"no\"","request":"req-1"}` {
+		t.Fatalf("unexpected body %s (%v)", body, err)
+	}
+
+	if o := decide("/public"); !o.Allow || o.DenyResponse != nil {
+		t.Fatalf("expected an allow without a deny response, got %+v", o)
+	}
+}
+
+func TestLoad_RejectsBadDenyResponse(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	base := "coarse-check:\n  enabled: true\n  validation-url: http://pdp\n"
+	for _, deny := range []string{
+		"deny-response:\n  status: 200\n",
+		"deny-response:\n  body: '{{.Reason'\n",
+		"  resource-map:\n    \"[/x]\":\n      resource: x\n      deny-response:\n        body: '{{end}}'\n",
+	} {
+		if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", base+deny)); err == nil {
+			t.Errorf("expected an error for %q", deny)
+		}
+	}
+}
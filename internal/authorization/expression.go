@@ -0,0 +1,118 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// celEnv declares the variables fine-grain expressions can reference
+var celEnv, celEnvErr = cel.NewEnv(
+	// principal holds user_id, username, email and tenant_id as strings, roles and scopes as lists
+	// and raw_claims as the claims mapped into the principal
+	cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("method", cel.StringType),
+	cel.Variable("path", cel.StringType),
+	cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+	cel.Variable("query", cel.MapType(cel.StringType, cel.StringType)),
+	// queries holds every value of each query parameter, where query holds the first
+	cel.Variable("queries", cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+	cel.Variable("body", cel.DynType),
+)
+
+// compileExpressions compiles the expression of every fine-grain rule that has one
+func (f *FineGrainConfig) compileExpressions() error {
+	f.programs = nil
+	for key, rule := range f.ResourceMap {
+		if rule.Expression == "" {
+			continue
+		}
+		if celEnvErr != nil {
+			return celEnvErr
+		}
+		ast, issues := celEnv.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("%s: rule %s: expression: %w", checkFineGrain, key, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return fmt.Errorf("%s: rule %s: expression must evaluate to a bool, got %s", checkFineGrain, key, ast.OutputType())
+		}
+		prg, err := celEnv.Program(ast)
+		if err != nil {
+			return fmt.Errorf("%s: rule %s: expression: %w", checkFineGrain, key, err)
+		}
+		if f.programs == nil {
+			f.programs = make(map[string]cel.Program)
+		}
+		f.programs[key] = prg
+	}
+	return nil
+}
+
+// evalExpression runs a compiled rule expression against the request
+func evalExpression(prg cel.Program, req RequestInfo, p jwtauth.Principal) (bool, error) {
+	var body any
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			return false, err
+		}
+	}
+	queries := requestQuery(req)
+	query := make(map[string]string, len(queries))
+	for k, v := range queries {
+		query[k] = v[0]
+	}
+	headers := req.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	claims := req.Claims
+	if claims == nil {
+		claims = map[string]any{}
+	}
+	out, _, err := prg.Eval(map[string]any{
+		"principal": principalVar(p),
+		"claims":    claims,
+		"method":    req.Method,
+		"path":      req.Path,
+		"headers":   headers,
+		"query":     query,
+		"queries":   map[string][]string(queries),
+		"body":      body,
+	})
+	if err != nil {
+		return false, err
+	}
+	allow, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %T, not bool", out.Value())
+	}
+	return allow, nil
+}
+
+// principalVar is the principal as the expressions see it; absent lists and claims are empty
+func principalVar(p jwtauth.Principal) map[string]any {
+	roles, scopes, raw := p.Roles, p.Scopes, p.RawClaims
+	if roles == nil {
+		roles = []string{}
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	return map[string]any{
+		"user_id":    p.UserID,
+		"username":   p.Username,
+		"email":      p.Email,
+		"tenant_id":  p.TenantID,
+		"roles":      roles,
+		"scopes":     scopes,
+		"raw_claims": raw,
+	}
+}
@@ -0,0 +1,87 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckFineGrain_Expression(t *testing.T) {
+	y := "finegrain-check:\n" +
+		"  enabled: true\n" +
+		"  resource-map:\n" +
+		"    \"[/pay:POST]\":\n" +
+		"      expression: body.amount < 1000 && 'ROLE_USER' in claims.roles && query.currency == 'EUR'\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	claims := map[string]any{"roles": []any{"ROLE_USER"}}
+	req := func(amount string) RequestInfo {
+		return RequestInfo{Method: "POST", Path: "/pay", FullURL: "http://svc/pay?currency=EUR", Body: json.RawMessage(`{"amount":` + amount + `}`), Claims: claims}
+	}
+	ctx := context.Background()
+	if allow, _, err := CheckFineGrainAccess(ctx, req("10"), jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Errorf("expected a small payment to be allowed, got %v %v", allow, err)
+	}
+	if allow, reason, err := CheckFineGrainAccess(ctx, req("5000"), jwtauthPrincipalForTest()); err != nil || allow || reason == "" {
+		t.Errorf("expected a large payment to be denied, got %v %q %v", allow, reason, err)
+	}
+	noBody := RequestInfo{Method: "POST", Path: "/pay", FullURL: "http://svc/pay?currency=EUR", Claims: claims}
+	if allow, _, err := CheckFineGrainAccess(ctx, noBody, jwtauthPrincipalForTest()); err == nil || allow {
+		t.Errorf("expected an evaluation error without a body, got %v %v", allow, err)
+	}
+}
+
+func TestCheckFineGrain_ExpressionQueries(t *testing.T) {
+	y := "finegrain-check:\n  enabled: true\n  resource-map:\n    \"[/items]\":\n" +
+		"      expression: \"'b' in queries.tag && query.tag == 'a'\"\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	req := RequestInfo{Method: "GET", Path: "/items", FullURL: "http://svc/items?tag=a&tag=b"}
+	if allow, _, err := CheckFineGrainAccess(context.Background(), req, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Errorf("expected every tag value in queries, got %v %v", allow, err)
+	}
+}
+
+func TestCheckFineGrain_ExpressionPrincipal(t *testing.T) {
+	y := "finegrain-check:\n  enabled: true\n  resource-map:\n    \"[/orders]\":\n" +
+		"      expression: \"'orders:read' in principal.scopes && principal.tenant_id == 'acme' && principal.raw_claims.department == 'sales'\"\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	req := RequestInfo{Method: "GET", Path: "/orders", FullURL: "http://svc/orders"}
+	p := jwtauthPrincipalForTest()
+	p.Scopes = []string{"orders:read"}
+	p.TenantID = "acme"
+	p.RawClaims = map[string]interface{}{"department": "sales"}
+	if allow, _, err := CheckFineGrainAccess(context.Background(), req, p); err != nil || !allow {
+		t.Errorf("expected the principal's scopes, tenant and raw claims to allow, got %v %v", allow, err)
+	}
+	p.TenantID = "other"
+	if allow, _, err := CheckFineGrainAccess(context.Background(), req, p); err != nil || allow {
+		t.Errorf("expected another tenant to be denied, got %v %v", allow, err)
+	}
+}
+
+func TestLoad_RejectsInvalidExpression(t *testing.T) {
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	for name, expr := range map[string]string{
+		"syntax":   "body.amount <",
+		"not bool": "size(principal.user_id)",
+		"unknown":  "tenant == 'acme'",
+	} {
+		y := "finegrain-check:\n  enabled: true\n  resource-map:\n    \"[/x]\":\n      expression: \"" + expr + "\"\n"
+		if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err == nil {
+			t.Errorf("%s: expected a compile error", name)
+		}
+	}
+}
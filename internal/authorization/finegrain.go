@@ -1,13 +1,17 @@
 package authorization
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
-	"fmt"
+	"context"
+	"maps"
 	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/tracing"
 )
 
 // finePayload is sent to the fine-grain validation-url
@@ -15,62 +19,131 @@ type finePayload struct {
 	Principal jwtauth.Principal `json:"principal"`
 	Request   RequestInfo       `json:"request"`
 	Rule      FineRule          `json:"rule"`
+	// Values holds the rule's body paths evaluated against the request body
+	Values map[string]any `json:"values,omitempty"`
+	// Attributes holds the claims selected by principal-claims
+	Attributes map[string]any `json:"attributes,omitempty"`
+	// Meta holds the section's and rule's meta fields
+	Meta map[string]any `json:"meta,omitempty"`
 }
 
 // CheckFineGrainAccess performs fine-grained authorization using config.finegrain-check.
 // Returns (allow, reason, error). If section disabled or URL is not set, it returns allow=true.
-func CheckFineGrainAccess(req RequestInfo, p jwtauth.Principal) (bool, string, error) {
+// The call to the validation service is abandoned when ctx is cancelled.
+func CheckFineGrainAccess(ctx context.Context, req RequestInfo, p jwtauth.Principal) (allow bool, reason string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "authz."+checkFineGrain)
+	checkStart := time.Now()
+	var ruleKey, variant string
+	skipped := false
+	defer func() {
+		span.SetAttributes(attribute.String("authz.decision", metrics.Decision(allow, err)), attribute.String("authz.reason", reason))
+		tracing.End(span, err)
+		recordAudit(ctx, checkFineGrain, req, p, ruleKey, auditDecision(skipped, allow, err), reason, checkStart)
+		noteSkipped(ctx, skipped)
+		observeVariant(checkFineGrain, variant, auditDecision(skipped, allow, err))
+	}()
+
 	c := ConfigOrNil()
-	if c == nil || !c.FineGrain.Enabled || c.FineGrain.ValidationURL == "" {
+	if c == nil || !c.FineGrain.Enabled || (c.FineGrain.ValidationURL == "" && len(c.FineGrain.forTenant(req.Tenant).programs) == 0) {
+		metrics.AuthzDecisions.WithLabelValues(checkFineGrain, "skip").Inc()
+		skipped = true
 		return true, "fine-grain check skipped (no config)", nil
 	}
-	rule, ok := c.FineGrain.MatchRule(req.Method, req.Path)
+	// a tenant's requests see its rules; principals in a canary see its validation URL and rules
+	conf, variant := c.FineGrain.forTenant(req.Tenant).variant(p)
+	ruleKey, rule, ok := conf.matchRule(req.Host, req.Method, req.Path)
 	if !ok {
+		if conf.DefaultAction == DefaultActionDeny {
+			metrics.AuthzDecisions.WithLabelValues(checkFineGrain, "deny").Inc()
+			return false, "fine-grain check denied (no matching rule)", nil
+		}
+		metrics.AuthzDecisions.WithLabelValues(checkFineGrain, "skip").Inc()
+		skipped = true
 		// By default, if no fine-grain rule matches, allow and proceed
 		return true, "fine-grain check skipped (no matching rule)", nil
 	}
+	noteDenyResponse(ctx, rule.DenyResponse)
+	// The role gate is enforced locally; the validation service is only asked once it passes
+	if !hasAnyRole(p, rule.Roles) {
+		metrics.AuthzDecisions.WithLabelValues(checkFineGrain, "deny").Inc()
+		return false, "fine-grain check denied (missing role)", nil
+	}
+	if prg, local := conf.programs[ruleKey]; local {
+		allow, err = evalExpression(prg, req, p)
+		metrics.AuthzDecisions.WithLabelValues(checkFineGrain, metrics.Decision(allow, err)).Inc()
+		if err == nil && !allow {
+			reason = "fine-grain check denied (expression)"
+		}
+		return allow, reason, err
+	}
+	if conf.ValidationURL == "" {
+		metrics.AuthzDecisions.WithLabelValues(checkFineGrain, "skip").Inc()
+		skipped = true
+		return true, "fine-grain check skipped (rule has no expression and no validation-url)", nil
+	}
+	attributes, headers := conf.PrincipalClaims.resolve(req.Claims)
 	payload := finePayload{
-		Principal: p,
-		Request:   req,
-		Rule:      rule,
+		Principal:  p,
+		Request:    req,
+		Rule:       rule,
+		Values:     extractValues(conf.paths[ruleKey], req, pathParams(ruleKey, req.Path)),
+		Attributes: attributes,
+		Meta:       mergeMeta(conf.Meta, rule.Meta),
+	}
+	if conf.decisions != nil {
+		if key, err := conf.decisionKey(payload, headers); err == nil {
+			if vr, ok := conf.decisions.lookup(checkFineGrain, key); ok {
+				metrics.AuthzDecisions.WithLabelValues(checkFineGrain, metrics.Decision(vr.Allow, nil)).Inc()
+				collectObligations(ctx, vr)
+				return vr.Allow, vr.Reason, nil
+			}
+		}
 	}
-	return postFineGrainCheck(c.FineGrain, payload)
+	return callValidation(ctx, checkFineGrain, conf.policy(), func(ctx context.Context) (bool, string, error) {
+		return postFineGrainCheck(ctx, conf, payload, headers)
+	})
 }
 
-func postFineGrainCheck(conf FineGrainConfig, payload finePayload) (bool, string, error) {
-	contentByteArray, err := json.Marshal(payload)
-	if err != nil {
-		return false, "", err
+// hasAnyRole reports whether the principal holds at least one of the roles; an empty list requires none
+func hasAnyRole(p jwtauth.Principal, roles []string) bool {
+	if len(roles) == 0 {
+		return true
 	}
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
 
-	req, err := http.NewRequest(http.MethodPost, conf.ValidationURL, bytes.NewReader(contentByteArray))
-
-	if err != nil {
-		return false, "", err
+// mergeMeta overlays a rule's meta fields on the section's
+func mergeMeta(section, rule map[string]any) map[string]any {
+	if len(rule) == 0 {
+		return section
 	}
-	req.Header.Set("Content-Type", "application/json")
-	if conf.ClientAuthMethod == "client_secret_basic" && conf.ClientID != "" {
-		req.SetBasicAuth(conf.ClientID, conf.ClientSecret)
-	} else if conf.ClientAuthMethod != "" && conf.ClientAuthMethod != "client_secret_basic" {
-		return false, "", fmt.Errorf("unsupported client auth method: %s", conf.ClientAuthMethod)
+	if len(section) == 0 {
+		return rule
 	}
-	resp, err := httpClient.Do(req)
+	merged := maps.Clone(section)
+	maps.Copy(merged, rule)
+	return merged
+}
 
+func postFineGrainCheck(ctx context.Context, conf FineGrainConfig, payload finePayload, headers http.Header) (bool, string, error) {
+	vr, err := postValidation(ctx, conf.ValidationURL, conf.clientAuth(), payload, headers)
 	if err != nil {
-		return false, "", err
+		return false, failureReason(err), err
 	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return false, "non-2xx from validation service", errors.New(resp.Status)
+	if f := vr.ResponseFilter; f != nil && (len(f.Allow) > 0 || len(f.Mask) > 0) {
+		vr.Obligations = append(vr.Obligations, f.obligation())
 	}
-
-	var vr validationResponse
-
-	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
-		return false, "", err
+	if conf.decisions != nil {
+		if key, err := conf.decisionKey(payload, headers); err == nil {
+			conf.decisions.store(key, vr)
+		}
 	}
+	collectObligations(ctx, vr)
 
 	return vr.Allow, vr.Reason, nil
 }
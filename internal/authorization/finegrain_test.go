@@ -1,20 +1,22 @@
 package authorization
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"reverseProxy/internal/jwtauth"
 )
 
 func TestCheckFineGrain_SkipWhenNoConfig(t *testing.T) {
-	old := cfg
-	cfg = nil
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(nil)
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckFineGrainAccess(RequestInfo{Method: "GET", Path: "/x"}, jwtauth.Principal{})
+	allow, reason, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauth.Principal{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -24,10 +26,10 @@ func TestCheckFineGrain_SkipWhenNoConfig(t *testing.T) {
 }
 
 func TestCheckFineGrain_SkipWhenNoURL(t *testing.T) {
-	old := cfg
-	cfg = &Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: ""}}
-	t.Cleanup(func() { cfg = old })
-	allow, reason, err := CheckFineGrainAccess(RequestInfo{}, jwtauth.Principal{})
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: ""}})
+	t.Cleanup(func() { cfg.Store(old) })
+	allow, reason, err := CheckFineGrainAccess(context.Background(), RequestInfo{}, jwtauth.Principal{})
 	if err != nil || !allow || reason == "" {
 		t.Fatalf("expected skip allow when URL empty, got allow=%v reason=%q err=%v", allow, reason, err)
 	}
@@ -43,15 +45,15 @@ func TestCheckFineGrain_Allow(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{
 		"[/items:POST]": {Roles: []string{"ROLE_USER"}, RulesetName: "rs", RulesetID: "1", Body: map[string]string{"username": "$.username"}},
-	}}}
-	t.Cleanup(func() { cfg = old })
+	}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
 	req := RequestInfo{Method: "POST", Path: "/items"}
-	p := jwtauth.Principal{UserID: "u1", Username: "alice", Email: "a@example.com"}
-	allow, reason, err := CheckFineGrainAccess(req, p)
+	p := jwtauth.Principal{UserID: "u1", Username: "alice", Email: "a@example.com", Roles: []string{"ROLE_USER"}}
+	allow, reason, err := CheckFineGrainAccess(context.Background(), req, p)
 	if err != nil || !allow || reason != "ok" {
 		t.Fatalf("unexpected result allow=%v reason=%q err=%v", allow, reason, err)
 	}
@@ -60,17 +62,44 @@ func TestCheckFineGrain_Allow(t *testing.T) {
 	}
 }
 
+func TestCheckFineGrain_RoleGate(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{
+		"[/admin/**]": {Roles: []string{"ROLE_ADMIN", "ROLE_OPS"}},
+	}}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	req := RequestInfo{Method: "DELETE", Path: "/admin/users/1"}
+	allow, reason, err := CheckFineGrainAccess(context.Background(), req, jwtauth.Principal{UserID: "u1", Roles: []string{"ROLE_USER"}})
+	if err != nil || allow || reason != "fine-grain check denied (missing role)" {
+		t.Fatalf("expected a local deny, got allow=%v reason=%q err=%v", allow, reason, err)
+	}
+	if calls != 0 {
+		t.Fatalf("validation service should not be called when the role gate fails, got %d calls", calls)
+	}
+	if allow, _, err := CheckFineGrainAccess(context.Background(), req, jwtauth.Principal{UserID: "u2", Roles: []string{"ROLE_OPS"}}); err != nil || !allow || calls != 1 {
+		t.Fatalf("expected the remote check once the role gate passes, got allow=%v err=%v calls=%d", allow, err, calls)
+	}
+}
+
 func TestCheckFineGrain_Deny(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(validationResponse{Allow: false, Reason: "blocked"})
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckFineGrainAccess(RequestInfo{}, jwtauth.Principal{})
+	allow, reason, err := CheckFineGrainAccess(context.Background(), RequestInfo{}, jwtauth.Principal{})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -79,17 +108,29 @@ func TestCheckFineGrain_Deny(t *testing.T) {
 	}
 }
 
+func TestCheckFineGrain_DefaultActionDeny(t *testing.T) {
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: "http://127.0.0.1:0", DefaultAction: DefaultActionDeny,
+		ResourceMap: map[string]FineRule{"[/orders/**]": {}}}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	allow, reason, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/admin"}, jwtauth.Principal{})
+	if err != nil || allow || reason != "fine-grain check denied (no matching rule)" {
+		t.Fatalf("expected deny for an unmatched route, got allow=%v reason=%q err=%v", allow, reason, err)
+	}
+}
+
 func TestCheckFineGrain_Non2xx(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "boom", http.StatusBadGateway)
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, reason, err := CheckFineGrainAccess(RequestInfo{}, jwtauth.Principal{})
+	allow, reason, err := CheckFineGrainAccess(context.Background(), RequestInfo{}, jwtauth.Principal{})
 	if err == nil || allow || reason == "" {
 		t.Fatalf("expected error, allow=false, and non-empty reason for non-2xx")
 	}
@@ -102,12 +143,46 @@ func TestCheckFineGrain_BadJSON(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	old := cfg
-	cfg = &Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}}
-	t.Cleanup(func() { cfg = old })
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/]": {}}}})
+	t.Cleanup(func() { cfg.Store(old) })
 
-	allow, _, err := CheckFineGrainAccess(RequestInfo{}, jwtauth.Principal{})
+	allow, _, err := CheckFineGrainAccess(context.Background(), RequestInfo{}, jwtauth.Principal{})
 	if err == nil || allow {
 		t.Fatalf("expected decode error and allow=false")
 	}
 }
+
+func TestCheckFineGrain_SendsMeta(t *testing.T) {
+	var seen map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Meta map[string]any `json:"meta"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		seen = payload.Meta
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	y := "finegrain-check:\n  enabled: true\n  validation-url: " + srv.URL + "\n" +
+		"  meta:\n    entityTypeId: user\n    runtimeFineTune:\n      combinedMultiValue: false\n" +
+		"  resource-map:\n    \"[/accounts]\": {}\n" +
+		"    \"[/payments]\":\n      meta:\n        runtimeFineTune:\n          combinedMultiValue: true\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	for path, want := range map[string]map[string]any{
+		"/accounts": {"entityTypeId": "user", "runtimeFineTune": map[string]any{"combinedMultiValue": false}},
+		"/payments": {"entityTypeId": "user", "runtimeFineTune": map[string]any{"combinedMultiValue": true}},
+	} {
+		if allow, _, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: path}, jwtauth.Principal{}); err != nil || !allow {
+			t.Fatalf("%s: expected allow, got %v %v", path, allow, err)
+		}
+		if !reflect.DeepEqual(seen, want) {
+			t.Errorf("%s: expected meta %v, got %v", path, want, seen)
+		}
+	}
+}
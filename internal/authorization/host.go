@@ -0,0 +1,41 @@
+package authorization
+
+import (
+	"net"
+	"strings"
+)
+
+// hostBound ranks resource-map keys bound to the request host above host-less keys, whatever
+// their paths, as routes bound to a host win over host-less routes
+const hostBound = 1 << 16
+
+// MatchHost reports whether a request host matches a host pattern; "*.example.com" matches any
+// subdomain. Ports are ignored, so a Host or :authority of api.example.com:8443 matches api.example.com.
+func MatchHost(pattern, host string) bool {
+	pattern, host = strings.ToLower(stripPort(pattern)), strings.ToLower(stripPort(host))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+// stripPort drops the port of a host and the brackets of an IPv6 literal
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// splitHost separates the host a pattern is bound to from its path: "api.example.com/orders/**"
+// and "api.example.com~^/orders$" are bound to api.example.com, "/orders/**" to any host
+func splitHost(pattern string) (host, rest string) {
+	if strings.HasPrefix(pattern, "/") || isRegexPattern(pattern) {
+		return "", pattern
+	}
+	i := strings.IndexAny(pattern, "/"+regexPrefix)
+	if i <= 0 {
+		return "", pattern
+	}
+	return pattern[:i], pattern[i:]
+}
@@ -0,0 +1,52 @@
+package authorization
+
+import "testing"
+
+func TestMatchHost(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, host string
+		want          bool
+	}{
+		{"api.example.com", "API.example.com", true},
+		{"api.example.com", "api.example.com:8443", true},
+		{"*.example.com", "eu.api.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"api.example.com", "web.example.com", false},
+		{"[::1]", "[::1]:3001", true},
+	} {
+		if got := MatchHost(tc.pattern, tc.host); got != tc.want {
+			t.Errorf("MatchHost(%q, %q) = %v, want %v", tc.pattern, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestHostBoundResourceMapKeys(t *testing.T) {
+	c := CoarseConfig{ResourceMap: map[string]CoarseResource{
+		"[/orders/**]":                       {Resource: "shared"},
+		"[/orders/{id}:GET]":                 {Resource: "shared-read"},
+		"[shop.example.com/orders/**]":       {Resource: "shop"},
+		"[*.partners.example.com/**:POST]":   {Resource: "partners"},
+		"[admin.example.com~^/orders/\\d+$]": {Resource: "admin"},
+	}}
+	for _, tc := range []struct {
+		host, method, path, want string
+	}{
+		{"api.example.com", "GET", "/orders/1", "shared-read"},
+		{"shop.example.com", "GET", "/orders/1", "shop"},
+		{"shop.example.com:443", "DELETE", "/orders/1", "shop"},
+		{"acme.partners.example.com", "POST", "/orders/1", "partners"},
+		{"acme.partners.example.com", "GET", "/orders/1", "shared-read"},
+		{"admin.example.com", "GET", "/orders/17", "admin"},
+		{"admin.example.com", "GET", "/orders/x/y", "shared"},
+	} {
+		if got, _ := c.MatchResource(tc.host, tc.method, tc.path); got != tc.want {
+			t.Errorf("MatchResource(%s %s %s) = %q, want %q", tc.host, tc.method, tc.path, got, tc.want)
+		}
+	}
+	if err := ValidatePattern("docs.example.com/**:GET"); err != nil {
+		t.Errorf("unexpected error for a host-bound pattern: %v", err)
+	}
+	if err := ValidatePattern("docs.example.com"); err == nil {
+		t.Error("expected an error for a host without a path")
+	}
+}
@@ -0,0 +1,221 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ohler55/ojg/jp"
+)
+
+// Sources a FineRule body entry can read from besides the JSON body
+const (
+	sourceBody   = ""
+	sourcePath   = "$path."
+	sourceHeader = "$header."
+	sourceQuery  = "$query."
+)
+
+// bodyPath is a compiled FineRule body entry. A plain JSONPath ($.a.b, $.items[0], $..id,
+// $.accounts[?(@.type == 'savings')].id) extracts values from the JSON body; $path.<name> reads a
+// {name} segment of the matched resource-map key, $header.<Name> a request header and $query.<name>
+// a query parameter, as set by query-values. A path starting with / is an XPath-lite selector over
+// an XML body (see xpathExpr). exists(<path>) only reports whether it matches.
+type bodyPath struct {
+	source string
+	// name is the parameter read from a non-body source
+	name   string
+	expr   jp.Expr
+	xpath  xpathExpr
+	exists bool
+	// join, when set, joins the values of a repeated query parameter into one string
+	join string
+	// definite paths select at most one value and extract it as is; others always extract an array
+	definite bool
+}
+
+// compileBodyPaths parses the body paths of every fine-grain rule
+func (f *FineGrainConfig) compileBodyPaths() error {
+	f.paths = nil
+	switch f.QueryValues {
+	case "", QueryValuesFirst, QueryValuesAll, QueryValuesJoin:
+	default:
+		return fmt.Errorf("%s: query-values must be first, all or join, got %q", checkFineGrain, f.QueryValues)
+	}
+	for key, rule := range f.ResourceMap {
+		for field, raw := range rule.Body {
+			bp, err := parseBodyPath(raw)
+			if err != nil {
+				return fmt.Errorf("%s: rule %s: body %s: %w", checkFineGrain, key, field, err)
+			}
+			if bp.source == sourceQuery {
+				bp.queryValues(f.QueryValues, f.QuerySeparator)
+			}
+			if f.paths == nil {
+				f.paths = make(map[string]map[string]bodyPath)
+			}
+			if f.paths[key] == nil {
+				f.paths[key] = make(map[string]bodyPath, len(rule.Body))
+			}
+			f.paths[key][field] = bp
+		}
+	}
+	return nil
+}
+
+// queryValues applies query-values to a $query path: all extracts every value as an array, like an
+// indefinite JSONPath, and join extracts them as one string
+func (bp *bodyPath) queryValues(mode, separator string) {
+	switch mode {
+	case QueryValuesAll:
+		bp.definite = false
+	case QueryValuesJoin:
+		bp.join = separator
+		if bp.join == "" {
+			bp.join = ","
+		}
+	}
+}
+
+func parseBodyPath(raw string) (bodyPath, error) {
+	s := strings.TrimSpace(raw)
+	var bp bodyPath
+	if inner, ok := strings.CutPrefix(s, "exists("); ok && strings.HasSuffix(inner, ")") {
+		bp.exists = true
+		s = strings.TrimSpace(strings.TrimSuffix(inner, ")"))
+	}
+	for _, source := range []string{sourcePath, sourceHeader, sourceQuery} {
+		if name, ok := strings.CutPrefix(s, source); ok {
+			if name == "" {
+				return bodyPath{}, fmt.Errorf("%q names no parameter", raw)
+			}
+			bp.source, bp.name, bp.definite = source, name, true
+			return bp, nil
+		}
+	}
+	if strings.HasPrefix(s, sourceXML) {
+		xp, err := parseXPath(s)
+		if err != nil {
+			return bodyPath{}, err
+		}
+		bp.source, bp.xpath, bp.definite = sourceXML, xp, xp.definite()
+		return bp, nil
+	}
+	if !strings.HasPrefix(s, "$") {
+		return bodyPath{}, fmt.Errorf("%q is not a JSONPath starting with $ or an XPath starting with /", raw)
+	}
+	expr, err := jp.ParseString(s)
+	if err != nil {
+		return bodyPath{}, err
+	}
+	bp.expr = expr
+	bp.definite = true
+	for _, frag := range expr {
+		switch frag.(type) {
+		case jp.Root, jp.At, jp.Child, jp.Nth:
+		default:
+			bp.definite = false
+		}
+	}
+	return bp, nil
+}
+
+// extractValues evaluates a rule's body paths against the request and the matched path parameters.
+// A definite path that matches nothing extracts null; body paths extract nothing without a JSON body,
+// and XPaths nothing without a well-formed XML body.
+func extractValues(paths map[string]bodyPath, req RequestInfo, params map[string]string) map[string]any {
+	if len(paths) == 0 {
+		return nil
+	}
+	var doc any
+	hasDoc := len(req.Body) > 0 && json.Unmarshal(req.Body, &doc) == nil
+	query := requestQuery(req)
+	// the XML body is parsed on first use
+	var xmlDoc *xmlNode
+	xmlParsed := false
+	values := make(map[string]any, len(paths))
+	for field, bp := range paths {
+		var matches []any
+		switch bp.source {
+		case sourcePath:
+			if v, ok := params[bp.name]; ok {
+				matches = []any{v}
+			}
+		case sourceHeader:
+			if v, ok := headerValue(req.Headers, bp.name); ok {
+				matches = []any{v}
+			}
+		case sourceQuery:
+			switch vs := query[bp.name]; {
+			case len(vs) == 0:
+			case bp.join != "":
+				matches = []any{strings.Join(vs, bp.join)}
+			default:
+				for _, v := range vs {
+					matches = append(matches, v)
+				}
+			}
+		case sourceXML:
+			if !xmlParsed {
+				xmlParsed = true
+				if len(req.XMLBody) > 0 {
+					xmlDoc, _ = parseXML(req.XMLBody)
+				}
+			}
+			if xmlDoc == nil {
+				continue
+			}
+			matches = bp.xpath.eval(xmlDoc)
+		default:
+			if !hasDoc {
+				continue
+			}
+			matches = bp.expr.Get(doc)
+		}
+		switch {
+		case bp.exists:
+			values[field] = len(matches) > 0
+		case bp.definite && len(matches) == 0:
+			values[field] = nil
+		case bp.definite:
+			values[field] = matches[0]
+		default:
+			if matches == nil {
+				matches = []any{}
+			}
+			values[field] = matches
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// headerValue looks a header up case-insensitively
+func headerValue(headers map[string]string, name string) (string, bool) {
+	if v, ok := headers[http.CanonicalHeaderKey(name)]; ok {
+		return v, true
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// requestQuery parses the query string of the request's full URL, falling back to its path
+func requestQuery(req RequestInfo) url.Values {
+	target := req.FullURL
+	if target == "" {
+		target = req.Path
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return url.Values{}
+	}
+	return u.Query()
+}
@@ -0,0 +1,177 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestExtractValues(t *testing.T) {
+	body := json.RawMessage(`{
+		"username": "alice",
+		"accounts": [
+			{"id": "a1", "type": "savings", "owner": {"id": "o1"}},
+			{"id": "a2", "type": "checking", "owner": {"id": "o2"}},
+			{"id": "a3", "type": "savings"}
+		]
+	}`)
+	paths := map[string]string{
+		"username":   "$.username",
+		"first":      "$.accounts[0].id",
+		"savings":    "$.accounts[?(@.type == 'savings')].id",
+		"owners":     "$..owner.id",
+		"types":      "$.accounts[*].type",
+		"missing":    "$.nickname",
+		"none":       "$.accounts[?(@.type == 'loan')].id",
+		"hasOwner":   "exists($.accounts[0].owner)",
+		"hasBalance": "exists($..balance)",
+	}
+	compiled := make(map[string]bodyPath, len(paths))
+	for field, raw := range paths {
+		bp, err := parseBodyPath(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		compiled[field] = bp
+	}
+
+	want := map[string]any{
+		"username":   "alice",
+		"first":      "a1",
+		"savings":    []any{"a1", "a3"},
+		"owners":     []any{"o1", "o2"},
+		"types":      []any{"savings", "checking", "savings"},
+		"missing":    nil,
+		"none":       []any{},
+		"hasOwner":   true,
+		"hasBalance": false,
+	}
+	if got := extractValues(compiled, RequestInfo{Body: body}, nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected values:\n got %#v\nwant %#v", got, want)
+	}
+	if got := extractValues(compiled, RequestInfo{}, nil); got != nil {
+		t.Fatalf("expected no values without a body, got %v", got)
+	}
+}
+
+func TestExtractValues_PathParams(t *testing.T) {
+	compiled := map[string]bodyPath{}
+	for field, raw := range map[string]string{"accountId": "$path.accountId", "other": "$path.other", "hasId": "exists($path.accountId)"} {
+		bp, err := parseBodyPath(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		compiled[field] = bp
+	}
+	want := map[string]any{"accountId": "a1", "other": nil, "hasId": true}
+	if got := extractValues(compiled, RequestInfo{}, map[string]string{"accountId": "a1"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected values %#v", got)
+	}
+}
+
+func TestExtractValues_HeaderAndQuery(t *testing.T) {
+	compiled := map[string]bodyPath{}
+	for field, raw := range map[string]string{
+		"channel":  "$header.x-channel",
+		"limit":    "$query.limit",
+		"tag":      "$query.tag",
+		"cursor":   "$query.cursor",
+		"hasTrace": "exists($header.X-Trace)",
+	} {
+		bp, err := parseBodyPath(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		compiled[field] = bp
+	}
+	req := RequestInfo{
+		Path:    "/items",
+		FullURL: "http://svc/items?limit=10&tag=a&tag=b",
+		Headers: map[string]string{"X-Channel": "mobile"},
+	}
+	want := map[string]any{"channel": "mobile", "limit": "10", "tag": "a", "cursor": nil, "hasTrace": false}
+	if got := extractValues(compiled, req, nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected values %#v", got)
+	}
+}
+
+func TestExtractValues_RepeatedQuery(t *testing.T) {
+	req := RequestInfo{Path: "/items", FullURL: "http://svc/items?tag=a&tag=b&limit=10"}
+	for mode, want := range map[string]map[string]any{
+		"":               {"tag": "a", "limit": "10", "cursor": nil},
+		QueryValuesFirst: {"tag": "a", "limit": "10", "cursor": nil},
+		QueryValuesAll:   {"tag": []any{"a", "b"}, "limit": []any{"10"}, "cursor": []any{}},
+		QueryValuesJoin:  {"tag": "a|b", "limit": "10", "cursor": nil},
+	} {
+		f := FineGrainConfig{QueryValues: mode, QuerySeparator: "|", ResourceMap: map[string]FineRule{
+			"[/items]": {Body: map[string]string{"tag": "$query.tag", "limit": "$query.limit", "cursor": "$query.cursor"}},
+		}}
+		if err := f.compileBodyPaths(); err != nil {
+			t.Fatalf("%q: %v", mode, err)
+		}
+		if got := extractValues(f.paths["[/items]"], req, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: unexpected values %#v", mode, got)
+		}
+	}
+
+	f := FineGrainConfig{QueryValues: "last"}
+	if err := f.compileBodyPaths(); err == nil {
+		t.Fatalf("expected an error for an unknown query-values")
+	}
+}
+
+func TestParseBodyPath_Invalid(t *testing.T) {
+	for _, raw := range []string{"username", "$.accounts[", "exists(username)", "$path.", "$header."} {
+		if _, err := parseBodyPath(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestCheckFineGrain_SendsExtractedValues(t *testing.T) {
+	var seen map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Values map[string]any `json:"values"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		seen = payload.Values
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	y := "finegrain-check:\n" +
+		"  enabled: true\n" +
+		"  validation-url: " + srv.URL + "\n" +
+		"  resource-map:\n" +
+		"    \"[/transfer:POST]\":\n" +
+		"      body:\n" +
+		"        from: $.from.account\n" +
+		"        amounts: $.lines[*].amount\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+
+	req := RequestInfo{Method: "POST", Path: "/transfer", Body: json.RawMessage(`{"from":{"account":"a1"},"lines":[{"amount":5},{"amount":7}]}`)}
+	if allow, _, err := CheckFineGrainAccess(context.Background(), req, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Fatalf("expected allow, got %v %v", allow, err)
+	}
+	want := map[string]any{"from": "a1", "amounts": []any{5.0, 7.0}}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("expected values %v, got %v", want, seen)
+	}
+}
+
+func TestLoad_RejectsInvalidBodyPath(t *testing.T) {
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	y := "finegrain-check:\n  enabled: true\n  validation-url: http://pdp\n  resource-map:\n    \"[/x]\":\n      body:\n        a: \"$.items[\"\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err == nil {
+		t.Fatal("expected an invalid body path to be rejected")
+	}
+}
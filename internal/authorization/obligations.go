@@ -0,0 +1,85 @@
+package authorization
+
+import (
+	"context"
+	"sync"
+)
+
+// Obligation is an instruction a validation service attaches to an allow decision. Obligations
+// must be fulfilled for the allow to stand; advice is applied when supported and otherwise ignored.
+type Obligation struct {
+	Type   string         `json:"type"`
+	Params map[string]any `json:"params,omitempty"`
+	// Advice marks entries that came from the advice array
+	Advice bool `json:"-"`
+}
+
+// ObligationFilterResponse is the obligation a fine-grain response_filter is turned into
+const ObligationFilterResponse = "filter-response"
+
+// ResponseFilter lists what the client may see of a JSON response. Allow keeps only the given
+// dotted field paths (arrays are traversed, so items.id keeps the id of every item); Mask removes
+// the given JSONPaths. Both may be combined, allow applying first.
+type ResponseFilter struct {
+	Allow []string `json:"allow,omitempty"`
+	Mask  []string `json:"mask,omitempty"`
+}
+
+func (f ResponseFilter) obligation() Obligation {
+	params := map[string]any{}
+	if len(f.Allow) > 0 {
+		params["allow"] = toAny(f.Allow)
+	}
+	if len(f.Mask) > 0 {
+		params["mask"] = toAny(f.Mask)
+	}
+	return Obligation{Type: ObligationFilterResponse, Params: params}
+}
+
+// toAny converts to the shape JSON-decoded obligation params have
+func toAny(list []string) []any {
+	out := make([]any, len(list))
+	for i, s := range list {
+		out[i] = s
+	}
+	return out
+}
+
+type obligationsKey struct{}
+
+// obligationSet collects obligations from the checks running concurrently for one request
+type obligationSet struct {
+	mu   sync.Mutex
+	list []Obligation
+}
+
+// WithObligations returns a context that collects the obligations and advice returned by the checks run with it
+func WithObligations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, obligationsKey{}, &obligationSet{})
+}
+
+// Obligations returns the obligations and advice collected in ctx, in arrival order
+func Obligations(ctx context.Context) []Obligation {
+	set, _ := ctx.Value(obligationsKey{}).(*obligationSet)
+	if set == nil {
+		return nil
+	}
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	return append([]Obligation(nil), set.list...)
+}
+
+// collectObligations records the obligations and advice of an allowing validation response
+func collectObligations(ctx context.Context, vr validationResponse) {
+	set, _ := ctx.Value(obligationsKey{}).(*obligationSet)
+	if set == nil || !vr.Allow || len(vr.Obligations)+len(vr.Advice) == 0 {
+		return
+	}
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.list = append(set.list, vr.Obligations...)
+	for _, a := range vr.Advice {
+		a.Advice = true
+		set.list = append(set.list, a)
+	}
+}
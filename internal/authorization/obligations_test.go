@@ -0,0 +1,70 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCoarse_CollectsObligations(t *testing.T) {
+	var decision validationResponse
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(decision)
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	cfg.Store(&Config{Coarse: CoarseConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]CoarseResource{"[/**]": {Resource: "/api"}}}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	decision = validationResponse{
+		Allow:       true,
+		Obligations: []Obligation{{Type: "add-request-header", Params: map[string]any{"name": "X-Scope", "value": "eu"}}},
+		Advice:      []Obligation{{Type: "log"}},
+	}
+	ctx := WithObligations(context.Background())
+	if _, _, err := CheckCoarseAccess(ctx, RequestInfo{Path: "/x"}, jwtauthPrincipalForTest()); err != nil {
+		t.Fatal(err)
+	}
+	got := Obligations(ctx)
+	if len(got) != 2 || got[0].Type != "add-request-header" || got[0].Advice || got[0].Params["value"] != "eu" || got[1].Type != "log" || !got[1].Advice {
+		t.Fatalf("unexpected obligations %+v", got)
+	}
+
+	decision = validationResponse{Allow: false, Obligations: []Obligation{{Type: "ignored"}}}
+	ctx = WithObligations(context.Background())
+	if _, _, err := CheckCoarseAccess(ctx, RequestInfo{Path: "/x"}, jwtauthPrincipalForTest()); err != nil {
+		t.Fatal(err)
+	}
+	if got := Obligations(ctx); len(got) != 0 {
+		t.Fatalf("obligations of a deny should not be collected, got %+v", got)
+	}
+	if got := Obligations(context.Background()); got != nil {
+		t.Fatalf("expected no obligations without a collector, got %+v", got)
+	}
+}
+
+func TestCheckFineGrain_ResponseFilterBecomesObligation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"allow":true,"response_filter":{"allow":["id","items.name"],"mask":["$..secret"]}}`))
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	cfg.Store(&Config{FineGrain: FineGrainConfig{Enabled: true, ValidationURL: srv.URL, ResourceMap: map[string]FineRule{"[/**]": {}}}})
+	t.Cleanup(func() { cfg.Store(old) })
+
+	ctx := WithObligations(context.Background())
+	if allow, _, err := CheckFineGrainAccess(ctx, RequestInfo{Method: "GET", Path: "/orders"}, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Fatalf("expected allow, got %v %v", allow, err)
+	}
+	got := Obligations(ctx)
+	if len(got) != 1 || got[0].Type != ObligationFilterResponse || got[0].Advice {
+		t.Fatalf("expected a filter-response obligation, got %+v", got)
+	}
+	if allow, _ := got[0].Params["allow"].([]any); len(allow) != 2 || allow[1] != "items.name" {
+		t.Fatalf("unexpected params %+v", got[0].Params)
+	}
+}
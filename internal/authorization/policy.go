@@ -0,0 +1,129 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+	"go.opentelemetry.io/otel/attribute"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/tracing"
+)
+
+// PolicyConfig evaluates Rego policies in-process, in addition to or instead of the validation services
+type PolicyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Files are the Rego modules to load, read on each config load
+	Files []string `yaml:"files"`
+	// Query is the decision evaluated per request (default DefaultPolicyQuery). It must produce a
+	// boolean, or an object with a boolean allow and an optional reason.
+	Query string `yaml:"query"`
+	// Mode is enforce (default) or monitor, which logs and meters decisions without blocking
+	Mode string `yaml:"mode"`
+
+	prepared *rego.PreparedEvalQuery
+}
+
+// DefaultPolicyQuery is evaluated when policy.query is not configured
+const DefaultPolicyQuery = "data.sidecar.authz.allow"
+
+const checkPolicy = "policy"
+
+// policyInput is the document policies see as input
+type policyInput struct {
+	Principal jwtauth.Principal `json:"principal"`
+	Request   RequestInfo       `json:"request"`
+}
+
+// prepare compiles the policy modules and query
+func (pc *PolicyConfig) prepare() error {
+	if len(pc.Files) == 0 {
+		return errors.New("policy: at least one file is required")
+	}
+	query := pc.Query
+	if query == "" {
+		query = DefaultPolicyQuery
+	}
+	opts := []func(*rego.Rego){rego.Query(query)}
+	for _, f := range pc.Files {
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("policy: %w", err)
+		}
+		opts = append(opts, rego.Module(filepath.Base(f), string(src)))
+	}
+	prepared, err := rego.New(opts...).PrepareForEval(context.Background())
+	if err != nil {
+		return fmt.Errorf("policy: %w", err)
+	}
+	pc.prepared = &prepared
+	return nil
+}
+
+// CheckPolicy evaluates the local Rego policy for a request.
+// Returns (allow, reason, error). If the policy is not enabled, it returns allow=true.
+func CheckPolicy(ctx context.Context, req RequestInfo, p jwtauth.Principal) (allow bool, reason string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "authz."+checkPolicy)
+	checkStart := time.Now()
+	skipped := false
+	defer func() {
+		span.SetAttributes(attribute.String("authz.decision", metrics.Decision(allow, err)), attribute.String("authz.reason", reason))
+		tracing.End(span, err)
+		recordAudit(ctx, checkPolicy, req, p, "", auditDecision(skipped, allow, err), reason, checkStart)
+		noteSkipped(ctx, skipped)
+	}()
+
+	c := ConfigOrNil()
+	if c == nil || c.Policy == nil || !c.Policy.Enabled || c.Policy.prepared == nil {
+		metrics.AuthzDecisions.WithLabelValues(checkPolicy, "skip").Inc()
+		skipped = true
+		return true, "policy check skipped (no config)", nil
+	}
+	allow, reason, err = evalPolicy(ctx, *c.Policy.prepared, policyInput{Principal: p, Request: req})
+	observeValidation(checkPolicy, checkStart, allow, err)
+	return allow, reason, err
+}
+
+func evalPolicy(ctx context.Context, pq rego.PreparedEvalQuery, in policyInput) (bool, string, error) {
+	// round-trip through JSON so the policy sees the same document the validation services receive
+	b, err := json.Marshal(in)
+	if err != nil {
+		return false, "", err
+	}
+	var input any
+	if err := json.Unmarshal(b, &input); err != nil {
+		return false, "", err
+	}
+	rs, err := pq.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, "", err
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return false, "policy check denied (undefined decision)", nil
+	}
+	switch v := rs[0].Expressions[0].Value.(type) {
+	case bool:
+		if !v {
+			return false, "policy check denied", nil
+		}
+		return true, "", nil
+	case map[string]any:
+		allow, ok := v["allow"].(bool)
+		if !ok {
+			return false, "", errors.New("policy decision has no boolean allow")
+		}
+		reason, _ := v["reason"].(string)
+		if !allow && reason == "" {
+			reason = "policy check denied"
+		}
+		return allow, reason, nil
+	}
+	return false, "", fmt.Errorf("policy decision must be a boolean or an object, got %T", rs[0].Expressions[0].Value)
+}
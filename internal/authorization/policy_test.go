@@ -0,0 +1,92 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+const testPolicy = `package sidecar.authz
+
+default allow := false
+
+allow if {
+	input.principal.user_id == "u1"
+	input.request.method == "GET"
+}
+
+allow if {
+	input.request.body.amount < 1000
+}
+
+decision := {"allow": allow, "reason": "amount over limit"}
+`
+
+func loadPolicy(t *testing.T, query string) {
+	t.Helper()
+	dir := t.TempDir()
+	rego := filepath.Join(dir, "authz.rego")
+	if err := os.WriteFile(rego, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	y := "policy:\n  enabled: true\n  files: [\"" + rego + "\"]\n"
+	if query != "" {
+		y += "  query: " + query + "\n"
+	}
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, dir, "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	loadPolicy(t, "")
+	ctx := context.Background()
+
+	if allow, _, err := CheckPolicy(ctx, RequestInfo{Method: "GET", Path: "/x"}, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Errorf("expected u1 GET to be allowed, got %v %v", allow, err)
+	}
+	other := jwtauth.Principal{UserID: "u2"}
+	if allow, _, err := CheckPolicy(ctx, RequestInfo{Method: "GET", Path: "/x"}, other); err != nil || allow {
+		t.Errorf("expected u2 to be denied, got %v %v", allow, err)
+	}
+	small := RequestInfo{Method: "POST", Path: "/pay", Body: json.RawMessage(`{"amount":10}`)}
+	if allow, _, err := CheckPolicy(ctx, small, other); err != nil || !allow {
+		t.Errorf("expected the body rule to allow, got %v %v", allow, err)
+	}
+}
+
+func TestCheckPolicy_ObjectDecision(t *testing.T) {
+	loadPolicy(t, "data.sidecar.authz.decision")
+	allow, reason, err := CheckPolicy(context.Background(), RequestInfo{Method: "POST", Body: json.RawMessage(`{"amount":5000}`)}, jwtauth.Principal{UserID: "u2"})
+	if err != nil || allow || reason != "amount over limit" {
+		t.Errorf("expected denial with the policy's reason, got %v %q %v", allow, reason, err)
+	}
+}
+
+func TestCheckPolicy_SkipWithoutConfig(t *testing.T) {
+	old := cfg.Load()
+	cfg.Store(&Config{})
+	t.Cleanup(func() { cfg.Store(old) })
+	if allow, _, err := CheckPolicy(context.Background(), RequestInfo{}, jwtauthPrincipalForTest()); !allow || err != nil {
+		t.Errorf("expected skip to allow, got %v %v", allow, err)
+	}
+}
+
+func TestLoad_RejectsInvalidPolicy(t *testing.T) {
+	dir := t.TempDir()
+	rego := filepath.Join(dir, "bad.rego")
+	if err := os.WriteFile(rego, []byte("package x\nallow if {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, dir, "auth-*.yaml", "policy:\n  enabled: true\n  files: [\""+rego+"\"]\n")); err == nil {
+		t.Fatalf("expected a compile error")
+	}
+}
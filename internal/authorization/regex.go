@@ -0,0 +1,96 @@
+package authorization
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexPrefix marks a resource-map key (after any [ ]) as a regular expression, anchored to match the
+// whole path, whose named groups become path parameters: "[~^/api/v\d+/orders/(?P<id>[^/]+)$:GET]"
+const regexPrefix = "~"
+
+// regexes caches compiled regex keys by pattern
+var regexes sync.Map
+
+// isRegexPattern reports whether a pattern (without method suffix) is a regex key
+func isRegexPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, regexPrefix)
+}
+
+// compileRegexKey compiles a regex key anchored at both ends, caching the result
+func compileRegexKey(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexes.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(pattern, regexPrefix) + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	regexes.Store(pattern, re)
+	return re, nil
+}
+
+// regexMatch matches a regex key against a path. A regex ranks like a pattern of '{name}'
+// segments spanning the path, below keys with literal segments.
+func regexMatch(pattern, path string) (bool, int) {
+	re, err := compileRegexKey(pattern)
+	if err != nil || !re.MatchString(path) {
+		return false, 0
+	}
+	return true, 2 * len(strings.Split(strings.TrimPrefix(path, "/"), "/"))
+}
+
+// regexParams returns the named groups of a regex key matched against path
+func regexParams(pattern, path string) map[string]string {
+	re, err := compileRegexKey(pattern)
+	if err != nil {
+		return nil
+	}
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return nil
+	}
+	var params map[string]string
+	for i, name := range re.SubexpNames() {
+		if name == "" || i >= len(m) {
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[name] = m[i]
+	}
+	return params
+}
+
+// ValidatePattern checks a resource-map style pattern: regex keys must compile and other
+// patterns must start with '/', after the host they may be bound to
+func ValidatePattern(pattern string) error {
+	pm, _ := splitMethod(normalizePattern(pattern))
+	if isRegexPattern(pm.pattern) {
+		if _, err := compileRegexKey(pm.pattern); err != nil {
+			return fmt.Errorf("%q: %w", pattern, err)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(pm.pattern, "/") {
+		return fmt.Errorf("%q must start with '/' or '%s', optionally after a host", pattern, regexPrefix)
+	}
+	return nil
+}
+
+// validateRegexKeys compiles a section's regex resource-map keys so mistakes fail the load
+func validateRegexKeys[V any](check string, resourceMap map[string]V) error {
+	for key := range resourceMap {
+		pm, _ := splitMethod(normalizePattern(key))
+		if !isRegexPattern(pm.pattern) {
+			continue
+		}
+		if _, err := compileRegexKey(pm.pattern); err != nil {
+			return fmt.Errorf("%s: resource-map key %q: %w", check, key, err)
+		}
+	}
+	return nil
+}
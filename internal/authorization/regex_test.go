@@ -0,0 +1,67 @@
+package authorization
+
+import "testing"
+
+func TestRegexKeys(t *testing.T) {
+	f := FineGrainConfig{ResourceMap: map[string]FineRule{
+		`[~^/api/v(?P<version>\d+)/orders/(?P<orderId>[A-Z]{2}-\d+)$:GET,HEAD]`: {RulesetID: "regex"},
+		"[/api/**]": {RulesetID: "wildcard"},
+		`[~^/files/(?:public|shared)/(?P<name>.+)$]`: {RulesetID: "files"},
+	}}
+	key, rule, ok := f.matchRule("", "GET", "/api/v2/orders/AB-17")
+	if !ok || rule.RulesetID != "regex" {
+		t.Fatalf("expected the regex rule to win over '**', got %q", key)
+	}
+	params := pathParams(key, "/api/v2/orders/AB-17")
+	if params["version"] != "2" || params["orderId"] != "AB-17" {
+		t.Fatalf("unexpected captures %v", params)
+	}
+	if _, rule, _ := f.matchRule("", "POST", "/api/v2/orders/AB-17"); rule.RulesetID != "wildcard" {
+		t.Fatalf("expected the regex method restriction to apply, got %q", rule.RulesetID)
+	}
+	if _, rule, _ := f.matchRule("", "GET", "/api/v2/orders/17"); rule.RulesetID != "wildcard" {
+		t.Fatalf("expected a non-matching regex to fall back, got %q", rule.RulesetID)
+	}
+
+	// ':' inside the regex is not a method suffix
+	key, _, ok = f.matchRule("", "DELETE", "/files/shared/a/b.txt")
+	if !ok || pathParams(key, "/files/shared/a/b.txt")["name"] != "a/b.txt" {
+		t.Fatalf("expected the files regex to match any method, got %q", key)
+	}
+}
+
+func TestRegexKeys_MatchTheWholePath(t *testing.T) {
+	f := FineGrainConfig{ResourceMap: map[string]FineRule{
+		`[~/admin/(?P<id>\d+)]`: {RulesetID: "admin"},
+		"[/**]":                 {RulesetID: "wildcard"},
+	}}
+	if _, rule, _ := f.matchRule("", "GET", "/admin/1"); rule.RulesetID != "admin" {
+		t.Fatalf("expected an unanchored regex to match the whole path, got %q", rule.RulesetID)
+	}
+	for _, path := range []string{"/x/admin/1", "/admin/1/delete"} {
+		if _, rule, _ := f.matchRule("", "GET", path); rule.RulesetID != "wildcard" {
+			t.Errorf("%s: expected the regex not to match part of the path, got %q", path, rule.RulesetID)
+		}
+	}
+}
+
+func TestLoad_RejectsInvalidRegexKey(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	y := "finegrain-check:\n  enabled: true\n  validation-url: http://pdp\n  resource-map:\n    \"[~^/api/(?P<id>[/]+$]\":\n      ruleset-id: x\n"
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err == nil {
+		t.Fatalf("expected an error for an invalid regex key")
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, p := range []string{"/health", `~^/v\d+/status$`, "[/docs/**:GET]"} {
+		if err := ValidatePattern(p); err != nil {
+			t.Errorf("ValidatePattern(%q) = %v", p, err)
+		}
+	}
+	for _, p := range []string{"health", "~^/v(\\d+$"} {
+		if err := ValidatePattern(p); err == nil {
+			t.Errorf("expected ValidatePattern(%q) to fail", p)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// RetryConfig retries failed validation service calls with exponential backoff
+type RetryConfig struct {
+	// Attempts is the number of retries after the first call (0 disables retries)
+	Attempts int `yaml:"attempts"`
+	// Backoff is the delay before the first retry, doubled for each further retry (default 100ms)
+	Backoff time.Duration `yaml:"backoff"`
+	// MaxBackoff caps the delay between retries (default 2s)
+	MaxBackoff time.Duration `yaml:"max-backoff"`
+	// RetryableStatusCodes are the responses worth retrying (default 502, 503, 504); transport errors always are
+	RetryableStatusCodes []int `yaml:"retryable-status-codes"`
+	// Deadline bounds the check's calls including retries and backoff; zero leaves only the client timeout
+	Deadline time.Duration `yaml:"deadline"`
+}
+
+// Retry defaults
+const (
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = 2 * time.Second
+)
+
+// DefaultRetryableStatusCodes are retried when retryable-status-codes is not configured
+var DefaultRetryableStatusCodes = []int{502, 503, 504}
+
+// statusError reports a non-2xx response from a validation service
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string { return e.status }
+
+func (r *RetryConfig) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.Attempts < 0 || r.Backoff < 0 || r.MaxBackoff < 0 || r.Deadline < 0 {
+		return errors.New("retry: values must not be negative")
+	}
+	return nil
+}
+
+// retryable reports whether a failed call may succeed when repeated
+func (r *RetryConfig) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		codes := r.RetryableStatusCodes
+		if len(codes) == 0 {
+			codes = DefaultRetryableStatusCodes
+		}
+		return slices.Contains(codes, se.code)
+	}
+	// transport failures are retried; responses that do not decode are not transient
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// delay returns the jittered backoff before retry n (0-based)
+func (r *RetryConfig) delay(n int) time.Duration {
+	d, maxD := r.Backoff, r.MaxBackoff
+	if d <= 0 {
+		d = DefaultRetryBackoff
+	}
+	if maxD <= 0 {
+		maxD = DefaultRetryMaxBackoff
+	}
+	for i := 0; i < n && d < maxD; i++ {
+		d *= 2
+	}
+	d = min(d, maxD)
+	// equal jitter keeps retries from a burst of failed requests apart
+	return d/2 + rand.N(d/2+1)
+}
+
+// withRetry runs call, retrying retryable failures until the attempts or ctx run out
+func withRetry(ctx context.Context, r *RetryConfig, call func(context.Context) (bool, string, error)) (bool, string, error) {
+	allow, reason, err := call(ctx)
+	if r == nil {
+		return allow, reason, err
+	}
+	for n := 0; n < r.Attempts && err != nil && r.retryable(err); n++ {
+		timer := time.NewTimer(r.delay(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, "", fmt.Errorf("%w (after %d attempts)", err, n+1)
+		case <-timer.C:
+		}
+		allow, reason, err = call(ctx)
+	}
+	return allow, reason, err
+}
@@ -0,0 +1,89 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckFineGrain_RetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	cfg.Store(&Config{FineGrain: FineGrainConfig{
+		Enabled: true, ValidationURL: srv.URL,
+		ResourceMap: map[string]FineRule{"[/x]": {}},
+		Retry:       &RetryConfig{Attempts: 2, Backoff: time.Millisecond},
+	}})
+
+	allow, _, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauthPrincipalForTest())
+	if err != nil || !allow || calls.Load() != 3 {
+		t.Fatalf("expected success on the third attempt, got allow=%v err=%v calls=%d", allow, err, calls.Load())
+	}
+}
+
+func TestCheckFineGrain_DoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	cfg.Store(&Config{FineGrain: FineGrainConfig{
+		Enabled: true, ValidationURL: srv.URL,
+		ResourceMap: map[string]FineRule{"[/x]": {}},
+		Retry:       &RetryConfig{Attempts: 3, Backoff: time.Millisecond},
+	}})
+
+	if _, _, err := CheckFineGrainAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauthPrincipalForTest()); err == nil || calls.Load() != 1 {
+		t.Fatalf("expected a single failed call, got err=%v calls=%d", err, calls.Load())
+	}
+}
+
+func TestCheckCoarse_RetryDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	cfg.Store(&Config{Coarse: CoarseConfig{
+		Enabled: true, ValidationURL: srv.URL,
+		ResourceMap: map[string]CoarseResource{"[/x]": {Resource: "/target"}},
+		Retry:       &RetryConfig{Attempts: 100, Backoff: 20 * time.Millisecond, Deadline: 100 * time.Millisecond},
+	}})
+
+	start := time.Now()
+	if _, _, err := CheckCoarseAccess(context.Background(), RequestInfo{Method: "GET", Path: "/x"}, jwtauthPrincipalForTest()); err == nil {
+		t.Fatalf("expected an error once the deadline passes")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the deadline to bound retries, took %s", elapsed)
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	r := &RetryConfig{Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for n := 0; n < 10; n++ {
+		if d := r.delay(n); d > 300*time.Millisecond || d < 50*time.Millisecond {
+			t.Errorf("delay(%d) = %s outside [50ms, 300ms]", n, d)
+		}
+	}
+}
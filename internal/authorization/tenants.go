@@ -0,0 +1,72 @@
+package authorization
+
+import "fmt"
+
+// CoarseTenant holds the coarse rules of one tenant
+type CoarseTenant struct {
+	// ResourceMap replaces the section's resource-map for the tenant's requests
+	ResourceMap map[string]CoarseResource `yaml:"resource-map"`
+}
+
+// FineGrainTenant holds the fine-grain rules of one tenant
+type FineGrainTenant struct {
+	// ResourceMap replaces the section's resource-map for the tenant's requests
+	ResourceMap map[string]FineRule `yaml:"resource-map"`
+}
+
+// prepareTenants builds the section of each tenant with its own resource map. A canary does not
+// apply to them, since its rules are merged over the section's own map.
+func (c *CoarseConfig) prepareTenants() error {
+	c.tenants = nil
+	for id, t := range c.Tenants {
+		if err := validateRegexKeys(fmt.Sprintf("%s tenant %s", checkCoarse, id), t.ResourceMap); err != nil {
+			return err
+		}
+		v := *c
+		v.Tenants, v.tenants, v.Canary, v.canary = nil, nil, nil, nil
+		v.ResourceMap = t.ResourceMap
+		if c.tenants == nil {
+			c.tenants = make(map[string]*CoarseConfig, len(c.Tenants))
+		}
+		c.tenants[id] = &v
+	}
+	return nil
+}
+
+func (f *FineGrainConfig) prepareTenants() error {
+	f.tenants = nil
+	for id, t := range f.Tenants {
+		if err := validateRegexKeys(fmt.Sprintf("%s tenant %s", checkFineGrain, id), t.ResourceMap); err != nil {
+			return err
+		}
+		v := *f
+		v.Tenants, v.tenants, v.Canary, v.canary = nil, nil, nil, nil
+		v.ResourceMap = t.ResourceMap
+		if err := v.compileExpressions(); err != nil {
+			return err
+		}
+		if err := v.compileBodyPaths(); err != nil {
+			return err
+		}
+		if f.tenants == nil {
+			f.tenants = make(map[string]*FineGrainConfig, len(f.Tenants))
+		}
+		f.tenants[id] = &v
+	}
+	return nil
+}
+
+// forTenant returns the section to apply to a tenant's requests: the tenant's own, else the section
+func (c CoarseConfig) forTenant(tenant string) CoarseConfig {
+	if t, ok := c.tenants[tenant]; ok {
+		return *t
+	}
+	return c
+}
+
+func (f FineGrainConfig) forTenant(tenant string) FineGrainConfig {
+	if t, ok := f.tenants[tenant]; ok {
+		return *t
+	}
+	return f
+}
@@ -0,0 +1,52 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantResourceMaps(t *testing.T) {
+	var seen coarsePayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = coarsePayload{}
+		if err := json.NewDecoder(r.Body).Decode(&seen); err != nil {
+			t.Errorf("decode error: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(validationResponse{Allow: true})
+	}))
+	defer srv.Close()
+
+	y := "coarse-check:\n  enabled: true\n  validation-url: " + srv.URL + "\n" +
+		"  resource-map:\n    \"[/orders]\": shared-orders\n" +
+		"  tenants:\n    acme:\n      resource-map:\n        \"[/orders]\": acme-orders\n" +
+		"finegrain-check:\n  enabled: true\n  resource-map:\n    \"[/orders]\":\n      expression: \"true\"\n" +
+		"  tenants:\n    acme:\n      resource-map:\n        \"[/orders]\":\n          expression: \"principal.tenant_id == 'acme'\"\n"
+	old := cfg.Load()
+	t.Cleanup(func() { cfg.Store(old) })
+	if err := Load(writeTempFile(t, t.TempDir(), "auth-*.yaml", y)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	ctx := context.Background()
+	p := jwtauthPrincipalForTest()
+
+	if allow, _, err := CheckCoarseAccess(ctx, RequestInfo{Method: "GET", Path: "/orders"}, p); err != nil || !allow || seen.Resource != "shared-orders" {
+		t.Fatalf("expected the section's map without a tenant, got %v %v %q", allow, err, seen.Resource)
+	}
+	req := RequestInfo{Method: "GET", Path: "/orders", Tenant: "acme"}
+	if allow, _, err := CheckCoarseAccess(ctx, req, p); err != nil || !allow || seen.Resource != "acme-orders" || seen.Request.Tenant != "acme" {
+		t.Fatalf("expected the tenant's map and the tenant in the payload, got %v %v %q %q", allow, err, seen.Resource, seen.Request.Tenant)
+	}
+	if allow, _, err := CheckFineGrainAccess(ctx, req, p); err != nil || allow {
+		t.Fatalf("expected the tenant's rule to deny a principal of no tenant, got %v %v", allow, err)
+	}
+	p.TenantID = "acme"
+	if allow, _, err := CheckFineGrainAccess(ctx, req, p); err != nil || !allow {
+		t.Fatalf("expected the tenant's rule to allow its principal, got %v %v", allow, err)
+	}
+	if allow, _, err := CheckFineGrainAccess(ctx, RequestInfo{Method: "GET", Path: "/orders", Tenant: "other"}, jwtauthPrincipalForTest()); err != nil || !allow {
+		t.Fatalf("expected a tenant without rules to use the section's, got %v %v", allow, err)
+	}
+}
@@ -0,0 +1,73 @@
+package authorization
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ClientTLSConfig configures TLS, including mutual TLS, to a validation service
+type ClientTLSConfig struct {
+	// CertFile and KeyFile are the PEM client certificate and key presented to the service
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// CAFile is a PEM bundle trusted for the service certificate instead of the system roots
+	CAFile string `yaml:"ca-file"`
+	// ServerName overrides the host name verified against the service certificate
+	ServerName string `yaml:"server-name"`
+}
+
+// newValidationClient builds a section's HTTP client from its tls block and timeout; nil means the
+// shared httpClient
+func newValidationClient(check string, conf *ClientTLSConfig, timeout time.Duration) (*http.Client, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("%s: timeout must not be negative", check)
+	}
+	if conf == nil && timeout == 0 {
+		return nil, nil
+	}
+	if timeout == 0 {
+		timeout = httpClient.Timeout
+	}
+	client := &http.Client{Timeout: timeout}
+	if conf != nil {
+		tc, err := conf.build()
+		if err != nil {
+			return nil, fmt.Errorf("%s: tls: %w", check, err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tc
+		client.Transport = transport
+	}
+	return client, nil
+}
+
+func (c ClientTLSConfig) build() (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("cert-file and key-file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	return tc, nil
+}
@@ -0,0 +1,101 @@
+package authorization
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes a PEM block to dir/name and returns the path
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPostCoarseCheck_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sidecar"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pdp := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "sidecar" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"allow":true}`))
+	}))
+	pdp.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	pdp.StartTLS()
+	defer pdp.Close()
+
+	conf := &ClientTLSConfig{
+		CertFile: writePEM(t, dir, "client.crt", "CERTIFICATE", certDER),
+		KeyFile:  writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDER),
+		CAFile:   writePEM(t, dir, "ca.crt", "CERTIFICATE", pdp.Certificate().Raw),
+	}
+	client, err := newValidationClient(checkCoarse, conf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, _, err := postCoarseCheck(context.Background(), CoarseConfig{ValidationURL: pdp.URL, client: client}, coarsePayload{}, nil)
+	if err != nil || !allow {
+		t.Fatalf("expected allow over mutual TLS, got allow=%v err=%v", allow, err)
+	}
+
+	// without the CA bundle the PDP certificate is not trusted
+	if _, _, err := postCoarseCheck(context.Background(), CoarseConfig{ValidationURL: pdp.URL}, coarsePayload{}, nil); err == nil {
+		t.Fatalf("expected a certificate error with the shared client")
+	}
+}
+
+func TestNewValidationClient_RejectsHalfKeyPair(t *testing.T) {
+	if _, err := newValidationClient(checkFineGrain, &ClientTLSConfig{CertFile: "client.crt"}, 0); err == nil {
+		t.Fatalf("expected an error when key-file is missing")
+	}
+}
+
+func TestNewValidationClient_Timeout(t *testing.T) {
+	client, err := newValidationClient(checkCoarse, nil, 0)
+	if err != nil || client != nil {
+		t.Fatalf("expected the shared client without tls or timeout, got %v, %v", client, err)
+	}
+	if client, err = newValidationClient(checkCoarse, nil, 250*time.Millisecond); err != nil || client.Timeout != 250*time.Millisecond {
+		t.Fatalf("expected a client with the section timeout, got %v, %v", client, err)
+	}
+	if _, err := newValidationClient(checkCoarse, nil, -time.Second); err == nil {
+		t.Fatalf("expected an error for a negative timeout")
+	}
+}
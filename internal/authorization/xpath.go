@@ -0,0 +1,177 @@
+package authorization
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// sourceXML marks a FineRule body entry that is an XPath over an XML request body
+const sourceXML = "/"
+
+// xpathExpr is an XPath-lite selector: an absolute path of element names (/a/b), where a step may be
+// * (any element), may be reached through // (any depth), and may carry a 1-based [n] index. It
+// selects the elements' text, or ends in @name to select an attribute.
+type xpathExpr struct {
+	steps []xpathStep
+	attr  string
+}
+
+type xpathStep struct {
+	name       string
+	descendant bool
+	// index is 1-based; 0 selects every match
+	index int
+}
+
+func parseXPath(s string) (xpathExpr, error) {
+	var e xpathExpr
+	if !strings.HasPrefix(s, "/") {
+		return e, fmt.Errorf("%q is not an absolute XPath", s)
+	}
+	rest := s
+	for rest != "" {
+		var step xpathStep
+		if after, ok := strings.CutPrefix(rest, "//"); ok {
+			step.descendant, rest = true, after
+		} else {
+			rest = rest[1:]
+		}
+		seg := rest
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			seg, rest = rest[:i], rest[i:]
+		} else {
+			rest = ""
+		}
+		if attr, ok := strings.CutPrefix(seg, "@"); ok {
+			if attr == "" || rest != "" || step.descendant {
+				return e, fmt.Errorf("%q: an attribute may only end the path", s)
+			}
+			e.attr = attr
+			break
+		}
+		if seg == "text()" && rest == "" {
+			break
+		}
+		if name, idx, ok := strings.Cut(seg, "["); ok {
+			n, err := strconv.Atoi(strings.TrimSuffix(idx, "]"))
+			if err != nil || !strings.HasSuffix(idx, "]") || n < 1 {
+				return e, fmt.Errorf("%q: invalid index in %q", s, seg)
+			}
+			seg, step.index = name, n
+		}
+		if seg == "" {
+			return e, fmt.Errorf("%q: empty step", s)
+		}
+		step.name = seg
+		e.steps = append(e.steps, step)
+	}
+	if len(e.steps) == 0 {
+		return e, fmt.Errorf("%q selects no element", s)
+	}
+	return e, nil
+}
+
+// definite reports whether the selector names a single node, like a definite JSONPath; it then
+// extracts the first match rather than an array
+func (e xpathExpr) definite() bool {
+	for _, s := range e.steps {
+		if s.descendant || (s.name == "*" && s.index == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// xmlNode is an element of a parsed XML document
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// parseXML reads a document into a tree under a synthetic root, ignoring namespaces
+func parseXML(b []byte) (*xmlNode, error) {
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			top.text.Write(t)
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, errors.New("xml: no root element")
+	}
+	return root, nil
+}
+
+// eval returns the text or attribute values the selector matches in document order
+func (e xpathExpr) eval(root *xmlNode) []any {
+	nodes := []*xmlNode{root}
+	for _, step := range e.steps {
+		var next []*xmlNode
+		for _, n := range nodes {
+			var candidates []*xmlNode
+			if step.descendant {
+				candidates = descendants(n, nil)
+			} else {
+				candidates = n.children
+			}
+			var matched []*xmlNode
+			for _, c := range candidates {
+				if step.name == "*" || c.name == step.name {
+					matched = append(matched, c)
+				}
+			}
+			if step.index > 0 {
+				if step.index > len(matched) {
+					continue
+				}
+				matched = matched[step.index-1 : step.index]
+			}
+			next = append(next, matched...)
+		}
+		nodes = next
+	}
+	var out []any
+	for _, n := range nodes {
+		if e.attr == "" {
+			out = append(out, strings.TrimSpace(n.text.String()))
+		} else if v, ok := n.attrs[e.attr]; ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func descendants(n *xmlNode, acc []*xmlNode) []*xmlNode {
+	for _, c := range n.children {
+		acc = append(acc, c)
+		acc = descendants(c, acc)
+	}
+	return acc
+}
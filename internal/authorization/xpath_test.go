@@ -0,0 +1,57 @@
+package authorization
+
+import (
+	"reflect"
+	"testing"
+)
+
+const soapTransfer = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope">
+  <soap:Body>
+    <transaction id="t-9" currency="EUR">
+      <amount>250.00</amount>
+      <line sku="a"><qty>1</qty></line>
+      <line sku="b"><qty>3</qty></line>
+    </transaction>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestExtractValues_XPath(t *testing.T) {
+	compiled := map[string]bodyPath{}
+	for field, raw := range map[string]string{
+		"amount":   "/Envelope/Body/transaction/amount",
+		"currency": "/Envelope/Body/transaction/@currency",
+		"second":   "/Envelope/Body/transaction/line[2]/@sku",
+		"qtys":     "//qty",
+		"lines":    "/Envelope/Body/transaction/*[2]/qty/text()",
+		"missing":  "/Envelope/Body/refund/amount",
+		"hasLine":  "exists(//line)",
+	} {
+		bp, err := parseBodyPath(raw)
+		if err != nil {
+			t.Fatalf("%s: %v", field, err)
+		}
+		compiled[field] = bp
+	}
+	want := map[string]any{
+		"amount": "250.00", "currency": "EUR", "second": "b", "qtys": []any{"1", "3"},
+		"lines": "1", "missing": nil, "hasLine": true,
+	}
+	got := extractValues(compiled, RequestInfo{XMLBody: []byte(soapTransfer)}, nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected values %#v", got)
+	}
+
+	// XPaths extract nothing from a malformed or missing XML body
+	if got := extractValues(compiled, RequestInfo{XMLBody: []byte("<transaction>")}, nil); got != nil {
+		t.Fatalf("expected no values from malformed XML, got %#v", got)
+	}
+}
+
+func TestParseXPath_Invalid(t *testing.T) {
+	for _, raw := range []string{"/", "/a//", "/a/@", "/a/@id/b", "/a[0]", "/a[x]", "//@id"} {
+		if _, err := parseXPath(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package balancer spreads the requests of a route with several upstreams over its endpoints and
+// takes endpoints that keep failing out of rotation for a while.
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// pools keeps one pool per route key, surviving config reloads
+var pools sync.Map
+
+// now is an indirection over the clock to allow deterministic tests
+var now = time.Now
+
+// pool is the balancing state of a route's endpoints
+type pool struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpoint
+	// next rotates round-robin picks and least-connections ties
+	next int
+}
+
+// endpoint is the state of one upstream URL
+type endpoint struct {
+	active int
+	// current is the smooth weighted round-robin credit
+	current      int
+	failures     int
+	ejectedUntil time.Time
+
+	// health probe state; endpoints start healthy until unhealthy-threshold probes fail
+	unhealthy bool
+	passes    int
+	fails     int
+	probing   bool
+	nextProbe time.Time
+	checkedAt time.Time
+	lastError string
+}
+
+// Lease is an endpoint picked for one request; Done must be called once the request finishes
+type Lease struct {
+	// URL is the endpoint's base URL without a trailing slash
+	URL   string
+	route string
+	key   string
+	lb    *ingressconfig.LoadBalancing
+	pool  *pool
+}
+
+// Pick chooses an endpoint for a request to route, skipping ejected and unhealthy endpoints unless
+// none is left, in which case every endpoint is eligible again
+func Pick(route string, endpoints []ingressconfig.Endpoint, lb *ingressconfig.LoadBalancing) *Lease {
+	p := poolFor(route)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := now()
+	eligible := make([]int, 0, len(endpoints))
+	for i, e := range endpoints {
+		if s := p.state(e.URL); !s.unhealthy && t.After(s.ejectedUntil) {
+			eligible = append(eligible, i)
+		}
+	}
+	if len(eligible) == 0 {
+		for i := range endpoints {
+			eligible = append(eligible, i)
+		}
+	}
+
+	var chosen int
+	switch lb.PolicyOrDefault() {
+	case ingressconfig.BalanceWeighted:
+		chosen = p.weighted(endpoints, eligible)
+	case ingressconfig.BalanceLeastConnections:
+		chosen = p.leastConnections(endpoints, eligible)
+	default:
+		chosen = eligible[p.next%len(eligible)]
+		p.next++
+	}
+	url := endpoints[chosen].URL
+	p.state(url).active++
+	return &Lease{URL: trimSlash(url), route: route, key: url, lb: lb, pool: p}
+}
+
+// weighted is nginx's smooth weighted round-robin: every eligible endpoint earns its weight, and
+// the richest is picked and pays back the total
+func (p *pool) weighted(endpoints []ingressconfig.Endpoint, eligible []int) int {
+	total, best := 0, -1
+	for _, i := range eligible {
+		s := p.state(endpoints[i].URL)
+		w := endpoints[i].WeightOrDefault()
+		s.current += w
+		total += w
+		if best < 0 || s.current > p.state(endpoints[best].URL).current {
+			best = i
+		}
+	}
+	p.state(endpoints[best].URL).current -= total
+	return best
+}
+
+// leastConnections picks the endpoint with the fewest requests in flight, rotating among ties
+func (p *pool) leastConnections(endpoints []ingressconfig.Endpoint, eligible []int) int {
+	best := -1
+	for j := range eligible {
+		i := eligible[(p.next+j)%len(eligible)]
+		if best < 0 || p.state(endpoints[i].URL).active < p.state(endpoints[best].URL).active {
+			best = i
+		}
+	}
+	p.next++
+	return best
+}
+
+// Done records the outcome of the request; failed requests count towards ejecting the endpoint
+func (l *Lease) Done(failed bool) {
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+	s := l.pool.state(l.key)
+	s.active--
+	if !failed {
+		s.failures = 0
+		return
+	}
+	s.failures++
+	if s.failures >= l.lb.Threshold() {
+		s.failures = 0
+		s.ejectedUntil = now().Add(l.lb.EjectFor())
+		metrics.UpstreamEjections.WithLabelValues(l.route, l.URL).Inc()
+	}
+}
+
+// Failed reports whether an upstream status counts as an endpoint failure
+func Failed(status int) bool {
+	return status == 502 || status == 503 || status == 504
+}
+
+func (p *pool) state(url string) *endpoint {
+	s, ok := p.endpoints[url]
+	if !ok {
+		s = &endpoint{}
+		p.endpoints[url] = s
+	}
+	return s
+}
+
+func trimSlash(url string) string { return strings.TrimSuffix(url, "/") }
+
+func poolFor(route string) *pool {
+	if p, ok := pools.Load(route); ok {
+		return p.(*pool)
+	}
+	p, _ := pools.LoadOrStore(route, &pool{endpoints: map[string]*endpoint{}})
+	return p.(*pool)
+}
@@ -0,0 +1,74 @@
+package balancer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+var endpoints = []ingressconfig.Endpoint{{URL: "http://a/"}, {URL: "http://b", Weight: 3}}
+
+// picks returns the endpoints chosen by n requests that finish immediately
+func picks(route string, lb *ingressconfig.LoadBalancing, n int) string {
+	var got []string
+	for range n {
+		l := Pick(route, endpoints, lb)
+		l.Done(false)
+		got = append(got, strings.TrimPrefix(l.URL, "http://"))
+	}
+	return strings.Join(got, "")
+}
+
+func TestPick_Policies(t *testing.T) {
+	if got := picks("rr", nil, 4); got != "abab" {
+		t.Fatalf("round-robin: got %s", got)
+	}
+	if got := picks("weighted", &ingressconfig.LoadBalancing{Policy: ingressconfig.BalanceWeighted}, 8); got != "babbbabb" {
+		t.Fatalf("weighted: expected a smooth 1:3 split, got %s", got)
+	}
+
+	lb := &ingressconfig.LoadBalancing{Policy: ingressconfig.BalanceLeastConnections}
+	busy := Pick("least", endpoints, lb)
+	for range 3 {
+		if l := Pick("least", endpoints, lb); l.URL == busy.URL {
+			t.Fatalf("least-connections: expected the idle endpoint, got %s", l.URL)
+		} else {
+			l.Done(false)
+		}
+	}
+	busy.Done(false)
+}
+
+func TestPick_EjectsFailingEndpoints(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	lb := &ingressconfig.LoadBalancing{FailureThreshold: 2, EjectDuration: time.Minute}
+
+	fail := func(url string) {
+		for range 4 {
+			if l := Pick("eject", endpoints, lb); l.URL == url {
+				l.Done(true)
+			} else {
+				l.Done(false)
+			}
+		}
+	}
+	fail("http://a")
+	if got := picks("eject", lb, 3); got != "bbb" {
+		t.Fatalf("expected the failing endpoint to be ejected, got %s", got)
+	}
+
+	// with every endpoint ejected, all of them are tried rather than none
+	fail("http://b")
+	if got := picks("eject", lb, 2); !strings.Contains(got, "a") || !strings.Contains(got, "b") {
+		t.Fatalf("expected all endpoints while all are ejected, got %s", got)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if got := picks("eject", lb, 2); got != "ab" && got != "ba" {
+		t.Fatalf("expected the endpoints back after the eject duration, got %s", got)
+	}
+}
@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// probeTick is how often RunHealthChecks looks for endpoints due a probe
+const probeTick = time.Second
+
+// probeClient sends health probes; each probe bounds itself with the route's timeout
+var probeClient = &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+// startProbe runs a probe in the background; an indirection so tests can wait for it
+var startProbe = func(route, url string, hc ingressconfig.HealthCheck) { go probe(route, url, hc) }
+
+// RunHealthChecks probes the upstreams of every route with a health-check, following config reloads; it never returns
+func RunHealthChecks() {
+	for range time.Tick(probeTick) {
+		probeDue(now())
+	}
+}
+
+// probeDue starts a probe of each endpoint whose interval has elapsed and that has none in flight
+func probeDue(t time.Time) {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return
+	}
+	for i := range conf.Routes {
+		r := &conf.Routes[i]
+		if r.HealthCheck == nil || len(r.Upstreams) == 0 {
+			continue
+		}
+		route, hc := r.Key(), *r.HealthCheck
+		p := poolFor(route)
+		for _, e := range r.Upstreams {
+			p.mu.Lock()
+			s := p.state(e.URL)
+			due := !s.probing && !t.Before(s.nextProbe)
+			if due {
+				s.probing = true
+				s.nextProbe = t.Add(hc.IntervalOrDefault())
+			}
+			p.mu.Unlock()
+			if due {
+				startProbe(route, e.URL, hc)
+			}
+		}
+	}
+}
+
+// probe checks one endpoint and records the result
+func probe(route, url string, hc ingressconfig.HealthCheck) {
+	err := check(url, hc)
+	if err != nil {
+		slog.Debug("upstream health probe failed", slog.String("route", route), slog.String("endpoint", url), slog.Any("error", err))
+	}
+	record(route, url, hc, err)
+}
+
+// check requests the health path; a 2xx or 3xx answer passes
+func check(url string, hc ingressconfig.HealthCheck) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.TimeoutOrDefault())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, trimSlash(url)+hc.PathOrDefault(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return &statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// record counts a probe result towards the endpoint's thresholds, flipping its health when one is reached
+func record(route, url string, hc ingressconfig.HealthCheck, err error) {
+	p := poolFor(route)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.state(url)
+	s.probing = false
+	s.checkedAt = now()
+	healthy, unhealthy := hc.Thresholds()
+	if err == nil {
+		s.lastError = ""
+		s.fails = 0
+		s.passes++
+		if s.unhealthy && s.passes >= healthy {
+			s.unhealthy = false
+		}
+	} else {
+		s.lastError = err.Error()
+		s.passes = 0
+		s.fails++
+		if !s.unhealthy && s.fails >= unhealthy {
+			s.unhealthy = true
+		}
+	}
+	gauge := 1.0
+	if s.unhealthy {
+		gauge = 0
+	}
+	metrics.UpstreamHealthy.WithLabelValues(route, trimSlash(url)).Set(gauge)
+}
+
+// EndpointStatus is the balancing and health state of one upstream endpoint
+type EndpointStatus struct {
+	URL      string `json:"url"`
+	Healthy  bool   `json:"healthy"`
+	Ejected  bool   `json:"ejected"`
+	InFlight int    `json:"in_flight"`
+	// LastCheck and LastError describe the latest health probe; both are empty without health checks
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Status reports the endpoints of every configured route with upstreams, keyed by route, in config order
+func Status() map[string][]EndpointStatus {
+	out := map[string][]EndpointStatus{}
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return out
+	}
+	t := now()
+	for i := range conf.Routes {
+		r := &conf.Routes[i]
+		if len(r.Upstreams) == 0 {
+			continue
+		}
+		p := poolFor(r.Key())
+		p.mu.Lock()
+		list := make([]EndpointStatus, 0, len(r.Upstreams))
+		for _, e := range r.Upstreams {
+			s := p.state(e.URL)
+			es := EndpointStatus{URL: trimSlash(e.URL), Healthy: !s.unhealthy, Ejected: t.Before(s.ejectedUntil), InFlight: s.active, LastError: s.lastError}
+			if !s.checkedAt.IsZero() {
+				checked := s.checkedAt
+				es.LastCheck = &checked
+			}
+			list = append(list, es)
+		}
+		p.mu.Unlock()
+		out[r.Key()] = list
+	}
+	return out
+}
+
+type statusError struct{ code int }
+
+func (e *statusError) Error() string { return fmt.Sprintf("health check returned %d", e.code) }
@@ -0,0 +1,98 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestHealthChecks_SkipUnhealthyEndpoints(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ready" || down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	eps := []ingressconfig.Endpoint{{URL: srv.URL}, {URL: "http://b"}}
+	hc := ingressconfig.HealthCheck{Path: "/ready", HealthyThreshold: 2, UnhealthyThreshold: 2}
+	probeTwice := func() {
+		for range 2 {
+			probe("health", srv.URL, hc)
+		}
+	}
+	pickAll := func() map[string]bool {
+		seen := map[string]bool{}
+		for range 4 {
+			l := Pick("health", eps, nil)
+			l.Done(false)
+			seen[l.URL] = true
+		}
+		return seen
+	}
+
+	down.Store(true)
+	probe("health", srv.URL, hc)
+	if !pickAll()[srv.URL] {
+		t.Fatalf("expected the endpoint to stay in rotation below the unhealthy threshold")
+	}
+	probe("health", srv.URL, hc)
+	if pickAll()[srv.URL] {
+		t.Fatalf("expected the unhealthy endpoint to be skipped")
+	}
+
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{Routes: []ingressconfig.Route{{Name: "health", Upstreams: eps}}})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	if s := Status()["health"]; len(s) != 2 || s[0].URL != srv.URL || s[0].Healthy || s[0].LastError == "" {
+		t.Fatalf("expected the status to report the failing endpoint, got %+v", s)
+	}
+
+	down.Store(false)
+	probeTwice()
+	if !pickAll()[srv.URL] {
+		t.Fatalf("expected the endpoint back in rotation after passing probes")
+	}
+}
+
+func TestProbeDue_HonoursInterval(t *testing.T) {
+	clock := time.Unix(1_700_000_000, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	// record the probe in place of a real one, so no goroutine outlives the test
+	var probes int
+	orig := startProbe
+	t.Cleanup(func() { startProbe = orig })
+	startProbe = func(route, url string, hc ingressconfig.HealthCheck) {
+		probes++
+		record(route, url, hc, nil)
+	}
+
+	route := ingressconfig.Route{Name: "due", Upstreams: []ingressconfig.Endpoint{{URL: "http://127.0.0.1:0"}},
+		HealthCheck: &ingressconfig.HealthCheck{Interval: time.Minute}}
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{Routes: []ingressconfig.Route{route}})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	next := func() time.Time {
+		p := poolFor("due")
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.state("http://127.0.0.1:0").nextProbe
+	}
+	probeDue(clock)
+	if got := next(); !got.Equal(clock.Add(time.Minute)) {
+		t.Fatalf("expected the next probe a minute later, got %v", got)
+	}
+	probeDue(clock.Add(30 * time.Second))
+	if got := next(); !got.Equal(clock.Add(time.Minute)) || probes != 1 {
+		t.Fatalf("expected no probe before the interval elapsed, got %d probes and next %v", probes, got)
+	}
+	probeDue(clock.Add(time.Minute))
+	if probes != 2 {
+		t.Fatalf("expected a probe once the interval elapsed, got %d", probes)
+	}
+}
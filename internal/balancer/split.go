@@ -0,0 +1,33 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// Split picks the upstream version of a route's traffic split for a request by weight. A sticky
+// split hashes the user ID with the route, so a principal keeps its version for as long as the
+// weights stay the same; anonymous requests are assigned at random.
+func Split(route string, split *ingressconfig.TrafficSplit, userID string) string {
+	total := split.TotalWeight()
+	var n int
+	if split.Sticky && userID != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(route + "\x00" + userID))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.IntN(total)
+	}
+	for _, t := range split.Targets {
+		if n < t.Weight {
+			metrics.IngressSplitRequests.WithLabelValues(route, t.Name).Inc()
+			return trimSlash(t.Upstream)
+		}
+		n -= t.Weight
+	}
+	// unreachable with a validated split
+	return trimSlash(split.Targets[len(split.Targets)-1].Upstream)
+}
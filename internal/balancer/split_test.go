@@ -0,0 +1,35 @@
+package balancer
+
+import (
+	"testing"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestSplit(t *testing.T) {
+	split := &ingressconfig.TrafficSplit{Targets: []ingressconfig.SplitTarget{
+		{Name: "stable", Upstream: "http://v1/", Weight: 3},
+		{Name: "drained", Upstream: "http://old", Weight: 0},
+		{Name: "canary", Upstream: "http://v2", Weight: 1},
+	}}
+	counts := map[string]int{}
+	for range 4000 {
+		counts[Split("split", split, "")]++
+	}
+	if counts["http://old"] != 0 || counts["http://v1"] < 2700 || counts["http://v2"] < 700 {
+		t.Fatalf("expected a 3:1 split without the drained target, got %v", counts)
+	}
+
+	split.Sticky = true
+	users := map[string]string{}
+	for _, u := range []string{"alice", "bob", "carol", "dave", "erin", "frank"} {
+		users[u] = Split("split", split, u)
+	}
+	for range 10 {
+		for u, want := range users {
+			if got := Split("split", split, u); got != want {
+				t.Fatalf("expected %s to stay on %s, got %s", u, want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package canonpath gives every ingress check one reading of the request path: the percent-decoded
+// path, refusing paths the upstream could resolve to another one (dot segments, empty segments,
+// encoded slashes and backslashes), so public paths, routes and resource-map keys match the
+// resource the upstream serves.
+package canonpath
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// localsKey marks a request whose path is already canonical, so it is never decoded twice
+const localsKey = "CanonicalPath"
+
+// ErrNotCanonical is returned for a path that could resolve to another path upstream
+var ErrNotCanonical = errors.New("request path must not contain dot segments, empty segments or encoded slashes")
+
+// Middleware applies Apply, refusing a non-canonical path with 400
+func Middleware(c fiber.Ctx) error {
+	if err := Apply(c); err != nil {
+		return err
+	}
+	return c.Next()
+}
+
+// Apply replaces the request path with its canonical form, once per request, so c.Path() returns
+// the decoded path from then on; a path that is not canonical gives a 400
+func Apply(c fiber.Ctx) error {
+	if done, _ := c.Locals(localsKey).(bool); done {
+		return nil
+	}
+	p, err := Canonical(c.Path())
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	c.Path(p)
+	c.Locals(localsKey, true)
+	return nil
+}
+
+// Canonical returns the percent-decoded form of a raw request path, or ErrNotCanonical when the
+// path has dot or empty segments, before or after decoding, or an encoded slash or backslash
+func Canonical(raw string) (string, error) {
+	lower := strings.ToLower(raw)
+	if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") {
+		return "", ErrNotCanonical
+	}
+	decoded, err := url.PathUnescape(raw)
+	if err != nil || strings.ContainsAny(decoded, "\\\x00") {
+		return "", ErrNotCanonical
+	}
+	if !strings.HasPrefix(decoded, "/") {
+		return decoded, nil
+	}
+	clean := path.Clean(decoded)
+	if strings.HasSuffix(decoded, "/") && clean != "/" {
+		clean += "/"
+	}
+	if clean != decoded {
+		return "", ErrNotCanonical
+	}
+	return decoded, nil
+}
+
+// Escape encodes a canonical path for an upstream request URL
+func Escape(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
@@ -0,0 +1,62 @@
+package canonpath
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestCanonical(t *testing.T) {
+	cases := []struct {
+		raw, want string
+		ok        bool
+	}{
+		{"/orders/1", "/orders/1", true},
+		{"/orders/", "/orders/", true},
+		{"/", "/", true},
+		{"/%61dmin/users", "/admin/users", true},
+		{"/files/a%20b", "/files/a b", true},
+		{"/files/100%25", "/files/100%", true},
+		{"/docs/../admin", "", false},
+		{"/docs/%2e%2e/admin", "", false},
+		{"/docs/%2E%2E/admin", "", false},
+		{"/docs/./index.html", "", false},
+		{"/docs//index.html", "", false},
+		{"/docs/..", "", false},
+		{"/docs%2f..%2fadmin", "", false},
+		{"/docs%5cadmin", "", false},
+		{"/docs\\admin", "", false},
+		{"/docs/%zz", "", false},
+	}
+	for _, tc := range cases {
+		got, err := Canonical(tc.raw)
+		if ok := err == nil; ok != tc.ok || got != tc.want {
+			t.Errorf("%s: expected %q (ok=%v), got %q (%v)", tc.raw, tc.want, tc.ok, got, err)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware)
+	// a second pass must not decode %25 again
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendString(c.Path() + " " + Escape(c.Path())) })
+
+	send := func(path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := send("/%61dmin/a%20b%2525"); code != 200 || body != "/admin/a b%25 /admin/a%20b%2525" {
+		t.Errorf("expected the decoded path once and its escaped form, got %d %q", code, body)
+	}
+	if code, _ := send("/docs/%2e%2e/admin"); code != fiber.StatusBadRequest {
+		t.Errorf("expected 400 for a dot segment, got %d", code)
+	}
+}
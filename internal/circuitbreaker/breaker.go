@@ -0,0 +1,196 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"reverseProxy/internal/metrics"
+)
+
+// Config configures a circuit breaker around calls to an external service
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// FailureThreshold is the number of consecutive failures that opens the circuit (default 5)
+	FailureThreshold int `yaml:"failure-threshold"`
+	// OpenDuration is how long the circuit stays open before half-open probes are let through (default 30s)
+	OpenDuration time.Duration `yaml:"open-duration"`
+	// HalfOpenProbes is the number of concurrent probes allowed while half-open; that many
+	// successes close the circuit again (default 1)
+	HalfOpenProbes int `yaml:"half-open-probes"`
+	// WhenOpen is the outcome of a call rejected by an open circuit: closed (deny) or open (allow).
+	// When empty the caller's default applies.
+	WhenOpen string `yaml:"when-open"`
+}
+
+// Outcomes for Config.WhenOpen
+const (
+	FailClosed = "closed"
+	FailOpen   = "open"
+)
+
+// Defaults applied when the config leaves a field empty
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenDuration     = 30 * time.Second
+	DefaultHalfOpenProbes   = 1
+)
+
+// States reported by Breaker.State and the circuit state gauge
+const (
+	StateClosed   = "closed"
+	StateHalfOpen = "half-open"
+	StateOpen     = "open"
+)
+
+// ErrOpen is returned for calls rejected while the circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Validate checks the config values
+func (c Config) Validate() error {
+	if c.FailureThreshold < 0 || c.HalfOpenProbes < 0 || c.OpenDuration < 0 {
+		return errors.New("circuit-breaker: values must not be negative")
+	}
+	switch c.WhenOpen {
+	case "", FailClosed, FailOpen:
+		return nil
+	}
+	return errors.New("circuit-breaker: when-open must be open or closed")
+}
+
+// FailOpen reports whether calls rejected by an open circuit should be allowed
+func (c Config) FailOpen() bool { return c.WhenOpen == FailOpen }
+
+// Breaker tracks consecutive failures of one service. A nil Breaker allows every call.
+type Breaker struct {
+	name string
+	conf Config
+	now  func() time.Time
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	inFlight  int
+	successes int
+}
+
+// New returns a closed breaker; name labels its state gauge
+func New(name string, conf Config) *Breaker {
+	if conf.FailureThreshold == 0 {
+		conf.FailureThreshold = DefaultFailureThreshold
+	}
+	if conf.OpenDuration == 0 {
+		conf.OpenDuration = DefaultOpenDuration
+	}
+	if conf.HalfOpenProbes == 0 {
+		conf.HalfOpenProbes = DefaultHalfOpenProbes
+	}
+	b := &Breaker{name: name, conf: conf, now: time.Now, state: StateClosed}
+	b.setState(StateClosed)
+	return b
+}
+
+// Config returns the breaker's config with defaults applied
+func (b *Breaker) Config() Config {
+	if b == nil {
+		return Config{}
+	}
+	return b.conf
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be followed by Record.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen {
+		if b.now().Sub(b.openedAt) < b.conf.OpenDuration {
+			return false
+		}
+		b.setState(StateHalfOpen)
+		b.inFlight, b.successes = 0, 0
+	}
+	if b.state == StateHalfOpen {
+		if b.inFlight >= b.conf.HalfOpenProbes {
+			return false
+		}
+		b.inFlight++
+	}
+	return true
+}
+
+// Record reports the outcome of an allowed call
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateHalfOpen:
+		b.inFlight--
+		if !success {
+			b.trip()
+			return
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenProbes {
+			b.failures = 0
+			b.setState(StateClosed)
+		}
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.conf.FailureThreshold {
+			b.trip()
+		}
+	}
+}
+
+// Abandon releases an allowed call that was cancelled by the caller; it counts as neither success nor failure
+func (b *Breaker) Abandon() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.inFlight--
+	}
+}
+
+// State returns closed, half-open or open
+func (b *Breaker) State() string {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.conf.OpenDuration {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) trip() {
+	b.openedAt = b.now()
+	b.failures = 0
+	b.setState(StateOpen)
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	for _, s := range []string{StateClosed, StateHalfOpen, StateOpen} {
+		v := 0.0
+		if s == state {
+			v = 1
+		}
+		metrics.CircuitState.WithLabelValues(b.name, s).Set(v)
+	}
+}
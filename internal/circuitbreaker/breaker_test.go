@@ -0,0 +1,97 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestBreaker(conf Config) (*Breaker, *time.Time) {
+	b := New("test", conf)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b, now := newTestBreaker(Config{Enabled: true, FailureThreshold: 2, OpenDuration: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("expected closed circuit to allow call %d", i)
+		}
+		b.Record(false)
+	}
+	if b.State() != StateOpen || b.Allow() {
+		t.Fatalf("expected circuit to open after the threshold, state %s", b.State())
+	}
+
+	*now = now.Add(time.Minute)
+	if b.State() != StateHalfOpen || !b.Allow() {
+		t.Fatalf("expected a half-open probe after open-duration, state %s", b.State())
+	}
+	if b.Allow() {
+		t.Errorf("expected only one concurrent probe while half-open")
+	}
+	b.Record(true)
+	if b.State() != StateClosed || !b.Allow() {
+		t.Errorf("expected a successful probe to close the circuit, state %s", b.State())
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b, now := newTestBreaker(Config{Enabled: true, FailureThreshold: 1, OpenDuration: time.Second})
+	b.Allow()
+	b.Record(false)
+
+	*now = now.Add(time.Second)
+	if !b.Allow() {
+		t.Fatalf("expected a probe")
+	}
+	b.Record(false)
+	if b.State() != StateOpen {
+		t.Errorf("expected a failed probe to reopen the circuit, state %s", b.State())
+	}
+}
+
+func TestBreakerAbandonReleasesProbe(t *testing.T) {
+	b, now := newTestBreaker(Config{Enabled: true, FailureThreshold: 1, OpenDuration: time.Second})
+	b.Allow()
+	b.Record(false)
+	*now = now.Add(time.Second)
+
+	b.Allow()
+	b.Abandon()
+	if !b.Allow() {
+		t.Errorf("expected an abandoned probe to free its slot")
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := newTestBreaker(Config{Enabled: true, FailureThreshold: 2})
+	b.Record(false)
+	b.Record(true)
+	b.Record(false)
+	if b.State() != StateClosed {
+		t.Errorf("expected non-consecutive failures to keep the circuit closed")
+	}
+}
+
+func TestNilBreakerAllows(t *testing.T) {
+	var b *Breaker
+	if !b.Allow() || b.State() != StateClosed {
+		t.Errorf("expected a nil breaker to allow every call")
+	}
+	b.Record(false)
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := (Config{WhenOpen: "sometimes"}).Validate(); err == nil {
+		t.Errorf("expected an error for an unknown when-open")
+	}
+	if err := (Config{FailureThreshold: -1}).Validate(); err == nil {
+		t.Errorf("expected an error for a negative threshold")
+	}
+	if err := (Config{WhenOpen: FailOpen}).Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
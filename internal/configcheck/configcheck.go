@@ -0,0 +1,184 @@
+// Package configcheck validates the sidecar configuration before a rollout: it loads every config
+// as the sidecar would, resolves the token issuers and their keys and, on request, checks that the
+// validation services and token endpoints are reachable, reporting each step.
+package configcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/plugins"
+	"reverseProxy/internal/sidecarconfig"
+)
+
+// Options selects the configuration to check and how far the check goes
+type Options struct {
+	// File is the unified config file; when empty the separate files below are read
+	File          string
+	Ingress       string
+	Authorization string
+	Egress        string
+	// Ping calls the validation services and egress token endpoints to check they answer
+	Ping bool
+	// Timeout bounds each ping (default DefaultTimeout)
+	Timeout time.Duration
+}
+
+// DefaultTimeout bounds each ping when Options.Timeout is not set
+const DefaultTimeout = 5 * time.Second
+
+// Result is the outcome of one check
+type Result struct {
+	Name string
+	// Detail describes what a passed or skipped check found
+	Detail  string
+	Skipped bool
+	Err     error
+}
+
+// Report lists the results in the order the checks ran
+type Report []Result
+
+// OK reports whether no check failed
+func (r Report) OK() bool {
+	for _, res := range r {
+		if res.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Write prints one line per check, followed by a summary
+func (r Report) Write(w io.Writer) {
+	failed := 0
+	for _, res := range r {
+		switch {
+		case res.Err != nil:
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", res.Name, res.Err)
+		case res.Skipped:
+			fmt.Fprintf(w, "skip  %s: %s\n", res.Name, res.Detail)
+		default:
+			fmt.Fprintf(w, "ok    %s", res.Name)
+			if res.Detail != "" {
+				fmt.Fprintf(w, ": %s", res.Detail)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "%d of %d checks failed\n", failed, len(r))
+		return
+	}
+	fmt.Fprintf(w, "all %d checks passed\n", len(r))
+}
+
+// Run checks the configuration. Configs are installed as the sidecar installs them, so Run is meant
+// for a process that does nothing else, such as the validate subcommand.
+func Run(ctx context.Context, opts Options) Report {
+	var r Report
+	if opts.File != "" {
+		r = append(r, Result{Name: "config " + opts.File, Err: sidecarconfig.Load(opts.File)})
+	} else {
+		r = append(r, Result{Name: "ingress config " + opts.Ingress, Err: ingressconfig.Load(opts.Ingress)})
+		r = append(r, optionalFile("authorization config", opts.Authorization, authorization.Load))
+		r = append(r, optionalFile("egress config", opts.Egress, egressconfig.Load))
+	}
+	if !r.OK() {
+		// Later checks would only report the same broken config again
+		return r
+	}
+
+	r = append(r, checkIssuers()...)
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && len(conf.Plugins) > 0 {
+		r = append(r, Result{Name: "plugins", Detail: fmt.Sprintf("%d loaded", len(conf.Plugins)), Err: plugins.Load(ctx, conf.Plugins)})
+	}
+	if opts.Ping {
+		r = append(r, ping(ctx, opts.Timeout)...)
+	}
+	return r
+}
+
+// optionalFile loads a config the sidecar can run without, skipping it when the file does not exist
+func optionalFile(name, path string, load func(string) error) Result {
+	name += " " + path
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return Result{Name: name, Skipped: true, Detail: "file not found; the sidecar runs without it"}
+	}
+	return Result{Name: name, Err: load(path)}
+}
+
+// checkIssuers resolves OIDC discovery and fetches the key set of every issuer
+func checkIssuers() Report {
+	if !jwtauth.IssuersConfigured() {
+		return Report{{Name: "token issuers", Err: errors.New("none configured: set authn.issuers in the ingress config")}}
+	}
+	r := Report{{Name: "OIDC discovery", Err: jwtauth.Discover()}}
+	for _, is := range jwtauth.Issuers() {
+		res := Result{Name: "issuer " + is.Issuer}
+		if res.Err = is.Keys.Fetch(); res.Err == nil {
+			res.Detail = fmt.Sprintf("%d keys from %s", len(is.Keys.Kids()), is.Keys.URL())
+			if len(is.Keys.Kids()) == 0 {
+				res.Err = fmt.Errorf("no usable keys at %s", is.Keys.URL())
+			}
+		}
+		r = append(r, res)
+	}
+	return r
+}
+
+// ping calls the validation services and egress token endpoints; any answer below 500 counts as
+// reachable, since a bare GET is not a valid call to either
+func ping(ctx context.Context, timeout time.Duration) Report {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	var r Report
+	for _, ep := range authorization.ValidationEndpoints() {
+		r = append(r, pingURL(ctx, ep.Client, timeout, ep.Check+" validation service", ep.URL))
+	}
+	idps := egressconfig.GetAllIDPTypes()
+	sort.Strings(idps)
+	for _, idp := range idps {
+		conf, err := egressconfig.GetOAuthConfig(idp)
+		if err != nil || conf.TokenURL == "" {
+			continue
+		}
+		r = append(r, pingURL(ctx, http.DefaultClient, timeout, "egress "+idp+" token endpoint", conf.TokenURL))
+	}
+	if len(r) == 0 {
+		r = append(r, Result{Name: "ping", Skipped: true, Detail: "no validation services or token endpoints configured"})
+	}
+	return r
+}
+
+func pingURL(ctx context.Context, client *http.Client, timeout time.Duration, name, url string) Result {
+	name += " " + url
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Result{Name: name, Err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{Name: name, Err: err}
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Result{Name: name, Err: fmt.Errorf("answered %s", resp.Status)}
+	}
+	return Result{Name: name, Detail: "answered " + resp.Status}
+}
@@ -0,0 +1,99 @@
+package configcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	// Validation services only accept POST; a 405 still shows they are reachable
+	validation := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer validation.Close()
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		authorization.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+
+	dir := t.TempDir()
+	opts := Options{
+		Ingress: writeFile(t, dir, "ingress-config.yaml", "authn:\n  issuers:\n    - issuer: https://idp.test\n      jwks-url: "+jwks.URL+"\n"),
+		Authorization: writeFile(t, dir, "authorization.yaml",
+			"coarse-check:\n  enabled: true\n  validation-url: "+validation.URL+"\n  resource-map:\n    \"[/api/**]\": api\n"),
+		Egress: filepath.Join(dir, "egress-config.yaml"),
+		Ping:   true,
+	}
+	report := Run(context.Background(), opts)
+	var out bytes.Buffer
+	report.Write(&out)
+	if !report.OK() {
+		t.Fatalf("expected every check to pass:\n%s", out.String())
+	}
+	for _, want := range []string{
+		"skip  egress config",
+		"ok    issuer https://idp.test: 1 keys from " + jwks.URL,
+		"ok    coarse validation service " + validation.URL + ": answered 405",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the report:\n%s", want, out.String())
+		}
+	}
+
+	// An unreachable key set fails the report
+	jwks.Close()
+	report = Run(context.Background(), opts)
+	if report.OK() {
+		t.Fatal("expected the report to fail when the issuer keys cannot be fetched")
+	}
+}
+
+func TestRun_StopsAtBrokenConfig(t *testing.T) {
+	t.Cleanup(func() { authorization.SetConfigForTest(nil) })
+	dir := t.TempDir()
+	report := Run(context.Background(), Options{
+		Ingress:       filepath.Join(dir, "missing.yaml"),
+		Authorization: writeFile(t, dir, "authorization.yaml", "coarse-check:\n  enabled: false\n"),
+		Egress:        filepath.Join(dir, "egress-config.yaml"),
+	})
+	if report.OK() || len(report) != 3 {
+		t.Fatalf("expected the two broken configs to be reported and later checks skipped, got %+v", report)
+	}
+}
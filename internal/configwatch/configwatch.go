@@ -0,0 +1,102 @@
+// Package configwatch reloads configuration files when they change on disk, including the symlink
+// swap Kubernetes performs when it updates a mounted ConfigMap or Secret, and reads secrets mounted
+// as files.
+package configwatch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Config enables watching the authorization and egress configs
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is how often the files are checked for changes (default DefaultInterval)
+	Interval time.Duration `yaml:"interval"`
+}
+
+// DefaultInterval applies when config-watch does not set an interval
+const DefaultInterval = 10 * time.Second
+
+// PollInterval returns the configured interval or DefaultInterval
+func (c Config) PollInterval() time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return DefaultInterval
+}
+
+// Watch calls reload whenever one of the files returned by files changes, checking every interval
+// until ctx is done. A file changes when its symlinks resolve to another target, as on a Kubernetes
+// volume update where the ..data link is swapped in one step, or when its size or modification time
+// changes. files is re-evaluated after each reload, so files a reloaded config references are followed.
+// A failed reload is logged and leaves the previous config active; it is retried on the next change.
+func Watch(ctx context.Context, name string, interval time.Duration, files func() []string, reload func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := fingerprint(files())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := fingerprint(files())
+			if current == last {
+				continue
+			}
+			last = current
+			if err := reload(); err != nil {
+				slog.Error("config reload failed; keeping the previous config", slog.String("config", name), slog.Any("error", err))
+				continue
+			}
+			slog.Info("config reloaded", slog.String("config", name))
+			// The reloaded config may reference other files
+			last = fingerprint(files())
+		}
+	}
+}
+
+// fingerprint identifies the current content of paths by resolved target, size and modification time
+func fingerprint(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		target, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", p)
+			continue
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			fmt.Fprintf(&b, "%s:missing;", p)
+			continue
+		}
+		fmt.Fprintf(&b, "%s:%s:%d:%d;", p, target, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
+}
+
+// ReadSecret reads a secret mounted as a file, dropping the trailing newline editors and
+// kubectl create secret --from-file commonly leave
+func ReadSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// ResolveSecret returns secret, or the content of file when it is set; setting both is an error
+func ResolveSecret(secret, file string) (string, error) {
+	if file == "" {
+		return secret, nil
+	}
+	if secret != "" {
+		return "", fmt.Errorf("a secret and a secret file are mutually exclusive")
+	}
+	return ReadSecret(file)
+}
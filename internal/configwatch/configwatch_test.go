@@ -0,0 +1,80 @@
+package configwatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mountVersion writes a Kubernetes-style volume version directory and points ..data at it
+// with an atomic rename, as the kubelet does on a ConfigMap update
+func mountVersion(t *testing.T, dir, version, content string) {
+	t.Helper()
+	if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version, "config.yaml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch_FollowsSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	mountVersion(t, dir, "..v1", "a: 1\n")
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan string, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, "test", 5*time.Millisecond, func() []string { return []string{path} }, func() error {
+		b, err := os.ReadFile(path)
+		reloads <- string(b)
+		return err
+	})
+
+	// Same-size content with the same modification time still resolves to another target
+	time.Sleep(20 * time.Millisecond)
+	mountVersion(t, dir, "..v2", "a: 2\n")
+	select {
+	case got := <-reloads:
+		if got != "a: 2\n" {
+			t.Fatalf("expected the swapped-in content to be reloaded, got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload after the ..data swap")
+	}
+
+	select {
+	case got := <-reloads:
+		t.Fatalf("expected a single reload per change, got another with %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ResolveSecret("", path); err != nil || got != "s3cret" {
+		t.Fatalf("expected the file's secret without the trailing newline, got %q, %v", got, err)
+	}
+	if got, err := ResolveSecret("inline", ""); err != nil || got != "inline" {
+		t.Fatalf("expected the inline secret, got %q, %v", got, err)
+	}
+	if _, err := ResolveSecret("inline", path); err == nil {
+		t.Fatal("expected an inline secret and a secret file together to be rejected")
+	}
+}
@@ -3,25 +3,64 @@ package egressconfig
 import (
 	"fmt"
 	"os"
+	"sort"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/configwatch"
+	"reverseProxy/internal/envsubst"
 )
 
 // OAuthClientConfig represents the configuration for a single OAuth provider
 type OAuthClientConfig struct {
-	TokenURL          string   `yaml:"tokenUrl"`
-	ClientID          string   `yaml:"clientId"`
-	ClientSecret      string   `yaml:"clientSecret"`
+	TokenURL     string `yaml:"tokenUrl"`
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	// ClientSecretFile reads the client secret from a file, such as a mounted Kubernetes Secret, instead of clientSecret
+	ClientSecretFile  string   `yaml:"clientSecretFile"`
 	ClientCertificate string   `yaml:"clientCertificate"`
 	Scope             []string `yaml:"scope"`
+	// ClientAuthMethod is client_secret_post (default) or private_key_jwt, which signs a client
+	// assertion with PrivateKeyFile instead of sending the client secret
+	ClientAuthMethod string `yaml:"clientAuthMethod"`
+	PrivateKeyFile   string `yaml:"privateKeyFile"`
+	// RefreshWindow is how long before expiry a token is refreshed in the background
+	// while the current one keeps being served. Defaults to DefaultRefreshWindow.
+	RefreshWindow time.Duration `yaml:"refreshWindow"`
+}
+
+// DefaultRefreshWindow applies when an IDP does not configure refreshWindow
+const DefaultRefreshWindow = time.Minute
+
+// StaleWindow returns the configured refresh window or the default
+func (c OAuthClientConfig) StaleWindow() time.Duration {
+	if c.RefreshWindow > 0 {
+		return c.RefreshWindow
+	}
+	return DefaultRefreshWindow
 }
 
 // EgressConfig represents the entire egress proxy configuration
 type EgressConfig struct {
 	MultiOAuthClientConfig map[string]OAuthClientConfig `yaml:"multi-oauth-client-config"`
+	// AccessLog configures the egress access log; read once at startup
+	AccessLog *accesslog.Config `yaml:"access-log"`
 }
 
-var globalConfig EgressConfig
+// globalConfig holds the current immutable config snapshot; Load swaps it atomically so
+// readers on the request path never race with a reload
+var globalConfig atomic.Pointer[EgressConfig]
+
+// current returns the loaded snapshot, or an empty config when nothing was loaded
+func current() *EgressConfig {
+	if c := globalConfig.Load(); c != nil {
+		return c
+	}
+	return &EgressConfig{}
+}
 
 // Load loads the egress configuration from a YAML file
 func Load(configPath string) error {
@@ -34,20 +73,42 @@ func Load(configPath string) error {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, &globalConfig); err != nil {
+	var c EgressConfig
+	if err := envsubst.Unmarshal(data, &c); err != nil {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	return install(&c)
+}
+
+// LoadNode loads the egress configuration from a parsed YAML node, such as the egress section of
+// the unified config file
+func LoadNode(n *yaml.Node) error {
+	var c EgressConfig
+	if err := n.Decode(&c); err != nil {
+		return err
+	}
+	return install(&c)
+}
 
-	if globalConfig.MultiOAuthClientConfig == nil {
-		globalConfig.MultiOAuthClientConfig = make(map[string]OAuthClientConfig)
+// install resolves the secret files of c and makes it the current config
+func install(c *EgressConfig) (err error) {
+	if c.MultiOAuthClientConfig == nil {
+		c.MultiOAuthClientConfig = make(map[string]OAuthClientConfig)
+	}
+	for idpType, oc := range c.MultiOAuthClientConfig {
+		if oc.ClientSecret, err = configwatch.ResolveSecret(oc.ClientSecret, oc.ClientSecretFile); err != nil {
+			return fmt.Errorf("IDP type '%s': %w", idpType, err)
+		}
+		c.MultiOAuthClientConfig[idpType] = oc
 	}
 
+	globalConfig.Store(c)
 	return nil
 }
 
 // GetOAuthConfig returns the OAuth configuration for a given IDP type
 func GetOAuthConfig(idpType string) (OAuthClientConfig, error) {
-	config, exists := globalConfig.MultiOAuthClientConfig[idpType]
+	config, exists := current().MultiOAuthClientConfig[idpType]
 	if !exists {
 		return OAuthClientConfig{}, fmt.Errorf("IDP type '%s' not found in configuration", idpType)
 	}
@@ -56,9 +117,30 @@ func GetOAuthConfig(idpType string) (OAuthClientConfig, error) {
 
 // GetAllIDPTypes returns all configured IDP types
 func GetAllIDPTypes() []string {
-	idpTypes := make([]string, 0, len(globalConfig.MultiOAuthClientConfig))
-	for idpType := range globalConfig.MultiOAuthClientConfig {
+	c := current()
+	idpTypes := make([]string, 0, len(c.MultiOAuthClientConfig))
+	for idpType := range c.MultiOAuthClientConfig {
 		idpTypes = append(idpTypes, idpType)
 	}
 	return idpTypes
 }
+
+// SecretFiles lists the files the loaded config reads secrets and keys from, so a watcher can
+// reload it when they change
+func SecretFiles() []string {
+	var files []string
+	for _, oc := range current().MultiOAuthClientConfig {
+		for _, f := range []string{oc.ClientSecretFile, oc.PrivateKeyFile} {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// AccessLogConfig returns the egress access log settings, or nil when none are configured
+func AccessLogConfig() *accesslog.Config {
+	return current().AccessLog
+}
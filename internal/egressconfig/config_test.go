@@ -2,6 +2,7 @@ package egressconfig
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -34,7 +35,7 @@ func TestLoadConfig(t *testing.T) {
 	tmpFile.Close()
 
 	// Reset global config for testing
-	globalConfig = EgressConfig{}
+	globalConfig.Store(&EgressConfig{})
 
 	// Load the config
 	if err := Load(tmpFile.Name()); err != nil {
@@ -42,8 +43,8 @@ func TestLoadConfig(t *testing.T) {
 	}
 
 	// Verify the config was loaded
-	if len(globalConfig.MultiOAuthClientConfig) != 2 {
-		t.Errorf("Expected 2 IDP configs, got %d", len(globalConfig.MultiOAuthClientConfig))
+	if len(globalConfig.Load().MultiOAuthClientConfig) != 2 {
+		t.Errorf("Expected 2 IDP configs, got %d", len(globalConfig.Load().MultiOAuthClientConfig))
 	}
 
 	// Test GetOAuthConfig
@@ -64,12 +65,45 @@ func TestLoadConfig(t *testing.T) {
 
 func TestGetOAuthConfigNotFound(t *testing.T) {
 	// Reset global config
-	globalConfig = EgressConfig{
+	globalConfig.Store(&EgressConfig{
 		MultiOAuthClientConfig: make(map[string]OAuthClientConfig),
-	}
+	})
 
 	_, err := GetOAuthConfig("nonexistent")
 	if err == nil {
 		t.Error("Expected error for nonexistent IDP type")
 	}
 }
+
+func TestLoadConfig_ClientSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "client-secret")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "egress-config.yaml")
+	conf := "multi-oauth-client-config:\n  ping:\n    clientId: ping-client\n    clientSecretFile: " + secret + "\n"
+	if err := os.WriteFile(path, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { globalConfig.Store(&EgressConfig{}) })
+
+	if err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ping, _ := GetOAuthConfig("ping")
+	if ping.ClientSecret != "from-file" {
+		t.Fatalf("expected the secret read from the file, got %q", ping.ClientSecret)
+	}
+	if files := SecretFiles(); len(files) != 1 || files[0] != secret {
+		t.Fatalf("expected the secret file to be watched, got %v", files)
+	}
+
+	conf = "multi-oauth-client-config:\n  ping:\n    clientSecret: inline\n    clientSecretFile: " + secret + "\n"
+	if err := os.WriteFile(path, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path); err == nil {
+		t.Fatal("expected clientSecret and clientSecretFile together to be rejected")
+	}
+}
@@ -1,19 +1,50 @@
 package egressproxy
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel/attribute"
 
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/logging"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/tokenmanager"
 	"reverseProxy/internal/tokenstorage"
+	"reverseProxy/internal/tracing"
 )
 
 // Handler handles egress proxy requests
-func Handler(c fiber.Ctx) error {
+func Handler(c fiber.Ctx) (err error) {
+	start := time.Now()
+	ctx, span := tracing.StartServerSpan(c, "egress "+c.Method())
+	defer func() {
+		idpType := strings.ToLower(c.Get("X-Idp-Type", "noIdp"))
+		status := metrics.StatusOf(c, err)
+		slog.InfoContext(ctx, "egress request",
+			slog.String("request_id", logging.RequestIDFrom(c)),
+			slog.String("method", c.Method()),
+			slog.String("backend", c.Get("X-Backend-Url")),
+			slog.String("idp_type", idpType),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+		)
+		metrics.EgressRequests.WithLabelValues(idpType, strconv.Itoa(status)).Inc()
+		metrics.EgressLatency.WithLabelValues(idpType).Observe(metrics.Since(start))
+		span.SetAttributes(attribute.String("idp_type", idpType), attribute.Int("http.response.status_code", status))
+		tracing.End(span, err)
+	}()
+
 	// Get the backend URL from the X-Backend-Url header
 	backendURL := c.Get("X-Backend-Url")
 	if backendURL == "" {
@@ -47,7 +78,7 @@ func Handler(c fiber.Ctx) error {
 	targetURL := backendURL + path
 
 	// Create a new HTTP request
-	req, err := createHTTPRequest(c, targetURL, idpType)
+	req, err := createHTTPRequest(ctx, c, targetURL, idpType)
 	if err != nil {
 		return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("failed to create request: %v", err))
 	}
@@ -57,10 +88,10 @@ func Handler(c fiber.Ctx) error {
 	resp, err := client.Do(req)
 	if err != nil {
 		// Forward backend errors as-is
-		log.Printf("Backend request failed: %v", err)
+		slog.WarnContext(ctx, "backend request failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
 		return fiber.NewError(fiber.StatusBadGateway, fmt.Sprintf("backend request failed: %v", err))
 	}
-	defer resp.Body.Close()
+	accesslog.SetUpstreamStatus(c, resp.StatusCode)
 
 	// Copy response headers to the Fiber context
 	for key, values := range resp.Header {
@@ -69,20 +100,56 @@ func Handler(c fiber.Ctx) error {
 		}
 	}
 
+	// Relay bodies of unknown length (server-sent events, long-lived chunked responses) as they arrive
+	if isStreaming(resp) {
+		c.Status(resp.StatusCode)
+		return c.SendStreamWriter(func(w *bufio.Writer) {
+			defer resp.Body.Close()
+			streamBody(w, resp.Body)
+		})
+	}
+	defer resp.Body.Close()
+
 	// Read and send the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Failed to read response body: %v", err)
+		slog.WarnContext(ctx, "failed to read response body", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
 		return fiber.NewError(fiber.StatusInternalServerError, "failed to read response body")
 	}
 
 	return c.Status(resp.StatusCode).Send(body)
 }
 
+// isStreaming reports whether a response body should be relayed as it arrives rather than read whole
+func isStreaming(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return resp.ContentLength < 0 || mediaType == "text/event-stream"
+}
+
+// streamBody copies body to w, flushing after every read, until either side ends
+func streamBody(w *bufio.Writer, body io.Reader) {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			// a flush error means the client went away
+			if werr := w.Flush(); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 // createHTTPRequest creates an HTTP request with proper headers and authentication
-func createHTTPRequest(c fiber.Ctx, targetURL, idpType string) (*http.Request, error) {
+func createHTTPRequest(ctx context.Context, c fiber.Ctx, targetURL, idpType string) (*http.Request, error) {
 	// Create request
-	req, err := http.NewRequest(c.Method(), targetURL, nil)
+	req, err := http.NewRequestWithContext(ctx, c.Method(), targetURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -113,9 +180,11 @@ func createHTTPRequest(c fiber.Ctx, targetURL, idpType string) (*http.Request, e
 	// Add authorization header if IDP type is not "noIdp"
 	// Skip Authorization header for noIdp mode (case-insensitive)
 	if idpType != "noidp" {
+		_, tokenSpan := tracing.Tracer().Start(ctx, "egress.token")
 		token, err := getToken(idpType)
+		tracing.End(tokenSpan, err)
 		if err != nil {
-			log.Printf("Failed to get token for IDP type '%s': %v", idpType, err)
+			slog.WarnContext(ctx, "failed to get token", slog.String("idp_type", idpType), slog.Any("error", err))
 			// Continue without token - let the backend handle it
 		} else if token != "" {
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
@@ -123,15 +192,29 @@ func createHTTPRequest(c fiber.Ctx, targetURL, idpType string) (*http.Request, e
 	}
 	// For noIdp mode, no Authorization header is added
 
+	// Propagate the trace context to the backend
+	tracing.InjectHTTP(ctx, req.Header)
+
 	return req, nil
 }
 
-// getToken retrieves a token for the given IDP type
+// getToken retrieves a token for the given IDP type. When the token is missing or within the
+// IDP's refresh window of expiry, a background refresh is started and the current token (if any)
+// is served immediately, so the request never waits on the token endpoint.
 func getToken(idpType string) (string, error) {
 	storage := tokenstorage.GetInstance()
 	token, err := storage.GetToken(idpType)
+	if conf, confErr := egressconfig.GetOAuthConfig(idpType); confErr == nil {
+		expiresAt, inMemory := storage.ExpiresAt(idpType)
+		if err != nil || !inMemory || time.Until(expiresAt) < conf.StaleWindow() {
+			refreshAsync(idpType)
+		}
+	}
 	if err != nil {
 		return "", err
 	}
 	return token, nil
 }
+
+// refreshAsync is an indirection over the token manager to allow stubbing in tests
+var refreshAsync = func(idpType string) { tokenmanager.GetInstance().RefreshAsync(idpType) }
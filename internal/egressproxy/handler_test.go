@@ -1,7 +1,9 @@
 package egressproxy
 
 import (
+	"bufio"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -123,3 +125,39 @@ func TestHandlerBackendError(t *testing.T) {
 		t.Errorf("Expected status 500, got %d", resp.StatusCode)
 	}
 }
+
+func TestHandlerStreamsEvents(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: two\n\n"))
+	}))
+	defer backend.Close()
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	// release the upstream first: shutdown waits for the stream to end
+	defer func() { close(release); _ = app.Shutdown() }()
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/events", nil)
+	req.Header.Set("X-Backend-Url", backend.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the first event arrives while the backend is still holding the second
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: one\n" {
+		t.Fatalf("expected the first event before the stream ends, got %q %v", line, err)
+	}
+}
@@ -0,0 +1,59 @@
+package egressproxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/tokenstorage"
+)
+
+func TestGetTokenServesStaleTokenAndRefreshesInBackground(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "egress-config.yaml")
+	configContent := "multi-oauth-client-config:\n  stale-idp:\n    tokenUrl: http://127.0.0.1:0/token\n    refreshWindow: 5m\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := egressconfig.Load(configPath); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	refreshed := make(chan string, 1)
+	oldRefresh := refreshAsync
+	refreshAsync = func(idpType string) { refreshed <- idpType }
+	t.Cleanup(func() { refreshAsync = oldRefresh })
+
+	storage := tokenstorage.GetInstance()
+	if err := storage.SaveToken("stale-idp", "about-to-expire", 1*time.Minute); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+	t.Cleanup(func() { _ = storage.ClearToken("stale-idp") })
+
+	token, err := getToken("stale-idp")
+	if err != nil || token != "about-to-expire" {
+		t.Fatalf("Expected current token to be served, got '%s' (%v)", token, err)
+	}
+	select {
+	case idp := <-refreshed:
+		if idp != "stale-idp" {
+			t.Errorf("Expected refresh for 'stale-idp', got '%s'", idp)
+		}
+	default:
+		t.Error("Expected a background refresh for a token inside the refresh window")
+	}
+
+	// a token well outside the window is served without a refresh
+	if err := storage.SaveToken("stale-idp", "fresh", 1*time.Hour); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+	if _, err := getToken("stale-idp"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case <-refreshed:
+		t.Error("Did not expect a refresh for a fresh token")
+	default:
+	}
+}
@@ -0,0 +1,107 @@
+// Package envsubst expands environment variable placeholders in YAML configuration values, so
+// secrets and URLs can be injected per environment without templating the files.
+package envsubst
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Unmarshal decodes YAML data into v after expanding the placeholders in its scalar values:
+// ${NAME} is the variable's value and fails when it is unset, ${NAME:-default} falls back to
+// default when it is unset or empty, and $${ escapes a literal ${. Comments are not expanded,
+// and a $ not followed by { is kept as is, so regular expressions need no escaping.
+func Unmarshal(data []byte, v any) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if err := ExpandNode(&doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		return nil
+	}
+	return doc.Decode(v)
+}
+
+// ExpandNode expands the placeholders of every scalar under n. A plain scalar is re-typed from
+// its expanded value, so ${ENABLED:-true} decodes into a bool; a quoted one stays a string.
+func ExpandNode(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		value, err := Expand(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = value
+		if n.Style == 0 {
+			n.Tag = ""
+		}
+		return nil
+	}
+	for _, c := range n.Content {
+		if err := ExpandNode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Expand replaces the ${NAME} and ${NAME:-default} placeholders in s with environment values
+func Expand(s string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// $${ is a literal ${
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated placeholder in %q", s[i:])
+		}
+		name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+		if !validName(name) {
+			// Not a placeholder, e.g. a regular expression replacement such as ${1}
+			b.WriteString(s[:i+end+1])
+			s = s[i+end+1:]
+			continue
+		}
+		value, set := os.LookupEnv(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !set:
+			return "", fmt.Errorf("environment variable %s is not set (use ${%s:-default} for an optional value)", name, name)
+		}
+		b.WriteString(s[:i])
+		b.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// validName reports whether name is a shell-style variable name
+func validName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package envsubst
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("AUTHZ_HOST", "authz.internal")
+	t.Setenv("EMPTY", "")
+
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"http://${AUTHZ_HOST}:8080/check", "http://authz.internal:8080/check"},
+		{"${MISSING:-fallback}", "fallback"},
+		{"${EMPTY:-fallback}", "fallback"},
+		{"${AUTHZ_HOST:-fallback}", "authz.internal"},
+		{"$${AUTHZ_HOST}", "${AUTHZ_HOST}"},
+		{"^/orders/(\\d+)$ -> /v2/orders/${1}", "^/orders/(\\d+)$ -> /v2/orders/${1}"},
+	} {
+		got, err := Expand(tc.in)
+		if err != nil || got != tc.want {
+			t.Fatalf("Expand(%q): expected %q, got %q, %v", tc.in, tc.want, got, err)
+		}
+	}
+
+	if _, err := Expand("${MISSING}"); err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Fatalf("expected an error naming the unset variable, got %v", err)
+	}
+	if _, err := Expand("${UNTERMINATED"); err == nil {
+		t.Fatal("expected an unterminated placeholder to be rejected")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Setenv("CLIENT_SECRET", "s3cret")
+	t.Setenv("ENABLED", "true")
+
+	var c struct {
+		Enabled  bool          `yaml:"enabled"`
+		Secret   string        `yaml:"secret"`
+		Quoted   string        `yaml:"quoted"`
+		Interval time.Duration `yaml:"interval"`
+	}
+	data := "# ${NOT_EXPANDED} in comments\nenabled: ${ENABLED}\nsecret: ${CLIENT_SECRET}\nquoted: \"${ENABLED}\"\ninterval: ${INTERVAL:-30s}\n"
+	if err := Unmarshal([]byte(data), &c); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !c.Enabled || c.Secret != "s3cret" || c.Quoted != "true" || c.Interval != 30*time.Second {
+		t.Fatalf("unexpected result %+v", c)
+	}
+
+	err := Unmarshal([]byte("a: 1\nsecret: ${NOT_SET_ANYWHERE}\n"), &c)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected an error locating the unset variable, got %v", err)
+	}
+}
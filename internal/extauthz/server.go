@@ -0,0 +1,190 @@
+// Package extauthz serves the Envoy external authorization gRPC API (envoy.service.auth.v3) so the
+// sidecar's authentication and authorization pipeline can run behind Envoy or Istio.
+package extauthz
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"reverseProxy/internal/logging"
+)
+
+// DefaultAddress is where the gRPC server listens when address is not set
+const DefaultAddress = ":9001"
+
+// Config enables the ext_authz gRPC server; read once at startup
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Address the gRPC server listens on (default :9001)
+	Address string `yaml:"address"`
+}
+
+// ListenAddress returns the configured address or DefaultAddress
+func (c Config) ListenAddress() string {
+	if c.Address == "" {
+		return DefaultAddress
+	}
+	return c.Address
+}
+
+// Server answers CheckRequests by replaying them as HTTP requests through a fiber handler.
+// Client certificates are not forwarded by Envoy, so routes using mtls authentication deny.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+	handler fasthttp.RequestHandler
+}
+
+// callContextKey carries the gRPC call context from Check to the fiber handler
+type callContextKey struct{}
+
+// New builds a server running check (typically proxyhandler.Check) for every CheckRequest
+// after the admission handlers, which refuse requests ahead of authentication as on the ingress
+// listener (ip-access, maintenance, load shedding)
+func New(check fiber.Handler, admission ...fiber.Handler) *Server {
+	app := fiber.New()
+	app.Use(callContext)
+	app.Use(logging.RequestID)
+	for _, h := range admission {
+		app.Use(h)
+	}
+	app.All("/*", check)
+	return &Server{handler: app.Handler()}
+}
+
+// callContext makes the gRPC call context the request context, so authorization calls are
+// abandoned when Envoy cancels the check or its deadline passes
+func callContext(c fiber.Ctx) error {
+	if ctx, ok := c.RequestCtx().UserValue(callContextKey{}).(context.Context); ok {
+		c.SetContext(ctx)
+	}
+	return c.Next()
+}
+
+// Register adds the authorization service to a gRPC server
+func (s *Server) Register(g *grpc.Server) {
+	authv3.RegisterAuthorizationServer(g, s)
+}
+
+// Check authorizes a single request. An allowed request returns the headers to add or replace
+// upstream (principal headers, token mode); a denied one returns the sidecar's HTTP error response.
+func (s *Server) Check(ctx context.Context, req *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attrs := req.GetAttributes()
+	httpReq := attrs.GetRequest().GetHttp()
+	in := requestHeaders(httpReq)
+
+	var r fasthttp.Request
+	r.Header.SetMethod(httpReq.GetMethod())
+	r.SetRequestURI(httpReq.GetPath())
+	for name, value := range in {
+		r.Header.Set(name, value)
+	}
+	r.Header.SetHost(httpReq.GetHost())
+	if body := httpReq.GetRawBody(); len(body) > 0 {
+		r.SetBody(body)
+	} else if httpReq.GetBody() != "" {
+		r.SetBodyString(httpReq.GetBody())
+	}
+
+	var fctx fasthttp.RequestCtx
+	fctx.Init(&r, sourceAddr(attrs.GetSource()), nil)
+	fctx.SetUserValue(callContextKey{}, ctx)
+	s.handler(&fctx)
+
+	code := fctx.Response.StatusCode()
+	if code == fiber.StatusOK {
+		ok := &authv3.OkHttpResponse{}
+		out := make(map[string]string)
+		for name, value := range fctx.Request.Header.All() {
+			key := strings.ToLower(string(name))
+			out[key] = string(value)
+			if key == "host" || in[key] == string(value) {
+				continue
+			}
+			ok.Headers = append(ok.Headers, headerOption(key, string(value)))
+		}
+		for name := range in {
+			if _, kept := out[name]; !kept && name != "host" {
+				ok.HeadersToRemove = append(ok.HeadersToRemove, name)
+			}
+		}
+		return &authv3.CheckResponse{
+			Status:       &status.Status{Code: int32(codes.OK)},
+			HttpResponse: &authv3.CheckResponse_OkResponse{OkResponse: ok},
+		}, nil
+	}
+
+	denied := &authv3.DeniedHttpResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+		Body:   string(fctx.Response.Body()),
+	}
+	for name, value := range fctx.Response.Header.All() {
+		if bytes.EqualFold(name, []byte(fiber.HeaderContentLength)) {
+			continue
+		}
+		denied.Headers = append(denied.Headers, headerOption(string(name), string(value)))
+	}
+	rpcCode := codes.PermissionDenied
+	if code == fiber.StatusUnauthorized {
+		rpcCode = codes.Unauthenticated
+	}
+	return &authv3.CheckResponse{
+		Status:       &status.Status{Code: int32(rpcCode)},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{DeniedResponse: denied},
+	}, nil
+}
+
+// requestHeaders returns the request headers keyed by lower-case name, without HTTP/2 pseudo-headers.
+// Envoy sends either the headers map or, with encode_raw_headers, the header map.
+func requestHeaders(httpReq *authv3.AttributeContext_HttpRequest) map[string]string {
+	headers := make(map[string]string)
+	add := func(name, value string) {
+		if strings.HasPrefix(name, ":") {
+			return
+		}
+		name = strings.ToLower(name)
+		if prev, ok := headers[name]; ok {
+			value = prev + "," + value
+		}
+		headers[name] = value
+	}
+	for name, value := range httpReq.GetHeaders() {
+		add(name, value)
+	}
+	for _, h := range httpReq.GetHeaderMap().GetHeaders() {
+		value := h.GetValue()
+		if raw := h.GetRawValue(); len(raw) > 0 {
+			value = string(raw)
+		}
+		add(h.GetKey(), value)
+	}
+	return headers
+}
+
+// headerOption sets a header, replacing any existing value
+func headerOption(name, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// sourceAddr is the downstream peer address reported by Envoy, or nil when absent
+func sourceAddr(peer *authv3.AttributeContext_Peer) net.Addr {
+	sock := peer.GetAddress().GetSocketAddress()
+	ip := net.ParseIP(sock.GetAddress())
+	if ip == nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: ip, Port: int(sock.GetPortValue())}
+}
@@ -0,0 +1,119 @@
+package extauthz
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/gofiber/fiber/v3"
+	"google.golang.org/grpc/codes"
+)
+
+// stubCheck allows requests carrying "Bearer ok", replacing the token with a user header
+func stubCheck(c fiber.Ctx) error {
+	if c.Get(fiber.HeaderAuthorization) != "Bearer ok" {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing or malformed token")
+	}
+	if c.Method() != "POST" || c.Path() != "/orders" || c.Query("id") != "7" || string(c.Body()) != `{"a":1}` {
+		return fiber.NewError(fiber.StatusForbidden, "unexpected request "+c.Method()+" "+c.OriginalURL())
+	}
+	c.Request().Header.Del(fiber.HeaderAuthorization)
+	c.Request().Header.Set("X-User-Id", "u1")
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func checkRequest(authorization string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{Attributes: &authv3.AttributeContext{
+		Source: &authv3.AttributeContext_Peer{Address: &corev3.Address{Address: &corev3.Address_SocketAddress{
+			SocketAddress: &corev3.SocketAddress{Address: "10.0.0.7", PortSpecifier: &corev3.SocketAddress_PortValue{PortValue: 51000}},
+		}}},
+		Request: &authv3.AttributeContext_Request{Http: &authv3.AttributeContext_HttpRequest{
+			Method:  "POST",
+			Path:    "/orders?id=7",
+			Host:    "orders.internal",
+			Headers: map[string]string{":authority": "orders.internal", "authorization": authorization, "content-type": "application/json"},
+			RawBody: []byte(`{"a":1}`),
+		}},
+	}}
+}
+
+func TestCheck_Allowed(t *testing.T) {
+	resp, err := New(stubCheck).Check(context.Background(), checkRequest("Bearer ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes.Code(resp.GetStatus().GetCode()) != codes.OK {
+		t.Fatalf("expected OK, got %v: %s", resp.GetStatus(), resp.GetDeniedResponse().GetBody())
+	}
+	ok := resp.GetOkResponse()
+	headers := map[string]string{}
+	for _, h := range ok.GetHeaders() {
+		headers[h.GetHeader().GetKey()] = h.GetHeader().GetValue()
+	}
+	if headers["x-user-id"] != "u1" {
+		t.Errorf("expected x-user-id to be added, got %v", headers)
+	}
+	if _, ok := headers["content-type"]; ok {
+		t.Errorf("unchanged headers should not be returned: %v", headers)
+	}
+	if removed := ok.GetHeadersToRemove(); len(removed) != 1 || removed[0] != "authorization" {
+		t.Errorf("expected authorization to be removed, got %v", removed)
+	}
+}
+
+func TestCheck_Denied(t *testing.T) {
+	resp, err := New(stubCheck).Check(context.Background(), checkRequest("Bearer bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes.Code(resp.GetStatus().GetCode()) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated, got %v", resp.GetStatus())
+	}
+	denied := resp.GetDeniedResponse()
+	if denied.GetStatus().GetCode() != 401 || denied.GetBody() != "Missing or malformed token" {
+		t.Errorf("expected the 401 response to be relayed, got %d %q", denied.GetStatus().GetCode(), denied.GetBody())
+	}
+	var challenge string
+	for _, h := range denied.GetHeaders() {
+		if strings.EqualFold(h.GetHeader().GetKey(), fiber.HeaderWWWAuthenticate) {
+			challenge = h.GetHeader().GetValue()
+		}
+	}
+	if challenge != "Bearer" {
+		t.Errorf("expected WWW-Authenticate to be relayed, got %q", challenge)
+	}
+}
+
+func TestCheck_UsesCallContext(t *testing.T) {
+	type key struct{}
+	var got any
+	s := New(func(c fiber.Ctx) error {
+		got = c.Context().Value(key{})
+		return c.SendStatus(fiber.StatusOK)
+	})
+	ctx := context.WithValue(context.Background(), key{}, "call")
+	if _, err := s.Check(ctx, checkRequest("Bearer ok")); err != nil {
+		t.Fatal(err)
+	}
+	if got != "call" {
+		t.Fatalf("expected the gRPC call context to reach the handler, got %v", got)
+	}
+}
+
+func TestCheck_RunsAdmissionFirst(t *testing.T) {
+	var source string
+	refuse := func(c fiber.Ctx) error {
+		source = c.IP()
+		return fiber.NewError(fiber.StatusForbidden, "client IP not allowed")
+	}
+	resp, err := New(stubCheck, refuse).Check(context.Background(), checkRequest("Bearer ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "10.0.0.7" || resp.GetDeniedResponse().GetStatus().GetCode() != 403 {
+		t.Fatalf("expected the admission handler to refuse the Envoy source, got %q %v", source, resp.GetStatus())
+	}
+}
@@ -0,0 +1,185 @@
+// Package grpcproxy serves gRPC (and any other HTTP/2 cleartext traffic) at the ingress. Fiber runs
+// on fasthttp, which speaks HTTP/1.1 only, so gRPC gets its own h2c listener that authenticates
+// and authorizes each call through the proxy pipeline before streaming it, trailers included, to
+// the upstream.
+package grpcproxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/grpc/codes"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/logging"
+)
+
+// Server authorizes gRPC calls by replaying their headers through a fiber handler, then proxies
+// them. A call is a POST to /<package>.<Service>/<Method>, so resource-map keys and public-paths
+// match the full method name, e.g. "[/orders.v1.OrderService/*:POST]". The body is streamed
+// and never inspected. Client certificates are not available, so routes using mtls authentication deny.
+type Server struct {
+	check     fasthttp.RequestHandler
+	transport http.RoundTripper
+}
+
+// callContextKey carries the call's context from ServeHTTP to the fiber handler
+type callContextKey struct{}
+
+// New builds a server running check (typically proxyhandler.Check) for every call
+// after the admission handlers, which refuse requests ahead of authentication as on the ingress
+// listener (ip-access, maintenance, load shedding)
+func New(check fiber.Handler, admission ...fiber.Handler) *Server {
+	app := fiber.New()
+	app.Use(callContext)
+	app.Use(logging.RequestID)
+	for _, h := range admission {
+		app.Use(h)
+	}
+	app.All("/*", check)
+	return &Server{check: app.Handler(), transport: newTransport()}
+}
+
+// newTransport speaks HTTP/2 to upstreams: h2c for http:// and negotiated HTTP/2 for https://
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP2(true)
+	t.Protocols.SetUnencryptedHTTP2(true)
+	return t
+}
+
+// callContext makes the call's context the request context, so authorization calls are abandoned
+// when the client cancels
+func callContext(c fiber.Ctx) error {
+	if ctx, ok := c.RequestCtx().UserValue(callContextKey{}).(context.Context); ok {
+		c.SetContext(ctx)
+	}
+	return c.Next()
+}
+
+// HTTPServer returns an http.Server serving the proxy over h2c (and HTTP/1.1 for non-gRPC clients)
+func (s *Server) HTTPServer(addr string) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: addr, Handler: s, Protocols: protocols}
+}
+
+// ServeHTTP authorizes the call and proxies it to the upstream its route resolves to. The upstream
+// request carries the headers as the pipeline left them: principal headers, token mode and
+// request obligations applied, credentials removed where the route says so.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req fasthttp.Request
+	req.Header.SetMethod(r.Method)
+	req.SetRequestURI(r.URL.RequestURI())
+	for name, values := range r.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.SetHost(r.Host)
+
+	var fctx fasthttp.RequestCtx
+	fctx.Init(&req, remoteAddr(r.RemoteAddr), nil)
+	fctx.SetUserValue(callContextKey{}, r.Context())
+	s.check(&fctx)
+	if code := fctx.Response.StatusCode(); code != fiber.StatusOK {
+		deny(w, code, string(fctx.Response.Body()))
+		return
+	}
+
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		deny(w, fiber.StatusBadGateway, "no upstream configured")
+		return
+	}
+	target, ok := conf.Resolve(r.Host, r.URL.Path)
+	if !ok {
+		deny(w, fiber.StatusBadGateway, "no upstream configured for "+r.URL.Path)
+		return
+	}
+	upstream, err := url.Parse(target.Upstream)
+	if err != nil {
+		deny(w, fiber.StatusBadGateway, "invalid upstream")
+		return
+	}
+
+	header := make(http.Header, len(r.Header))
+	for name, value := range fctx.Request.Header.All() {
+		if k := http.CanonicalHeaderKey(string(name)); !skipHeaders[k] {
+			header.Add(k, string(value))
+		}
+	}
+	ctx := r.Context()
+	if target.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, target.Timeout)
+		defer cancel()
+	}
+	proxy := &httputil.ReverseProxy{
+		Transport: s.transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// the proxy already reduced TE to "trailers", which gRPC requires
+			if te := pr.Out.Header.Get("Te"); te != "" {
+				header.Set("Te", te)
+			}
+			pr.Out.Header = header
+			pr.Out.URL.Scheme, pr.Out.URL.Host = upstream.Scheme, upstream.Host
+			pr.Out.URL.Path, pr.Out.URL.RawPath = upstream.Path+target.Path, ""
+			pr.Out.Host = ""
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			deny(w, fiber.StatusBadGateway, "upstream unavailable")
+		},
+	}
+	proxy.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// skipHeaders are not copied from the pipeline to the upstream request: the host is the
+// upstream's, and hop-by-hop headers are the proxy's to set
+var skipHeaders = map[string]bool{
+	"Host": true, "Content-Length": true, "Connection": true, "Keep-Alive": true, "Proxy-Connection": true,
+	"Transfer-Encoding": true, "Upgrade": true, "Te": true, "Trailer": true,
+}
+
+// deny answers with a trailers-only gRPC error carrying the status the pipeline chose
+func deny(w http.ResponseWriter, httpStatus int, message string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(int(grpcCode(httpStatus))))
+	h.Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcCode maps the pipeline's HTTP status to the gRPC status code clients expect
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case fiber.StatusUnauthorized:
+		return codes.Unauthenticated
+	case fiber.StatusForbidden:
+		return codes.PermissionDenied
+	case fiber.StatusTooManyRequests, fiber.StatusServiceUnavailable, fiber.StatusBadGateway:
+		return codes.Unavailable
+	case fiber.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case fiber.StatusNotFound:
+		return codes.Unimplemented
+	}
+	return codes.Internal
+}
+
+// remoteAddr parses the client address for the pipeline's logs, or nil when malformed
+func remoteAddr(addr string) net.Addr {
+	a, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil
+	}
+	return a
+}
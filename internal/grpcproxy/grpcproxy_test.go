@@ -0,0 +1,114 @@
+package grpcproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// stubCheck allows calls carrying "Bearer ok" except to the Delete method, replacing the token with a user header
+func stubCheck(c fiber.Ctx) error {
+	if c.Get(fiber.HeaderAuthorization) != "Bearer ok" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing or malformed token")
+	}
+	if c.Path() == "/orders.v1.OrderService/Delete" {
+		return fiber.NewError(fiber.StatusForbidden, "coarse check denied")
+	}
+	c.Request().Header.Del(fiber.HeaderAuthorization)
+	c.Request().Header.Set("X-User-Id", "u1")
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func h2cServer(h http.Handler) *httptest.Server {
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	return srv
+}
+
+func TestServer_ProxiesGRPC(t *testing.T) {
+	upstream := h2cServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.URL.Path != "/orders.v1.OrderService/Get" || string(body) != "frame" {
+			t.Errorf("unexpected upstream request %s %s %q", r.Proto, r.URL.Path, body)
+		}
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-User-Id") != "u1" || r.Header.Get("Te") != "trailers" {
+			t.Errorf("unexpected upstream headers %v", r.Header)
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte("reply"))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	defer upstream.Close()
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: upstream.URL})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	proxy := h2cServer(New(stubCheck))
+	defer proxy.Close()
+	client := &http.Client{Transport: newTransport()}
+	call := func(method, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("POST", proxy.URL+"/orders.v1.OrderService/"+method, strings.NewReader("frame"))
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		req.Header.Set("Authorization", token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := call("Get", "Bearer ok")
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "reply" || resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("expected the reply and its trailers over HTTP/2, got %s %q %v", resp.Proto, body, resp.Trailer)
+	}
+
+	for method, want := range map[string]string{"Delete": "7", "Get": "16"} {
+		token := "Bearer ok"
+		if method == "Get" {
+			token = "Bearer bad"
+		}
+		resp := call(method, token)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Grpc-Status") != want {
+			t.Errorf("%s: expected grpc-status %s, got %d %v", method, want, resp.StatusCode, resp.Header)
+		}
+	}
+}
+
+func TestServer_RunsAdmissionFirst(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://unreachable.internal"})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	checked := false
+	check := func(c fiber.Ctx) error { checked = true; return stubCheck(c) }
+	refuse := func(c fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "service under maintenance")
+	}
+	proxy := h2cServer(New(check, refuse))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("POST", proxy.URL+"/orders.v1.OrderService/Get", strings.NewReader("frame"))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Authorization", "Bearer ok")
+	resp, err := (&http.Client{Transport: newTransport()}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if checked || resp.Header.Get("Grpc-Status") != "14" {
+		t.Fatalf("expected the admission handler to refuse the call as unavailable, got %v", resp.Header)
+	}
+}
@@ -0,0 +1,659 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/apikey"
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/configwatch"
+	"reverseProxy/internal/extauthz"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/plugins"
+	"reverseProxy/internal/replay"
+	"reverseProxy/internal/revocation"
+	"reverseProxy/internal/tokenexchange"
+	"reverseProxy/internal/transform"
+)
+
+// IngressConfig represents the ingress proxy configuration loaded from ingress-config.yaml
+type IngressConfig struct {
+	// DefaultUpstream is the base URL requests are proxied to when no route sets an upstream
+	DefaultUpstream string `yaml:"default-upstream"`
+	// PriorityHeader names the request header carrying an integer priority (default X-Request-Priority);
+	// it is only believed from client-ip.trusted-proxies
+	PriorityHeader string  `yaml:"priority-header"`
+	Routes         []Route `yaml:"routes"`
+	// PublicPaths skip authentication and authorization; patterns use the authorization.yaml wildcard syntax
+	PublicPaths []string `yaml:"public-paths"`
+	// RateLimit limits requests per client on routes without a rate-limit of their own
+	RateLimit *RateLimit `yaml:"rate-limit"`
+	// Retry retries failed upstream attempts on routes without a retry policy of their own
+	Retry *RetryPolicy `yaml:"retry"`
+	// MaxInFlight caps the requests the ingress handles at once; zero means no limit
+	MaxInFlight int `yaml:"max-in-flight"`
+	// MaxBodyBytes caps request bodies on routes without a max-body-bytes of their own (default
+	// DefaultMaxBodyBytes). The listener refuses larger bodies while reading them, with the value read at startup.
+	MaxBodyBytes int `yaml:"max-body-bytes"`
+	// Maintenance is the 503 answered while maintenance mode is switched on through the admin API
+	Maintenance *MaintenancePage `yaml:"maintenance"`
+	// ErrorResponses shapes the bodies of the errors the ingress returns
+	ErrorResponses *ErrorResponses `yaml:"error-responses"`
+	// SecurityHeaders are set on every ingress response, overriding the upstream's; an empty value removes the header
+	SecurityHeaders map[string]string `yaml:"security-headers"`
+	// ClientIP derives the client IP behind trusted proxies, for ip-access, rate limits and the access log
+	ClientIP *ClientIPConfig `yaml:"client-ip"`
+	// IPAccess admits clients by IP before authentication, on every route
+	IPAccess *IPAccess `yaml:"ip-access"`
+	// AccessLog configures the ingress access log; read once at startup
+	AccessLog *accesslog.Config `yaml:"access-log"`
+	// TLS serves the ingress listener over HTTPS, optionally verifying client certificates; read once at startup
+	TLS *TLSConfig `yaml:"tls"`
+	// CORS answers preflights and adds CORS headers on the ingress listener; read once at startup
+	CORS *CORSConfig `yaml:"cors"`
+	// BatchAuthz serves a batch pre-authorization endpoint on the ingress listener; its path is read once at startup
+	BatchAuthz *BatchAuthzConfig `yaml:"batch-authz"`
+	// ExtAuthz serves the Envoy external authorization gRPC API alongside the proxy; read once at startup
+	ExtAuthz *extauthz.Config `yaml:"ext-authz"`
+	// GRPC serves gRPC and other HTTP/2 cleartext traffic through the pipeline on its own listener; read once at startup
+	GRPC *GRPCConfig `yaml:"grpc"`
+	// Authn configures bearer token validation; applied to jwtauth on each Load
+	Authn *jwtauth.Config `yaml:"authn"`
+	// Transforms run on every route, before the route's own transforms
+	Transforms transform.Chain `yaml:"transforms"`
+	// RequestHeaders scrubs client request headers on routes without request-headers of their own
+	RequestHeaders *HeaderPolicy `yaml:"request-headers"`
+	// PrincipalHeaders, when set, passes the authenticated principal to the upstream as headers
+	PrincipalHeaders *PrincipalHeaders `yaml:"principal-headers"`
+	// IdentityAssertion forwards a sidecar-signed JWT of the principal; applied to assertion on each Load
+	IdentityAssertion *assertion.Config `yaml:"identity-assertion"`
+	// TokenExchange configures RFC 8693 exchange for routes using token: exchange
+	TokenExchange *tokenexchange.Config `yaml:"token-exchange"`
+	// Plugins extend authentication, authorization and filtering with Go plugins or WebAssembly modules; read once at startup
+	Plugins []plugins.Config `yaml:"plugins"`
+	// ConfigWatch reloads authorization.yaml and egress-config.yaml when they change on disk; read once at startup
+	ConfigWatch *configwatch.Config `yaml:"config-watch"`
+	// APIKeys configures the key store for routes using authn: api-key; applied to apikey on each Load
+	APIKeys *apikey.Config `yaml:"api-keys"`
+	// ReplayProtection rejects reused token jtis on routes with replay-protection: true; applied to replay on each Load
+	ReplayProtection *replay.Config `yaml:"replay-protection"`
+	// Revocation rejects validated tokens whose jti or subject is on a denylist; applied to revocation on each Load
+	Revocation *revocation.Config `yaml:"revocation"`
+	// ACRLevels ranks acr values weakest first, so a route's step-up acr also accepts stronger levels
+	ACRLevels []string `yaml:"acr-levels"`
+	// Tenancy selects a tenant per request, restricting its issuers and authorization resource maps
+	Tenancy *Tenancy `yaml:"tenancy"`
+}
+
+// TLSConfig configures HTTPS on the ingress listener
+type TLSConfig struct {
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// ClientCAFile enables client certificates verified against these CAs (PEM bundle)
+	ClientCAFile string `yaml:"client-ca-file"`
+	// ClientAuth is optional (default; a certificate is verified when presented) or require (the handshake fails without one)
+	ClientAuth string `yaml:"client-auth"`
+}
+
+// Client certificate policies for TLSConfig.ClientAuth
+const (
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// GRPCConfig enables the h2c listener proxying gRPC calls
+type GRPCConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address the listener listens on (default DefaultGRPCAddress)
+	Address string `yaml:"address"`
+}
+
+// DefaultGRPCAddress is where the gRPC listener listens when address is not set
+const DefaultGRPCAddress = ":3004"
+
+// ListenAddress returns the configured address or DefaultGRPCAddress
+func (g GRPCConfig) ListenAddress() string { return orDefault(g.Address, DefaultGRPCAddress) }
+
+// BatchAuthzConfig configures the endpoint that authorizes several prospective requests in one call
+type BatchAuthzConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path the endpoint is served on (default DefaultBatchAuthzPath); it is never proxied
+	Path string `yaml:"path"`
+	// MaxItems bounds the requests in one batch (default DefaultBatchMaxItems)
+	MaxItems int `yaml:"max-items"`
+}
+
+// ErrorResponses selects how the ingress writes the errors it returns instead of an upstream response
+type ErrorResponses struct {
+	// Format is text (default: the plain message) or problem (RFC 7807 application/problem+json)
+	Format string `yaml:"format"`
+	// TypeBase prefixes the error code to form a problem's type URI; without it the type is about:blank
+	TypeBase string `yaml:"type-base"`
+}
+
+// Values for error-responses.format
+const (
+	ErrorFormatText    = "text"
+	ErrorFormatProblem = "problem"
+)
+
+func (e *ErrorResponses) validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Format {
+	case "", ErrorFormatText, ErrorFormatProblem:
+	default:
+		return fmt.Errorf("error-responses: unknown format %q", e.Format)
+	}
+	if e.TypeBase != "" {
+		if u, err := url.Parse(e.TypeBase); err != nil || !u.IsAbs() {
+			return fmt.Errorf("error-responses: type-base must be an absolute URI")
+		}
+	}
+	return nil
+}
+
+// CORSConfig answers browser preflights at the ingress, before authentication, since browsers cannot
+// attach bearer tokens to them, and adds CORS headers to the responses of allowed origins
+type CORSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowOrigins lists the allowed origins; "*" allows any and "https://*.example.com" any subdomain (default "*")
+	AllowOrigins []string `yaml:"allow-origins"`
+	// AllowMethods answers preflights (default GET, POST, HEAD, PUT, DELETE, PATCH)
+	AllowMethods []string `yaml:"allow-methods"`
+	// AllowHeaders answers preflights; empty reflects the headers the browser asks for
+	AllowHeaders  []string `yaml:"allow-headers"`
+	ExposeHeaders []string `yaml:"expose-headers"`
+	// AllowCredentials lets browsers send cookies and Authorization; it cannot be combined with the "*" origin
+	AllowCredentials bool `yaml:"allow-credentials"`
+	// MaxAge is how long browsers may cache a preflight answer; zero leaves it to the browser
+	MaxAge time.Duration `yaml:"max-age"`
+}
+
+func (c *CORSConfig) validate() error {
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	if c.AllowCredentials && (len(c.AllowOrigins) == 0 || slices.Contains(c.AllowOrigins, "*")) {
+		return fmt.Errorf("cors: allow-credentials requires explicit allow-origins")
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("cors: max-age must not be negative")
+	}
+	for _, o := range c.AllowOrigins {
+		if o == "*" {
+			continue
+		}
+		u, err := url.Parse(strings.Replace(o, "://*.", "://", 1))
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return fmt.Errorf("cors: invalid origin %q", o)
+		}
+	}
+	return nil
+}
+
+// Batch pre-authorization defaults
+const (
+	DefaultBatchAuthzPath = "/authz/batch"
+	DefaultBatchMaxItems  = 50
+)
+
+// EndpointPath returns the configured path or DefaultBatchAuthzPath
+func (b BatchAuthzConfig) EndpointPath() string { return orDefault(b.Path, DefaultBatchAuthzPath) }
+
+// ItemLimit returns the configured max-items or DefaultBatchMaxItems
+func (b BatchAuthzConfig) ItemLimit() int {
+	if b.MaxItems <= 0 {
+		return DefaultBatchMaxItems
+	}
+	return b.MaxItems
+}
+
+// PrincipalHeaders names the headers carrying the principal upstream. Client-supplied values
+// of these headers are always removed so they cannot be spoofed.
+type PrincipalHeaders struct {
+	UserID   string `yaml:"user-id"`
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	// Claims, when set, carries all token claims as base64-encoded JSON
+	Claims string `yaml:"claims"`
+}
+
+// Default principal header names, used when principal-headers leaves a name empty
+const (
+	DefaultUserIDHeader   = "X-User-Id"
+	DefaultUsernameHeader = "X-User-Name"
+	DefaultEmailHeader    = "X-User-Email"
+)
+
+// UserIDHeader returns the configured user ID header or DefaultUserIDHeader
+func (h PrincipalHeaders) UserIDHeader() string { return orDefault(h.UserID, DefaultUserIDHeader) }
+
+// UsernameHeader returns the configured username header or DefaultUsernameHeader
+func (h PrincipalHeaders) UsernameHeader() string {
+	return orDefault(h.Username, DefaultUsernameHeader)
+}
+
+// EmailHeader returns the configured email header or DefaultEmailHeader
+func (h PrincipalHeaders) EmailHeader() string { return orDefault(h.Email, DefaultEmailHeader) }
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// Route holds per-route ingress options, selected by host and the longest matching path prefix
+type Route struct {
+	Name string `yaml:"name"`
+	// Host restricts the route to a Host header value; "*.example.com" matches any subdomain
+	Host       string `yaml:"host"`
+	PathPrefix string `yaml:"path-prefix"`
+	Upstream   string `yaml:"upstream"`
+	// Upstreams balances the route over several backend instances instead of a single upstream
+	Upstreams     []Endpoint     `yaml:"upstreams"`
+	LoadBalancing *LoadBalancing `yaml:"load-balancing"`
+	HealthCheck   *HealthCheck   `yaml:"health-check"`
+	// Split divides the route between upstream versions by weight instead of a single upstream
+	Split *TrafficSplit `yaml:"split"`
+	// StripPrefix removes PathPrefix from the path before proxying
+	StripPrefix bool `yaml:"strip-prefix"`
+	// Rewrite replaces PathPrefix with this value before proxying
+	Rewrite string `yaml:"rewrite"`
+	// Timeout bounds the upstream call; zero means no route-specific timeout
+	Timeout       time.Duration  `yaml:"timeout"`
+	LatencyBudget *LatencyBudget `yaml:"latency-budget"`
+	// Retry retries failed upstream attempts on this route, replacing the global retry policy
+	Retry *RetryPolicy `yaml:"retry"`
+	// Transforms edit the request before it is proxied and the upstream response
+	Transforms transform.Chain `yaml:"transforms"`
+	// RequestHeaders scrubs client request headers on this route, replacing the global request-headers
+	RequestHeaders *HeaderPolicy `yaml:"request-headers"`
+	// Mirror sends a copy of a share of the route's admitted requests to a secondary upstream
+	Mirror *Mirror `yaml:"mirror"`
+	// RateLimit limits requests per client on this route, replacing the global rate-limit
+	RateLimit *RateLimit `yaml:"rate-limit"`
+	// MaxInFlight caps the requests this route handles at once, within the global max-in-flight; zero means no limit
+	MaxInFlight int `yaml:"max-in-flight"`
+	// MaxBodyBytes caps request bodies on this route, below the global max-body-bytes; zero uses the global cap
+	MaxBodyBytes int `yaml:"max-body-bytes"`
+	// IPAccess admits clients by IP on this route, in addition to the global ip-access
+	IPAccess *IPAccess `yaml:"ip-access"`
+	// Token controls the Authorization header sent upstream: relay (default), strip, assertion or exchange
+	Token string `yaml:"token"`
+	// TokenAudience is the audience requested by token: exchange; defaults to token-exchange.audience
+	TokenAudience string `yaml:"token-audience"`
+	// Authn selects how callers authenticate: jwt (default), mtls, either or api-key
+	Authn string `yaml:"authn"`
+	// ReplayProtection accepts each bearer token once: its jti is remembered until exp and a reuse is rejected
+	ReplayProtection bool `yaml:"replay-protection"`
+	// StepUp requires a minimum acr or specific amr methods of the token on this route
+	StepUp *StepUp `yaml:"step-up"`
+}
+
+// Authentication modes for Route.Authn
+const (
+	// AuthnJWT requires a bearer token
+	AuthnJWT = "jwt"
+	// AuthnMTLS builds the principal from a verified client certificate
+	AuthnMTLS = "mtls"
+	// AuthnEither uses the bearer token when one is sent and the client certificate otherwise
+	AuthnEither = "either"
+	// AuthnAPIKey requires an API key validated against the api-keys store
+	AuthnAPIKey = "api-key"
+)
+
+// Token modes for Route.Token
+const (
+	// TokenRelay forwards the client's Authorization header unchanged
+	TokenRelay = "relay"
+	// TokenStrip removes the Authorization header
+	TokenStrip = "strip"
+	// TokenAssertion replaces the bearer with the sidecar-signed identity assertion
+	TokenAssertion = "assertion"
+	// TokenExchange replaces the bearer with one obtained through RFC 8693 token exchange
+	TokenExchange = "exchange"
+)
+
+// LatencyBudget enables load shedding on a route once its rolling p99 latency exceeds P99
+type LatencyBudget struct {
+	P99 time.Duration `yaml:"p99"`
+	// Window is the rolling period the p99 is computed over (default 30s)
+	Window time.Duration `yaml:"window"`
+	// ShedFraction is the share of eligible requests rejected while over budget (0..1)
+	ShedFraction float64 `yaml:"shed-fraction"`
+	// ShedMaxPriority is the highest request priority that may be shed (default 0)
+	ShedMaxPriority int `yaml:"shed-max-priority"`
+}
+
+// RateLimit allows each client (the authenticated user ID, or the client IP on public paths)
+// Requests per Window, spent from a bucket that refills continuously
+type RateLimit struct {
+	Requests int `yaml:"requests"`
+	// Window is the period Requests refill over (default 1s)
+	Window time.Duration `yaml:"window"`
+}
+
+// DefaultRateLimitWindow is used when a rate limit does not configure a window
+const DefaultRateLimitWindow = time.Second
+
+// WindowOrDefault returns the configured window or DefaultRateLimitWindow
+func (r *RateLimit) WindowOrDefault() time.Duration {
+	if r.Window <= 0 {
+		return DefaultRateLimitWindow
+	}
+	return r.Window
+}
+
+func (r *RateLimit) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.Requests <= 0 {
+		return fmt.Errorf("rate-limit.requests must be positive")
+	}
+	if r.Window < 0 {
+		return fmt.Errorf("rate-limit.window must not be negative")
+	}
+	return nil
+}
+
+// MaintenancePage is the response to requests under maintenance; without a body the 503 is
+// written like any other ingress error
+type MaintenancePage struct {
+	Body string `yaml:"body"`
+	// ContentType of the body (default text/html; charset=utf-8)
+	ContentType string `yaml:"content-type"`
+	// RetryAfter, when set, is sent as Retry-After in seconds
+	RetryAfter time.Duration `yaml:"retry-after"`
+}
+
+// MediaType returns the configured content type or text/html
+func (p *MaintenancePage) MediaType() string {
+	return orDefault(p.ContentType, "text/html; charset=utf-8")
+}
+
+// DefaultPriorityHeader is used when priority-header is not configured
+const DefaultPriorityHeader = "X-Request-Priority"
+
+// DefaultLatencyWindow is used when a latency budget does not configure a window
+const DefaultLatencyWindow = 30 * time.Second
+
+// cfg holds the current immutable config snapshot; Load swaps it atomically
+var cfg atomic.Pointer[IngressConfig]
+
+// Load reads the ingress configuration from a YAML file
+func Load(configPath string) error {
+	if configPath == "" {
+		configPath = "ingress-config.yaml"
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var c IngressConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	return install(&c)
+}
+
+// LoadNode loads the ingress configuration from a parsed YAML node, such as the ingress section of
+// the unified config file
+func LoadNode(n *yaml.Node) error {
+	var c IngressConfig
+	if err := n.Decode(&c); err != nil {
+		return err
+	}
+	return install(&c)
+}
+
+// install validates c, applies its authn, assertion, exchange and API key sections and makes it
+// the current config
+func install(c *IngressConfig) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if err := jwtauth.Configure(c.Authn); err != nil {
+		return err
+	}
+	if err := assertion.Configure(c.IdentityAssertion); err != nil {
+		return err
+	}
+	if err := tokenexchange.Configure(c.TokenExchange); err != nil {
+		return err
+	}
+	if err := apikey.Configure(c.APIKeys); err != nil {
+		return err
+	}
+	if err := replay.Configure(c.ReplayProtection); err != nil {
+		return err
+	}
+	if err := revocation.Configure(c.Revocation); err != nil {
+		return err
+	}
+
+	cfg.Store(c)
+	return nil
+}
+
+func (c *IngressConfig) validate() error {
+	if c.DefaultUpstream != "" {
+		if err := validateUpstream(c.DefaultUpstream); err != nil {
+			return fmt.Errorf("default-upstream: %w", err)
+		}
+	}
+	if t := c.TLS; t != nil {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return fmt.Errorf("tls: cert-file and key-file are required")
+		}
+		switch t.ClientAuth {
+		case "", ClientAuthOptional, ClientAuthRequire:
+		default:
+			return fmt.Errorf("tls: client-auth: unknown policy %q", t.ClientAuth)
+		}
+		if t.ClientAuth != "" && t.ClientCAFile == "" {
+			return fmt.Errorf("tls: client-auth requires client-ca-file")
+		}
+	}
+	if w := c.ConfigWatch; w != nil && w.Interval < 0 {
+		return fmt.Errorf("config-watch: interval must not be negative")
+	}
+	if b := c.BatchAuthz; b != nil && b.Path != "" && !strings.HasPrefix(b.Path, "/") {
+		return fmt.Errorf("batch-authz: path must start with '/'")
+	}
+	for _, p := range c.PublicPaths {
+		if err := authorization.ValidatePattern(p); err != nil {
+			return fmt.Errorf("public-paths: %w", err)
+		}
+	}
+	if err := c.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := c.validateTenancy(); err != nil {
+		return err
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	if err := c.RequestHeaders.validate(); err != nil {
+		return err
+	}
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("max-in-flight must not be negative")
+	}
+	if c.Maintenance != nil && c.Maintenance.RetryAfter < 0 {
+		return fmt.Errorf("maintenance.retry-after must not be negative")
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("max-body-bytes must not be negative")
+	}
+	if err := c.CORS.validate(); err != nil {
+		return err
+	}
+	if err := c.ErrorResponses.validate(); err != nil {
+		return err
+	}
+	for name, value := range c.SecurityHeaders {
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("security-headers: invalid header %q", name)
+		}
+	}
+	if c.ClientIP != nil && c.ClientIP.ForwardedForDepth < 0 {
+		return fmt.Errorf("client-ip.forwarded-for-depth must not be negative")
+	}
+	for i, r := range c.Routes {
+		if r.PathPrefix == "" && r.Host == "" {
+			return fmt.Errorf("route %d: path-prefix or host is required", i)
+		}
+		if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+			return fmt.Errorf("route %d: path-prefix must start with '/'", i)
+		}
+		if r.StripPrefix && r.Rewrite != "" {
+			return fmt.Errorf("route %d: strip-prefix and rewrite are mutually exclusive", i)
+		}
+		if r.Rewrite != "" && !strings.HasPrefix(r.Rewrite, "/") {
+			return fmt.Errorf("route %d: rewrite must start with '/'", i)
+		}
+		if r.Timeout < 0 {
+			return fmt.Errorf("route %d: timeout must not be negative", i)
+		}
+		if r.Upstream != "" {
+			if err := validateUpstream(r.Upstream); err != nil {
+				return fmt.Errorf("route %d: upstream: %w", i, err)
+			}
+		}
+		if err := r.validateUpstreams(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := r.validateSplit(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		switch r.Token {
+		case "", TokenRelay, TokenStrip:
+		case TokenAssertion:
+			if c.IdentityAssertion == nil || !c.IdentityAssertion.Enabled {
+				return fmt.Errorf("route %d: token: assertion requires identity-assertion to be enabled", i)
+			}
+		case TokenExchange:
+			if c.TokenExchange == nil || !c.TokenExchange.Enabled {
+				return fmt.Errorf("route %d: token: exchange requires token-exchange to be enabled", i)
+			}
+		default:
+			return fmt.Errorf("route %d: token: unknown mode %q", i, r.Token)
+		}
+		switch r.Authn {
+		case "", AuthnJWT:
+		case AuthnMTLS, AuthnEither:
+			if c.TLS == nil || c.TLS.ClientCAFile == "" {
+				return fmt.Errorf("route %d: authn: %s requires tls.client-ca-file", i, r.Authn)
+			}
+		case AuthnAPIKey:
+			if c.APIKeys == nil || !c.APIKeys.Enabled {
+				return fmt.Errorf("route %d: authn: api-key requires api-keys to be enabled", i)
+			}
+		default:
+			return fmt.Errorf("route %d: authn: unknown mode %q", i, r.Authn)
+		}
+		if r.ReplayProtection && (c.ReplayProtection == nil || !c.ReplayProtection.Enabled) {
+			return fmt.Errorf("route %d: replay-protection requires replay-protection to be enabled", i)
+		}
+		if err := r.StepUp.validate(c.ACRLevels); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if r.StepUp != nil && (r.Authn == AuthnMTLS || r.Authn == AuthnAPIKey) {
+			return fmt.Errorf("route %d: step-up requires token authentication, not %s", i, r.Authn)
+		}
+		if err := r.RateLimit.validate(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := r.Retry.validate(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := r.Mirror.validate(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if err := r.RequestHeaders.validate(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+		if r.MaxInFlight < 0 {
+			return fmt.Errorf("route %d: max-in-flight must not be negative", i)
+		}
+		if r.MaxBodyBytes < 0 {
+			return fmt.Errorf("route %d: max-body-bytes must not be negative", i)
+		}
+		if b := r.LatencyBudget; b != nil {
+			if b.P99 <= 0 {
+				return fmt.Errorf("route %d: latency-budget.p99 must be positive", i)
+			}
+			if b.ShedFraction < 0 || b.ShedFraction > 1 {
+				return fmt.Errorf("route %d: latency-budget.shed-fraction must be between 0 and 1", i)
+			}
+		}
+	}
+	return nil
+}
+
+// validateUpstream requires an absolute http(s) base URL without query or fragment
+func validateUpstream(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http(s) URL", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q must not contain a query or fragment", raw)
+	}
+	return nil
+}
+
+// ConfigOrNil returns the loaded config or nil if not loaded.
+func ConfigOrNil() *IngressConfig { return cfg.Load() }
+
+// SetConfigForTest allows tests in other packages to install a config. Do not use in production code paths.
+func SetConfigForTest(c *IngressConfig) { cfg.Store(c) }
+
+// DefaultMaxBodyBytes is used when max-body-bytes is not configured
+const DefaultMaxBodyBytes = 4 << 20
+
+// BodyLimit returns the route's max-body-bytes, or the global cap when route is nil or sets none
+func (c *IngressConfig) BodyLimit(route *Route) int {
+	if route != nil && route.MaxBodyBytes > 0 {
+		return route.MaxBodyBytes
+	}
+	if c != nil && c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// PriorityHeaderName returns the configured priority header or the default
+func (c *IngressConfig) PriorityHeaderName() string {
+	if c.PriorityHeader != "" {
+		return c.PriorityHeader
+	}
+	return DefaultPriorityHeader
+}
+
+// WindowOrDefault returns the configured rolling window or DefaultLatencyWindow
+func (b *LatencyBudget) WindowOrDefault() time.Duration {
+	if b.Window > 0 {
+		return b.Window
+	}
+	return DefaultLatencyWindow
+}
@@ -0,0 +1,128 @@
+package ingressconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "ingress-config.yaml")
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return p
+}
+
+func TestLoadAndMatchRoute(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	p := writeConfig(t, `routes:
+  - path-prefix: /
+  - name: reports
+    path-prefix: /api/reports
+    latency-budget:
+      p99: 250ms
+      shed-fraction: 0.5
+  - path-prefix: /api
+`)
+	if err := Load(p); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	c := ConfigOrNil()
+	if c == nil || len(c.Routes) != 3 {
+		t.Fatalf("expected 3 routes, got %+v", c)
+	}
+
+	r, ok := c.MatchRoute("", "/api/reports/daily")
+	if !ok || r.Key() != "reports" {
+		t.Fatalf("expected reports route, got %+v", r)
+	}
+	if r.LatencyBudget.P99 != 250*time.Millisecond || r.LatencyBudget.WindowOrDefault() != DefaultLatencyWindow {
+		t.Fatalf("unexpected latency budget %+v", r.LatencyBudget)
+	}
+	if r, _ := c.MatchRoute("", "/api/reportsx"); r.PathPrefix != "/api" {
+		t.Fatalf("prefix must match whole segments, got %q", r.PathPrefix)
+	}
+	if r, _ := c.MatchRoute("", "/web"); r.PathPrefix != "/" {
+		t.Fatalf("expected catch-all route, got %q", r.PathPrefix)
+	}
+	if c.PriorityHeaderName() != DefaultPriorityHeader {
+		t.Fatalf("expected default priority header")
+	}
+}
+
+func TestLoadRejectsInvalidRoutes(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	cases := map[string]string{
+		"relative prefix":      "routes:\n  - path-prefix: api\n",
+		"no prefix or host":    "routes:\n  - upstream: http://api\n",
+		"strip and rewrite":    "routes:\n  - path-prefix: /api\n    strip-prefix: true\n    rewrite: /v2\n",
+		"missing p99":          "routes:\n  - path-prefix: /api\n    latency-budget:\n      shed-fraction: 0.5\n",
+		"bad fraction":         "routes:\n  - path-prefix: /api\n    latency-budget:\n      p99: 1s\n      shed-fraction: 2\n",
+		"unknown token":        "routes:\n  - path-prefix: /api\n    token: forward\n",
+		"assertion w/o key":    "routes:\n  - path-prefix: /api\n    token: assertion\n",
+		"exchange disabled":    "routes:\n  - path-prefix: /api\n    token: exchange\n",
+		"unknown authn":        "routes:\n  - path-prefix: /api\n    authn: basic\n",
+		"api-key disabled":     "routes:\n  - path-prefix: /api\n    authn: api-key\n",
+		"relative public":      "public-paths: [health]\n",
+		"mtls without ca":      "tls:\n  cert-file: c.pem\n  key-file: k.pem\nroutes:\n  - path-prefix: /api\n    authn: mtls\n",
+		"tls without key":      "tls:\n  cert-file: c.pem\n",
+		"bad client-auth":      "tls:\n  cert-file: c.pem\n  key-file: k.pem\n  client-ca-file: ca.pem\n  client-auth: always\n",
+		"no rate requests":     "rate-limit:\n  window: 1s\n",
+		"cors wildcard creds":  "cors:\n  enabled: true\n  allow-credentials: true\n",
+		"cors bad origin":      "cors:\n  enabled: true\n  allow-origins: [app.example.com]\n",
+		"negative body cap":    "routes:\n  - path-prefix: /api\n    max-body-bytes: -1\n",
+		"bad security header":  "security-headers:\n  \"X Frame\": DENY\n",
+		"unknown error format": "error-responses:\n  format: xml\n",
+		"negative inflight":    "routes:\n  - path-prefix: /api\n    max-in-flight: -1\n",
+		"negative window":      "routes:\n  - path-prefix: /api\n    rate-limit:\n      requests: 5\n      window: -1s\n",
+	}
+	for name, content := range cases {
+		if err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+	if ConfigOrNil() != nil {
+		t.Fatalf("expected config to remain unset on error")
+	}
+}
+
+func TestLoadRejectsInvalidUpstream(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	for _, content := range []string{
+		"default-upstream: \"localhost:8080\"\n",
+		"default-upstream: \"ftp://files\"\n",
+		"routes:\n  - path-prefix: /api\n    upstream: \"http://api?x=1\"\n",
+		"routes:\n  - path-prefix: /api\n    upstream: http://api\n    upstreams: [{url: \"http://api-2\"}]\n",
+		"routes:\n  - path-prefix: /api\n    upstreams: [{url: \"http://api\"}, {url: \"http://api\"}]\n",
+		"routes:\n  - path-prefix: /api\n    upstreams: [{url: \"api:8080\"}]\n",
+		"routes:\n  - path-prefix: /api\n    upstreams: [{url: \"http://api\"}]\n    load-balancing:\n      policy: random\n",
+		"routes:\n  - path-prefix: /api\n    upstream: http://api\n    load-balancing:\n      policy: weighted\n",
+		"routes:\n  - path-prefix: /api\n    upstream: http://api\n    health-check:\n      path: /health\n",
+		"retry:\n  retries: -1\n",
+		"routes:\n  - path-prefix: /api\n    retry:\n      statuses: [404]\n",
+		"routes:\n  - path-prefix: /api\n    mirror:\n      upstream: http://next\n      percent: 101\n",
+		"routes:\n  - path-prefix: /api\n    mirror:\n      percent: 50\n",
+		"request-headers:\n  strip: [\"X Internal\"]\n",
+		"transforms:\n  - type: no-such-step\n",
+		"config-watch:\n  enabled: true\n  interval: -1s\n",
+		"routes:\n  - path-prefix: /api\n    transforms:\n      - type: rewrite-path\n",
+		"routes:\n  - path-prefix: /api\n    request-headers:\n      allow: [\"\"]\n",
+		"routes:\n  - path-prefix: /api\n    upstream: http://api\n    split:\n      targets: [{name: v2, upstream: \"http://v2\", weight: 1}]\n",
+		"routes:\n  - path-prefix: /api\n    split:\n      targets: [{name: v1, upstream: \"http://v1\"}, {name: v2, upstream: \"http://v2\"}]\n",
+		"routes:\n  - path-prefix: /api\n    split:\n      targets: [{name: v1, upstream: \"http://v1\", weight: 1}, {name: v1, upstream: \"http://v2\", weight: 1}]\n",
+		"routes:\n  - path-prefix: /api\n    upstreams: [{url: \"http://api\"}]\n    health-check:\n      path: health\n",
+		"routes:\n  - path-prefix: /api\n    replay-protection: true\n",
+		"replay-protection:\n  enabled: true\n  store: redis\n",
+		"routes:\n  - path-prefix: /api\n    step-up: {}\n",
+		"acr-levels: [silver, gold]\nroutes:\n  - path-prefix: /api\n    step-up:\n      acr: platinum\n",
+		"routes:\n  - path-prefix: /api\n    authn: mtls\n    step-up:\n      amr: [mfa]\n",
+		"tenancy:\n  tenants:\n    - id: acme\n      issuers: [\"https://idp.acme\"]\n",
+	} {
+		if err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeaderPolicy scrubs the client's request headers before they are forwarded upstream. Headers
+// the sidecar sets itself (Authorization under the route's token mode, X-Request-ID, the principal
+// and identity assertion headers, and trace context, injected afterwards) and Host, Content-Type and Content-Length are
+// never scrubbed. Names match case-insensitively; a trailing '*' matches a prefix, as in X-Internal-*.
+type HeaderPolicy struct {
+	// StripHopByHop removes the hop-by-hop headers of RFC 9110 section 7.6.1 and those listed in
+	// Connection; WebSocket upgrades keep theirs
+	StripHopByHop bool `yaml:"strip-hop-by-hop"`
+	// Strip removes the named headers
+	Strip []string `yaml:"strip"`
+	// Allow, when set, forwards only the named headers
+	Allow []string `yaml:"allow"`
+}
+
+// Forwards reports whether the policy lets a client header through, ignoring hop-by-hop stripping
+func (p *HeaderPolicy) Forwards(name string) bool {
+	if matchHeader(p.Strip, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchHeader(p.Allow, name)
+}
+
+func matchHeader(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *HeaderPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	for _, list := range [][]string{p.Strip, p.Allow} {
+		for _, name := range list {
+			if n := strings.TrimSuffix(name, "*"); name == "" || strings.ContainsAny(n, " \t\r\n:*") {
+				return fmt.Errorf("request-headers: invalid header name %q", name)
+			}
+		}
+	}
+	return nil
+}
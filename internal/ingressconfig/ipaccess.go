@@ -0,0 +1,91 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPConfig derives the client IP from X-Forwarded-For when the peer is a trusted proxy
+type ClientIPConfig struct {
+	// TrustedProxies are the proxies whose X-Forwarded-For entries are believed
+	TrustedProxies CIDRs `yaml:"trusted-proxies"`
+	// ForwardedForDepth is how many X-Forwarded-For entries, from the right, trusted proxies may have
+	// appended (default 1)
+	ForwardedForDepth int `yaml:"forwarded-for-depth"`
+}
+
+// DefaultForwardedForDepth is used when forwarded-for-depth is not configured
+const DefaultForwardedForDepth = 1
+
+// Depth returns the configured forwarded-for-depth or DefaultForwardedForDepth
+func (c *ClientIPConfig) Depth() int {
+	if c.ForwardedForDepth <= 0 {
+		return DefaultForwardedForDepth
+	}
+	return c.ForwardedForDepth
+}
+
+// IPAccess admits client IPs by CIDR: a denied IP is always refused, and when allow is set only the
+// IPs it contains are admitted
+type IPAccess struct {
+	Allow CIDRs `yaml:"allow"`
+	Deny  CIDRs `yaml:"deny"`
+}
+
+// Admits reports whether the client IP passes the lists
+func (a *IPAccess) Admits(ip netip.Addr) bool {
+	if a == nil {
+		return true
+	}
+	if a.Deny.Contains(ip) {
+		return false
+	}
+	return len(a.Allow) == 0 || a.Allow.Contains(ip)
+}
+
+// CIDRs is a list of networks, written as CIDRs or single addresses
+type CIDRs []netip.Prefix
+
+// UnmarshalYAML parses each entry, rejecting malformed ones at load time
+func (c *CIDRs) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw []string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*c = make(CIDRs, 0, len(raw))
+	for _, s := range raw {
+		p, err := parsePrefix(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		*c = append(*c, p)
+	}
+	return nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP %q: %w", s, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Contains reports whether any network contains ip; IPv4-mapped IPv6 addresses match IPv4 networks
+func (c CIDRs) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, p := range c {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package ingressconfig
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestLoadIPAccess(t *testing.T) {
+	t.Cleanup(func() { cfg.Store(nil) })
+	p := writeConfig(t, `client-ip:
+  trusted-proxies: ["10.0.0.0/8"]
+ip-access:
+  allow: ["192.0.2.0/24", "2001:db8::1"]
+  deny: ["192.0.2.66"]
+`)
+	if err := Load(p); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	c := ConfigOrNil()
+	if c.ClientIP.Depth() != DefaultForwardedForDepth || !c.ClientIP.TrustedProxies.Contains(netip.MustParseAddr("10.4.5.6")) {
+		t.Fatalf("unexpected client-ip %+v", c.ClientIP)
+	}
+	cases := map[string]bool{
+		"192.0.2.10":        true,
+		"::ffff:192.0.2.10": true,
+		"2001:db8::1":       true,
+		"192.0.2.66":        false,
+		"198.51.100.1":      false,
+		"2001:db8::2":       false,
+	}
+	for ip, want := range cases {
+		if got := c.IPAccess.Admits(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("%s: expected admitted=%v", ip, want)
+		}
+	}
+	if !(*IPAccess)(nil).Admits(netip.MustParseAddr("198.51.100.1")) {
+		t.Fatalf("expected no ip-access to admit every client")
+	}
+
+	for _, bad := range []string{"ip-access:\n  deny: [\"10.0.0.0/33\"]\n", "client-ip:\n  trusted-proxies: [proxy]\n"} {
+		if err := Load(writeConfig(t, bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
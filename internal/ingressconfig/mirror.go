@@ -0,0 +1,44 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"time"
+)
+
+// Mirror copies a share of a route's admitted requests to a secondary upstream, such as a new
+// backend version, without waiting for or returning its response
+type Mirror struct {
+	// Upstream is the base URL mirrored requests are sent to
+	Upstream string `yaml:"upstream"`
+	// Percent of requests (0-100) that are mirrored
+	Percent int `yaml:"percent"`
+	// Timeout bounds a mirrored request (default 5s)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultMirrorTimeout is used when a mirror does not configure a timeout
+const DefaultMirrorTimeout = 5 * time.Second
+
+// TimeoutOrDefault returns the configured timeout or DefaultMirrorTimeout
+func (m *Mirror) TimeoutOrDefault() time.Duration {
+	if m.Timeout <= 0 {
+		return DefaultMirrorTimeout
+	}
+	return m.Timeout
+}
+
+func (m *Mirror) validate() error {
+	if m == nil {
+		return nil
+	}
+	if err := validateUpstream(m.Upstream); err != nil {
+		return fmt.Errorf("mirror.upstream: %w", err)
+	}
+	if m.Percent < 0 || m.Percent > 100 {
+		return fmt.Errorf("mirror.percent must be between 0 and 100")
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("mirror.timeout must not be negative")
+	}
+	return nil
+}
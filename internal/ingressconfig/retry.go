@@ -0,0 +1,117 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RetryPolicy retries idempotent requests whose upstream attempt failed to connect, timed out or
+// answered with a retryable status, within a budget that keeps retries from multiplying an outage
+type RetryPolicy struct {
+	// Retries is the number of attempts after the first (default 2)
+	Retries int `yaml:"retries"`
+	// PerTryTimeout bounds each attempt instead of the route timeout; zero keeps the route timeout
+	PerTryTimeout time.Duration `yaml:"per-try-timeout"`
+	// Backoff is the pause before the first retry, doubled before each further one; zero retries at once
+	Backoff time.Duration `yaml:"backoff"`
+	// Methods that may be retried (default GET, HEAD, OPTIONS, PUT, DELETE and TRACE)
+	Methods []string `yaml:"methods"`
+	// Statuses are the upstream responses that are retried (default 502, 503 and 504)
+	Statuses []int `yaml:"statuses"`
+	// Budget caps the retries of the route relative to its traffic
+	Budget *RetryBudget `yaml:"budget"`
+}
+
+// RetryBudget lets retries add at most Percent of a route's requests over Window, plus
+// MinRetries per window so quiet routes can still retry
+type RetryBudget struct {
+	Percent    int           `yaml:"percent"`
+	MinRetries int           `yaml:"min-retries"`
+	Window     time.Duration `yaml:"window"`
+}
+
+// Retry defaults
+const (
+	DefaultRetries           = 2
+	DefaultRetryBudgetPct    = 20
+	DefaultRetryBudgetMin    = 10
+	DefaultRetryBudgetWindow = 10 * time.Second
+)
+
+var (
+	defaultRetryMethods  = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace}
+	defaultRetryStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+)
+
+// RetriesOrDefault returns the configured number of retries or DefaultRetries
+func (p *RetryPolicy) RetriesOrDefault() int {
+	if p.Retries <= 0 {
+		return DefaultRetries
+	}
+	return p.Retries
+}
+
+// AllowsMethod reports whether requests with method may be retried
+func (p *RetryPolicy) AllowsMethod(method string) bool {
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	return slices.ContainsFunc(methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// RetriesStatus reports whether an upstream status is retried
+func (p *RetryPolicy) RetriesStatus(status int) bool {
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	return slices.Contains(statuses, status)
+}
+
+// TryTimeout returns the timeout of one attempt given the route timeout
+func (p *RetryPolicy) TryTimeout(route time.Duration) time.Duration {
+	if p.PerTryTimeout > 0 && (route <= 0 || p.PerTryTimeout < route) {
+		return p.PerTryTimeout
+	}
+	return route
+}
+
+// Limits returns the budget's percent, minimum retries and window, defaulted
+func (b *RetryBudget) Limits() (percent, minRetries int, window time.Duration) {
+	percent, minRetries, window = DefaultRetryBudgetPct, DefaultRetryBudgetMin, DefaultRetryBudgetWindow
+	if b == nil {
+		return
+	}
+	if b.Percent > 0 {
+		percent = b.Percent
+	}
+	if b.MinRetries > 0 {
+		minRetries = b.MinRetries
+	}
+	if b.Window > 0 {
+		window = b.Window
+	}
+	return
+}
+
+func (p *RetryPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.Retries < 0 || p.PerTryTimeout < 0 || p.Backoff < 0 {
+		return fmt.Errorf("retry: retries, per-try-timeout and backoff must not be negative")
+	}
+	for _, s := range p.Statuses {
+		if s < 500 || s > 599 {
+			return fmt.Errorf("retry: statuses must be 5xx, got %d", s)
+		}
+	}
+	if b := p.Budget; b != nil && (b.Percent < 0 || b.MinRetries < 0 || b.Window < 0) {
+		return fmt.Errorf("retry: budget values must not be negative")
+	}
+	return nil
+}
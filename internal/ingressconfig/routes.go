@@ -0,0 +1,172 @@
+package ingressconfig
+
+import (
+	"strings"
+	"time"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/transform"
+)
+
+// Target is the upstream a request resolves to
+type Target struct {
+	// Upstream is the base URL without a trailing slash; empty when Endpoints are to be balanced
+	Upstream string
+	// Endpoints are the route's upstreams, one of which is chosen per request under Balancing
+	Endpoints []Endpoint
+	Balancing *LoadBalancing
+	// Split divides requests between upstream versions; Upstream is empty when it is set
+	Split *TrafficSplit
+	// Route is the matched route's key, or "" for the default upstream
+	Route string
+	// Path is the request path after strip-prefix/rewrite, always starting with '/'
+	Path    string
+	Timeout time.Duration
+	// TokenMode is how the Authorization header is forwarded, one of the Token* modes
+	TokenMode string
+	// TokenAudience is the audience requested when TokenMode is TokenExchange
+	TokenAudience string
+	// Retry is the route's retry policy, else the global one; nil when neither is configured
+	Retry *RetryPolicy
+	// Mirror is the route's request mirror, or nil
+	Mirror *Mirror
+	// RequestHeaders is the route's header policy, else the global one; nil when neither is configured
+	RequestHeaders *HeaderPolicy
+	// Transforms are the global and route transform chains, in the order they run
+	Transforms []transform.Chain
+}
+
+// MatchRoute returns the route for a request. Routes bound to the request host win over
+// host-less routes; within the same tier the longest matching path prefix wins.
+func (c *IngressConfig) MatchRoute(host, path string) (*Route, bool) {
+	var best *Route
+	bestHost := false
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if r.Host != "" && !matchHost(r.Host, host) {
+			continue
+		}
+		if !hasPathPrefix(path, r.prefix()) {
+			continue
+		}
+		hostBound := r.Host != ""
+		if best == nil || (hostBound && !bestHost) ||
+			(hostBound == bestHost && len(r.prefix()) > len(best.prefix())) {
+			best, bestHost = r, hostBound
+		}
+	}
+	return best, best != nil
+}
+
+// Resolve maps a request host and path to its upstream target: the matching route's upstream,
+// upstreams or split, falling back to the default upstream. It returns false when neither is configured.
+func (c *IngressConfig) Resolve(host, path string) (Target, bool) {
+	r, matched := c.MatchRoute(host, path)
+	upstream := c.DefaultUpstream
+	if matched && r.Upstream != "" {
+		upstream = r.Upstream
+	}
+	balanced := matched && len(r.Upstreams) > 0
+	split := matched && r.Split != nil
+	if upstream == "" && !balanced && !split {
+		return Target{}, false
+	}
+	t := Target{Upstream: strings.TrimSuffix(upstream, "/"), Path: path, TokenMode: TokenRelay, Retry: c.Retry, RequestHeaders: c.RequestHeaders}
+	if !c.Transforms.Empty() {
+		t.Transforms = append(t.Transforms, c.Transforms)
+	}
+	if balanced {
+		t.Upstream, t.Endpoints, t.Balancing = "", r.Upstreams, r.LoadBalancing
+	}
+	if split {
+		t.Upstream, t.Split = "", r.Split
+	}
+	if matched {
+		t.Route = r.Key()
+		t.Path = r.RewritePath(path)
+		t.Timeout = r.Timeout
+		if r.Token != "" {
+			t.TokenMode = r.Token
+		}
+		t.TokenAudience = r.TokenAudience
+		t.Mirror = r.Mirror
+		if r.RequestHeaders != nil {
+			t.RequestHeaders = r.RequestHeaders
+		}
+		if !r.Transforms.Empty() {
+			t.Transforms = append(t.Transforms, r.Transforms)
+		}
+		if r.Retry != nil {
+			t.Retry = r.Retry
+		}
+	}
+	return t, true
+}
+
+// AuthnMode returns how callers of a host and path authenticate, one of the Authn* modes
+func (c *IngressConfig) AuthnMode(host, path string) string {
+	if r, ok := c.MatchRoute(host, path); ok && r.Authn != "" {
+		return r.Authn
+	}
+	return AuthnJWT
+}
+
+// ReplayProtected reports whether tokens sent to a host and path are accepted only once
+func (c *IngressConfig) ReplayProtected(host, path string) bool {
+	r, ok := c.MatchRoute(host, path)
+	return ok && r.ReplayProtection
+}
+
+// IsPublic reports whether a request matches public-paths and so needs no credentials
+func (c *IngressConfig) IsPublic(host, method, path string) bool {
+	for _, p := range c.PublicPaths {
+		if authorization.MatchPattern(p, host, method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// RewritePath applies strip-prefix or rewrite to a path this route matched
+func (r *Route) RewritePath(path string) string {
+	if !r.StripPrefix && r.Rewrite == "" {
+		return path
+	}
+	rest := strings.TrimPrefix(path, strings.TrimSuffix(r.prefix(), "/"))
+	rewritten := strings.TrimSuffix(r.Rewrite, "/") + rest
+	if !strings.HasPrefix(rewritten, "/") {
+		rewritten = "/" + rewritten
+	}
+	return rewritten
+}
+
+// Key identifies a route across config reloads
+func (r *Route) Key() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Host + r.PathPrefix
+}
+
+// prefix returns the path prefix, defaulting host-only routes to "/"
+func (r *Route) prefix() string {
+	if r.PathPrefix == "" {
+		return "/"
+	}
+	return r.PathPrefix
+}
+
+// matchHost compares a route host pattern with a request Host or :authority, case-insensitively
+// and ignoring ports, as resource-map keys do
+func matchHost(pattern, host string) bool {
+	return authorization.MatchHost(pattern, host)
+}
+
+// hasPathPrefix matches whole segments, so /api matches /api and /api/x but not /apix
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || path == prefix {
+		return true
+	}
+	return strings.HasPrefix(path, prefix+"/")
+}
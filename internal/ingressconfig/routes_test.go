@@ -0,0 +1,129 @@
+package ingressconfig
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	c := &IngressConfig{
+		DefaultUpstream: "http://app:8080/",
+		Routes: []Route{
+			{PathPrefix: "/api", Upstream: "http://api:9000", Timeout: 2 * time.Second},
+			{PathPrefix: "/web"},
+			{PathPrefix: "/orders/", Upstream: "http://orders", StripPrefix: true},
+			{PathPrefix: "/legacy/v1", Upstream: "http://legacy", Rewrite: "/v2"},
+		},
+	}
+	cases := []struct {
+		path, upstream, rewritten string
+		timeout                   time.Duration
+	}{
+		{"/api/items", "http://api:9000", "/api/items", 2 * time.Second},
+		{"/web/index.html", "http://app:8080", "/web/index.html", 0},
+		{"/orders/42", "http://orders", "/42", 0},
+		{"/orders", "http://orders", "/", 0},
+		{"/legacy/v1/users", "http://legacy", "/v2/users", 0},
+		{"/unrouted", "http://app:8080", "/unrouted", 0},
+	}
+	for _, tc := range cases {
+		target, ok := c.Resolve("", tc.path)
+		if !ok {
+			t.Fatalf("%s: expected a target", tc.path)
+		}
+		if target.Upstream != tc.upstream || target.Path != tc.rewritten || target.Timeout != tc.timeout {
+			t.Errorf("%s: unexpected target %+v", tc.path, target)
+		}
+	}
+	if _, ok := (&IngressConfig{}).Resolve("", "/x"); ok {
+		t.Fatalf("expected no target when nothing is configured")
+	}
+}
+
+func TestResolveTokenMode(t *testing.T) {
+	c := &IngressConfig{
+		DefaultUpstream: "http://app",
+		Routes:          []Route{{PathPrefix: "/internal", Token: TokenStrip}},
+	}
+	if target, _ := c.Resolve("", "/internal/x"); target.TokenMode != TokenStrip {
+		t.Errorf("expected strip on /internal, got %q", target.TokenMode)
+	}
+	if target, _ := c.Resolve("", "/other"); target.TokenMode != TokenRelay {
+		t.Errorf("expected relay by default, got %q", target.TokenMode)
+	}
+}
+
+func TestResolveUpstreams(t *testing.T) {
+	endpoints := []Endpoint{{URL: "http://orders-1"}, {URL: "http://orders-2", Weight: 2}}
+	lb := &LoadBalancing{Policy: BalanceWeighted}
+	c := &IngressConfig{Routes: []Route{{Name: "orders", PathPrefix: "/orders", Upstreams: endpoints, LoadBalancing: lb}}}
+	target, ok := c.Resolve("", "/orders/1")
+	if !ok || target.Upstream != "" || len(target.Endpoints) != 2 || target.Balancing != lb || target.Route != "orders" {
+		t.Fatalf("expected the endpoints to balance, got %+v", target)
+	}
+	if lb.Threshold() != DefaultFailureThreshold || lb.EjectFor() != DefaultEjectDuration || (*LoadBalancing)(nil).PolicyOrDefault() != BalanceRoundRobin {
+		t.Fatalf("unexpected load-balancing defaults")
+	}
+}
+
+func TestResolveSplit(t *testing.T) {
+	split := &TrafficSplit{Targets: []SplitTarget{{Name: "v1", Upstream: "http://v1", Weight: 9}, {Name: "v2", Upstream: "http://v2", Weight: 1}}}
+	c := &IngressConfig{DefaultUpstream: "http://default", Routes: []Route{{Name: "orders", PathPrefix: "/orders", Split: split}}}
+	target, ok := c.Resolve("", "/orders/1")
+	if !ok || target.Upstream != "" || target.Split != split || split.TotalWeight() != 10 {
+		t.Fatalf("expected the split target, got %+v", target)
+	}
+}
+
+func TestMatchRouteByHost(t *testing.T) {
+	c := &IngressConfig{Routes: []Route{
+		{PathPrefix: "/", Upstream: "http://catch-all"},
+		{Host: "admin.example.com", Upstream: "http://admin"},
+		{Host: "*.tenants.example.com", PathPrefix: "/api", Upstream: "http://tenants"},
+	}}
+	if r, _ := c.MatchRoute("ADMIN.example.com", "/users"); r.Upstream != "http://admin" {
+		t.Errorf("expected host route to win over a longer host-less prefix, got %q", r.Upstream)
+	}
+	if r, _ := c.MatchRoute("acme.tenants.example.com", "/api/x"); r.Upstream != "http://tenants" {
+		t.Errorf("expected wildcard host route, got %q", r.Upstream)
+	}
+	if r, _ := c.MatchRoute("acme.tenants.example.com", "/other"); r.Upstream != "http://catch-all" {
+		t.Errorf("expected fallback when host route path does not match, got %q", r.Upstream)
+	}
+	if r, _ := c.MatchRoute("example.com", "/users"); r.Upstream != "http://catch-all" {
+		t.Errorf("expected catch-all for unknown host, got %q", r.Upstream)
+	}
+	if r, _ := c.MatchRoute("admin.example.com:8443", "/users"); r.Upstream != "http://admin" {
+		t.Errorf("expected an :authority with a port to match the host route, got %q", r.Upstream)
+	}
+}
+
+func TestAuthnMode(t *testing.T) {
+	c := &IngressConfig{Routes: []Route{
+		{PathPrefix: "/internal", Authn: AuthnMTLS},
+		{PathPrefix: "/api"},
+	}}
+	if got := c.AuthnMode("", "/internal/x"); got != AuthnMTLS {
+		t.Errorf("expected mtls on /internal, got %q", got)
+	}
+	if got := c.AuthnMode("", "/api"); got != AuthnJWT {
+		t.Errorf("expected jwt when the route sets no authn, got %q", got)
+	}
+	if got := c.AuthnMode("", "/unrouted"); got != AuthnJWT {
+		t.Errorf("expected jwt without a matching route, got %q", got)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	c := &IngressConfig{PublicPaths: []string{"/health", "/.well-known/**", "/docs/**:GET"}}
+	if !c.IsPublic("", "GET", "/health") || !c.IsPublic("", "GET", "/.well-known/jwks.json") || !c.IsPublic("", "GET", "/docs/index.html") {
+		t.Errorf("expected listed paths to be public")
+	}
+	hosted := &IngressConfig{PublicPaths: []string{"docs.example.com/**"}}
+	if !hosted.IsPublic("docs.example.com", "GET", "/guide") || hosted.IsPublic("api.example.com", "GET", "/guide") {
+		t.Error("expected a host-bound public path to match its host only")
+	}
+	if c.IsPublic("", "POST", "/docs/index.html") || c.IsPublic("", "GET", "/api/orders") {
+		t.Errorf("expected other methods and paths to require credentials")
+	}
+}
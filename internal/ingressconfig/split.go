@@ -0,0 +1,60 @@
+package ingressconfig
+
+import "fmt"
+
+// TrafficSplit divides a route's requests between upstream versions by weight, such as a 90/10
+// canary. Weights are re-read on every config reload.
+type TrafficSplit struct {
+	// Sticky keeps each principal on one version, chosen by a hash of the user ID; anonymous
+	// requests are still split at random
+	Sticky  bool          `yaml:"sticky"`
+	Targets []SplitTarget `yaml:"targets"`
+}
+
+// SplitTarget is one upstream version of a traffic split
+type SplitTarget struct {
+	// Name labels the version in metrics
+	Name     string `yaml:"name"`
+	Upstream string `yaml:"upstream"`
+	// Weight is the version's share relative to the other targets; zero drains it
+	Weight int `yaml:"weight"`
+}
+
+// TotalWeight sums the weights of the split's targets
+func (s *TrafficSplit) TotalWeight() int {
+	total := 0
+	for _, t := range s.Targets {
+		total += t.Weight
+	}
+	return total
+}
+
+func (r *Route) validateSplit() error {
+	s := r.Split
+	if s == nil {
+		return nil
+	}
+	if r.Upstream != "" || len(r.Upstreams) > 0 {
+		return fmt.Errorf("split is mutually exclusive with upstream and upstreams")
+	}
+	if len(s.Targets) == 0 {
+		return fmt.Errorf("split: targets are required")
+	}
+	seen := map[string]bool{}
+	for j, t := range s.Targets {
+		if t.Name == "" || seen[t.Name] {
+			return fmt.Errorf("split: targets %d: name is required and must be unique", j)
+		}
+		seen[t.Name] = true
+		if err := validateUpstream(t.Upstream); err != nil {
+			return fmt.Errorf("split: targets %d: %w", j, err)
+		}
+		if t.Weight < 0 {
+			return fmt.Errorf("split: targets %d: weight must not be negative", j)
+		}
+	}
+	if s.TotalWeight() == 0 {
+		return fmt.Errorf("split: at least one target needs a positive weight")
+	}
+	return nil
+}
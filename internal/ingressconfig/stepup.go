@@ -0,0 +1,60 @@
+package ingressconfig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// StepUp requires a stronger authentication on a route than tokens may carry. Tokens falling short
+// are answered with an RFC 9470 challenge naming the acr_values to re-authenticate with.
+type StepUp struct {
+	// ACR is the minimum authentication context class of the token's acr claim. With acr-levels it
+	// accepts the same or a stronger level, else only itself.
+	ACR string `yaml:"acr"`
+	// AMR lists authentication methods the token's amr claim must all contain, e.g. mfa
+	AMR []string `yaml:"amr"`
+}
+
+// StepUp returns the step-up requirement of the route matching a host and path, or nil
+func (c *IngressConfig) StepUp(host, path string) *StepUp {
+	if r, ok := c.MatchRoute(host, path); ok {
+		return r.StepUp
+	}
+	return nil
+}
+
+// AcceptableACRs lists the acr values satisfying a required one, weakest first: required and the
+// stronger acr-levels, or required alone when it is not ranked
+func (c *IngressConfig) AcceptableACRs(required string) []string {
+	if i := slices.Index(c.ACRLevels, required); i >= 0 {
+		return c.ACRLevels[i:]
+	}
+	return []string{required}
+}
+
+// Satisfies reports whether a token's acr and amr claims meet the requirement
+func (s *StepUp) Satisfies(c *IngressConfig, acr string, amr []string) bool {
+	if s.ACR != "" && !slices.Contains(c.AcceptableACRs(s.ACR), acr) {
+		return false
+	}
+	for _, m := range s.AMR {
+		if !slices.Contains(amr, m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *StepUp) validate(levels []string) error {
+	if s == nil {
+		return nil
+	}
+	if s.ACR == "" && len(s.AMR) == 0 {
+		return errors.New("step-up: acr or amr is required")
+	}
+	if s.ACR != "" && len(levels) > 0 && !slices.Contains(levels, s.ACR) {
+		return fmt.Errorf("step-up: acr %q is not one of acr-levels", s.ACR)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package ingressconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStepUpSatisfies(t *testing.T) {
+	c := &IngressConfig{
+		ACRLevels: []string{"urn:loa:1", "urn:loa:2", "urn:loa:3"},
+		Routes: []Route{
+			{PathPrefix: "/pay", StepUp: &StepUp{ACR: "urn:loa:2", AMR: []string{"mfa"}}},
+			{PathPrefix: "/legacy", StepUp: &StepUp{ACR: "gold"}},
+		},
+	}
+	pay := c.StepUp("", "/pay/now")
+	if pay == nil || c.StepUp("", "/other") != nil {
+		t.Fatal("expected the step-up of the matched route only")
+	}
+	for _, tc := range []struct {
+		acr  string
+		amr  []string
+		want bool
+	}{
+		{"urn:loa:2", []string{"pwd", "mfa"}, true},
+		{"urn:loa:3", []string{"mfa"}, true},
+		{"urn:loa:1", []string{"mfa"}, false},
+		{"urn:loa:3", []string{"pwd"}, false},
+		{"", nil, false},
+	} {
+		if got := pay.Satisfies(c, tc.acr, tc.amr); got != tc.want {
+			t.Errorf("acr %q amr %v: expected %v, got %v", tc.acr, tc.amr, tc.want, got)
+		}
+	}
+	if want := []string{"urn:loa:2", "urn:loa:3"}; !slices.Equal(c.AcceptableACRs("urn:loa:2"), want) {
+		t.Errorf("expected %v, got %v", want, c.AcceptableACRs("urn:loa:2"))
+	}
+
+	legacy := c.StepUp("", "/legacy")
+	if !legacy.Satisfies(c, "gold", nil) || legacy.Satisfies(c, "urn:loa:3", nil) {
+		t.Error("expected an unranked acr to accept only itself")
+	}
+}
@@ -0,0 +1,92 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"slices"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// Tenancy lets one sidecar front a multi-tenant API. A request's tenant is selected by its host or
+// path prefix, else by the tenant claim of its token (claims-mapping tenant-id); the tenant then
+// limits the accepted issuers and selects the tenant's authorization resource maps.
+type Tenancy struct {
+	Tenants []Tenant `yaml:"tenants"`
+	// Required rejects requests no tenant is selected for
+	Required bool `yaml:"required"`
+}
+
+// Tenant is one tenant and how its requests are recognised. A tenant with hosts and a path-prefix
+// needs both to match; one with neither is only selected by the token claim.
+type Tenant struct {
+	ID string `yaml:"id"`
+	// Hosts select the tenant by Host header; "*.example.com" matches any subdomain
+	Hosts      []string `yaml:"hosts"`
+	PathPrefix string   `yaml:"path-prefix"`
+	// Issuers, when set, are the only token issuers accepted for the tenant, out of authn.issuers
+	Issuers []string `yaml:"issuers"`
+}
+
+// TenantFor returns the tenant a host and path select, or nil. The first tenant listed wins.
+func (c *IngressConfig) TenantFor(host, path string) *Tenant {
+	if c.Tenancy == nil {
+		return nil
+	}
+	for i := range c.Tenancy.Tenants {
+		t := &c.Tenancy.Tenants[i]
+		if len(t.Hosts) == 0 && t.PathPrefix == "" {
+			continue
+		}
+		if len(t.Hosts) > 0 && !slices.ContainsFunc(t.Hosts, func(p string) bool { return matchHost(p, host) }) {
+			continue
+		}
+		if t.PathPrefix != "" && !hasPathPrefix(path, t.PathPrefix) {
+			continue
+		}
+		return t
+	}
+	return nil
+}
+
+// Tenant returns the tenant with an ID, or nil
+func (c *IngressConfig) Tenant(id string) *Tenant {
+	if c.Tenancy == nil || id == "" {
+		return nil
+	}
+	for i := range c.Tenancy.Tenants {
+		if c.Tenancy.Tenants[i].ID == id {
+			return &c.Tenancy.Tenants[i]
+		}
+	}
+	return nil
+}
+
+// AcceptsIssuer reports whether tokens of an issuer are accepted for the tenant
+func (t *Tenant) AcceptsIssuer(iss string) bool {
+	return len(t.Issuers) == 0 || slices.Contains(t.Issuers, iss)
+}
+
+func (c *IngressConfig) validateTenancy() error {
+	if c.Tenancy == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(c.Tenancy.Tenants))
+	for i, t := range c.Tenancy.Tenants {
+		if t.ID == "" {
+			return fmt.Errorf("tenancy: tenant %d: id is required", i)
+		}
+		if seen[t.ID] {
+			return fmt.Errorf("tenancy: duplicate tenant %q", t.ID)
+		}
+		seen[t.ID] = true
+		if t.PathPrefix != "" && t.PathPrefix[0] != '/' {
+			return fmt.Errorf("tenancy: tenant %s: path-prefix must start with '/'", t.ID)
+		}
+		for _, iss := range t.Issuers {
+			if c.Authn == nil || !slices.ContainsFunc(c.Authn.Issuers, func(ic jwtauth.IssuerConfig) bool { return ic.Issuer == iss }) {
+				return fmt.Errorf("tenancy: tenant %s: issuer %q is not one of authn.issuers", t.ID, iss)
+			}
+		}
+	}
+	return nil
+}
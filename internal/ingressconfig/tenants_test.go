@@ -0,0 +1,60 @@
+package ingressconfig
+
+import (
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestTenantFor(t *testing.T) {
+	c := &IngressConfig{Tenancy: &Tenancy{Tenants: []Tenant{
+		{ID: "acme", Hosts: []string{"acme.example.com", "*.acme.example.com"}},
+		{ID: "globex", PathPrefix: "/t/globex"},
+		{ID: "initech", Hosts: []string{"shared.example.com"}, PathPrefix: "/initech", Issuers: []string{"https://idp.initech"}},
+		{ID: "claim-only"},
+	}}}
+	for _, tc := range []struct {
+		host, path, want string
+	}{
+		{"acme.example.com", "/orders", "acme"},
+		{"eu.acme.example.com", "/orders", "acme"},
+		{"api.example.com", "/t/globex/orders", "globex"},
+		{"api.example.com", "/t/globexx", ""},
+		{"shared.example.com", "/initech/orders", "initech"},
+		{"shared.example.com", "/orders", ""},
+	} {
+		got := ""
+		if tenant := c.TenantFor(tc.host, tc.path); tenant != nil {
+			got = tenant.ID
+		}
+		if got != tc.want {
+			t.Errorf("%s%s: expected tenant %q, got %q", tc.host, tc.path, tc.want, got)
+		}
+	}
+	if c.Tenant("claim-only") == nil || c.Tenant("unknown") != nil {
+		t.Error("expected tenants to be found by ID")
+	}
+	initech := c.Tenant("initech")
+	if !initech.AcceptsIssuer("https://idp.initech") || initech.AcceptsIssuer("https://idp.acme") || !c.Tenant("acme").AcceptsIssuer("https://any") {
+		t.Error("unexpected issuer acceptance")
+	}
+}
+
+func TestValidateTenancy(t *testing.T) {
+	authn := &jwtauth.Config{Issuers: []jwtauth.IssuerConfig{{Issuer: "https://idp.acme"}}}
+	for name, tenancy := range map[string]*Tenancy{
+		"missing id":     {Tenants: []Tenant{{Hosts: []string{"a.example.com"}}}},
+		"duplicate":      {Tenants: []Tenant{{ID: "a"}, {ID: "a"}}},
+		"relative path":  {Tenants: []Tenant{{ID: "a", PathPrefix: "a"}}},
+		"unknown issuer": {Tenants: []Tenant{{ID: "a", Issuers: []string{"https://idp.other"}}}},
+	} {
+		c := &IngressConfig{Authn: authn, Tenancy: tenancy}
+		if err := c.validateTenancy(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	c := &IngressConfig{Authn: authn, Tenancy: &Tenancy{Tenants: []Tenant{{ID: "a", Issuers: []string{"https://idp.acme"}}}}}
+	if err := c.validateTenancy(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package ingressconfig
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Endpoint is one backend instance of a route with several upstreams
+type Endpoint struct {
+	URL string `yaml:"url"`
+	// Weight is the endpoint's share under the weighted policy (default 1)
+	Weight int `yaml:"weight"`
+}
+
+// WeightOrDefault returns the configured weight or 1
+func (e Endpoint) WeightOrDefault() int {
+	if e.Weight <= 0 {
+		return 1
+	}
+	return e.Weight
+}
+
+// Load balancing policies
+const (
+	BalanceRoundRobin       = "round-robin"
+	BalanceWeighted         = "weighted"
+	BalanceLeastConnections = "least-connections"
+)
+
+// LoadBalancing chooses among a route's upstreams and takes failing endpoints out of rotation
+type LoadBalancing struct {
+	// Policy is round-robin (default), weighted (smooth weighted round-robin) or least-connections
+	Policy string `yaml:"policy"`
+	// FailureThreshold is how many consecutive failures (connection errors, 502, 503, 504) eject an
+	// endpoint (default 5)
+	FailureThreshold int `yaml:"failure-threshold"`
+	// EjectDuration is how long an ejected endpoint is skipped (default 30s)
+	EjectDuration time.Duration `yaml:"eject-duration"`
+}
+
+// Load balancing defaults
+const (
+	DefaultFailureThreshold = 5
+	DefaultEjectDuration    = 30 * time.Second
+)
+
+// PolicyOrDefault returns the configured policy or round-robin
+func (l *LoadBalancing) PolicyOrDefault() string {
+	if l == nil || l.Policy == "" {
+		return BalanceRoundRobin
+	}
+	return l.Policy
+}
+
+// Threshold returns the configured failure-threshold or DefaultFailureThreshold
+func (l *LoadBalancing) Threshold() int {
+	if l == nil || l.FailureThreshold <= 0 {
+		return DefaultFailureThreshold
+	}
+	return l.FailureThreshold
+}
+
+// EjectFor returns the configured eject-duration or DefaultEjectDuration
+func (l *LoadBalancing) EjectFor() time.Duration {
+	if l == nil || l.EjectDuration <= 0 {
+		return DefaultEjectDuration
+	}
+	return l.EjectDuration
+}
+
+// HealthCheck probes each of a route's upstreams; an endpoint is taken out of rotation after
+// unhealthy-threshold failed probes and back in after healthy-threshold passing ones. A probe
+// passes on a 2xx or 3xx response.
+type HealthCheck struct {
+	// Path is requested on each endpoint (default /health)
+	Path     string        `yaml:"path"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// HealthyThreshold is how many consecutive passing probes make an endpoint healthy again (default 2)
+	HealthyThreshold int `yaml:"healthy-threshold"`
+	// UnhealthyThreshold is how many consecutive failed probes make an endpoint unhealthy (default 3)
+	UnhealthyThreshold int `yaml:"unhealthy-threshold"`
+}
+
+// Health check defaults
+const (
+	DefaultHealthPath         = "/health"
+	DefaultHealthInterval     = 10 * time.Second
+	DefaultHealthTimeout      = 2 * time.Second
+	DefaultHealthyThreshold   = 2
+	DefaultUnhealthyThreshold = 3
+)
+
+// PathOrDefault returns the configured path or DefaultHealthPath
+func (h *HealthCheck) PathOrDefault() string { return orDefault(h.Path, DefaultHealthPath) }
+
+// IntervalOrDefault returns the configured interval or DefaultHealthInterval
+func (h *HealthCheck) IntervalOrDefault() time.Duration {
+	if h.Interval <= 0 {
+		return DefaultHealthInterval
+	}
+	return h.Interval
+}
+
+// TimeoutOrDefault returns the configured timeout or DefaultHealthTimeout
+func (h *HealthCheck) TimeoutOrDefault() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultHealthTimeout
+	}
+	return h.Timeout
+}
+
+// Thresholds returns the healthy and unhealthy thresholds, defaulted
+func (h *HealthCheck) Thresholds() (healthy, unhealthy int) {
+	healthy, unhealthy = h.HealthyThreshold, h.UnhealthyThreshold
+	if healthy <= 0 {
+		healthy = DefaultHealthyThreshold
+	}
+	if unhealthy <= 0 {
+		unhealthy = DefaultUnhealthyThreshold
+	}
+	return healthy, unhealthy
+}
+
+// validateUpstreams checks a route's upstreams and load-balancing block
+func (r *Route) validateUpstreams() error {
+	if len(r.Upstreams) == 0 {
+		if r.LoadBalancing != nil || r.HealthCheck != nil {
+			return fmt.Errorf("load-balancing and health-check require upstreams")
+		}
+		return nil
+	}
+	if h := r.HealthCheck; h != nil {
+		if h.Path != "" && !strings.HasPrefix(h.Path, "/") {
+			return fmt.Errorf("health-check: path must start with '/'")
+		}
+		if h.Interval < 0 || h.Timeout < 0 || h.HealthyThreshold < 0 || h.UnhealthyThreshold < 0 {
+			return fmt.Errorf("health-check: interval, timeout and thresholds must not be negative")
+		}
+	}
+	if r.Upstream != "" {
+		return fmt.Errorf("upstream and upstreams are mutually exclusive")
+	}
+	seen := map[string]bool{}
+	for j, e := range r.Upstreams {
+		if err := validateUpstream(e.URL); err != nil {
+			return fmt.Errorf("upstreams %d: %w", j, err)
+		}
+		if seen[e.URL] {
+			return fmt.Errorf("upstreams %d: %q listed twice", j, e.URL)
+		}
+		seen[e.URL] = true
+		if e.Weight < 0 {
+			return fmt.Errorf("upstreams %d: weight must not be negative", j)
+		}
+	}
+	if lb := r.LoadBalancing; lb != nil {
+		switch lb.Policy {
+		case "", BalanceRoundRobin, BalanceWeighted, BalanceLeastConnections:
+		default:
+			return fmt.Errorf("load-balancing: unknown policy %q", lb.Policy)
+		}
+		if lb.FailureThreshold < 0 || lb.EjectDuration < 0 {
+			return fmt.Errorf("load-balancing: failure-threshold and eject-duration must not be negative")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Package ipfilter admits ingress requests by client IP against CIDR allow and deny lists, deriving
+// the client IP from X-Forwarded-For when the peer is a trusted proxy.
+package ipfilter
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// globalKey labels refusals by the global ip-access lists
+const globalKey = "*"
+
+// Middleware refuses with 403 clients the global or the matched route's ip-access does not admit,
+// before any authentication, and records the derived client IP for the access log
+func Middleware(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return c.Next()
+	}
+	ip := clientAddr(c, conf.ClientIP)
+	accesslog.SetClientIP(c, ip.String())
+	if !conf.IPAccess.Admits(ip) {
+		return denied(globalKey)
+	}
+	if route, ok := conf.MatchRoute(c.Hostname(), c.Path()); ok && !route.IPAccess.Admits(ip) {
+		return denied(route.Key())
+	}
+	return c.Next()
+}
+
+func denied(key string) error {
+	metrics.IngressIPDenied.WithLabelValues(key).Inc()
+	return fiber.NewError(fiber.StatusForbidden, "client IP not allowed")
+}
+
+// ClientIP returns the client IP of the request, derived behind trusted proxies
+func ClientIP(c fiber.Ctx) string {
+	var trust *ingressconfig.ClientIPConfig
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		trust = conf.ClientIP
+	}
+	return clientAddr(c, trust).String()
+}
+
+func clientAddr(c fiber.Ctx, trust *ingressconfig.ClientIPConfig) netip.Addr {
+	peer, _ := netip.ParseAddr(c.IP())
+	var hops []string
+	for _, v := range c.Request().Header.PeekAll(fiber.HeaderXForwardedFor) {
+		hops = append(hops, strings.Split(string(v), ",")...)
+	}
+	return resolve(peer.Unmap(), hops, trust)
+}
+
+// resolve walks X-Forwarded-For back from the right while each hop is a trusted proxy, up to the
+// configured depth; the first untrusted address, or the last one the depth allows, is the client.
+// A malformed entry stops the walk, since nothing to its left can be believed.
+func resolve(peer netip.Addr, hops []string, trust *ingressconfig.ClientIPConfig) netip.Addr {
+	if trust == nil {
+		return peer
+	}
+	ip := peer
+	for i := 0; i < trust.Depth() && i < len(hops); i++ {
+		if !trust.TrustedProxies.Contains(ip) {
+			break
+		}
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1-i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+	}
+	return ip
+}
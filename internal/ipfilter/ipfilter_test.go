@@ -0,0 +1,92 @@
+package ipfilter
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/ingressconfig"
+)
+
+func cidrs(t *testing.T, values ...string) ingressconfig.CIDRs {
+	t.Helper()
+	var c ingressconfig.CIDRs
+	for _, v := range values {
+		c = append(c, netip.MustParsePrefix(v))
+	}
+	return c
+}
+
+func TestResolve(t *testing.T) {
+	trust := &ingressconfig.ClientIPConfig{TrustedProxies: cidrs(t, "10.0.0.0/8"), ForwardedForDepth: 2}
+	peer := netip.MustParseAddr("10.0.0.1")
+	cases := []struct {
+		name  string
+		peer  netip.Addr
+		hops  []string
+		trust *ingressconfig.ClientIPConfig
+		want  string
+	}{
+		{"no trust config", peer, []string{"203.0.113.9"}, nil, "10.0.0.1"},
+		{"untrusted peer", netip.MustParseAddr("198.51.100.7"), []string{"203.0.113.9"}, trust, "198.51.100.7"},
+		{"one hop", peer, []string{"203.0.113.9"}, trust, "203.0.113.9"},
+		{"through a second proxy", peer, []string{"203.0.113.9", " 10.1.2.3"}, trust, "203.0.113.9"},
+		{"spoofed entry beyond an untrusted hop", peer, []string{"10.9.9.9", "203.0.113.9"}, trust, "203.0.113.9"},
+		{"beyond the depth", peer, []string{"192.0.2.1", "10.2.2.2", "10.1.1.1"}, trust, "10.2.2.2"},
+		{"malformed hop", peer, []string{"unknown"}, trust, "10.0.0.1"},
+		{"no header", peer, nil, trust, "10.0.0.1"},
+	}
+	for _, tc := range cases {
+		if got := resolve(tc.peer, tc.hops, tc.trust).String(); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	// app.Test connects from 0.0.0.0, which stands in for the trusted load balancer
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		ClientIP: &ingressconfig.ClientIPConfig{TrustedProxies: cidrs(t, "0.0.0.0/32")},
+		IPAccess: &ingressconfig.IPAccess{Deny: cidrs(t, "203.0.113.0/24")},
+		Routes: []ingressconfig.Route{{
+			PathPrefix: "/admin",
+			IPAccess:   &ingressconfig.IPAccess{Allow: cidrs(t, "192.0.2.0/24"), Deny: cidrs(t, "192.0.2.66/32")},
+		}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New()
+	app.Use(canonpath.Middleware)
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendString(ClientIP(c)) })
+
+	cases := []struct {
+		path, forwardedFor string
+		want               int
+	}{
+		{"/orders", "198.51.100.1", fiber.StatusOK},
+		{"/orders", "203.0.113.5", fiber.StatusForbidden},
+		{"/admin/users", "192.0.2.10", fiber.StatusOK},
+		{"/admin/users", "198.51.100.1", fiber.StatusForbidden},
+		{"/admin/users", "192.0.2.66", fiber.StatusForbidden},
+		// only the entry the trusted proxy appended counts
+		{"/admin/users", "192.0.2.10, 198.51.100.1", fiber.StatusForbidden},
+		// the route is matched on the path the upstream serves
+		{"/orders/../admin/users", "198.51.100.1", fiber.StatusBadRequest},
+		{"/%61dmin/users", "198.51.100.1", fiber.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s from %s: expected %d, got %d", tc.path, tc.forwardedFor, tc.want, resp.StatusCode)
+		}
+	}
+}
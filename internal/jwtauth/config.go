@@ -0,0 +1,271 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config configures ingress token validation; it lives under authn: in ingress-config.yaml
+type Config struct {
+	// Algorithms is the allowlist of accepted JWS algorithms (default DefaultAlgorithms)
+	Algorithms []string `yaml:"algorithms"`
+	// ClockSkew is the tolerance applied when checking exp and nbf
+	ClockSkew time.Duration `yaml:"clock-skew"`
+	// RequireExp rejects tokens without an exp claim
+	RequireExp bool `yaml:"require-exp"`
+	// KeyRefresh tunes the scheduled refresh of issuer keys
+	KeyRefresh *KeyRefreshConfig `yaml:"key-refresh"`
+	// KeyCacheFile, when set, persists fetched key sets and loads them at startup before the first fetch
+	KeyCacheFile string `yaml:"key-cache-file"`
+	// DiscoveryInterval is how often issuers without a jwks-url are re-discovered (default DefaultDiscoveryInterval)
+	DiscoveryInterval time.Duration `yaml:"discovery-interval"`
+	// TokenCacheSize bounds the cache of validated tokens (default DefaultTokenCacheSize; negative disables it)
+	TokenCacheSize int `yaml:"token-cache-size"`
+	// ClaimsMapping selects the claims the principal's fields are read from
+	ClaimsMapping *ClaimsMapping `yaml:"claims-mapping"`
+	// RoleClaims lists the claims, as dotted paths into nested objects, whose values become the
+	// principal's roles (default DefaultRoleClaims)
+	RoleClaims []string `yaml:"role-claims"`
+	// Introspection accepts opaque (non-JWS) bearer tokens by asking the provider about them
+	Introspection *IntrospectionConfig `yaml:"introspection"`
+	// UserInfo merges the claims of the OIDC userinfo endpoint into the principal
+	UserInfo *UserInfoConfig `yaml:"userinfo"`
+	// Decryption accepts access tokens encrypted to the sidecar (nested JWTs)
+	Decryption *DecryptionConfig `yaml:"decryption"`
+	// DPoP validates proof-of-possession for sender-constrained tokens
+	DPoP *DPoPConfig `yaml:"dpop"`
+	// Issuers lists the accepted token issuers. The key set is selected by the token's iss claim;
+	// when empty, tokens are verified against the default key set filled by FetchPublicKeys.
+	Issuers []IssuerConfig `yaml:"issuers"`
+}
+
+// IssuerConfig describes one identity provider accepted at ingress
+type IssuerConfig struct {
+	// Issuer must equal the iss claim of tokens from this provider
+	Issuer string `yaml:"issuer"`
+	// JWKSURL pins the key set location; when empty it is resolved through OIDC discovery
+	JWKSURL string `yaml:"jwks-url"`
+	// Audiences, when set, requires the aud claim to contain at least one of them
+	Audiences []string `yaml:"audiences"`
+	// ClockSkew overrides the authn clock-skew for this issuer when set
+	ClockSkew time.Duration `yaml:"clock-skew"`
+	// RequireExp rejects tokens from this issuer without an exp claim, in addition to the authn require-exp
+	RequireExp bool `yaml:"require-exp"`
+	// Algorithms narrows the accepted JWS algorithms for this issuer, replacing the authn algorithms
+	Algorithms []string `yaml:"algorithms"`
+}
+
+// Issuer is a configured issuer together with its key set
+type Issuer struct {
+	IssuerConfig
+	Keys *KeySet
+	meta *atomic.Pointer[ProviderMetadata]
+}
+
+// DefaultAlgorithms are accepted when no allowlist is configured
+var DefaultAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "EdDSA"}
+
+// supportedAlgorithms are the asymmetric algorithms keys from a JWKS can verify
+var supportedAlgorithms = append(DefaultAlgorithms, "ES512")
+
+// authnState is the installed config and the issuers built from it
+type authnState struct {
+	conf           *Config
+	issuers        map[string]*Issuer
+	decryptionKeys []decryptionKey
+}
+
+var state atomic.Pointer[authnState]
+
+// Configure validates and installs the authn config; nil restores the defaults.
+// Key sets of issuers whose JWKS URL is unchanged are carried over, so a reload keeps their keys.
+func Configure(c *Config) error {
+	if c == nil {
+		state.Store(nil)
+		purgeTokenCache()
+		return nil
+	}
+	if err := checkAlgorithms("authn", c.Algorithms); err != nil {
+		return err
+	}
+
+	if ic := c.Introspection; ic != nil && ic.Enabled && ic.Endpoint == "" && ic.Issuer == "" {
+		return errors.New("authn: introspection requires an endpoint or an issuer to discover it from")
+	}
+	if ui := c.UserInfo; ui != nil && ui.CacheTTL < 0 {
+		return errors.New("authn: userinfo cache-ttl must not be negative")
+	}
+	if kr := c.KeyRefresh; kr != nil {
+		if kr.Interval < 0 || kr.GracePeriod < 0 {
+			return errors.New("authn: key-refresh interval and grace-period must not be negative")
+		}
+		if kr.Jitter != nil && (*kr.Jitter < 0 || *kr.Jitter >= 1) {
+			return errors.New("authn: key-refresh jitter must be at least 0 and below 1")
+		}
+	}
+	if c.DPoP != nil && c.DPoP.MaxAge < 0 {
+		return errors.New("authn: dpop.max-age must not be negative")
+	}
+
+	prev := state.Load()
+	issuers := make(map[string]*Issuer, len(c.Issuers))
+	for i, ic := range c.Issuers {
+		if ic.Issuer == "" {
+			return fmt.Errorf("authn: issuer %d: issuer is required", i)
+		}
+		if _, dup := issuers[ic.Issuer]; dup {
+			return fmt.Errorf("authn: duplicate issuer %q", ic.Issuer)
+		}
+		if err := checkAlgorithms("authn: issuer "+ic.Issuer, ic.Algorithms); err != nil {
+			return err
+		}
+		is := &Issuer{IssuerConfig: ic, Keys: NewKeySet(ic.JWKSURL), meta: new(atomic.Pointer[ProviderMetadata])}
+		if prev != nil {
+			if old, ok := prev.issuers[ic.Issuer]; ok && old.JWKSURL == ic.JWKSURL {
+				is.Keys, is.meta = old.Keys, old.meta
+			}
+		}
+		issuers[ic.Issuer] = is
+	}
+	var decryptionKeys []decryptionKey
+	if c.Decryption != nil {
+		var err error
+		if decryptionKeys, err = loadDecryptionKeys(c.Decryption); err != nil {
+			return err
+		}
+	}
+	state.Store(&authnState{conf: c, issuers: issuers, decryptionKeys: decryptionKeys})
+	// cached results were validated against the previous issuers, audiences and allowlist
+	purgeTokenCache()
+	return nil
+}
+
+// checkAlgorithms rejects allowlist entries no JWKS key can verify, naming "none" and the symmetric
+// HMAC algorithms explicitly since they are the usual confusion attacks
+func checkAlgorithms(where string, algs []string) error {
+	for _, alg := range algs {
+		switch {
+		case strings.EqualFold(alg, "none"):
+			return fmt.Errorf("%s: algorithm \"none\" accepts unsigned tokens and is never allowed", where)
+		case strings.HasPrefix(alg, "HS"):
+			return fmt.Errorf("%s: symmetric algorithm %q is not supported; keys come from a public JWKS", where, alg)
+		case !slices.Contains(supportedAlgorithms, alg):
+			return fmt.Errorf("%s: unsupported algorithm %q", where, alg)
+		}
+	}
+	return nil
+}
+
+// AllowedAlgorithms returns the configured algorithm allowlist or DefaultAlgorithms
+func AllowedAlgorithms() []string {
+	if s := state.Load(); s != nil && len(s.conf.Algorithms) > 0 {
+		return s.conf.Algorithms
+	}
+	return DefaultAlgorithms
+}
+
+// IssuersConfigured reports whether tokens are matched against configured issuers
+func IssuersConfigured() bool {
+	s := state.Load()
+	return s != nil && len(s.issuers) > 0
+}
+
+// ResolveIssuer returns the issuer whose keys verify a token with the given iss claim.
+// Without configured issuers every token is verified against the default key set.
+func ResolveIssuer(iss string) (*Issuer, bool) {
+	s := state.Load()
+	if s == nil || len(s.issuers) == 0 {
+		return &Issuer{Keys: defaultKeys}, true
+	}
+	is, ok := s.issuers[iss]
+	return is, ok
+}
+
+// Issuers returns the configured issuers sorted by issuer string
+func Issuers() []*Issuer {
+	s := state.Load()
+	if s == nil {
+		return nil
+	}
+	list := make([]*Issuer, 0, len(s.issuers))
+	for _, is := range s.issuers {
+		list = append(list, is)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Issuer < list[j].Issuer })
+	return list
+}
+
+// FetchIssuerKeys refetches the JWKS of every configured issuer, returning the joined errors
+func FetchIssuerKeys() error {
+	var errs []error
+	for _, is := range Issuers() {
+		if err := is.Keys.Fetch(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", is.Issuer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// KeyRefreshInterval is how often RunRefresh refetches every issuer's keys when authn.key-refresh
+// sets no interval
+var KeyRefreshInterval = 24 * time.Hour
+
+// RunRefresh keeps the issuers current until ctx is done: each key set is refetched when its
+// scheduled refresh is due (see KeyRefreshConfig) and discovered issuers re-resolved every
+// DiscoveryInterval, so rotations and endpoint moves are picked up
+func RunRefresh(ctx context.Context) {
+	start := time.Now()
+	keys := time.NewTimer(time.Until(nextKeyRefresh(start)))
+	defer keys.Stop()
+	discovery := time.NewTimer(DiscoveryInterval())
+	defer discovery.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keys.C:
+			if err := refreshDueKeys(start); err != nil {
+				slog.Error("error refreshing public keys", slog.Any("error", err))
+			}
+			keys.Reset(time.Until(nextKeyRefresh(start)))
+		case <-discovery.C:
+			if err := Discover(); err != nil {
+				slog.Error("error re-discovering token issuers", slog.Any("error", err))
+			}
+			discovery.Reset(DiscoveryInterval())
+		}
+	}
+}
+
+// nextKeyRefresh returns when the earliest scheduled key set refresh is due
+func nextKeyRefresh(start time.Time) time.Time {
+	next := start.Add(KeyRefreshPeriod())
+	for _, is := range Issuers() {
+		if due := is.Keys.refreshDue(start); due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// refreshDueKeys refetches the key sets whose scheduled refresh is due, returning the joined errors
+func refreshDueKeys(start time.Time) error {
+	var errs []error
+	now := time.Now()
+	for _, is := range Issuers() {
+		if is.Keys.refreshDue(start).After(now) {
+			continue
+		}
+		if err := is.Keys.Fetch(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", is.Issuer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package jwtauth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigureAlgorithms(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	if err := Configure(&Config{Algorithms: []string{"HS256"}}); err == nil {
+		t.Fatalf("expected HS256 to be rejected")
+	}
+	if err := Configure(&Config{Algorithms: []string{"none"}}); err == nil {
+		t.Fatalf("expected none to be rejected")
+	}
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: "https://idp.test", Algorithms: []string{"HS512"}}}}); err == nil {
+		t.Fatalf("expected HS512 to be rejected for an issuer")
+	}
+	if err := Configure(&Config{Algorithms: []string{"ES256"}}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if got := AllowedAlgorithms(); !slices.Equal(got, []string{"ES256"}) {
+		t.Fatalf("AllowedAlgorithms = %v", got)
+	}
+	if err := Configure(nil); err != nil {
+		t.Fatalf("Configure(nil): %v", err)
+	}
+	if got := AllowedAlgorithms(); !slices.Equal(got, DefaultAlgorithms) {
+		t.Fatalf("expected defaults, got %v", got)
+	}
+}
+
+func TestConfigureIssuers(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	if err := Configure(&Config{Issuers: []IssuerConfig{{JWKSURL: "http://a/keys"}}}); err == nil {
+		t.Fatalf("expected error without issuer")
+	}
+	dup := []IssuerConfig{{Issuer: "a", JWKSURL: "http://a/keys"}, {Issuer: "a", JWKSURL: "http://b/keys"}}
+	if err := Configure(&Config{Issuers: dup}); err == nil {
+		t.Fatalf("expected error for duplicate issuer")
+	}
+
+	issuers := []IssuerConfig{{Issuer: "a", JWKSURL: "http://a/keys"}, {Issuer: "b", JWKSURL: "http://b/keys"}}
+	if err := Configure(&Config{Issuers: issuers}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	a, ok := ResolveIssuer("a")
+	if !ok || a.Keys.URL() != "http://a/keys" {
+		t.Fatalf("expected issuer a, got %+v", a)
+	}
+	if _, ok := ResolveIssuer("unknown"); ok {
+		t.Fatalf("unknown issuer must not resolve when issuers are configured")
+	}
+	a.Keys.set("kid-a", "key")
+
+	// reload: a keeps its key set, b's JWKS URL changed so it starts empty
+	issuers[1].JWKSURL = "http://b2/keys"
+	if err := Configure(&Config{Issuers: issuers}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if a2, _ := ResolveIssuer("a"); a2.Keys != a.Keys {
+		t.Fatalf("expected key set of unchanged issuer to be kept")
+	}
+	if b, _ := ResolveIssuer("b"); b.Keys.URL() != "http://b2/keys" {
+		t.Fatalf("expected new key set for b, got %s", b.Keys.URL())
+	}
+
+	if err := Configure(nil); err != nil {
+		t.Fatal(err)
+	}
+	if is, ok := ResolveIssuer("anything"); !ok || is.Keys != defaultKeys {
+		t.Fatalf("expected default key set without issuers")
+	}
+}
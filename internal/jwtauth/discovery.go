@@ -0,0 +1,83 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultDiscoveryInterval applies when authn discovery-interval is not set
+const DefaultDiscoveryInterval = time.Hour
+
+// ProviderMetadata holds the endpoints resolved from an issuer's OpenID configuration
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	JWKSURI               string `json:"jwks_uri"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+var discoveryClient = &http.Client{Timeout: 10 * time.Second}
+
+// DiscoveryInterval returns how often issuers relying on discovery are re-resolved
+func DiscoveryInterval() time.Duration {
+	if s := state.Load(); s != nil && s.conf.DiscoveryInterval > 0 {
+		return s.conf.DiscoveryInterval
+	}
+	return DefaultDiscoveryInterval
+}
+
+// Discover resolves /.well-known/openid-configuration for every issuer without a jwks-url
+// and points its key set at the discovered jwks_uri. Errors are joined per issuer.
+func Discover() error {
+	var errs []error
+	for _, is := range Issuers() {
+		if !is.usesDiscovery() {
+			continue
+		}
+		if err := is.discover(); err != nil {
+			errs = append(errs, fmt.Errorf("issuer %s: %w", is.Issuer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Metadata returns the last discovered provider metadata, or nil before the first successful discovery
+func (is *Issuer) Metadata() *ProviderMetadata {
+	if is.meta == nil {
+		return nil
+	}
+	return is.meta.Load()
+}
+
+func (is *Issuer) usesDiscovery() bool { return is.JWKSURL == "" }
+
+func (is *Issuer) discover() error {
+	url := strings.TrimSuffix(is.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := discoveryClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discovery returned %s", resp.Status)
+	}
+	var md ProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&md); err != nil {
+		return fmt.Errorf("decoding discovery document: %w", err)
+	}
+	// OpenID Connect Discovery 1.0 §4.3: the document must be for the issuer that was asked for
+	if md.Issuer != is.Issuer {
+		return fmt.Errorf("discovery document is for issuer %q", md.Issuer)
+	}
+	if md.JWKSURI == "" {
+		return errors.New("discovery document has no jwks_uri")
+	}
+	is.meta.Store(&md)
+	is.Keys.setURL(md.JWKSURI)
+	return nil
+}
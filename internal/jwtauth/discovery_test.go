@@ -0,0 +1,76 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoverResolvesJWKSURI(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int32
+	keys := jwksServer(t, map[string]*rsa.PublicKey{"disc-kid": &priv.PublicKey}, 0, &hits)
+	defer keys.Close()
+
+	var issuerURL string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/realms/test/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                issuerURL,
+			JWKSURI:               keys.URL,
+			TokenEndpoint:         issuerURL + "/token",
+			IntrospectionEndpoint: issuerURL + "/introspect",
+		})
+	}))
+	defer idp.Close()
+	issuerURL = idp.URL + "/realms/test"
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: issuerURL}}}); err != nil {
+		t.Fatal(err)
+	}
+	is, _ := ResolveIssuer(issuerURL)
+	if err := is.Keys.Fetch(); err == nil {
+		t.Fatalf("expected fetch to fail before discovery")
+	}
+
+	if err := Discover(); err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if md := is.Metadata(); md == nil || md.TokenEndpoint != issuerURL+"/token" || md.IntrospectionEndpoint != issuerURL+"/introspect" {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+	if err := FetchIssuerKeys(); err != nil {
+		t.Fatalf("FetchIssuerKeys: %v", err)
+	}
+	if _, ok := is.Keys.Get("disc-kid"); !ok {
+		t.Fatalf("expected discovered key set to be fetched")
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ProviderMetadata{Issuer: "https://impostor.example", JWKSURI: "http://keys"})
+	}))
+	defer idp.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: idp.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Discover(); err == nil {
+		t.Fatalf("expected issuer mismatch to be rejected")
+	}
+	if is, _ := ResolveIssuer(idp.URL); is.Keys.URL() != "" {
+		t.Fatalf("jwks_uri from a mismatched document must not be used")
+	}
+}
@@ -0,0 +1,206 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/replay"
+)
+
+// DPoPConfig enables RFC 9449 DPoP: sender-constrained tokens presented with a signed proof per request
+type DPoPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Required rejects access tokens that are not DPoP-bound (no cnf.jkt claim)
+	Required bool `yaml:"required"`
+	// MaxAge is how far a proof's iat may be from now; proof jtis are remembered this long (default 5m)
+	MaxAge time.Duration `yaml:"max-age"`
+}
+
+// DefaultDPoPMaxAge is used when dpop.max-age is not configured
+const DefaultDPoPMaxAge = 5 * time.Minute
+
+const maxDPoPReplayEntries = 100000
+
+// DPoP errors returned by VerifyDPoP
+var (
+	ErrDPoPInvalidProof = errors.New("invalid DPoP proof")
+	ErrDPoPReplayed     = errors.New("DPoP proof replayed")
+	ErrDPoPKeyMismatch  = errors.New("DPoP proof key does not match token binding")
+)
+
+var dpopReplayMu sync.Mutex
+var dpopReplay = make(map[string]time.Time)
+
+// DPoP returns the installed DPoP config, or nil when DPoP is disabled
+func DPoP() *DPoPConfig {
+	s := state.Load()
+	if s == nil || s.conf.DPoP == nil || !s.conf.DPoP.Enabled {
+		return nil
+	}
+	return s.conf.DPoP
+}
+
+// ConfirmationThumbprint returns the cnf.jkt claim binding a token to a DPoP key, or "" when unbound
+func ConfirmationThumbprint(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// VerifyDPoP checks a DPoP proof for a request: its signature by the embedded public key, typ,
+// htm and htu against the request, iat freshness, jti replay, the ath hash of accessToken and,
+// when jkt is set, that the proof key's thumbprint matches it.
+func VerifyDPoP(proof, method, htu, accessToken, jkt string) error {
+	maxAge := DefaultDPoPMaxAge
+	var skew time.Duration
+	if s := state.Load(); s != nil {
+		skew = s.conf.ClockSkew
+		if s.conf.DPoP != nil && s.conf.DPoP.MaxAge > 0 {
+			maxAge = s.conf.DPoP.MaxAge
+		}
+	}
+
+	var thumbprint string
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, "dpop+jwt") {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		jwk, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		if _, private := jwk["d"]; private {
+			return nil, errors.New("jwk header contains a private key")
+		}
+		key, err := parseJWK(jwk)
+		if err != nil || key == nil {
+			return nil, errors.New("unsupported jwk header")
+		}
+		if thumbprint, err = jwkThumbprint(jwk); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}, jwt.WithValidMethods(supportedAlgorithms), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDPoPInvalidProof, err)
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return fmt.Errorf("%w: htm does not match request method", ErrDPoPInvalidProof)
+	}
+	if claimed, _ := claims["htu"].(string); !sameHTU(claimed, htu) {
+		return fmt.Errorf("%w: htu does not match request URL", ErrDPoPInvalidProof)
+	}
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return fmt.Errorf("%w: missing iat", ErrDPoPInvalidProof)
+	}
+	if age := time.Since(iat.Time); age > maxAge+skew || age < -skew {
+		return fmt.Errorf("%w: iat outside the accepted window", ErrDPoPInvalidProof)
+	}
+	sum := sha256.Sum256([]byte(accessToken))
+	if ath, _ := claims["ath"].(string); ath != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("%w: ath does not match access token", ErrDPoPInvalidProof)
+	}
+	if jkt != "" && thumbprint != jkt {
+		return ErrDPoPKeyMismatch
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("%w: missing jti", ErrDPoPInvalidProof)
+	}
+	// with replay protection enabled its store, possibly shared by replicas, also keeps proof jtis
+	if replay.Enabled() {
+		err := replay.CheckProof(context.Background(), jti, iat.Add(maxAge+skew))
+		if errors.Is(err, replay.ErrReplayed) {
+			return ErrDPoPReplayed
+		}
+		return err
+	}
+	if !rememberJTI(jti, iat.Add(maxAge+skew)) {
+		return ErrDPoPReplayed
+	}
+	return nil
+}
+
+// sameHTU compares htu values ignoring query, fragment and the case of scheme and host (RFC 9449 section 4.3)
+func sameHTU(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) && ua.Path == ub.Path
+}
+
+// jwkThumbprint computes the RFC 7638 SHA-256 thumbprint of a public JWK, base64url encoded
+func jwkThumbprint(jwk map[string]interface{}) (string, error) {
+	var members []string
+	switch jwk["kty"] {
+	case "RSA":
+		members = []string{"e", "kty", "n"}
+	case "EC":
+		members = []string{"crv", "kty", "x", "y"}
+	case "OKP":
+		members = []string{"crv", "kty", "x"}
+	default:
+		return "", fmt.Errorf("unsupported kty %v", jwk["kty"])
+	}
+	// members are listed in lexicographic order, as the canonical form requires
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, m := range members {
+		v, ok := jwk[m].(string)
+		if !ok {
+			return "", fmt.Errorf("jwk is missing %q", m)
+		}
+		name, _ := json.Marshal(m)
+		value, _ := json.Marshal(v)
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	sum := sha256.Sum256([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// rememberJTI records a proof jti until expires, reporting false when it was already seen
+func rememberJTI(jti string, expires time.Time) bool {
+	dpopReplayMu.Lock()
+	defer dpopReplayMu.Unlock()
+	now := time.Now()
+	if seen, ok := dpopReplay[jti]; ok && now.Before(seen) {
+		return false
+	}
+	if len(dpopReplay) >= maxDPoPReplayEntries {
+		for k, exp := range dpopReplay {
+			if now.After(exp) {
+				delete(dpopReplay, k)
+			}
+		}
+		if len(dpopReplay) >= maxDPoPReplayEntries {
+			// fail closed rather than forget jtis that are still inside the window
+			return false
+		}
+	}
+	dpopReplay[jti] = expires
+	return true
+}
@@ -0,0 +1,96 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func ecJWK(pub *ecdsa.PublicKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   b64url(pub.X.FillBytes(make([]byte, 32))),
+		"y":   b64url(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func makeDPoPProof(t *testing.T, priv *ecdsa.PrivateKey, htm, htu, accessToken, jti string, iat time.Time) string {
+	t.Helper()
+	ath := sha256.Sum256([]byte(accessToken))
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"htm": htm, "htu": htu, "jti": jti, "iat": iat.Unix(), "ath": b64url(ath[:]),
+	})
+	tok.Header["typ"] = "dpop+jwt"
+	tok.Header["jwk"] = ecJWK(&priv.PublicKey)
+	s, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWKThumbprintRFC7638(t *testing.T) {
+	jwk := map[string]interface{}{
+		"kty": "RSA",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+		"n":   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	got, err := jwkThumbprint(jwk)
+	if err != nil || got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("unexpected thumbprint %q %v", got, err)
+	}
+}
+
+func TestVerifyDPoP(t *testing.T) {
+	if err := Configure(&Config{DPoP: &DPoPConfig{Enabled: true, MaxAge: time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := jwkThumbprint(ecJWK(&priv.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const htu = "https://api.example.com/orders"
+	now := time.Now()
+
+	valid := makeDPoPProof(t, priv, "GET", htu, "access", "jti-1", now)
+	if err := VerifyDPoP(valid, "GET", "https://API.example.com/orders", "access", jkt); err != nil {
+		t.Fatalf("expected valid proof, got %v", err)
+	}
+	if err := VerifyDPoP(valid, "GET", htu, "access", jkt); !errors.Is(err, ErrDPoPReplayed) {
+		t.Errorf("expected replay to be rejected, got %v", err)
+	}
+
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cases := map[string]struct {
+		proof string
+		jkt   string
+		want  error
+	}{
+		"htm":         {makeDPoPProof(t, priv, "POST", htu, "access", "jti-2", now), jkt, ErrDPoPInvalidProof},
+		"htu":         {makeDPoPProof(t, priv, "GET", htu+"/1", "access", "jti-3", now), jkt, ErrDPoPInvalidProof},
+		"ath":         {makeDPoPProof(t, priv, "GET", htu, "other", "jti-4", now), jkt, ErrDPoPInvalidProof},
+		"stale iat":   {makeDPoPProof(t, priv, "GET", htu, "access", "jti-5", now.Add(-2*time.Minute)), jkt, ErrDPoPInvalidProof},
+		"key binding": {makeDPoPProof(t, other, "GET", htu, "access", "jti-6", now), jkt, ErrDPoPKeyMismatch},
+		"garbage":     {"not-a-jwt", jkt, ErrDPoPInvalidProof},
+	}
+	for name, tc := range cases {
+		if err := VerifyDPoP(tc.proof, "GET", htu, "access", tc.jkt); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
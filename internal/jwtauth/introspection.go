@@ -0,0 +1,184 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/tracing"
+	"reverseProxy/internal/util"
+)
+
+// IntrospectionConfig enables RFC 7662 token introspection for bearer tokens that are not JWS
+type IntrospectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the introspection URL; when empty the introspection_endpoint discovered for Issuer is used
+	Endpoint string `yaml:"endpoint"`
+	Issuer   string `yaml:"issuer"`
+	ClientID string `yaml:"client-id"`
+	// ClientSecret authenticates the sidecar to the introspection endpoint
+	ClientSecret string `yaml:"client-secret"`
+	// ClientAuthMethod is client_secret_basic (default) or client_secret_post
+	ClientAuthMethod string `yaml:"client-auth-method"`
+	// CacheTTL bounds how long an active result is reused; it never outlives the token's exp (default 60s)
+	CacheTTL time.Duration `yaml:"cache-ttl"`
+}
+
+const (
+	defaultIntrospectionCacheTTL = time.Minute
+	maxIntrospectionEntries      = 10000
+)
+
+// ErrTokenInactive is returned when the introspection endpoint reports the token as not active
+var ErrTokenInactive = errors.New("token is not active")
+
+var introspectionClient = &http.Client{Timeout: 5 * time.Second}
+
+type introspectionEntry struct {
+	principal Principal
+	claims    jwt.MapClaims
+	expires   time.Time
+}
+
+var introspectionMu sync.Mutex
+var introspectionCache = make(map[[sha256.Size]byte]introspectionEntry)
+
+// IntrospectionEnabled reports whether opaque tokens are accepted through introspection
+func IntrospectionEnabled() bool {
+	s := state.Load()
+	return s != nil && s.conf.Introspection != nil && s.conf.Introspection.Enabled
+}
+
+// Introspect resolves an opaque token to a Principal and the introspection response claims,
+// reusing cached active results. Inactive tokens are not cached, so a token that becomes active
+// is picked up immediately.
+func Introspect(ctx context.Context, token string) (Principal, jwt.MapClaims, error) {
+	s := state.Load()
+	if s == nil || s.conf.Introspection == nil || !s.conf.Introspection.Enabled {
+		return Principal{}, nil, errors.New("introspection is not enabled")
+	}
+	conf := *s.conf.Introspection
+
+	key := sha256.Sum256([]byte(token))
+	if e, ok := cachedIntrospection(key); ok {
+		return e.principal, e.claims, nil
+	}
+
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		if is, ok := ResolveIssuer(conf.Issuer); ok {
+			if md := is.Metadata(); md != nil {
+				endpoint = md.IntrospectionEndpoint
+			}
+		}
+	}
+	if endpoint == "" {
+		return Principal{}, nil, errors.New("no introspection endpoint configured or discovered")
+	}
+
+	claims, err := postIntrospection(ctx, conf, endpoint, token)
+	if err != nil {
+		return Principal{}, nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return Principal{}, nil, ErrTokenInactive
+	}
+	p := principalFromIntrospection(claims)
+
+	ttl := conf.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultIntrospectionCacheTTL
+	}
+	expires := time.Now().Add(ttl)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+	storeIntrospection(key, introspectionEntry{principal: p, claims: claims, expires: expires})
+	return p, claims, nil
+}
+
+func postIntrospection(ctx context.Context, conf IntrospectionConfig, endpoint, token string) (jwt.MapClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	if conf.ClientAuthMethod == "client_secret_post" {
+		form.Set("client_id", conf.ClientID)
+		form.Set("client_secret", conf.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	switch conf.ClientAuthMethod {
+	case "", "client_secret_basic":
+		if conf.ClientID != "" {
+			req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+		}
+	case "client_secret_post":
+	default:
+		return nil, fmt.Errorf("unsupported client auth method: %s", conf.ClientAuthMethod)
+	}
+	tracing.InjectHTTP(ctx, req.Header)
+
+	resp, err := introspectionClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %s", resp.Status)
+	}
+	var claims jwt.MapClaims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("decoding introspection response: %w", err)
+	}
+	return claims, nil
+}
+
+// principalFromIntrospection maps an introspection response like JWT claims, falling back to sub for the user ID
+func principalFromIntrospection(claims jwt.MapClaims) Principal {
+	p := PrincipalFromClaims(claims)
+	if p.UserID == "" {
+		p.UserID = util.GetClaimAsString(claims, "sub")
+	}
+	return p
+}
+
+func cachedIntrospection(key [sha256.Size]byte) (introspectionEntry, bool) {
+	introspectionMu.Lock()
+	defer introspectionMu.Unlock()
+	e, ok := introspectionCache[key]
+	if !ok {
+		return introspectionEntry{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(introspectionCache, key)
+		return introspectionEntry{}, false
+	}
+	return e, true
+}
+
+func storeIntrospection(key [sha256.Size]byte, e introspectionEntry) {
+	introspectionMu.Lock()
+	defer introspectionMu.Unlock()
+	if len(introspectionCache) >= maxIntrospectionEntries {
+		now := time.Now()
+		for k, old := range introspectionCache {
+			if now.After(old.expires) {
+				delete(introspectionCache, k)
+			}
+		}
+	}
+	if len(introspectionCache) < maxIntrospectionEntries {
+		introspectionCache[key] = e
+	}
+}
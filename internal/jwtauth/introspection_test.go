@@ -0,0 +1,67 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospectCachesActiveResults(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "sidecar" || secret != "s3cret" {
+			t.Errorf("expected client_secret_basic credentials, got %q/%q", id, secret)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm: %v", err)
+		}
+		resp := map[string]any{"active": false}
+		if r.PostForm.Get("token") == "good-token" {
+			resp = map[string]any{"active": true, "sub": "u-42", "username": "bob", "exp": time.Now().Add(time.Hour).Unix()}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Introspection: &IntrospectionConfig{
+		Enabled: true, Endpoint: srv.URL, ClientID: "sidecar", ClientSecret: "s3cret",
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		p, _, err := Introspect(context.Background(), "good-token")
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		if p.UserID != "u-42" || p.Username != "bob" {
+			t.Fatalf("unexpected principal %+v", p)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected active result to be cached, got %d calls", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := Introspect(context.Background(), "revoked-token"); !errors.Is(err, ErrTokenInactive) {
+			t.Fatalf("expected ErrTokenInactive, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 3 {
+		t.Fatalf("inactive results must not be cached, got %d calls", got)
+	}
+}
+
+func TestConfigureRequiresIntrospectionEndpoint(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Introspection: &IntrospectionConfig{Enabled: true}}); err == nil {
+		t.Fatalf("expected error without endpoint or issuer")
+	}
+}
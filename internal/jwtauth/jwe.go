@@ -0,0 +1,259 @@
+package jwtauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// DecryptionConfig unwraps nested JWTs: access tokens encrypted as a compact JWE around the signed
+// token (RFC 7519 section 5.2). Keys are managed with RSA-OAEP or RSA-OAEP-256 and contents
+// encrypted with A128GCM, A192GCM, A256GCM, A128CBC-HS256, A192CBC-HS384 or A256CBC-HS512.
+type DecryptionConfig struct {
+	// Keys are the RSA private keys tokens are encrypted to; the JWE kid header selects one
+	Keys []DecryptionKey `yaml:"keys"`
+	// Required rejects tokens that are not encrypted
+	Required bool `yaml:"required"`
+}
+
+// DecryptionKey is one token decryption key
+type DecryptionKey struct {
+	// Kid matches the kid header of tokens encrypted to this key; it may be empty with a single key
+	Kid string `yaml:"kid"`
+	// KeyFile is a PEM encoded PKCS#1 or PKCS#8 RSA private key
+	KeyFile string `yaml:"key-file"`
+}
+
+type decryptionKey struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+// ErrNotEncrypted reports a plain signed token where decryption.required demands a JWE
+var ErrNotEncrypted = errors.New("token is not encrypted")
+
+// loadDecryptionKeys reads the configured decryption keys
+func loadDecryptionKeys(c *DecryptionConfig) ([]decryptionKey, error) {
+	if len(c.Keys) == 0 {
+		return nil, errors.New("authn: decryption requires at least one key")
+	}
+	keys := make([]decryptionKey, 0, len(c.Keys))
+	for i, k := range c.Keys {
+		if k.Kid == "" && len(c.Keys) > 1 {
+			return nil, fmt.Errorf("authn: decryption key %d: kid is required with several keys", i)
+		}
+		key, err := readRSAPrivateKey(k.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("authn: decryption key %d: %w", i, err)
+		}
+		keys = append(keys, decryptionKey{kid: k.Kid, key: key})
+	}
+	return keys, nil
+}
+
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rsaKey, ok := k.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("%s: not an RSA private key", path)
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported private key", path)
+}
+
+// IsEncrypted reports whether a token has the five segments of a compact JWE
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// DecryptionEnabled reports whether encrypted tokens are accepted
+func DecryptionEnabled() bool {
+	s := state.Load()
+	return s != nil && len(s.decryptionKeys) > 0
+}
+
+// EncryptionRequired reports whether plain signed tokens are rejected
+func EncryptionRequired() bool {
+	s := state.Load()
+	return s != nil && s.conf.Decryption != nil && s.conf.Decryption.Required
+}
+
+// Decrypt unwraps a nested JWT and returns the signed token inside, which still has to be verified
+func Decrypt(token string) (string, error) {
+	s := state.Load()
+	if s == nil || len(s.decryptionKeys) == 0 {
+		return "", errors.New("token decryption is not configured")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", errors.New("not a compact JWE")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Enc string `json:"enc"`
+		Kid string `json:"kid"`
+		Zip string `json:"zip"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("JWE header: %w", err)
+	}
+	if header.Zip != "" {
+		return "", fmt.Errorf("unsupported JWE compression %q", header.Zip)
+	}
+	var segments [4][]byte
+	for i, part := range parts[1:] {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return "", errors.New("malformed JWE")
+		}
+		segments[i] = b
+	}
+	encryptedKey, iv, ciphertext, tag := segments[0], segments[1], segments[2], segments[3]
+
+	var oaepHash hash.Hash
+	switch header.Alg {
+	case "RSA-OAEP":
+		oaepHash = sha1.New()
+	case "RSA-OAEP-256":
+		oaepHash = sha256.New()
+	default:
+		return "", fmt.Errorf("unsupported JWE key management algorithm %q", header.Alg)
+	}
+
+	var plaintext []byte
+	err := fmt.Errorf("no decryption key for kid %q", header.Kid)
+	for _, k := range s.decryptionKeys {
+		if header.Kid != "" && k.kid != "" && k.kid != header.Kid {
+			continue
+		}
+		var cek []byte
+		cek, err = rsa.DecryptOAEP(oaepHash, nil, k.key, encryptedKey, nil)
+		if err != nil {
+			continue
+		}
+		// the protected header, as sent, is the additional authenticated data
+		plaintext, err = decryptContent(header.Enc, cek, iv, ciphertext, tag, []byte(parts[0]))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	inner := string(plaintext)
+	if strings.Count(inner, ".") != 2 {
+		return "", errors.New("encrypted token does not contain a signed JWT")
+	}
+	return inner, nil
+}
+
+// decryptContent decrypts and authenticates the JWE ciphertext with the content encryption key
+func decryptContent(enc string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	switch enc {
+	case "A128GCM", "A192GCM", "A256GCM":
+		if len(cek)*8 != gcmKeyBits(enc) {
+			return nil, errors.New("content encryption key has the wrong size")
+		}
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, errors.New("JWE initialization vector has the wrong size")
+		}
+		return aead.Open(nil, iv, append(ciphertext[:len(ciphertext):len(ciphertext)], tag...), aad)
+	case "A128CBC-HS256":
+		return decryptCBCHMAC(sha256.New, 16, cek, iv, ciphertext, tag, aad)
+	case "A192CBC-HS384":
+		return decryptCBCHMAC(sha512.New384, 24, cek, iv, ciphertext, tag, aad)
+	case "A256CBC-HS512":
+		return decryptCBCHMAC(sha512.New, 32, cek, iv, ciphertext, tag, aad)
+	}
+	return nil, fmt.Errorf("unsupported JWE content encryption %q", enc)
+}
+
+func gcmKeyBits(enc string) int {
+	switch enc {
+	case "A128GCM":
+		return 128
+	case "A192GCM":
+		return 192
+	}
+	return 256
+}
+
+// decryptCBCHMAC implements AES_CBC_HMAC_SHA2 (RFC 7518 section 5.2): the key splits into a MAC key
+// and an encryption key, and the tag is checked before any padding is looked at
+func decryptCBCHMAC(newHash func() hash.Hash, keyLen int, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if len(cek) != 2*keyLen {
+		return nil, errors.New("content encryption key has the wrong size")
+	}
+	macKey, encKey := cek[:keyLen], cek[keyLen:]
+	mac := hmac.New(newHash, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(aad))*8)
+	if want := mac.Sum(nil)[:keyLen]; subtle.ConstantTimeCompare(want, tag) != 1 {
+		return nil, errors.New("JWE authentication tag mismatch")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed JWE ciphertext")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, errors.New("malformed JWE padding")
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return nil, errors.New("malformed JWE padding")
+		}
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// decodeSegment decodes a base64url JSON segment
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,123 @@
+package jwtauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDecryptionKey stores priv as a PKCS#8 PEM file and returns its path
+func writeDecryptionKey(t *testing.T, priv *rsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwe.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encryptForTest wraps a signed token in a compact JWE using RSA-OAEP-256 and enc
+// (A256GCM or A128CBC-HS256)
+func encryptForTest(t *testing.T, pub *rsa.PublicKey, kid, enc, plaintext string) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RSA-OAEP-256", "enc": enc, "kid": kid, "cty": "JWT"})
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	cekLen := 32
+	cek := make([]byte, cekLen)
+	_, _ = rand.Read(cek)
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var iv, ciphertext, tag []byte
+	switch enc {
+	case "A256GCM":
+		block, _ := aes.NewCipher(cek)
+		aead, _ := cipher.NewGCM(block)
+		iv = make([]byte, aead.NonceSize())
+		_, _ = rand.Read(iv)
+		sealed := aead.Seal(nil, iv, []byte(plaintext), []byte(protected))
+		ciphertext, tag = sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+	case "A128CBC-HS256":
+		macKey, encKey := cek[:16], cek[16:]
+		block, _ := aes.NewCipher(encKey)
+		iv = make([]byte, block.BlockSize())
+		_, _ = rand.Read(iv)
+		pad := block.BlockSize() - len(plaintext)%block.BlockSize()
+		padded := append([]byte(plaintext), []byte(strings.Repeat(string(rune(pad)), pad))...)
+		ciphertext = make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write([]byte(protected))
+		mac.Write(iv)
+		mac.Write(ciphertext)
+		_ = binary.Write(mac, binary.BigEndian, uint64(len(protected))*8)
+		tag = mac.Sum(nil)[:16]
+	default:
+		t.Fatalf("unsupported enc %s", enc)
+	}
+	return strings.Join([]string{protected, b64url(encryptedKey), b64url(iv), b64url(ciphertext), b64url(tag)}, ".")
+}
+
+func TestDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Decryption: &DecryptionConfig{Keys: []DecryptionKey{{Kid: "enc-1", KeyFile: writeDecryptionKey(t, priv)}}}}); err != nil {
+		t.Fatal(err)
+	}
+	const inner = "eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ1MSJ9.c2ln"
+
+	for _, enc := range []string{"A256GCM", "A128CBC-HS256"} {
+		token := encryptForTest(t, &priv.PublicKey, "enc-1", enc, inner)
+		if !IsEncrypted(token) {
+			t.Fatalf("%s: expected a five-segment token", enc)
+		}
+		got, err := Decrypt(token)
+		if err != nil || got != inner {
+			t.Fatalf("%s: Decrypt = %q, %v", enc, got, err)
+		}
+
+		parts := strings.Split(token, ".")
+		parts[4] = b64url(make([]byte, 16))
+		if _, err := Decrypt(strings.Join(parts, ".")); err == nil {
+			t.Fatalf("%s: expected a tampered tag to be rejected", enc)
+		}
+	}
+
+	if _, err := Decrypt(encryptForTest(t, &priv.PublicKey, "other", "A256GCM", inner)); err == nil {
+		t.Fatal("expected an unknown kid to be rejected")
+	}
+	if _, err := Decrypt(encryptForTest(t, &priv.PublicKey, "enc-1", "A256GCM", "not-a-jwt")); err == nil {
+		t.Fatal("expected a plaintext that is not a signed JWT to be rejected")
+	}
+}
+
+func TestConfigureDecryption(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Decryption: &DecryptionConfig{}}); err == nil {
+		t.Fatal("expected decryption without keys to be rejected")
+	}
+	if err := Configure(&Config{Decryption: &DecryptionConfig{Keys: []DecryptionKey{{KeyFile: "/nonexistent.pem"}}}}); err == nil {
+		t.Fatal("expected a missing key file to be rejected")
+	}
+}
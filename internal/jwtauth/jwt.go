@@ -1,69 +1,134 @@
 package jwtauth
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"math/big"
-	"net/http"
-	"sync"
+	"strings"
 )
 
-// Principal represents the authenticated user extracted from JWT claims
+// Principal represents the authenticated user extracted from JWT claims (see ClaimsMapping)
 type Principal struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	// Roles are collected from the role-claims of the token (roles, groups, realm_access.roles by default)
+	Roles []string `json:"roles,omitempty"`
+	// Scopes are the token's granted scopes (scope or scp by default)
+	Scopes []string `json:"scopes,omitempty"`
+	// TenantID identifies the tenant the caller belongs to (tenant_id or tid by default)
+	TenantID string `json:"tenant_id,omitempty"`
+	// RawClaims holds the claims listed in claims-mapping.raw-claims, keyed by their path
+	RawClaims map[string]interface{} `json:"raw_claims,omitempty"`
 }
 
-// publicKeysCache stores the public keys by kid (Key ID)
-var publicKeysCache = make(map[string]*rsa.PublicKey)
+// defaultKeys is the key set used when no issuers are configured
+var defaultKeys = NewKeySet("")
 
-// cacheMutex ensures thread-safe access to the cache
-var cacheMutex sync.RWMutex
+// FetchPublicKeys fetches the JWKS from a given URL and caches the public keys in the default key set
+func FetchPublicKeys(url string) error {
+	return defaultKeys.fetchFrom(context.Background(), url)
+}
 
-// FetchPublicKeys fetches the JWKS from a given URL and caches the public keys
-func FetchPublicKeys(jwksURL string) error {
-	resp, err := http.Get(jwksURL)
-	if err != nil {
-		return err
+// keyFitsAlg reports whether a public key can verify signatures of the given JWS algorithm,
+// including the curve ES algorithms require
+func keyFitsAlg(key crypto.PublicKey, alg string) bool {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case strings.HasPrefix(alg, "ES"):
+		pk, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		want := map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}[alg]
+		return want != nil && pk.Curve == want
+	case alg == "EdDSA":
+		_, ok := key.(ed25519.PublicKey)
+		return ok
 	}
-	defer resp.Body.Close()
+	return false
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+// parseJWK converts a JWK into a public key. Unsupported key types and incomplete keys yield nil.
+func parseJWK(key map[string]interface{}) (crypto.PublicKey, error) {
+	str := func(name string) (string, bool) {
+		v, ok := key[name].(string)
+		return v, ok
 	}
-
-	var jwks map[string][]map[string]interface{}
-	if err := json.Unmarshal(body, &jwks); err != nil {
-		return err
+	switch key["kty"] {
+	case "RSA":
+		nVal, nOK := str("n")
+		eVal, eOK := str("e")
+		if !nOK || !eOK {
+			return nil, nil
+		}
+		return parseRSAPublicKey(nVal, eVal)
+	case "EC":
+		crv, _ := str("crv")
+		xVal, xOK := str("x")
+		yVal, yOK := str("y")
+		if !xOK || !yOK {
+			return nil, nil
+		}
+		return parseECPublicKey(crv, xVal, yVal)
+	case "OKP":
+		crv, _ := str("crv")
+		xVal, xOK := str("x")
+		if crv != "Ed25519" || !xOK {
+			return nil, nil
+		}
+		return parseEd25519PublicKey(xVal)
 	}
+	return nil, nil
+}
 
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
+// parseECPublicKey converts curve coordinates to an ECDSA public key
+func parseECPublicKey(crv, xStr, yStr string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported EC curve %q", crv)
+	}
+	xBytes, err := base64.RawURLEncoding.DecodeString(xStr)
+	if err != nil {
+		return nil, errors.New("failed to decode EC x coordinate")
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(yStr)
+	if err != nil {
+		return nil, errors.New("failed to decode EC y coordinate")
+	}
+	pk := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(pk.X, pk.Y) {
+		return nil, errors.New("EC point is not on curve " + crv)
+	}
+	return pk, nil
+}
 
-	for _, key := range jwks["keys"] {
-		kidFromKey, ok := key["kid"].(string)
-		if !ok {
-			continue
-		}
-		if key["kty"] == "RSA" {
-			nVal, nOK := key["n"].(string)
-			eVal, eOK := key["e"].(string)
-			if !nOK || !eOK {
-				continue
-			}
-			pubKey, err := parseRSAPublicKey(nVal, eVal)
-			if err != nil {
-				return err
-			}
-			publicKeysCache[kidFromKey] = pubKey
-		}
+// parseEd25519PublicKey decodes an OKP Ed25519 public key
+func parseEd25519PublicKey(xStr string) (ed25519.PublicKey, error) {
+	xBytes, err := base64.RawURLEncoding.DecodeString(xStr)
+	if err != nil {
+		return nil, errors.New("failed to decode Ed25519 key")
+	}
+	if len(xBytes) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key size")
 	}
-	return nil
+	return ed25519.PublicKey(xBytes), nil
 }
 
 // parseRSAPublicKey converts modulus and exponent to RSA public key
@@ -84,17 +149,22 @@ func parseRSAPublicKey(nStr, eStr string) (*rsa.PublicKey, error) {
 	return &rsa.PublicKey{N: n, E: exponent}, nil
 }
 
-// GetPublicKey returns a cached public key for a given kid and a boolean indicating existence
-func GetPublicKey(kid string) (*rsa.PublicKey, bool) {
-	cacheMutex.RLock()
-	defer cacheMutex.RUnlock()
-	pk, ok := publicKeysCache[kid]
-	return pk, ok
+// GetPublicKey returns a public key from the default key set and a boolean indicating existence
+func GetPublicKey(kid string) (crypto.PublicKey, bool) {
+	return defaultKeys.Get(kid)
+}
+
+// RefreshForKid looks a kid up in the default key set, refetching its JWKS on a miss
+func RefreshForKid(ctx context.Context, kid string) (crypto.PublicKey, bool) {
+	return defaultKeys.RefreshForKid(ctx, kid)
+}
+
+// CachedKids returns the key IDs currently held in the default key set, sorted
+func CachedKids() []string {
+	return defaultKeys.Kids()
 }
 
-// SetPublicKeyForTest allows tests to seed the cache. Do not use in production code paths.
-func SetPublicKeyForTest(kid string, pk *rsa.PublicKey) {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-	publicKeysCache[kid] = pk
+// SetPublicKeyForTest allows tests to seed the default key set. Do not use in production code paths.
+func SetPublicKeyForTest(kid string, pk crypto.PublicKey) {
+	defaultKeys.set(kid, pk)
 }
@@ -1,6 +1,9 @@
 package jwtauth
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
@@ -79,3 +82,47 @@ func TestFetchPublicKeysAndGet(t *testing.T) {
 func TestPrincipalType(t *testing.T) {
 	_ = Principal{UserID: "u", Username: "n"}
 }
+
+func TestFetchPublicKeys_ECAndOKP(t *testing.T) {
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string][]map[string]string{
+		"keys": {
+			{"kty": "EC", "kid": "ec-kid", "crv": "P-256", "x": b64url(ecPriv.X.Bytes()), "y": b64url(ecPriv.Y.Bytes())},
+			{"kty": "OKP", "kid": "ed-kid", "crv": "Ed25519", "x": b64url(edPub)},
+			{"kty": "oct", "kid": "hmac-kid", "k": "c2VjcmV0"},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+
+	if err := FetchPublicKeys(srv.URL); err != nil {
+		t.Fatalf("FetchPublicKeys error: %v", err)
+	}
+	if pk, ok := GetPublicKey("ec-kid"); !ok || !ecPriv.PublicKey.Equal(pk) {
+		t.Fatalf("expected EC key in cache, got %v", pk)
+	}
+	if pk, ok := GetPublicKey("ed-kid"); !ok || !edPub.Equal(pk) {
+		t.Fatalf("expected Ed25519 key in cache, got %v", pk)
+	}
+	if _, ok := GetPublicKey("hmac-kid"); ok {
+		t.Fatalf("symmetric keys must not be cached")
+	}
+}
+
+func TestParseECPublicKey_RejectsPointOffCurve(t *testing.T) {
+	if _, err := parseECPublicKey("P-256", b64url([]byte{1}), b64url([]byte{2})); err == nil {
+		t.Fatalf("expected error for point not on curve")
+	}
+	if _, err := parseECPublicKey("secp256k1", b64url([]byte{1}), b64url([]byte{2})); err == nil {
+		t.Fatalf("expected error for unsupported curve")
+	}
+}
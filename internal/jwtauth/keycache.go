@@ -0,0 +1,150 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// keyCacheFile is the document persisted at authn.key-cache-file: the last JWKS fetched per issuer
+type keyCacheFile struct {
+	Issuers map[string]cachedJWKS `json:"issuers"`
+}
+
+type cachedJWKS struct {
+	JWKSURL string          `json:"jwks_url"`
+	ETag    string          `json:"etag,omitempty"`
+	JWKS    json.RawMessage `json:"jwks"`
+}
+
+// keyCacheMu serializes writes of the key cache file
+var keyCacheMu sync.Mutex
+
+func keyCachePath() string {
+	if s := state.Load(); s != nil {
+		return s.conf.KeyCacheFile
+	}
+	return ""
+}
+
+// LoadKeyCache fills the key sets of the configured issuers from the key cache file, so tokens signed
+// with known keys verify before the first fetch succeeds. A missing file is not an error; issuers
+// whose keys were already fetched are left alone.
+func LoadKeyCache() error {
+	path := keyCachePath()
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cache keyCacheFile
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return fmt.Errorf("key cache %s: %w", path, err)
+	}
+
+	var errs []error
+	for _, is := range Issuers() {
+		entry, ok := cache.Issuers[is.Issuer]
+		if !ok {
+			continue
+		}
+		keys, err := parseJWKS(entry.JWKS)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key cache %s: issuer %s: %w", path, is.Issuer, err))
+			continue
+		}
+		is.Keys.loadCached(entry, keys)
+	}
+	return errors.Join(errs...)
+}
+
+// loadCached installs keys read from the key cache file unless the set already holds fetched keys
+func (s *KeySet) loadCached(entry cachedJWKS, keys map[string]jwk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.raw != nil {
+		return
+	}
+	// a pinned URL that changed since the file was written invalidates the cached keys
+	if s.url != "" && s.url != entry.JWKSURL {
+		return
+	}
+	s.url = entry.JWKSURL
+	s.etag = entry.ETag
+	s.raw = entry.JWKS
+	s.fromCache = true
+	for kid, k := range keys {
+		s.keys[kid] = k.key
+		s.setAlg(kid, k.alg)
+	}
+}
+
+// persistKeyCache writes the last fetched JWKS of every issuer to the key cache file, when one is
+// configured. The file is replaced atomically; failures are logged, as the keys stay usable in memory.
+func persistKeyCache() {
+	path := keyCachePath()
+	if path == "" {
+		return
+	}
+	cache := keyCacheFile{Issuers: map[string]cachedJWKS{}}
+	for _, is := range Issuers() {
+		is.Keys.mu.RLock()
+		if is.Keys.raw != nil {
+			cache.Issuers[is.Issuer] = cachedJWKS{JWKSURL: is.Keys.url, ETag: is.Keys.etag, JWKS: is.Keys.raw}
+		}
+		is.Keys.mu.RUnlock()
+	}
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err == nil {
+		keyCacheMu.Lock()
+		err = writeFileAtomic(path, b)
+		keyCacheMu.Unlock()
+	}
+	if err != nil {
+		slog.Warn("error writing key cache", slog.String("file", path), slog.Any("error", err))
+	}
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the same directory
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// keysFromCache reports whether some issuer still relies on keys read from the key cache file
+func keysFromCache() bool {
+	for _, is := range Issuers() {
+		is.Keys.mu.RLock()
+		fromCache := is.Keys.fromCache
+		is.Keys.mu.RUnlock()
+		if fromCache {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyCache_SurvivesRestartWithoutProvider(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PublicKey{"k1": &priv.PublicKey}, 0, &hits)
+	conf := &Config{
+		KeyCacheFile: filepath.Join(t.TempDir(), "cache", "jwks.json"),
+		Issuers:      []IssuerConfig{{Issuer: "https://idp.test", JWKSURL: srv.URL}},
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := FetchIssuerKeys(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// a restart: fresh key sets, and the provider is down
+	_ = Configure(nil)
+	if err := Configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	if Ready() {
+		t.Fatal("expected no keys before the cache is loaded")
+	}
+	if err := LoadKeyCache(); err != nil {
+		t.Fatal(err)
+	}
+	if !Ready() || !keysFromCache() {
+		t.Fatalf("expected ready from cached keys, got ready=%v fromCache=%v", Ready(), keysFromCache())
+	}
+	is, _ := ResolveIssuer("https://idp.test")
+	if _, ok := is.Keys.Get("k1"); !ok {
+		t.Fatal("expected the cached key")
+	}
+}
+
+func TestKeyCache_IgnoresChangedJWKSURL(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PublicKey{"k1": &priv.PublicKey}, 0, &hits)
+	defer srv.Close()
+	cacheFile := filepath.Join(t.TempDir(), "jwks.json")
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{KeyCacheFile: cacheFile, Issuers: []IssuerConfig{{Issuer: "https://idp.test", JWKSURL: srv.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := FetchIssuerKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Configure(&Config{KeyCacheFile: cacheFile, Issuers: []IssuerConfig{{Issuer: "https://idp.test", JWKSURL: srv.URL + "/moved"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadKeyCache(); err != nil {
+		t.Fatal(err)
+	}
+	if Ready() {
+		t.Fatal("expected keys cached for another JWKS URL to be ignored")
+	}
+}
@@ -0,0 +1,269 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// jwksClient fetches key sets; the timeout also bounds the unknown-kid refetches made on the
+// request path, so a hanging identity provider cannot hold requests indefinitely
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// KeySet caches the public keys published at one JWKS URL, by kid (Key ID):
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+type KeySet struct {
+	mu   sync.RWMutex
+	url  string
+	keys map[string]crypto.PublicKey
+	// algs holds the alg declared by each key's JWK, when it declares one
+	algs map[string]string
+	// vanished records since when a cached kid is no longer published; it is dropped after the grace period
+	vanished map[string]time.Time
+	// etag validates the cached keys with If-None-Match; refreshAt is when the scheduled refresh is due
+	etag      string
+	refreshAt time.Time
+	// raw is the last fetched JWKS document, persisted to the key cache file; fromCache is set while
+	// the keys come from that file and no fetch has confirmed them yet
+	raw       []byte
+	fromCache bool
+
+	refreshGroup singleflight.Group
+
+	refreshMu   sync.Mutex
+	lastRefresh time.Time // when the last on-demand fetch started
+
+	negativeMu sync.Mutex
+	negative   map[string]time.Time
+}
+
+// NewKeySet returns an empty key set for the given JWKS URL
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		url:      url,
+		keys:     make(map[string]crypto.PublicKey),
+		algs:     make(map[string]string),
+		vanished: make(map[string]time.Time),
+		negative: make(map[string]time.Time),
+	}
+}
+
+// URL returns the JWKS URL the set is fetched from
+func (s *KeySet) URL() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.url
+}
+
+// setURL points the set at a new JWKS URL; cached keys stay until they are replaced
+func (s *KeySet) setURL(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.url = url
+}
+
+// Fetch refetches the JWKS from the set's URL and caches the public keys
+func (s *KeySet) Fetch() error {
+	url := s.URL()
+	if url == "" {
+		s.scheduleRefresh(keyRetryInterval)
+		return errors.New("no JWKS URL known")
+	}
+	return s.fetchFrom(context.Background(), url)
+}
+
+// fetchFrom fetches the JWKS at url, revalidating the cached keys with their ETag. The next scheduled
+// refresh follows the response's Cache-Control max-age, bounded by the configured interval.
+func (s *KeySet) fetchFrom(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	if s.etag != "" && s.url == url {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.RUnlock()
+
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		s.scheduleRefresh(keyRetryInterval)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		s.mu.Lock()
+		s.fromCache = false
+		s.mu.Unlock()
+		s.scheduleRefresh(maxAge(resp.Header.Get("Cache-Control")))
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		s.scheduleRefresh(keyRetryInterval)
+		return fmt.Errorf("JWKS %s answered %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.scheduleRefresh(keyRetryInterval)
+		return err
+	}
+
+	fetched, err := parseJWKS(body)
+	if err != nil {
+		s.scheduleRefresh(keyRetryInterval)
+		return err
+	}
+
+	s.mu.Lock()
+	s.replaceKeys(fetched)
+	s.url = url
+	s.etag = resp.Header.Get("ETag")
+	s.raw = body
+	s.fromCache = false
+	s.mu.Unlock()
+
+	s.scheduleRefresh(maxAge(resp.Header.Get("Cache-Control")))
+	persistKeyCache()
+	return nil
+}
+
+// jwk is a parsed signing key with the algorithm its JWK declares, if any
+type jwk struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// parseJWKS returns the usable signing keys of a JWKS document by kid. Keys published for
+// another use, such as encryption, are left out.
+func parseJWKS(body []byte) (map[string]jwk, error) {
+	var jwks map[string][]map[string]interface{}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jwk, len(jwks["keys"]))
+	for _, key := range jwks["keys"] {
+		kidFromKey, ok := key["kid"].(string)
+		if !ok || !signingKey(key) {
+			continue
+		}
+		pubKey, err := parseJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		if pubKey == nil {
+			continue
+		}
+		alg, _ := key["alg"].(string)
+		keys[kidFromKey] = jwk{key: pubKey, alg: alg}
+	}
+	return keys, nil
+}
+
+// signingKey reports whether a JWK may verify signatures: its use, when declared, is "sig" and its
+// key_ops, when declared, include "verify"
+func signingKey(key map[string]interface{}) bool {
+	if use, ok := key["use"].(string); ok && use != "sig" {
+		return false
+	}
+	ops, ok := key["key_ops"].([]interface{})
+	if !ok {
+		return true
+	}
+	for _, op := range ops {
+		if op == "verify" {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceKeys installs a freshly fetched key set; s.mu must be held
+func (s *KeySet) replaceKeys(fetched map[string]jwk) {
+	now := time.Now()
+	grace := KeyGracePeriod()
+	for kid := range s.keys {
+		if _, ok := fetched[kid]; ok {
+			continue
+		}
+		// keep a key the provider stopped publishing for the grace period, so tokens it signed
+		// shortly before a rotation still verify
+		since, ok := s.vanished[kid]
+		if !ok {
+			since = now
+			s.vanished[kid] = now
+		}
+		if now.Sub(since) >= grace {
+			delete(s.keys, kid)
+			delete(s.algs, kid)
+			delete(s.vanished, kid)
+		}
+	}
+	for kid, k := range fetched {
+		s.keys[kid] = k.key
+		s.setAlg(kid, k.alg)
+		delete(s.vanished, kid)
+		s.forgetMiss(kid)
+	}
+}
+
+// Get returns a cached public key for a given kid and a boolean indicating existence
+func (s *KeySet) Get(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pk, ok := s.keys[kid]
+	if since, gone := s.vanished[kid]; ok && gone && time.Since(since) >= KeyGracePeriod() {
+		return nil, false
+	}
+	return pk, ok
+}
+
+// AcceptsAlg reports whether a token signed with alg may be verified by the key kid: the key must
+// suit the algorithm and, when its JWK declares an alg, that alg must match
+func (s *KeySet) AcceptsAlg(kid, alg string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pk, ok := s.keys[kid]
+	if !ok || !keyFitsAlg(pk, alg) {
+		return false
+	}
+	declared, ok := s.algs[kid]
+	return !ok || declared == alg
+}
+
+// setAlg records the algorithm a key's JWK declares; s.mu must be held
+func (s *KeySet) setAlg(kid, alg string) {
+	if alg == "" {
+		delete(s.algs, kid)
+		return
+	}
+	s.algs[kid] = alg
+}
+
+// Kids returns the key IDs currently held in the set, sorted
+func (s *KeySet) Kids() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
+func (s *KeySet) set(kid string, pk crypto.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = pk
+}
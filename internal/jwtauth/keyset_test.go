@@ -0,0 +1,75 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestParseJWKS_KeyUseAndAlg(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := func(kid string, extra map[string]any) map[string]any {
+		key := map[string]any{"kty": "RSA", "kid": kid, "n": b64url(priv.N.Bytes()), "e": b64url(big.NewInt(int64(priv.E)).Bytes())}
+		for k, v := range extra {
+			key[k] = v
+		}
+		return key
+	}
+	body, _ := json.Marshal(map[string]any{"keys": []map[string]any{
+		rsaKey("plain", nil),
+		rsaKey("sig", map[string]any{"use": "sig", "alg": "PS256"}),
+		rsaKey("enc", map[string]any{"use": "enc", "alg": "RSA-OAEP"}),
+		rsaKey("wrap", map[string]any{"key_ops": []string{"wrapKey"}}),
+	}})
+	keys, err := parseJWKS(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys["enc"]; ok {
+		t.Error("expected the encryption key to be left out")
+	}
+	if _, ok := keys["wrap"]; ok {
+		t.Error("expected the key wrapping key to be left out")
+	}
+
+	ks := NewKeySet("")
+	ks.mu.Lock()
+	ks.replaceKeys(keys)
+	ks.mu.Unlock()
+	cases := []struct {
+		kid, alg string
+		want     bool
+	}{
+		{"plain", "RS256", true},
+		{"plain", "PS512", true},
+		{"plain", "ES256", false},
+		{"sig", "PS256", true},
+		{"sig", "RS256", false},
+		{"enc", "RS256", false},
+	}
+	for _, tc := range cases {
+		if got := ks.AcceptsAlg(tc.kid, tc.alg); got != tc.want {
+			t.Errorf("AcceptsAlg(%s, %s) = %v, want %v", tc.kid, tc.alg, got, tc.want)
+		}
+	}
+}
+
+func TestKeyFitsAlg_ECCurve(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keyFitsAlg(&priv.PublicKey, "ES256") {
+		t.Error("expected a P-256 key to fit ES256")
+	}
+	if keyFitsAlg(&priv.PublicKey, "ES384") {
+		t.Error("expected a P-256 key not to fit ES384")
+	}
+}
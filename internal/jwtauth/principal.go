@@ -0,0 +1,125 @@
+package jwtauth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaimsMapping selects the claims the principal is built from; it lives under authn.claims-mapping.
+// Each field lists claim paths, dotted into nested objects (e.g. realm_access.roles): string fields
+// take the first path present, list fields merge the values of every path.
+type ClaimsMapping struct {
+	// UserID defaults to DefaultClaimsMapping.UserID
+	UserID   []string `yaml:"user-id"`
+	Username []string `yaml:"username"`
+	Email    []string `yaml:"email"`
+	TenantID []string `yaml:"tenant-id"`
+	// Roles replaces authn.role-claims when set
+	Roles  []string `yaml:"roles"`
+	Scopes []string `yaml:"scopes"`
+	// RawClaims are copied into the principal as they are, for policies needing more than the
+	// mapped fields; "*" copies every claim
+	RawClaims []string `yaml:"raw-claims"`
+}
+
+// DefaultClaimsMapping applies to every field claims-mapping leaves unset. Roles default to the
+// role-claims; scp is where Azure AD and Okta put scopes, tid where Azure AD puts the tenant.
+var DefaultClaimsMapping = ClaimsMapping{
+	UserID:   []string{"user_id"},
+	Username: []string{"username"},
+	Email:    []string{"email"},
+	TenantID: []string{"tenant_id", "tid"},
+	Scopes:   []string{"scope", "scp"},
+}
+
+// claimsMapping returns the configured mapping with defaults filled in
+func claimsMapping() ClaimsMapping {
+	m := DefaultClaimsMapping
+	m.Roles = RoleClaims()
+	s := state.Load()
+	if s == nil || s.conf.ClaimsMapping == nil {
+		return m
+	}
+	c := s.conf.ClaimsMapping
+	for _, f := range []struct{ dst, src *[]string }{
+		{&m.UserID, &c.UserID}, {&m.Username, &c.Username}, {&m.Email, &c.Email},
+		{&m.TenantID, &c.TenantID}, {&m.Scopes, &c.Scopes},
+	} {
+		if len(*f.src) > 0 {
+			*f.dst = *f.src
+		}
+	}
+	m.RawClaims = c.RawClaims
+	return m
+}
+
+// PrincipalFromClaims builds the principal of validated token claims following the claims mapping
+func PrincipalFromClaims(claims jwt.MapClaims) Principal {
+	m := claimsMapping()
+	p := Principal{
+		UserID:   firstString(claims, m.UserID),
+		Username: firstString(claims, m.Username),
+		Email:    firstString(claims, m.Email),
+		TenantID: firstString(claims, m.TenantID),
+		Roles:    stringValues(claims, m.Roles),
+		Scopes:   stringValues(claims, m.Scopes),
+	}
+	for _, path := range m.RawClaims {
+		if path == "*" {
+			p.RawClaims = make(map[string]interface{}, len(claims))
+			for k, v := range claims {
+				p.RawClaims[k] = v
+			}
+			break
+		}
+		if v := ClaimAt(claims, path); v != nil {
+			if p.RawClaims == nil {
+				p.RawClaims = make(map[string]interface{})
+			}
+			p.RawClaims[path] = v
+		}
+	}
+	return p
+}
+
+// firstString returns the first non-empty string claim among paths
+func firstString(claims jwt.MapClaims, paths []string) string {
+	for _, path := range paths {
+		if v, ok := ClaimAt(claims, path).(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stringValues collects the distinct string values of the claims at paths. A claim may hold a list
+// of strings or a single space-separated string.
+func stringValues(claims jwt.MapClaims, paths []string) []string {
+	var values []string
+	add := func(v string) {
+		if v != "" && !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	for _, path := range paths {
+		switch v := ClaimAt(claims, path).(type) {
+		case string:
+			for _, s := range strings.Fields(v) {
+				add(s)
+			}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					add(s)
+				}
+			}
+		case []string:
+			for _, s := range v {
+				add(s)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,75 @@
+package jwtauth
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPrincipalFromClaims_Defaults(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	_ = Configure(nil)
+
+	p := PrincipalFromClaims(jwt.MapClaims{
+		"user_id":  "u1",
+		"username": "alice",
+		"email":    "alice@example.com",
+		"tid":      "acme",
+		"scope":    "orders:read orders:write",
+		"scp":      []interface{}{"orders:read", "profile"},
+		"roles":    []interface{}{"ROLE_USER"},
+	})
+	if p.UserID != "u1" || p.Username != "alice" || p.Email != "alice@example.com" || p.TenantID != "acme" {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+	if want := []string{"orders:read", "orders:write", "profile"}; !slices.Equal(p.Scopes, want) {
+		t.Fatalf("expected scopes %v, got %v", want, p.Scopes)
+	}
+	if !slices.Equal(p.Roles, []string{"ROLE_USER"}) || p.RawClaims != nil {
+		t.Fatalf("unexpected roles %v or raw claims %v", p.Roles, p.RawClaims)
+	}
+}
+
+func TestPrincipalFromClaims_Mapping(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	conf := &Config{
+		RoleClaims: []string{"roles"},
+		ClaimsMapping: &ClaimsMapping{
+			UserID:    []string{"sub"},
+			Username:  []string{"preferred_username", "username"},
+			TenantID:  []string{"org.id"},
+			Roles:     []string{"realm_access.roles"},
+			RawClaims: []string{"department", "org.region", "missing"},
+		},
+	}
+	if err := Configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	p := PrincipalFromClaims(jwt.MapClaims{
+		"sub":          "s1",
+		"username":     "fallback",
+		"email":        "alice@example.com",
+		"org":          map[string]interface{}{"id": "acme", "region": "eu"},
+		"roles":        []interface{}{"ignored"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+		"department":   "sales",
+	})
+	if p.UserID != "s1" || p.Username != "fallback" || p.Email != "alice@example.com" || p.TenantID != "acme" {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+	if !slices.Equal(p.Roles, []string{"admin"}) {
+		t.Fatalf("expected the mapped roles to replace role-claims, got %v", p.Roles)
+	}
+	if len(p.RawClaims) != 2 || p.RawClaims["department"] != "sales" || p.RawClaims["org.region"] != "eu" {
+		t.Fatalf("unexpected raw claims %v", p.RawClaims)
+	}
+
+	conf.ClaimsMapping.RawClaims = []string{"*"}
+	if err := Configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	if p := PrincipalFromClaims(jwt.MapClaims{"sub": "s1", "department": "sales"}); len(p.RawClaims) != 2 {
+		t.Fatalf("expected every claim copied, got %v", p.RawClaims)
+	}
+}
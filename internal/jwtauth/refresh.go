@@ -0,0 +1,115 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// NegativeCacheTTL is how long a kid that is still missing after a refetch is remembered,
+// so repeated tokens carrying a bogus kid do not trigger a JWKS fetch each time.
+var NegativeCacheTTL = 30 * time.Second
+
+// MinRefreshInterval rate-limits on-demand JWKS fetches: tokens carrying many distinct unknown kids
+// cannot make the sidecar hit the identity provider more than once per interval.
+var MinRefreshInterval = 10 * time.Second
+
+// maxNegativeEntries bounds the negative cache; expired entries are pruned beyond this size
+const maxNegativeEntries = 1024
+
+// RefreshForKid refetches the JWKS in an attempt to find a kid that is not cached yet.
+// Concurrent misses share a single in-flight fetch, and a kid that is still unknown afterwards
+// is negatively cached for NegativeCacheTTL, during which no further fetch is attempted for it.
+// Fetches are additionally limited to one per MinRefreshInterval across all kids. The shared fetch is
+// detached from any one caller and bounded by the JWKS client's timeout; each caller stops waiting
+// for it when its own ctx ends, without failing the fetch for the others.
+func (s *KeySet) RefreshForKid(ctx context.Context, kid string) (crypto.PublicKey, bool) {
+	if pk, ok := s.Get(kid); ok {
+		return pk, true
+	}
+	if s.isNegativelyCached(kid) {
+		return nil, false
+	}
+
+	url := s.URL()
+	if url == "" {
+		return nil, false
+	}
+
+	// keyed by URL rather than kid: one fetch answers every concurrent miss
+	ch := s.refreshGroup.DoChan(url, func() (interface{}, error) {
+		if !s.allowRefresh() {
+			return false, nil
+		}
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksClient.Timeout)
+		defer cancel()
+		return true, s.fetchFrom(fetchCtx, url)
+	})
+	var res singleflight.Result
+	select {
+	case res = <-ch:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	if pk, ok := s.Get(kid); ok {
+		return pk, true
+	}
+	if fetched, _ := res.Val.(bool); fetched && res.Err == nil {
+		// only a kid the provider really does not publish is remembered as missing, not one a failed
+		// fetch could not look up
+		s.rememberMiss(kid)
+	}
+	return nil, false
+}
+
+// allowRefresh reports whether an on-demand fetch may start now and, if so, records it
+func (s *KeySet) allowRefresh() bool {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	now := time.Now()
+	if !s.lastRefresh.IsZero() && now.Sub(s.lastRefresh) < MinRefreshInterval {
+		return false
+	}
+	s.lastRefresh = now
+	return true
+}
+
+func (s *KeySet) isNegativelyCached(kid string) bool {
+	s.negativeMu.Lock()
+	defer s.negativeMu.Unlock()
+	until, ok := s.negative[kid]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.negative, kid)
+		return false
+	}
+	return true
+}
+
+func (s *KeySet) rememberMiss(kid string) {
+	s.negativeMu.Lock()
+	defer s.negativeMu.Unlock()
+	now := time.Now()
+	if len(s.negative) >= maxNegativeEntries {
+		for k, until := range s.negative {
+			if now.After(until) {
+				delete(s.negative, k)
+			}
+		}
+	}
+	if len(s.negative) < maxNegativeEntries {
+		s.negative[kid] = now.Add(NegativeCacheTTL)
+	}
+}
+
+// forgetMiss clears a negative entry once a kid becomes available
+func (s *KeySet) forgetMiss(kid string) {
+	s.negativeMu.Lock()
+	delete(s.negative, kid)
+	s.negativeMu.Unlock()
+}
@@ -0,0 +1,173 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// jwksServer serves the given keys and counts how many times it was hit
+func jwksServer(t *testing.T, keys map[string]*rsa.PublicKey, delay time.Duration, hits *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		time.Sleep(delay)
+		var list []map[string]interface{}
+		for kid, pk := range keys {
+			list = append(list, map[string]interface{}{
+				"kty": "RSA",
+				"kid": kid,
+				"n":   b64url(pk.N.Bytes()),
+				"e":   b64url(big.NewInt(int64(pk.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": list})
+	}))
+}
+
+// resetRefreshState replaces the default key set so tests start without keys, rate limit or negative cache
+func resetRefreshState(t *testing.T, url string) {
+	t.Helper()
+	defaultKeys = NewKeySet(url)
+}
+
+func TestRefreshForKid_ConcurrentMissesShareOneFetch(t *testing.T) {
+	var hits int32
+	srv := jwksServer(t, nil, 100*time.Millisecond, &hits)
+	defer srv.Close()
+	resetRefreshState(t, srv.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := RefreshForKid(context.Background(), "bogus-kid"); ok {
+				t.Errorf("expected bogus kid to stay unknown")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected exactly one JWKS fetch, got %d", got)
+	}
+
+	// negatively cached: no further fetch within the TTL
+	if _, ok := RefreshForKid(context.Background(), "bogus-kid"); ok {
+		t.Fatalf("expected bogus kid to stay unknown")
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected negative cache to suppress the fetch, got %d hits", got)
+	}
+}
+
+func TestRefreshForKid_FindsRotatedKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int32
+	srv := jwksServer(t, map[string]*rsa.PublicKey{"rotated-kid": &priv.PublicKey}, 0, &hits)
+	defer srv.Close()
+	resetRefreshState(t, srv.URL)
+
+	pk, ok := RefreshForKid(context.Background(), "rotated-kid")
+	if rsaKey, isRSA := pk.(*rsa.PublicKey); !ok || !isRSA || rsaKey.N.Cmp(priv.N) != 0 {
+		t.Fatalf("expected rotated key to be fetched")
+	}
+	// now cached: no second fetch
+	if _, ok := RefreshForKid(context.Background(), "rotated-kid"); !ok || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("expected cached key without refetch, hits=%d", hits)
+	}
+}
+
+func TestRefreshForKid_RateLimitsDistinctKids(t *testing.T) {
+	var hits int32
+	srv := jwksServer(t, nil, 0, &hits)
+	defer srv.Close()
+	resetRefreshState(t, srv.URL)
+
+	for _, kid := range []string{"kid-a", "kid-b", "kid-c"} {
+		if _, ok := RefreshForKid(context.Background(), kid); ok {
+			t.Fatalf("expected %s to stay unknown", kid)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected one JWKS fetch within MinRefreshInterval, got %d", got)
+	}
+	// kid-b was never looked up remotely, so it must not be negatively cached
+	if defaultKeys.isNegativelyCached("kid-b") {
+		t.Fatalf("rate-limited kid should not be negatively cached")
+	}
+}
+
+func TestRefreshForKid_CallerContextDoesNotCancelSharedFetch(t *testing.T) {
+	var hits int32
+	srv := jwksServer(t, nil, 300*time.Millisecond, &hits)
+	defer srv.Close()
+	resetRefreshState(t, srv.URL)
+
+	done := make(chan bool)
+	go func() {
+		_, ok := RefreshForKid(context.Background(), "missing-kid")
+		done <- ok
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, ok := RefreshForKid(ctx, "missing-kid"); ok {
+		t.Fatalf("expected the kid to stay unknown")
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected the caller to stop waiting with its context, took %v", elapsed)
+	}
+
+	if ok := <-done; ok {
+		t.Fatalf("expected the kid to stay unknown")
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected one shared fetch, got %d", n)
+	}
+	// the fetch finished despite the cancelled caller, so the provider really lacks the kid
+	if !defaultKeys.isNegativelyCached("missing-kid") {
+		t.Fatalf("expected the completed fetch to negatively cache the kid")
+	}
+}
+
+func TestRefreshForKid_BoundedByClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	resetRefreshState(t, srv.URL)
+	timeout := jwksClient.Timeout
+	jwksClient.Timeout = 50 * time.Millisecond
+	t.Cleanup(func() { jwksClient.Timeout = timeout })
+
+	start := time.Now()
+	if _, ok := RefreshForKid(context.Background(), "slow-kid"); ok {
+		t.Fatalf("expected the kid to stay unknown")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the refetch to give up with the client timeout, took %v", elapsed)
+	}
+	// the provider never answered, so the kid is not known to be missing
+	if defaultKeys.isNegativelyCached("slow-kid") {
+		t.Fatalf("an abandoned fetch must not negatively cache the kid")
+	}
+}
@@ -0,0 +1,41 @@
+package jwtauth
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRoleClaims are read for roles when authn sets no role-claims; realm_access.roles is where Keycloak puts realm roles
+var DefaultRoleClaims = []string{"roles", "groups", "realm_access.roles"}
+
+// RoleClaims returns the roles of the claims mapping, else the configured role claims, else DefaultRoleClaims
+func RoleClaims() []string {
+	s := state.Load()
+	if s != nil && s.conf.ClaimsMapping != nil && len(s.conf.ClaimsMapping.Roles) > 0 {
+		return s.conf.ClaimsMapping.Roles
+	}
+	if s != nil && len(s.conf.RoleClaims) > 0 {
+		return s.conf.RoleClaims
+	}
+	return DefaultRoleClaims
+}
+
+// Roles collects the distinct string values of the role claims. A claim may hold a list of
+// strings or a single space-separated string.
+func Roles(claims jwt.MapClaims) []string {
+	return stringValues(claims, RoleClaims())
+}
+
+// ClaimAt resolves a dotted path through nested claim objects, returning nil when absent
+func ClaimAt(claims map[string]interface{}, path string) interface{} {
+	var v interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
@@ -0,0 +1,40 @@
+package jwtauth
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoles_DefaultClaims(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	_ = Configure(nil)
+
+	claims := jwt.MapClaims{
+		"roles":        []interface{}{"ROLE_USER", "ROLE_ADMIN"},
+		"groups":       "ops ROLE_USER",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"offline_access", 42}},
+	}
+	want := []string{"ROLE_USER", "ROLE_ADMIN", "ops", "offline_access"}
+	if got := Roles(claims); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRoles_ConfiguredClaims(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{RoleClaims: []string{"resource_access.orders.roles"}}); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{
+		"roles":           []interface{}{"ignored"},
+		"resource_access": map[string]interface{}{"orders": map[string]interface{}{"roles": []interface{}{"orders:write"}}},
+	}
+	if got := Roles(claims); !slices.Equal(got, []string{"orders:write"}) {
+		t.Fatalf("expected only the configured claim, got %v", got)
+	}
+	if got := Roles(jwt.MapClaims{"resource_access": "not-an-object"}); len(got) != 0 {
+		t.Fatalf("expected no roles, got %v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package jwtauth
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key refresh defaults, used when authn.key-refresh leaves them unset
+const (
+	DefaultKeyRefreshJitter = 0.1
+	DefaultKeyGracePeriod   = time.Hour
+)
+
+// keyRetryInterval is how soon a failed scheduled fetch is retried, and minCacheMaxAge the shortest
+// Cache-Control max-age honored, so a provider answering max-age=0 is not polled continuously
+const (
+	keyRetryInterval = time.Minute
+	minCacheMaxAge   = time.Minute
+)
+
+// KeyRefreshConfig tunes how issuer keys are kept current; it lives under authn.key-refresh
+type KeyRefreshConfig struct {
+	// Interval is the longest time between fetches of a key set (default KeyRefreshInterval);
+	// a shorter Cache-Control max-age from the JWKS endpoint refreshes sooner
+	Interval time.Duration `yaml:"interval"`
+	// Jitter spreads refreshes by up to this fraction of the interval either way (default DefaultKeyRefreshJitter)
+	Jitter *float64 `yaml:"jitter"`
+	// GracePeriod is how long a key the provider stopped publishing is still accepted (default DefaultKeyGracePeriod)
+	GracePeriod time.Duration `yaml:"grace-period"`
+}
+
+// KeyRefreshPeriod returns the configured interval between key set fetches, or KeyRefreshInterval
+func KeyRefreshPeriod() time.Duration {
+	if s := state.Load(); s != nil && s.conf.KeyRefresh != nil && s.conf.KeyRefresh.Interval > 0 {
+		return s.conf.KeyRefresh.Interval
+	}
+	return KeyRefreshInterval
+}
+
+// KeyGracePeriod returns how long keys that vanished from their JWKS are still accepted
+func KeyGracePeriod() time.Duration {
+	if s := state.Load(); s != nil && s.conf.KeyRefresh != nil && s.conf.KeyRefresh.GracePeriod > 0 {
+		return s.conf.KeyRefresh.GracePeriod
+	}
+	return DefaultKeyGracePeriod
+}
+
+func keyRefreshJitter() float64 {
+	if s := state.Load(); s != nil && s.conf.KeyRefresh != nil && s.conf.KeyRefresh.Jitter != nil {
+		return *s.conf.KeyRefresh.Jitter
+	}
+	return DefaultKeyRefreshJitter
+}
+
+// jittered spreads d by up to the configured jitter fraction either way, so sidecars started together
+// do not all hit the identity provider at once
+func jittered(d time.Duration) time.Duration {
+	j := keyRefreshJitter()
+	if j <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*j*float64(d))
+}
+
+// maxAge returns the refresh delay a Cache-Control header asks for, bounded to
+// [minCacheMaxAge, KeyRefreshPeriod], or KeyRefreshPeriod when it sets no max-age
+func maxAge(cacheControl string) time.Duration {
+	period := KeyRefreshPeriod()
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		secs, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || secs < 0 {
+			break
+		}
+		return min(max(time.Duration(secs)*time.Second, minCacheMaxAge), period)
+	}
+	return period
+}
+
+// scheduleRefresh sets the next scheduled refresh of the set to d from now, with jitter
+func (s *KeySet) scheduleRefresh(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshAt = time.Now().Add(jittered(d))
+}
+
+// refreshDue returns when the scheduled refresh of the set is due; a set never fetched yet is
+// due a full period after since
+func (s *KeySet) refreshDue(since time.Time) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.refreshAt.IsZero() {
+		return since.Add(KeyRefreshPeriod())
+	}
+	return s.refreshAt
+}
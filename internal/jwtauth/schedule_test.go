@@ -0,0 +1,134 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxAge(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{KeyRefresh: &KeyRefreshConfig{Interval: time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]time.Duration{
+		"":                          time.Hour,
+		"public, max-age=600":       10 * time.Minute,
+		"max-age=0":                 minCacheMaxAge,
+		"max-age=86400, s-maxage=1": time.Hour,
+		"no-cache":                  time.Hour,
+		"max-age=bogus":             time.Hour,
+	}
+	for header, want := range cases {
+		if got := maxAge(header); got != want {
+			t.Errorf("maxAge(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestConfigureKeyRefresh(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	bad := 1.5
+	for name, kr := range map[string]*KeyRefreshConfig{
+		"negative interval": {Interval: -time.Second},
+		"negative grace":    {GracePeriod: -time.Second},
+		"jitter too large":  {Jitter: &bad},
+	} {
+		if err := Configure(&Config{KeyRefresh: kr}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// rotatingJWKS serves the current keys with an ETag and answers 304 to a matching If-None-Match
+type rotatingJWKS struct {
+	mu           sync.Mutex
+	keys         map[string]*rsa.PublicKey
+	version      int
+	full, cached int
+}
+
+func (j *rotatingJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	etag := `"v` + strconv.Itoa(j.version) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "max-age=300")
+	if r.Header.Get("If-None-Match") == etag {
+		j.cached++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	j.full++
+	var list []map[string]any
+	for kid, pk := range j.keys {
+		list = append(list, map[string]any{"kty": "RSA", "kid": kid, "n": b64url(pk.N.Bytes()), "e": b64url(big.NewInt(int64(pk.E)).Bytes())})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": list})
+}
+
+func (j *rotatingJWKS) rotate(keys map[string]*rsa.PublicKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	j.version++
+}
+
+func TestFetch_RevalidatesAndRemovesVanishedKeys(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{KeyRefresh: &KeyRefreshConfig{Interval: time.Hour, GracePeriod: 50 * time.Millisecond}}); err != nil {
+		t.Fatal(err)
+	}
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := &rotatingJWKS{keys: map[string]*rsa.PublicKey{"old": &priv.PublicKey}}
+	srv := httptest.NewServer(jwks)
+	defer srv.Close()
+	ks := NewKeySet(srv.URL)
+
+	if err := ks.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if jwks.full != 1 || jwks.cached != 1 {
+		t.Fatalf("expected the second fetch to be revalidated with the ETag, got %d full and %d cached", jwks.full, jwks.cached)
+	}
+	// max-age=300 schedules the next refresh 5m out, within the default jitter
+	if due := time.Until(ks.refreshDue(time.Now())); due < 4*time.Minute || due > 6*time.Minute {
+		t.Fatalf("expected the refresh due in about 5m, got %v", due)
+	}
+
+	jwks.rotate(map[string]*rsa.PublicKey{"new": &priv.PublicKey})
+	if err := ks.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.Get("old"); !ok {
+		t.Fatal("expected the vanished key to be accepted during the grace period")
+	}
+	if _, ok := ks.Get("new"); !ok {
+		t.Fatal("expected the new key")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := ks.Get("old"); ok {
+		t.Fatal("expected the vanished key to be rejected after the grace period")
+	}
+	jwks.rotate(map[string]*rsa.PublicKey{"new": &priv.PublicKey})
+	if err := ks.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if kids := ks.Kids(); len(kids) != 1 || kids[0] != "new" {
+		t.Fatalf("expected the vanished key to be removed, got %v", kids)
+	}
+}
@@ -0,0 +1,60 @@
+package jwtauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Backoff bounds of LoadKeys between failed attempts
+var (
+	StartupBackoff    = time.Second
+	MaxStartupBackoff = time.Minute
+)
+
+// Ready reports whether tokens can be verified: every configured issuer holds at least one key,
+// or the default key set does when no issuers are configured
+func Ready() bool {
+	issuers := Issuers()
+	if len(issuers) == 0 {
+		return len(defaultKeys.Kids()) > 0
+	}
+	for _, is := range issuers {
+		if len(is.Keys.Kids()) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadKeys resolves the discovered issuers and fetches every issuer's keys, retrying with
+// exponential backoff from StartupBackoff to MaxStartupBackoff until Ready or ctx is done. Failures
+// are logged rather than fatal, so the sidecar can start before its identity providers. Keys in the
+// authn.key-cache-file are loaded first, so known tokens verify while the providers are unreachable.
+func LoadKeys(ctx context.Context) {
+	if err := LoadKeyCache(); err != nil {
+		slog.Warn("error reading key cache", slog.Any("error", err))
+	}
+	backoff := StartupBackoff
+	for {
+		err := errors.Join(Discover(), FetchIssuerKeys())
+		// keys from the key cache make the sidecar ready, but fetching goes on until they are confirmed
+		if Ready() && (err == nil || !keysFromCache()) {
+			if err != nil {
+				slog.Warn("issuer keys loaded with errors", slog.Any("error", err))
+			}
+			return
+		}
+		if err == nil {
+			err = errors.New("no usable keys published")
+		}
+		slog.Warn("issuer keys not loaded; retrying", slog.Any("error", err), slog.Duration("retry_in", backoff))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, MaxStartupBackoff)
+	}
+}
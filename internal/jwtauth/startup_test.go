@@ -0,0 +1,71 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadKeys_RetriesUntilReady(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The IdP is still booting for the first two attempts
+		if atomic.AddInt32(&hits, 1) <= 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA", "kid": "k1", "n": b64url(priv.N.Bytes()), "e": b64url(big.NewInt(int64(priv.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: "https://idp.test", JWKSURL: srv.URL}}}); err != nil {
+		t.Fatal(err)
+	}
+	prevBackoff := StartupBackoff
+	StartupBackoff = time.Millisecond
+	t.Cleanup(func() { StartupBackoff = prevBackoff })
+
+	if Ready() {
+		t.Fatal("expected not ready before the keys are loaded")
+	}
+	done := make(chan struct{})
+	go func() {
+		LoadKeys(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected LoadKeys to return once the keys load")
+	}
+	if !Ready() || atomic.LoadInt32(&hits) != 3 {
+		t.Fatalf("expected ready after the third attempt, got ready=%v after %d attempts", Ready(), hits)
+	}
+}
+
+func TestLoadKeys_StopsWithContext(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: "https://idp.test", JWKSURL: "http://127.0.0.1:1/keys"}}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	LoadKeys(ctx)
+	if Ready() {
+		t.Fatal("expected not ready with an unreachable key set")
+	}
+}
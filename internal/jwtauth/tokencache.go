@@ -0,0 +1,118 @@
+package jwtauth
+
+import (
+	"container/list"
+	"crypto"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultTokenCacheSize applies when authn token-cache-size is not set; a negative size disables the cache
+const DefaultTokenCacheSize = 10000
+
+// tokenCacheMaxTTL caps how long a validated token is reused, including tokens without exp
+const tokenCacheMaxTTL = 5 * time.Minute
+
+type tokenKey [sha256.Size]byte
+
+type tokenEntry struct {
+	key       tokenKey
+	principal Principal
+	claims    jwt.MapClaims
+	expires   time.Time
+	// keys, kid and pub pin the verifying key: the entry is dropped once the set no longer holds it
+	keys *KeySet
+	kid  string
+	pub  crypto.PublicKey
+}
+
+// tokenLRU is a bounded least-recently-used cache of validated tokens
+type tokenLRU struct {
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[tokenKey]*list.Element
+}
+
+var tokenCache = &tokenLRU{order: list.New(), entries: make(map[tokenKey]*list.Element)}
+
+func tokenCacheSize() int {
+	if s := state.Load(); s != nil && s.conf.TokenCacheSize != 0 {
+		return s.conf.TokenCacheSize
+	}
+	return DefaultTokenCacheSize
+}
+
+// LookupToken returns the principal and claims of a token validated earlier, as long as it has not
+// expired and the key that verified it is still published under the same kid.
+func LookupToken(token string) (Principal, jwt.MapClaims, bool) {
+	if tokenCacheSize() < 0 {
+		return Principal{}, nil, false
+	}
+	key := sha256.Sum256([]byte(token))
+
+	tokenCache.mu.Lock()
+	defer tokenCache.mu.Unlock()
+	el, ok := tokenCache.entries[key]
+	if !ok {
+		return Principal{}, nil, false
+	}
+	e := el.Value.(*tokenEntry)
+	if time.Now().After(e.expires) || !e.keyStillValid() {
+		tokenCache.remove(el)
+		return Principal{}, nil, false
+	}
+	tokenCache.order.MoveToFront(el)
+	return e.principal, e.claims, true
+}
+
+// StoreToken remembers a validated token until its exp claim (capped at tokenCacheMaxTTL).
+// keys, kid and pub identify the key that verified the signature.
+func StoreToken(token string, p Principal, claims jwt.MapClaims, keys *KeySet, kid string, pub crypto.PublicKey) {
+	size := tokenCacheSize()
+	if size < 0 {
+		return
+	}
+	expires := time.Now().Add(tokenCacheMaxTTL)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+	key := sha256.Sum256([]byte(token))
+	e := &tokenEntry{key: key, principal: p, claims: claims, expires: expires, keys: keys, kid: kid, pub: pub}
+
+	tokenCache.mu.Lock()
+	defer tokenCache.mu.Unlock()
+	if el, ok := tokenCache.entries[key]; ok {
+		el.Value = e
+		tokenCache.order.MoveToFront(el)
+		return
+	}
+	tokenCache.entries[key] = tokenCache.order.PushFront(e)
+	for tokenCache.order.Len() > size {
+		tokenCache.remove(tokenCache.order.Back())
+	}
+}
+
+// purgeTokenCache drops every cached token, e.g. when validation rules change
+func purgeTokenCache() {
+	tokenCache.mu.Lock()
+	defer tokenCache.mu.Unlock()
+	tokenCache.order.Init()
+	tokenCache.entries = make(map[tokenKey]*list.Element)
+}
+
+func (c *tokenLRU) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*tokenEntry).key)
+}
+
+func (e *tokenEntry) keyStillValid() bool {
+	current, ok := e.keys.Get(e.kid)
+	if !ok {
+		return false
+	}
+	eq, ok := current.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && eq.Equal(e.pub)
+}
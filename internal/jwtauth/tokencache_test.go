@@ -0,0 +1,68 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenCache(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{TokenCacheSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	old, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet("")
+	keys.set("kid", &old.PublicKey)
+	claims := jwt.MapClaims{"exp": float64(time.Now().Add(time.Hour).Unix())}
+
+	StoreToken("t1", Principal{UserID: "u1"}, claims, keys, "kid", &old.PublicKey)
+	if p, _, ok := LookupToken("t1"); !ok || p.UserID != "u1" {
+		t.Fatalf("expected cached principal, got %+v %v", p, ok)
+	}
+
+	// bounded: t2 is least recently used once t1 was looked up, so t3 evicts it
+	StoreToken("t2", Principal{UserID: "u2"}, claims, keys, "kid", &old.PublicKey)
+	LookupToken("t1")
+	StoreToken("t3", Principal{UserID: "u3"}, claims, keys, "kid", &old.PublicKey)
+	if _, _, ok := LookupToken("t2"); ok {
+		t.Fatalf("expected least recently used entry to be evicted")
+	}
+	if _, _, ok := LookupToken("t1"); !ok {
+		t.Fatalf("expected recently used entry to survive")
+	}
+
+	StoreToken("expired", Principal{}, jwt.MapClaims{"exp": float64(time.Now().Add(-time.Second).Unix())}, keys, "kid", &old.PublicKey)
+	if _, _, ok := LookupToken("expired"); ok {
+		t.Fatalf("expired token must not be served from cache")
+	}
+
+	// the provider publishes a different key under the same kid
+	rotated, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.set("kid", &rotated.PublicKey)
+	if _, _, ok := LookupToken("t1"); ok {
+		t.Fatalf("entry verified with a rotated-out key must be invalidated")
+	}
+}
+
+func TestTokenCacheDisabled(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{TokenCacheSize: -1}); err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet("")
+	keys.set("kid", "key")
+	StoreToken("t", Principal{UserID: "u"}, jwt.MapClaims{}, keys, "kid", "key")
+	if _, _, ok := LookupToken("t"); ok {
+		t.Fatalf("expected no caching with a negative size")
+	}
+}
@@ -0,0 +1,176 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/tracing"
+)
+
+// UserInfoConfig enriches the principal with the claims of the OIDC userinfo endpoint, for
+// providers issuing access tokens without the attributes policies need
+type UserInfoConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the userinfo URL; when empty the userinfo_endpoint discovered for the token's issuer is used
+	Endpoint string `yaml:"endpoint"`
+	// CacheTTL bounds how long a response is reused; it never outlives the token's exp (default 5m)
+	CacheTTL time.Duration `yaml:"cache-ttl"`
+	// Required rejects the request when userinfo cannot be fetched; otherwise the principal is built
+	// from the token alone
+	Required bool `yaml:"required"`
+}
+
+const (
+	defaultUserInfoCacheTTL = 5 * time.Minute
+	maxUserInfoEntries      = 10000
+)
+
+// ErrUserInfoSubject is returned when the userinfo response is about another subject than the token
+var ErrUserInfoSubject = errors.New("userinfo subject does not match the token")
+
+var userInfoClient = &http.Client{Timeout: 5 * time.Second}
+
+type userInfoEntry struct {
+	claims  jwt.MapClaims
+	expires time.Time
+}
+
+var userInfoMu sync.Mutex
+var userInfoCache = make(map[[sha256.Size]byte]userInfoEntry)
+
+// UserInfo returns the userinfo config when enrichment is enabled, else nil
+func UserInfo() *UserInfoConfig {
+	if s := state.Load(); s != nil && s.conf.UserInfo != nil && s.conf.UserInfo.Enabled {
+		return s.conf.UserInfo
+	}
+	return nil
+}
+
+// Enrich merges the userinfo claims of token into its validated claims and rebuilds the principal p
+// from them. Token claims win over userinfo claims of the same name, so a provider cannot override
+// what it signed; a user ID the claims do not map is kept from p (such as the sub of an introspected
+// token). Responses are cached per token.
+func Enrich(ctx context.Context, token string, claims jwt.MapClaims, p Principal) (Principal, error) {
+	conf := UserInfo()
+	if conf == nil {
+		return Principal{}, errors.New("userinfo is not enabled")
+	}
+	info, err := userInfo(ctx, *conf, token, claims)
+	if err != nil {
+		return Principal{}, err
+	}
+	// OpenID Connect Core 1.0 §5.3.4: the sub of the response must match the token's
+	if sub, _ := claims["sub"].(string); sub != "" && info["sub"] != sub {
+		return Principal{}, ErrUserInfoSubject
+	}
+	merged := make(jwt.MapClaims, len(info)+len(claims))
+	for k, v := range info {
+		merged[k] = v
+	}
+	for k, v := range claims {
+		merged[k] = v
+	}
+	enriched := PrincipalFromClaims(merged)
+	if enriched.UserID == "" {
+		enriched.UserID = p.UserID
+	}
+	return enriched, nil
+}
+
+// userInfo returns the cached userinfo claims of token, fetching them on a miss
+func userInfo(ctx context.Context, conf UserInfoConfig, token string, claims jwt.MapClaims) (jwt.MapClaims, error) {
+	key := sha256.Sum256([]byte(token))
+	if e, ok := cachedUserInfo(key); ok {
+		return e.claims, nil
+	}
+
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		iss, _ := claims["iss"].(string)
+		if is, ok := ResolveIssuer(iss); ok {
+			if md := is.Metadata(); md != nil {
+				endpoint = md.UserInfoEndpoint
+			}
+		}
+	}
+	if endpoint == "" {
+		return nil, errors.New("no userinfo endpoint configured or discovered")
+	}
+	info, err := fetchUserInfo(ctx, endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := conf.CacheTTL
+	if ttl <= 0 {
+		ttl = defaultUserInfoCacheTTL
+	}
+	expires := time.Now().Add(ttl)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+		expires = exp.Time
+	}
+	storeUserInfo(key, userInfoEntry{claims: info, expires: expires})
+	return info, nil
+}
+
+func fetchUserInfo(ctx context.Context, endpoint, token string) (jwt.MapClaims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	tracing.InjectHTTP(ctx, req.Header)
+
+	resp, err := userInfoClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned %s", resp.Status)
+	}
+	var info jwt.MapClaims
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decoding userinfo response: %w", err)
+	}
+	return info, nil
+}
+
+func cachedUserInfo(key [sha256.Size]byte) (userInfoEntry, bool) {
+	userInfoMu.Lock()
+	defer userInfoMu.Unlock()
+	e, ok := userInfoCache[key]
+	if !ok {
+		return userInfoEntry{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(userInfoCache, key)
+		return userInfoEntry{}, false
+	}
+	return e, true
+}
+
+func storeUserInfo(key [sha256.Size]byte, e userInfoEntry) {
+	userInfoMu.Lock()
+	defer userInfoMu.Unlock()
+	if len(userInfoCache) >= maxUserInfoEntries {
+		now := time.Now()
+		for k, old := range userInfoCache {
+			if now.After(old.expires) {
+				delete(userInfoCache, k)
+			}
+		}
+	}
+	if len(userInfoCache) < maxUserInfoEntries {
+		userInfoCache[key] = e
+	}
+}
@@ -0,0 +1,81 @@
+package jwtauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEnrichMergesAndCachesUserInfo(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if got := r.Header.Get("Authorization"); got != "Bearer thin-token" && got != "Bearer other-token" {
+			t.Errorf("expected the access token as bearer, got %q", got)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"sub": "u-42", "email": "bob@example.com", "username": "spoofed", "groups": []string{"ops"},
+		})
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{UserInfo: &UserInfoConfig{Enabled: true, Endpoint: srv.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "u-42", "username": "bob", "exp": float64(time.Now().Add(time.Hour).Unix())}
+	for i := 0; i < 3; i++ {
+		p, err := Enrich(context.Background(), "thin-token", claims, Principal{UserID: "u-42"})
+		if err != nil {
+			t.Fatalf("Enrich: %v", err)
+		}
+		if p.UserID != "u-42" || p.Username != "bob" || p.Email != "bob@example.com" || len(p.Roles) != 1 || p.Roles[0] != "ops" {
+			t.Fatalf("unexpected principal %+v", p)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected the response to be cached, got %d calls", got)
+	}
+
+	if _, err := Enrich(context.Background(), "other-token", jwt.MapClaims{"sub": "u-7"}, Principal{}); !errors.Is(err, ErrUserInfoSubject) {
+		t.Fatalf("expected ErrUserInfoSubject, got %v", err)
+	}
+}
+
+func TestEnrichUsesDiscoveredEndpoint(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/jwks", "userinfo_endpoint": srv.URL + "/userinfo"})
+		case "/userinfo":
+			_ = json.NewEncoder(w).Encode(map[string]any{"sub": "u-1", "tenant_id": "acme"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Issuers: []IssuerConfig{{Issuer: srv.URL}}, UserInfo: &UserInfoConfig{Enabled: true}}); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{"iss": srv.URL, "sub": "u-1"}
+	if _, err := Enrich(context.Background(), "token-before-discovery", claims, Principal{}); err == nil {
+		t.Fatal("expected an error before discovery")
+	}
+	if err := Discover(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Enrich(context.Background(), "discovered-token", claims, Principal{})
+	if err != nil || p.TenantID != "acme" {
+		t.Fatalf("expected the discovered endpoint's tenant, got %+v %v", p, err)
+	}
+}
@@ -0,0 +1,61 @@
+package jwtauth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ParserOptions returns the claim validation applied to tokens of this issuer:
+// the algorithm allowlist, clock skew on exp/nbf, and iss, aud and required exp when configured.
+func (is *Issuer) ParserOptions() []jwt.ParserOption {
+	var skew time.Duration
+	requireExp := is.RequireExp
+	if s := state.Load(); s != nil {
+		skew = s.conf.ClockSkew
+		requireExp = requireExp || s.conf.RequireExp
+	}
+	if is.ClockSkew > 0 {
+		skew = is.ClockSkew
+	}
+
+	algs := AllowedAlgorithms()
+	if len(is.Algorithms) > 0 {
+		algs = is.Algorithms
+	}
+	opts := []jwt.ParserOption{jwt.WithValidMethods(algs), jwt.WithLeeway(skew)}
+	if is.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(is.Issuer))
+	}
+	if len(is.Audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(is.Audiences...))
+	}
+	if requireExp {
+		opts = append(opts, jwt.WithExpirationRequired())
+	}
+	return opts
+}
+
+// ErrorReason maps a token parsing error to a client-facing reason
+func ErrorReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "Malformed token"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "Invalid token signature"
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		return "Invalid signing method"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "Token expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "Token not valid yet"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "Invalid token issuer"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "Invalid token audience"
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return "Token missing required claim"
+	}
+	return "Invalid token"
+}
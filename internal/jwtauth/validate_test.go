@@ -0,0 +1,69 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParserOptionsAndErrorReason(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{
+		ClockSkew: 30 * time.Second,
+		Issuers: []IssuerConfig{
+			{Issuer: "https://idp.example", JWKSURL: "http://idp/keys", Audiences: []string{"orders"}, RequireExp: true},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	issuer, _ := ResolveIssuer("https://idp.example")
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"iss": "https://idp.example", "aud": "orders", "exp": now.Add(time.Hour).Unix()}
+	}
+	with := func(k string, v any) jwt.MapClaims {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	cases := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   string
+	}{
+		{"valid", valid(), ""},
+		{"expired within skew", with("exp", now.Add(-10*time.Second).Unix()), ""},
+		{"expired", with("exp", now.Add(-time.Minute).Unix()), "Token expired"},
+		{"not yet valid", with("nbf", now.Add(time.Minute).Unix()), "Token not valid yet"},
+		{"wrong issuer", with("iss", "https://other.example"), "Invalid token issuer"},
+		{"wrong audience", with("aud", "billing"), "Invalid token audience"},
+		{"missing exp", with("exp", nil), "Token missing required claim"},
+	}
+	for _, tc := range cases {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, tc.claims).SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return &priv.PublicKey, nil }, issuer.ParserOptions()...)
+		got := ""
+		if err != nil {
+			got = ErrorReason(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: reason = %q, want %q (err %v)", tc.name, got, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package loadshed
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// globalKey labels refusals by the global max-in-flight
+const globalKey = "*"
+
+// inFlight counts the requests being handled, globally and per route key. Requests are counted
+// whether or not a limit is configured, so a limit added by a config reload starts from the true count.
+var (
+	inFlight      atomic.Int64
+	routeInFlight sync.Map
+)
+
+// ConcurrencyLimit refuses requests with 503 while the ingress, or the matched route, already
+// handles its max-in-flight requests, protecting the validation services and the upstream from
+// overload. A request counts until its response headers are ready.
+func ConcurrencyLimit(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return c.Next()
+	}
+	defer inFlight.Add(-1)
+	if n := inFlight.Add(1); conf.MaxInFlight > 0 && n > int64(conf.MaxInFlight) {
+		return overloaded(c, globalKey)
+	}
+	route, ok := conf.MatchRoute(c.Hostname(), c.Path())
+	if !ok {
+		return c.Next()
+	}
+	count := routeCounter(route.Key())
+	defer count.Add(-1)
+	if n := count.Add(1); route.MaxInFlight > 0 && n > int64(route.MaxInFlight) {
+		return overloaded(c, route.Key())
+	}
+	return c.Next()
+}
+
+func overloaded(c fiber.Ctx, key string) error {
+	metrics.IngressConcurrencyLimited.WithLabelValues(key).Inc()
+	c.Set(fiber.HeaderRetryAfter, "1")
+	return fiber.NewError(fiber.StatusServiceUnavailable, "too many requests in flight; request shed")
+}
+
+func routeCounter(key string) *atomic.Int64 {
+	if n, ok := routeInFlight.Load(key); ok {
+		return n.(*atomic.Int64)
+	}
+	n, _ := routeInFlight.LoadOrStore(key, new(atomic.Int64))
+	return n.(*atomic.Int64)
+}
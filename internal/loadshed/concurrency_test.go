@@ -0,0 +1,71 @@
+package loadshed
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		MaxInFlight: 2,
+		Routes:      []ingressconfig.Route{{PathPrefix: "/orders", MaxInFlight: 1}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	app := fiber.New()
+	app.Use(ConcurrencyLimit)
+	app.All("/*", func(c fiber.Ctx) error {
+		if c.Query("block") != "" {
+			entered <- struct{}{}
+			<-release
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	status := func(target string) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", target, nil), fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == fiber.StatusServiceUnavailable && resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("expected Retry-After on a shed request")
+		}
+		return resp.StatusCode
+	}
+	done := make(chan int, 2)
+	block := func(target string) {
+		go func() { done <- status(target) }()
+		<-entered
+	}
+
+	// the route allows one request at a time
+	block("/orders/1?block=1")
+	if got := status("/orders/2"); got != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected 503 over the route limit, got %d", got)
+	}
+	if got := status("/other"); got != fiber.StatusOK {
+		t.Fatalf("expected other routes to be unaffected, got %d", got)
+	}
+
+	// the global limit covers every route
+	block("/other?block=1")
+	if got := status("/other"); got != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected 503 over the global limit, got %d", got)
+	}
+
+	close(release)
+	for range 2 {
+		if got := <-done; got != fiber.StatusOK {
+			t.Fatalf("expected the blocked requests to complete, got %d", got)
+		}
+	}
+	if got := status("/orders/2"); got != fiber.StatusOK {
+		t.Fatalf("expected requests to be admitted once the others finish, got %d", got)
+	}
+}
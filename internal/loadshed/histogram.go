@@ -0,0 +1,103 @@
+package loadshed
+
+import (
+	"sync"
+	"time"
+)
+
+// slotsPerWindow is how many sub-windows the rolling window is divided into
+const slotsPerWindow = 10
+
+// bucketBounds are the histogram upper bounds, growing by 25% from 1ms to roughly a minute
+var bucketBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := float64(time.Millisecond); b < float64(time.Minute); b *= 1.25 {
+		bounds = append(bounds, time.Duration(b))
+	}
+	return bounds
+}()
+
+type slot struct {
+	start  time.Time
+	counts []uint64
+	total  uint64
+}
+
+// Histogram is a rolling latency histogram over a fixed time window
+type Histogram struct {
+	mu       sync.Mutex
+	slotSize time.Duration
+	slots    [slotsPerWindow]slot
+	now      func() time.Time
+}
+
+// NewHistogram creates a rolling histogram covering the given window
+func NewHistogram(window time.Duration) *Histogram {
+	h := &Histogram{slotSize: window / slotsPerWindow, now: time.Now}
+	for i := range h.slots {
+		h.slots[i].counts = make([]uint64, len(bucketBounds)+1)
+	}
+	return h
+}
+
+// Observe records a single latency sample
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	s := &h.slots[(now.UnixNano()/int64(h.slotSize))%slotsPerWindow]
+	if now.Sub(s.start) >= h.slotSize {
+		// slot belongs to an earlier lap of the ring: reset it
+		for i := range s.counts {
+			s.counts[i] = 0
+		}
+		s.total = 0
+		s.start = now.Truncate(h.slotSize)
+	}
+	s.counts[bucketIndex(d)]++
+	s.total++
+}
+
+// Quantile returns the latency at quantile q over the window and the number of samples it is based on
+func (h *Histogram) Quantile(q float64) (time.Duration, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	window := h.slotSize * slotsPerWindow
+	merged := make([]uint64, len(bucketBounds)+1)
+	var total uint64
+	for i := range h.slots {
+		s := &h.slots[i]
+		if s.total == 0 || now.Sub(s.start) >= window {
+			continue
+		}
+		for j, c := range s.counts {
+			merged[j] += c
+		}
+		total += s.total
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	rank := uint64(q * float64(total))
+	var seen uint64
+	for i, c := range merged {
+		seen += c
+		if seen > rank {
+			if i < len(bucketBounds) {
+				return bucketBounds[i], total
+			}
+			break
+		}
+	}
+	return time.Minute, total
+}
+
+func bucketIndex(d time.Duration) int {
+	for i, b := range bucketBounds {
+		if d <= b {
+			return i
+		}
+	}
+	return len(bucketBounds)
+}
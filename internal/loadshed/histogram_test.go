@@ -0,0 +1,42 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	h := NewHistogram(10 * time.Second)
+	for i := 0; i < 99; i++ {
+		h.Observe(2 * time.Millisecond)
+	}
+	h.Observe(900 * time.Millisecond)
+	h.Observe(900 * time.Millisecond)
+
+	p50, n := h.Quantile(0.5)
+	if n != 101 {
+		t.Fatalf("expected 101 samples, got %d", n)
+	}
+	if p50 < 2*time.Millisecond || p50 > 3*time.Millisecond {
+		t.Fatalf("unexpected p50 %v", p50)
+	}
+	if p99, _ := h.Quantile(0.99); p99 < 900*time.Millisecond {
+		t.Fatalf("expected p99 to reflect the slow tail, got %v", p99)
+	}
+}
+
+func TestHistogramForgetsOldSamples(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	h := NewHistogram(10 * time.Second)
+	h.now = func() time.Time { return now }
+	h.Observe(time.Second)
+
+	now = now.Add(11 * time.Second)
+	if _, n := h.Quantile(0.99); n != 0 {
+		t.Fatalf("expected samples outside the window to be dropped, got %d", n)
+	}
+	h.Observe(time.Millisecond)
+	if p99, n := h.Quantile(0.99); n != 1 || p99 > time.Millisecond {
+		t.Fatalf("expected only the fresh sample, got p99=%v n=%d", p99, n)
+	}
+}
@@ -0,0 +1,72 @@
+package loadshed
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// minSamples is the number of observations needed before a p99 is trusted for shedding
+const minSamples = 20
+
+// histograms keeps one rolling histogram per route key, surviving config reloads
+var histograms sync.Map
+
+// shedRoll is an indirection over the random source to allow deterministic tests
+var shedRoll = rand.Float64
+
+// Middleware sheds a fraction of low-priority traffic with 503 while a route's rolling p99
+// latency (authorization plus upstream proxy) is above its configured latency budget.
+func Middleware(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return c.Next()
+	}
+	route, ok := conf.MatchRoute(c.Hostname(), c.Path())
+	if !ok || route.LatencyBudget == nil {
+		return c.Next()
+	}
+	budget := route.LatencyBudget
+	hist := histogramFor(route.Key(), budget.WindowOrDefault())
+
+	if p99, samples := hist.Quantile(0.99); samples >= minSamples && p99 > budget.P99 {
+		if requestPriority(c, conf) <= budget.ShedMaxPriority && shedRoll() < budget.ShedFraction {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return fiber.NewError(fiber.StatusServiceUnavailable, "route over latency budget; request shed")
+		}
+	}
+
+	start := time.Now()
+	err := c.Next()
+	hist.Observe(time.Since(start))
+	return err
+}
+
+func histogramFor(key string, window time.Duration) *Histogram {
+	if h, ok := histograms.Load(key); ok {
+		return h.(*Histogram)
+	}
+	h, _ := histograms.LoadOrStore(key, NewHistogram(window))
+	return h.(*Histogram)
+}
+
+// requestPriority parses the priority header set by a trusted proxy (client-ip.trusted-proxies), since
+// any other caller could claim a priority that is never shed; missing, malformed or untrusted values
+// count as 0
+func requestPriority(c fiber.Ctx, conf *ingressconfig.IngressConfig) int {
+	peer, err := netip.ParseAddr(c.IP())
+	if err != nil || conf.ClientIP == nil || !conf.ClientIP.TrustedProxies.Contains(peer.Unmap()) {
+		return 0
+	}
+	p, err := strconv.Atoi(c.Get(conf.PriorityHeaderName()))
+	if err != nil {
+		return 0
+	}
+	return p
+}
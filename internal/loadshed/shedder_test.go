@@ -0,0 +1,121 @@
+package loadshed
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestMiddlewareShedsLowPriorityWhenOverBudget(t *testing.T) {
+	// app.Test connects from 0.0.0.0, which stands in for the trusted load balancer
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		ClientIP: &ingressconfig.ClientIPConfig{TrustedProxies: ingressconfig.CIDRs{netip.MustParsePrefix("0.0.0.0/32")}},
+		Routes: []ingressconfig.Route{{
+			PathPrefix:    "/slow",
+			LatencyBudget: &ingressconfig.LatencyBudget{P99: 10 * time.Millisecond, ShedFraction: 1},
+		}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	histograms = sync.Map{}
+
+	// push the route over budget
+	hist := histogramFor("/slow", ingressconfig.DefaultLatencyWindow)
+	for i := 0; i < minSamples; i++ {
+		hist.Observe(50 * time.Millisecond)
+	}
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/slow/x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+
+	// higher-priority traffic is never shed
+	req := httptest.NewRequest("GET", "/slow/x", nil)
+	req.Header.Set(ingressconfig.DefaultPriorityHeader, "5")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected 200 for high-priority request, got %d", resp.StatusCode)
+	}
+
+	// routes without a budget are untouched
+	resp, err = app.Test(httptest.NewRequest("GET", "/other", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected 200 for unbudgeted route, got %d", resp.StatusCode)
+	}
+}
+
+func TestMiddlewareIgnoresPriorityFromUntrustedPeer(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		ClientIP: &ingressconfig.ClientIPConfig{TrustedProxies: ingressconfig.CIDRs{netip.MustParsePrefix("10.0.0.0/8")}},
+		Routes: []ingressconfig.Route{{
+			PathPrefix:    "/slow",
+			LatencyBudget: &ingressconfig.LatencyBudget{P99: 10 * time.Millisecond, ShedFraction: 1},
+		}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	histograms = sync.Map{}
+
+	hist := histogramFor("/slow", ingressconfig.DefaultLatencyWindow)
+	for i := 0; i < minSamples; i++ {
+		hist.Observe(50 * time.Millisecond)
+	}
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/slow/x", nil)
+	req.Header.Set(ingressconfig.DefaultPriorityHeader, "5")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected a priority claimed by the client itself to be shed, got %d", resp.StatusCode)
+	}
+}
+
+func TestMiddlewarePassesWithinBudget(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{Routes: []ingressconfig.Route{{
+		PathPrefix:    "/fast",
+		LatencyBudget: &ingressconfig.LatencyBudget{P99: time.Second, ShedFraction: 1},
+	}}})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	histograms = sync.Map{}
+
+	app := fiber.New()
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	for i := 0; i < minSamples+5; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/fast", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// Options configures the process-wide structured logger
+type Options struct {
+	Level slog.Level
+	// Format is "json" (default) or "text"
+	Format string
+	// Redact lists principal fields (user_id, username, email) that are hashed before logging
+	Redact map[string]bool
+}
+
+// defaultRedact keeps PII out of logs unless explicitly allowed
+var defaultRedact = map[string]bool{"username": true, "email": true}
+
+// redactFields is read on every request log line and swapped by Init
+var redactFields atomic.Pointer[map[string]bool]
+
+func init() {
+	redactFields.Store(&defaultRedact)
+}
+
+// OptionsFromEnv reads LOG_LEVEL (debug, info, warn, error), LOG_FORMAT (json, text) and
+// LOG_REDACT (comma-separated principal fields, or "none"; default "username,email").
+func OptionsFromEnv() Options {
+	opts := Options{Format: os.Getenv("LOG_FORMAT"), Redact: defaultRedact}
+	if err := opts.Level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		opts.Level = slog.LevelInfo
+	}
+	if spec, ok := os.LookupEnv("LOG_REDACT"); ok {
+		opts.Redact = ParseRedact(spec)
+	}
+	return opts
+}
+
+// ParseRedact parses a comma-separated field list; "none" or an empty list disables redaction
+func ParseRedact(spec string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" && f != "none" {
+			fields[f] = true
+		}
+	}
+	return fields
+}
+
+// Init installs the structured logger as the slog default (which also backs the standard log package)
+func Init(opts Options) {
+	slog.SetDefault(slog.New(newHandler(os.Stdout, opts)))
+	redact := opts.Redact
+	redactFields.Store(&redact)
+}
+
+func newHandler(w io.Writer, opts Options) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	if opts.Format == "text" {
+		return slog.NewTextHandler(w, handlerOpts)
+	}
+	return slog.NewJSONHandler(w, handlerOpts)
+}
+
+// Principal renders a principal as a log group, hashing the fields selected for redaction
+func Principal(p jwtauth.Principal) slog.Attr {
+	redact := *redactFields.Load()
+	field := func(name, value string) slog.Attr {
+		if value != "" && redact[name] {
+			sum := sha256.Sum256([]byte(value))
+			value = "sha256:" + hex.EncodeToString(sum[:6])
+		}
+		return slog.String(name, value)
+	}
+	return slog.Group("principal",
+		field("user_id", p.UserID),
+		field("username", p.Username),
+		field("email", p.Email),
+	)
+}
+
+// requestIDKey is the fiber Locals key holding the request ID
+const requestIDKey = "RequestID"
+
+// RequestID reuses an incoming X-Request-Id or generates one, echoes it on the response and
+// keeps it on the request so it is forwarded to upstreams
+func RequestID(c fiber.Ctx) error {
+	rid := c.Get(fiber.HeaderXRequestID)
+	if rid == "" {
+		rid = uuid.NewString()
+		c.Request().Header.Set(fiber.HeaderXRequestID, rid)
+	}
+	c.Set(fiber.HeaderXRequestID, rid)
+	c.Locals(requestIDKey, rid)
+	return c.Next()
+}
+
+// RequestIDFrom returns the request ID assigned by RequestID, or the raw header when the middleware did not run
+func RequestIDFrom(c fiber.Ctx) string {
+	if rid, ok := c.Locals(requestIDKey).(string); ok {
+		return rid
+	}
+	return c.Get(fiber.HeaderXRequestID)
+}
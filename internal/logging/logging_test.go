@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestPrincipalRedaction(t *testing.T) {
+	old := redactFields.Load()
+	t.Cleanup(func() { redactFields.Store(old) })
+
+	var buf bytes.Buffer
+	logger := slog.New(newHandler(&buf, Options{}))
+	p := jwtauth.Principal{UserID: "u1", Username: "alice", Email: "alice@example.com"}
+
+	logger.Info("req", Principal(p))
+	out := buf.String()
+	if strings.Contains(out, "alice") || !strings.Contains(out, `"user_id":"u1"`) {
+		t.Fatalf("expected username/email redacted and user_id kept, got %s", out)
+	}
+	if !strings.Contains(out, "sha256:") {
+		t.Fatalf("expected hashed values for correlation, got %s", out)
+	}
+
+	buf.Reset()
+	none := ParseRedact("none")
+	redactFields.Store(&none)
+	logger.Info("req", Principal(p))
+	if !strings.Contains(buf.String(), "alice@example.com") {
+		t.Fatalf("expected raw values with redaction disabled, got %s", buf.String())
+	}
+}
+
+func TestParseRedact(t *testing.T) {
+	fields := ParseRedact(" Email , user_id,")
+	if len(fields) != 2 || !fields["email"] || !fields["user_id"] {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if len(ParseRedact("")) != 0 {
+		t.Fatalf("expected empty spec to disable redaction")
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestID)
+	var seen, forwarded string
+	app.Get("/", func(c fiber.Ctx) error {
+		seen = RequestIDFrom(c)
+		forwarded = c.Get(fiber.HeaderXRequestID)
+		return nil
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen == "" || seen != forwarded || resp.Header.Get(fiber.HeaderXRequestID) != seen {
+		t.Fatalf("expected generated id on locals, request and response: %q %q %q", seen, forwarded, resp.Header.Get(fiber.HeaderXRequestID))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderXRequestID, "abc-123")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	if seen != "abc-123" {
+		t.Fatalf("expected incoming id to be reused, got %q", seen)
+	}
+}
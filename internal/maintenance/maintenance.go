@@ -0,0 +1,94 @@
+// Package maintenance answers ingress requests with 503 while maintenance mode is switched on
+// through the admin API, globally or for single routes, without reaching the upstream.
+package maintenance
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// globalKey labels requests refused by global maintenance
+const globalKey = "*"
+
+// the switches are runtime state: they survive config reloads but not a restart
+var (
+	mu     sync.RWMutex
+	global bool
+	routes = map[string]bool{}
+)
+
+// Set switches maintenance on or off for a route key, or for the whole ingress when route is ""
+func Set(route string, on bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case route == "":
+		global = on
+	case on:
+		routes[route] = true
+	default:
+		delete(routes, route)
+	}
+}
+
+// State reports whether global maintenance is on and the route keys under maintenance, sorted
+func State() (bool, []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	keys := make([]string, 0, len(routes))
+	for k := range routes {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return global, keys
+}
+
+// active returns the key the request is under maintenance for, or "" when it is not
+func active(route string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if global {
+		return globalKey
+	}
+	if route != "" && routes[route] {
+		return route
+	}
+	return ""
+}
+
+// Middleware answers requests under maintenance with 503 and the configured maintenance page
+func Middleware(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	var route string
+	if conf != nil {
+		if r, ok := conf.MatchRoute(c.Hostname(), c.Path()); ok {
+			route = r.Key()
+		}
+	}
+	key := active(route)
+	if key == "" {
+		return c.Next()
+	}
+	metrics.IngressMaintenance.WithLabelValues(key).Inc()
+	var page *ingressconfig.MaintenancePage
+	if conf != nil {
+		page = conf.Maintenance
+	}
+	if page == nil {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "service under maintenance")
+	}
+	if page.RetryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(page.RetryAfter.Seconds())))
+	}
+	if page.Body == "" {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "service under maintenance")
+	}
+	c.Set(fiber.HeaderContentType, page.MediaType())
+	return c.Status(fiber.StatusServiceUnavailable).SendString(page.Body)
+}
@@ -0,0 +1,56 @@
+package maintenance
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestMiddleware(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		Routes:      []ingressconfig.Route{{Name: "orders", PathPrefix: "/orders"}, {Name: "users", PathPrefix: "/users"}},
+		Maintenance: &ingressconfig.MaintenancePage{Body: "<h1>back soon</h1>", RetryAfter: 2 * time.Minute},
+	})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		Set("", false)
+		Set("orders", false)
+	})
+	app := fiber.New()
+	app.Use(Middleware)
+	app.All("/*", func(c fiber.Ctx) error { return c.SendString("upstream") })
+	get := func(path string) (int, string, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), resp.Header.Get("Retry-After")
+	}
+
+	if status, _, _ := get("/orders/1"); status != 200 {
+		t.Fatalf("expected requests through before maintenance, got %d", status)
+	}
+
+	Set("orders", true)
+	if status, body, retry := get("/orders/1"); status != 503 || body != "<h1>back soon</h1>" || retry != "120" {
+		t.Fatalf("expected the maintenance page on the route, got %d %q retry %q", status, body, retry)
+	}
+	if status, _, _ := get("/users/1"); status != 200 {
+		t.Fatalf("expected other routes to be unaffected, got %d", status)
+	}
+
+	Set("orders", false)
+	Set("", true)
+	if status, _, _ := get("/users/1"); status != 503 {
+		t.Fatalf("expected global maintenance to cover every route, got %d", status)
+	}
+	if global, routes := State(); !global || len(routes) != 0 {
+		t.Fatalf("unexpected state %v %v", global, routes)
+	}
+}
@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sidecar"
+
+var (
+	// IngressRequests counts ingress requests by route and response status
+	IngressRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "requests_total",
+		Help: "Ingress requests handled, by route and status code.",
+	}, []string{"route", "code"})
+
+	// IngressLatency observes end-to-end ingress latency (authn, authz and upstream)
+	IngressLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "request_duration_seconds",
+		Help:    "Ingress request latency including authorization and upstream proxying.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	// IngressRateLimited counts requests refused by a rate limit, per route ("*" for the global limit)
+	IngressRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "rate_limited_total",
+		Help: "Ingress requests refused with 429 by route rate-limit key.",
+	}, []string{"route"})
+
+	// IngressIPDenied counts requests refused by ip-access, per route ("*" for the global lists)
+	IngressIPDenied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "ip_denied_total",
+		Help: "Ingress requests refused with 403 by ip-access route key.",
+	}, []string{"route"})
+
+	// IngressConcurrencyLimited counts requests refused by a max-in-flight limit, per route ("*" for the global limit)
+	IngressConcurrencyLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "concurrency_limited_total",
+		Help: "Ingress requests refused with 503 by max-in-flight route key.",
+	}, []string{"route"})
+
+	// IngressMaintenance counts requests answered by maintenance mode, per route ("*" for global maintenance)
+	IngressMaintenance = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "maintenance_total",
+		Help: "Ingress requests answered with 503 by maintenance mode by route key.",
+	}, []string{"route"})
+
+	// UpstreamEjections counts endpoints taken out of a route's rotation after consecutive failures
+	UpstreamEjections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "upstream_ejections_total",
+		Help: "Upstream endpoints ejected from load balancing by route and endpoint.",
+	}, []string{"route", "endpoint"})
+
+	// UpstreamHealthy is 1 while an endpoint passes its route's health checks and 0 once it fails them
+	UpstreamHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "upstream_healthy",
+		Help: "Health of upstream endpoints with health checks by route and endpoint (1 healthy, 0 unhealthy).",
+	}, []string{"route", "endpoint"})
+
+	// UpstreamRetries counts retried upstream attempts, and retries refused by the retry budget, per route
+	UpstreamRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "upstream_retries_total",
+		Help: "Upstream retries by route and outcome (retried, budget_exhausted).",
+	}, []string{"route", "outcome"})
+
+	// IngressMirrored counts mirrored requests per route by result
+	IngressMirrored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "mirrored_requests_total",
+		Help: "Requests mirrored to a route's secondary upstream by route and result (sent, error, dropped).",
+	}, []string{"route", "result"})
+
+	// IngressSplitRequests counts requests per route and traffic-split target
+	IngressSplitRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "ingress", Name: "split_requests_total",
+		Help: "Requests sent to each target of a route's traffic split by route and target.",
+	}, []string{"route", "target"})
+
+	// AuthzDecisions counts authorization outcomes per check
+	AuthzDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "decisions_total",
+		Help: "Authorization decisions by check (coarse, fine-grain, policy) and decision (allow, deny, error, skip).",
+	}, []string{"check", "decision"})
+
+	// AuthzMonitored counts decisions of checks in monitor mode, which never block
+	AuthzMonitored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "monitored_decisions_total",
+		Help: "Decisions of checks in monitor mode by check and the decision that would have applied (allow, deny, error).",
+	}, []string{"check", "decision"})
+
+	// AuthzVariantDecisions counts decisions of checks with a canary by variant (stable, canary)
+	AuthzVariantDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "variant_decisions_total",
+		Help: "Decisions of checks running a canary by check, variant (stable, canary) and decision (allow, deny, error, skip).",
+	}, []string{"check", "variant", "decision"})
+
+	// AuthzDecisionCache counts decision cache lookups per check by result (hit, miss)
+	AuthzDecisionCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "decision_cache_lookups_total",
+		Help: "Decision cache lookups by check and result (hit, miss).",
+	}, []string{"check", "result"})
+
+	// AuthzLatency observes validation service round trips per check
+	AuthzLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "validation_duration_seconds",
+		Help:    "Latency of calls to the external validation services.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"check"})
+
+	// CircuitState is 1 for the current state (closed, half-open, open) of each validation service circuit breaker
+	CircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: "authz", Name: "circuit_state",
+		Help: "Circuit breaker state per check; the series for the current state is 1.",
+	}, []string{"check", "state"})
+
+	// EgressRequests counts egress requests by IDP type and response status
+	EgressRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "egress", Name: "requests_total",
+		Help: "Egress requests handled, by IDP type and status code.",
+	}, []string{"idp_type", "code"})
+
+	// EgressLatency observes egress request latency by IDP type
+	EgressLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "egress", Name: "request_duration_seconds",
+		Help:    "Egress request latency including the backend call.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"idp_type"})
+
+	// TokenFetches counts token endpoint calls by IDP type and result
+	TokenFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "oauth", Name: "token_fetches_total",
+		Help: "Token endpoint calls by IDP type and result (success, failure).",
+	}, []string{"idp_type", "result"})
+
+	// TokenFetchLatency observes token endpoint latency by IDP type
+	TokenFetchLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "oauth", Name: "token_fetch_duration_seconds",
+		Help:    "Latency of token endpoint calls.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"idp_type"})
+
+	// TokenRefreshFailures counts failed token refreshes in the token manager
+	TokenRefreshFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "tokenmanager", Name: "refresh_failures_total",
+		Help: "Failed token refresh attempts by IDP type.",
+	}, []string{"idp_type"})
+
+	// AuditEvents counts authorization audit events by outcome (written, dropped, failed)
+	AuditEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "audit", Name: "events_total",
+		Help: "Authorization audit events by delivery result.",
+	}, []string{"result"})
+)
+
+// Handler serves the Prometheus exposition format
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// Since returns the seconds elapsed since start, for histogram observations
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// StatusOf returns the status code a handler produced, taking returned fiber errors into account
+func StatusOf(c fiber.Ctx, err error) int {
+	if err != nil {
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return fe.Code
+		}
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// Decision maps a check outcome to the decision label
+func Decision(allow bool, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case allow:
+		return "allow"
+	default:
+		return "deny"
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDecision(t *testing.T) {
+	if got := Decision(true, nil); got != "allow" {
+		t.Fatalf("expected allow, got %q", got)
+	}
+	if got := Decision(false, nil); got != "deny" {
+		t.Fatalf("expected deny, got %q", got)
+	}
+	if got := Decision(true, errors.New("boom")); got != "error" {
+		t.Fatalf("expected error, got %q", got)
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+
+	c.Status(fiber.StatusCreated)
+	if got := StatusOf(c, nil); got != fiber.StatusCreated {
+		t.Fatalf("expected response status, got %d", got)
+	}
+	if got := StatusOf(c, fiber.NewError(fiber.StatusForbidden, "no")); got != fiber.StatusForbidden {
+		t.Fatalf("expected fiber error code, got %d", got)
+	}
+	if got := StatusOf(c, errors.New("boom")); got != fiber.StatusInternalServerError {
+		t.Fatalf("expected 500 for plain errors, got %d", got)
+	}
+}
+
+func TestCountersAreRegistered(t *testing.T) {
+	before := testutil.ToFloat64(AuthzDecisions.WithLabelValues("coarse", "allow"))
+	AuthzDecisions.WithLabelValues("coarse", "allow").Inc()
+	if after := testutil.ToFloat64(AuthzDecisions.WithLabelValues("coarse", "allow")); after != before+1 {
+		t.Fatalf("expected counter to increment, got %v -> %v", before, after)
+	}
+}
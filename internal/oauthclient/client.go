@@ -2,6 +2,7 @@ package oauthclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -10,10 +11,17 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"reverseProxy/internal/assertion"
 	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/metrics"
 	"reverseProxy/internal/tokenstorage"
+	"reverseProxy/internal/tracing"
 )
 
 // TokenResponse represents the OAuth token response
@@ -60,23 +68,46 @@ func NewOAuthClient(idpType string) (*OAuthClient, error) {
 }
 
 // FetchToken fetches a new token from the OAuth provider
-func (oc *OAuthClient) FetchToken() (string, time.Duration, error) {
+func (oc *OAuthClient) FetchToken() (token string, expiresIn time.Duration, err error) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(context.Background(), "oauth.token_fetch", trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(attribute.String("idp_type", oc.idpType))
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		metrics.TokenFetches.WithLabelValues(oc.idpType, result).Inc()
+		metrics.TokenFetchLatency.WithLabelValues(oc.idpType).Observe(metrics.Since(start))
+		tracing.End(span, err)
+	}()
+
 	// Prepare the token request
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
 	data.Set("client_id", oc.config.ClientID)
-	data.Set("client_secret", oc.config.ClientSecret)
+	if oc.config.ClientAuthMethod == assertion.ClientAuthPrivateKeyJWT {
+		signed, err := clientAssertion(oc.idpType, oc.config)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to sign client assertion: %w", err)
+		}
+		data.Set("client_assertion_type", assertion.ClientAssertionType)
+		data.Set("client_assertion", signed)
+	} else {
+		data.Set("client_secret", oc.config.ClientSecret)
+	}
 	if len(oc.config.Scope) > 0 {
 		data.Set("scope", strings.Join(oc.config.Scope, " "))
 	}
 
-	req, err := http.NewRequest("POST", oc.config.TokenURL, bytes.NewBufferString(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", oc.config.TokenURL, bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to create token request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
+	tracing.InjectHTTP(ctx, req.Header)
 
 	resp, err := oc.client.Do(req)
 	if err != nil {
@@ -96,8 +127,7 @@ func (oc *OAuthClient) FetchToken() (string, time.Duration, error) {
 		return "", 0, fmt.Errorf("failed to decode token response: %w", err)
 	}
 
-	expiresIn := time.Duration(tokenResp.ExpiresIn) * time.Second
-	return tokenResp.AccessToken, expiresIn, nil
+	return tokenResp.AccessToken, time.Duration(tokenResp.ExpiresIn) * time.Second, nil
 }
 
 // RefreshToken fetches and stores a new token
@@ -111,6 +141,23 @@ func (oc *OAuthClient) RefreshToken() error {
 	return storage.SaveToken(oc.idpType, token, expiresIn)
 }
 
+// signers caches each IDP's private_key_jwt signer, and with it the signed assertion, across clients
+var signers sync.Map
+
+// clientAssertion signs a client assertion for the IDP's token endpoint, reloading the key when the config changes
+func clientAssertion(idpType string, config egressconfig.OAuthClientConfig) (string, error) {
+	s, ok := signers.Load(idpType)
+	if signer, _ := s.(*assertion.ClientSigner); !ok || signer.ClientID != config.ClientID || signer.KeyFile != config.PrivateKeyFile {
+		signer, err := assertion.NewClientSigner(config.ClientID, config.PrivateKeyFile)
+		if err != nil {
+			return "", err
+		}
+		signers.Store(idpType, signer)
+		s = signer
+	}
+	return s.(*assertion.ClientSigner).Assertion(config.TokenURL)
+}
+
 // loadClientCertificate loads a client certificate from a file (PEM or PKCS12)
 func loadClientCertificate(certPath string) (*tls.Config, error) {
 	if strings.HasSuffix(strings.ToLower(certPath), ".pfx") || strings.HasSuffix(strings.ToLower(certPath), ".p12") {
@@ -0,0 +1,73 @@
+package oauthclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/egressconfig"
+)
+
+func TestFetchTokenPrivateKeyJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "client.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_secret") != "" {
+			t.Errorf("client secret must not be sent with private_key_jwt")
+		}
+		if r.FormValue("client_assertion_type") != assertion.ClientAssertionType {
+			t.Errorf("unexpected client_assertion_type %q", r.FormValue("client_assertion_type"))
+		}
+		_, err := jwt.Parse(r.FormValue("client_assertion"), func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil },
+			jwt.WithIssuer("sidecar"), jwt.WithSubject("sidecar"), jwt.WithAudience(tokenURL))
+		if err != nil {
+			t.Errorf("client assertion does not verify: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"tok","expires_in":60}`))
+	}))
+	defer srv.Close()
+	tokenURL = srv.URL + "/token"
+
+	configPath := filepath.Join(dir, "egress-config.yaml")
+	content := "multi-oauth-client-config:\n  pkj-idp:\n    tokenUrl: " + tokenURL + "\n    clientId: sidecar\n" +
+		"    clientAuthMethod: private_key_jwt\n    privateKeyFile: " + keyPath + "\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := egressconfig.Load(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewOAuthClient("pkj-idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := client.FetchToken()
+	if err != nil || token != "tok" {
+		t.Fatalf("FetchToken = %q, %v", token, err)
+	}
+}
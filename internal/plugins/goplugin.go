@@ -0,0 +1,32 @@
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// NewFunc is the constructor a Go plugin exports as New. It receives the plugin's config and
+// returns a value implementing any of the plugin interfaces. The plugin must be built with the
+// same Go version and dependency versions as the sidecar.
+type NewFunc = func(config map[string]any) (any, error)
+
+func openGoPlugin(conf Config) (any, error) {
+	p, err := plugin.Open(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("New")
+	if err != nil {
+		return nil, err
+	}
+	newFunc, ok := sym.(NewFunc)
+	if !ok {
+		if ptr, isPtr := sym.(*NewFunc); isPtr {
+			newFunc, ok = *ptr, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("New has type %T, expected func(map[string]any) (any, error)", sym)
+	}
+	return newFunc(conf.Config)
+}
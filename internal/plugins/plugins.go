@@ -0,0 +1,191 @@
+// Package plugins extends the sidecar with custom authentication, authorization and request and
+// response filters, loaded from Go plugins (.so) or WebAssembly modules (.wasm) listed under
+// plugins in ingress-config.yaml, or registered in-process with Register.
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// Request is the view of an ingress request passed to plugins; filters may change it
+type Request struct {
+	Method string      `json:"method"`
+	Host   string      `json:"host"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Response is the view of an upstream response passed to response filters, which may change it
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// Authenticator recognises credentials the built-in authentication does not, such as a
+// proprietary token format. It returns a nil principal and nil error for requests it does not
+// recognise, which then go through the route's authentication mode; an error refuses them with 401.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *Request) (*jwtauth.Principal, error)
+}
+
+// Authorizer decides requests after the built-in authorization providers have allowed them
+type Authorizer interface {
+	Authorize(ctx context.Context, req *Request, principal jwtauth.Principal) (allow bool, reason string, err error)
+}
+
+// RequestFilter edits the request before it is proxied; returning a *Reject answers the client instead
+type RequestFilter interface {
+	FilterRequest(ctx context.Context, req *Request) error
+}
+
+// ResponseFilter edits the upstream response; returning a *Reject replaces it
+type ResponseFilter interface {
+	FilterResponse(ctx context.Context, req *Request, resp *Response) error
+}
+
+// Reject is returned by a filter to answer the client with Status and Message
+type Reject struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (r *Reject) Error() string { return fmt.Sprintf("rejected with %d: %s", r.Status, r.Message) }
+
+// Config declares a plugin to load
+type Config struct {
+	Name string `yaml:"name"`
+	// Path is a Go plugin (.so) exporting New, or a WebAssembly module (.wasm)
+	Path string `yaml:"path"`
+	// Config is handed to the plugin when it is loaded
+	Config map[string]any `yaml:"config"`
+}
+
+// Named is a plugin implementation and the name it was loaded or registered under
+type Named[T any] struct {
+	Name   string
+	Plugin T
+}
+
+// registry holds the loaded plugins by the interfaces they implement, in load order
+type registry struct {
+	authenticators  []Named[Authenticator]
+	authorizers     []Named[Authorizer]
+	requestFilters  []Named[RequestFilter]
+	responseFilters []Named[ResponseFilter]
+}
+
+var (
+	mu      sync.RWMutex
+	plugins registry
+)
+
+// Register adds an implementation of any of the plugin interfaces; call it before serving requests
+func Register(name string, impl any) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if !add(name, impl) {
+		return fmt.Errorf("plugin %s implements none of the plugin interfaces", name)
+	}
+	return nil
+}
+
+// add files impl under each plugin interface it implements, reporting whether there was any
+func add(name string, impl any) bool {
+	matched := false
+	if p, ok := impl.(Authenticator); ok {
+		plugins.authenticators = append(plugins.authenticators, Named[Authenticator]{name, p})
+		matched = true
+	}
+	if p, ok := impl.(Authorizer); ok {
+		plugins.authorizers = append(plugins.authorizers, Named[Authorizer]{name, p})
+		matched = true
+	}
+	if p, ok := impl.(RequestFilter); ok {
+		plugins.requestFilters = append(plugins.requestFilters, Named[RequestFilter]{name, p})
+		matched = true
+	}
+	if p, ok := impl.(ResponseFilter); ok {
+		plugins.responseFilters = append(plugins.responseFilters, Named[ResponseFilter]{name, p})
+		matched = true
+	}
+	return matched
+}
+
+// Load opens the configured plugins and registers them; it is meant to run once at startup
+func Load(ctx context.Context, confs []Config) error {
+	for _, conf := range confs {
+		if conf.Name == "" || conf.Path == "" {
+			return fmt.Errorf("plugins: name and path are required")
+		}
+		var impls []any
+		switch filepath.Ext(conf.Path) {
+		case ".so":
+			impl, err := openGoPlugin(conf)
+			if err != nil {
+				return fmt.Errorf("plugin %s: %w", conf.Name, err)
+			}
+			impls = []any{impl}
+		case ".wasm":
+			var err error
+			if impls, err = openWASM(ctx, conf); err != nil {
+				return fmt.Errorf("plugin %s: %w", conf.Name, err)
+			}
+		default:
+			return fmt.Errorf("plugin %s: unsupported file %q; expected .so or .wasm", conf.Name, conf.Path)
+		}
+		mu.Lock()
+		matched := false
+		for _, impl := range impls {
+			matched = add(conf.Name, impl) || matched
+		}
+		mu.Unlock()
+		if !matched {
+			return fmt.Errorf("plugin %s implements none of the plugin interfaces", conf.Name)
+		}
+	}
+	return nil
+}
+
+// Authenticators returns the registered authenticators in order
+func Authenticators() []Named[Authenticator] {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plugins.authenticators
+}
+
+// Authorizers returns the registered authorizers in order
+func Authorizers() []Named[Authorizer] {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plugins.authorizers
+}
+
+// RequestFilters returns the registered request filters in order
+func RequestFilters() []Named[RequestFilter] {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plugins.requestFilters
+}
+
+// ResponseFilters returns the registered response filters in order
+func ResponseFilters() []Named[ResponseFilter] {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plugins.responseFilters
+}
+
+// Reset removes every plugin; for tests
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	plugins = registry{}
+}
@@ -0,0 +1,91 @@
+package plugins
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+type headerFilter struct{}
+
+func (headerFilter) FilterRequest(_ context.Context, req *Request) error {
+	req.Header.Set("X-Filtered", "yes")
+	return nil
+}
+
+func (headerFilter) Authorize(_ context.Context, req *Request, p jwtauth.Principal) (bool, string, error) {
+	return p.UserID == "alice", "only alice", nil
+}
+
+func TestRegister(t *testing.T) {
+	t.Cleanup(Reset)
+	if err := Register("filter", headerFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(RequestFilters()) != 1 || len(Authorizers()) != 1 || len(Authenticators()) != 0 {
+		t.Fatalf("expected the plugin filed under both of its interfaces")
+	}
+	if err := Register("nothing", struct{}{}); err == nil {
+		t.Fatalf("expected a value implementing no interface to be refused")
+	}
+}
+
+func TestLoad_RejectsUnknownFiles(t *testing.T) {
+	t.Cleanup(Reset)
+	if err := Load(context.Background(), []Config{{Name: "x", Path: "plugin.js"}}); err == nil {
+		t.Fatalf("expected an unsupported extension to fail")
+	}
+	if err := Load(context.Background(), []Config{{Name: "x", Path: "/missing/plugin.so"}}); err == nil {
+		t.Fatalf("expected a missing Go plugin to fail")
+	}
+}
+
+// authorizeModule is a WebAssembly module whose authorize always answers {"allow":true,"reason":"wasm"}
+func authorizeModule() []byte {
+	result := `{"allow":true,"reason":"wasm"}`
+	section := func(id byte, payload ...byte) []byte { return append([]byte{id, byte(len(payload))}, payload...) }
+	name := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	concat := func(parts ...[]byte) []byte {
+		var out []byte
+		for _, p := range parts {
+			out = append(out, p...)
+		}
+		return out
+	}
+	return concat(
+		[]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		// (i32) -> i32 and (i32, i32) -> i64
+		section(1, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e),
+		section(3, 0x02, 0x00, 0x01),
+		section(5, 0x01, 0x00, 0x01),
+		section(7, concat([]byte{0x03},
+			name("memory"), []byte{0x02, 0x00},
+			name("alloc"), []byte{0x00, 0x00},
+			name("authorize"), []byte{0x00, 0x01})...),
+		// alloc returns 1024; authorize returns the result at offset 0
+		section(10, 0x02, 0x05, 0x00, 0x41, 0x80, 0x08, 0x0b, 0x04, 0x00, 0x42, byte(len(result)), 0x0b),
+		section(11, concat([]byte{0x01, 0x00, 0x41, 0x00, 0x0b}, name(result))...),
+	)
+}
+
+func TestLoad_WASM(t *testing.T) {
+	t.Cleanup(Reset)
+	path := filepath.Join(t.TempDir(), "authz.wasm")
+	if err := os.WriteFile(path, authorizeModule(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(context.Background(), []Config{{Name: "authz", Path: path}}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	authorizers := Authorizers()
+	if len(authorizers) != 1 || len(RequestFilters()) != 0 {
+		t.Fatalf("expected only an authorizer from the module's exports")
+	}
+	allow, reason, err := authorizers[0].Plugin.Authorize(context.Background(), &Request{Method: "GET", Path: "/"}, jwtauth.Principal{UserID: "u1"})
+	if err != nil || !allow || reason != "wasm" {
+		t.Fatalf("expected the module's decision, got %v %q %v", allow, reason, err)
+	}
+}
@@ -0,0 +1,245 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// A WebAssembly plugin exports its memory, alloc(size i32) -> i32 for the host to write inputs
+// into, and any of authenticate, authorize, filter_request and filter_response. Each takes the
+// pointer and length of a JSON document and returns the pointer and length of a JSON result,
+// packed as ptr<<32 | len into an i64. An optional init receives the plugin's config the same way
+// when an instance starts, and an optional dealloc(ptr, len i32) frees what the host has read.
+//
+//	authenticate    {request}               -> {principal?, error?}
+//	authorize       {request, principal}    -> {allow, reason?, error?}
+//	filter_request  {request}               -> {request?, reject?, error?}
+//	filter_response {request, response}     -> {response?, reject?, error?}
+const wasmPoolSize = 16
+
+// wasmModule runs calls on a pool of instances, since an instance is not safe for concurrent use
+type wasmModule struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	config   []byte
+	pool     chan api.Module
+}
+
+type wasmAuthenticator struct{ *wasmModule }
+type wasmAuthorizer struct{ *wasmModule }
+type wasmRequestFilter struct{ *wasmModule }
+type wasmResponseFilter struct{ *wasmModule }
+
+// wasmResult is the union of the results plugins return
+type wasmResult struct {
+	Principal *jwtauth.Principal `json:"principal"`
+	Allow     bool               `json:"allow"`
+	Reason    string             `json:"reason"`
+	Request   *Request           `json:"request"`
+	Response  *Response          `json:"response"`
+	Reject    *Reject            `json:"reject"`
+	Error     string             `json:"error"`
+}
+
+// openWASM compiles the module and returns an adapter per exported entry point
+func openWASM(ctx context.Context, conf Config) ([]any, error) {
+	bin, err := os.ReadFile(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+	r := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		return nil, err
+	}
+	compiled, err := r.CompileModule(ctx, bin)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	m := &wasmModule{name: conf.Name, runtime: r, compiled: compiled, config: config, pool: make(chan api.Module, wasmPoolSize)}
+	exports := compiled.ExportedFunctions()
+	if _, ok := exports["alloc"]; !ok {
+		_ = r.Close(ctx)
+		return nil, errors.New("module does not export alloc")
+	}
+	var impls []any
+	if _, ok := exports["authenticate"]; ok {
+		impls = append(impls, wasmAuthenticator{m})
+	}
+	if _, ok := exports["authorize"]; ok {
+		impls = append(impls, wasmAuthorizer{m})
+	}
+	if _, ok := exports["filter_request"]; ok {
+		impls = append(impls, wasmRequestFilter{m})
+	}
+	if _, ok := exports["filter_response"]; ok {
+		impls = append(impls, wasmResponseFilter{m})
+	}
+	// start one instance now, so a module that cannot be instantiated fails at startup
+	inst, err := m.instance(ctx)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	m.release(ctx, inst)
+	return impls, nil
+}
+
+func (a wasmAuthenticator) Authenticate(ctx context.Context, req *Request) (*jwtauth.Principal, error) {
+	res, err := a.call(ctx, "authenticate", map[string]any{"request": req})
+	if err != nil {
+		return nil, err
+	}
+	return res.Principal, nil
+}
+
+func (a wasmAuthorizer) Authorize(ctx context.Context, req *Request, principal jwtauth.Principal) (bool, string, error) {
+	res, err := a.call(ctx, "authorize", map[string]any{"request": req, "principal": principal})
+	if err != nil {
+		return false, "", err
+	}
+	return res.Allow, res.Reason, nil
+}
+
+func (f wasmRequestFilter) FilterRequest(ctx context.Context, req *Request) error {
+	res, err := f.call(ctx, "filter_request", map[string]any{"request": req})
+	if err != nil {
+		return err
+	}
+	if res.Reject != nil {
+		return res.Reject
+	}
+	if res.Request != nil {
+		*req = *res.Request
+	}
+	return nil
+}
+
+func (f wasmResponseFilter) FilterResponse(ctx context.Context, req *Request, resp *Response) error {
+	res, err := f.call(ctx, "filter_response", map[string]any{"request": req, "response": resp})
+	if err != nil {
+		return err
+	}
+	if res.Reject != nil {
+		return res.Reject
+	}
+	if res.Response != nil {
+		*resp = *res.Response
+	}
+	return nil
+}
+
+// call passes input as JSON to an exported function and decodes its result
+func (m *wasmModule) call(ctx context.Context, fn string, input any) (wasmResult, error) {
+	var res wasmResult
+	in, err := json.Marshal(input)
+	if err != nil {
+		return res, err
+	}
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return res, err
+	}
+	out, err := invoke(ctx, inst, fn, in)
+	if err != nil {
+		// the instance may be left in a broken state
+		_ = inst.Close(ctx)
+		return res, fmt.Errorf("%s: %w", fn, err)
+	}
+	m.release(ctx, inst)
+	if err := json.Unmarshal(out, &res); err != nil {
+		return res, fmt.Errorf("%s result: %w", fn, err)
+	}
+	if res.Error != "" {
+		return res, errors.New(res.Error)
+	}
+	return res, nil
+}
+
+// invoke writes in to the instance's memory, calls fn and copies its result out
+func invoke(ctx context.Context, inst api.Module, fn string, in []byte) ([]byte, error) {
+	ptr, err := write(ctx, inst, in)
+	if err != nil {
+		return nil, err
+	}
+	results, err := inst.ExportedFunction(fn).Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		return nil, err
+	}
+	free(ctx, inst, ptr, uint32(len(in)))
+	if len(results) != 1 {
+		return nil, errors.New("expected a single i64 result")
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	view, ok := inst.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, errors.New("result out of memory bounds")
+	}
+	out := append([]byte(nil), view...)
+	free(ctx, inst, outPtr, outLen)
+	return out, nil
+}
+
+func write(ctx context.Context, inst api.Module, b []byte) (uint32, error) {
+	results, err := inst.ExportedFunction("alloc").Call(ctx, uint64(len(b)))
+	if err != nil {
+		return 0, fmt.Errorf("alloc: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !inst.Memory().Write(ptr, b) {
+		return 0, errors.New("alloc returned memory out of bounds")
+	}
+	return ptr, nil
+}
+
+func free(ctx context.Context, inst api.Module, ptr, size uint32) {
+	if dealloc := inst.ExportedFunction("dealloc"); dealloc != nil {
+		_, _ = dealloc.Call(ctx, uint64(ptr), uint64(size))
+	}
+}
+
+// instance takes an idle instance from the pool or starts a new one, passing it the config
+func (m *wasmModule) instance(ctx context.Context) (api.Module, error) {
+	select {
+	case inst := <-m.pool:
+		return inst, nil
+	default:
+	}
+	// anonymous, so several instances of the module can run side by side; reactor modules
+	// (TinyGo, Go c-shared) initialise in _initialize
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	inst, err := m.runtime.InstantiateModule(ctx, m.compiled, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if init := inst.ExportedFunction("init"); init != nil {
+		if _, err := invoke(ctx, inst, "init", m.config); err != nil {
+			_ = inst.Close(ctx)
+			return nil, fmt.Errorf("init: %w", err)
+		}
+	}
+	return inst, nil
+}
+
+// release returns an instance to the pool, closing it when the pool is full
+func (m *wasmModule) release(ctx context.Context, inst api.Module) {
+	select {
+	case m.pool <- inst:
+	default:
+		_ = inst.Close(ctx)
+	}
+}
@@ -0,0 +1,61 @@
+package proxyhandler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/apikey"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/logging"
+)
+
+// authenticate establishes the principal through a plugin authenticator or the authentication mode of the matched route
+func authenticate(ctx context.Context, c fiber.Ctx) (error, bool) {
+	// plugin authenticators see the request first, for credentials the built-in modes do not know
+	if err, handled := pluginAuthenticate(ctx, c); handled {
+		return err, err != nil
+	}
+	mode := ingressconfig.AuthnJWT
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		mode = conf.AuthnMode(c.Hostname(), c.Path())
+	}
+	switch mode {
+	case ingressconfig.AuthnAPIKey:
+		return apiKeyAuthenticate(ctx, c)
+	case ingressconfig.AuthnMTLS:
+		return certificateAuthenticate(c)
+	case ingressconfig.AuthnEither:
+		if c.Get(fiber.HeaderAuthorization) == "" {
+			return certificateAuthenticate(c)
+		}
+	}
+	return jwtAuthenticate(ctx, c)
+}
+
+// apiKeyAuthenticate validates the API key header and removes it so the key never reaches the upstream
+func apiKeyAuthenticate(ctx context.Context, c fiber.Ctx) (error, bool) {
+	header, ok := apikey.Header()
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "API keys are not enabled"), true
+	}
+	key := c.Get(header)
+	if key == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing API key"), true
+	}
+	c.Request().Header.Del(header)
+	principal, err := apikey.Validate(ctx, key)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid API key"), true
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "API key validation failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "API key validation unavailable"), true
+	}
+	c.Locals("Principal", principal)
+	c.Locals("Claims", jwt.MapClaims{"sub": principal.UserID, "name": principal.Username})
+	return nil, false
+}
@@ -0,0 +1,151 @@
+package proxyhandler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/apikey"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestHandler_APIKeyAuthn(t *testing.T) {
+	sum := sha256.Sum256([]byte("k-orders"))
+	keys := filepath.Join(t.TempDir(), "api-keys.yaml")
+	if err := os.WriteFile(keys, []byte("- id: orders-service\n  hash: sha256:"+hex.EncodeToString(sum[:])+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes:          []ingressconfig.Route{{PathPrefix: "/svc", Authn: ingressconfig.AuthnAPIKey}},
+	})
+	if err := apikey.Configure(&apikey.Config{Enabled: true, File: keys}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = apikey.Configure(nil)
+	})
+
+	var principal jwtauth.Principal
+	var forwardedKey string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		principal, _ = c.Locals("Principal").(jwtauth.Principal)
+		forwardedKey = c.Get(apikey.DefaultHeader)
+		return nil
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	status := func(key string) int {
+		req := httptest.NewRequest("GET", "/svc/items", nil)
+		if key != "" {
+			req.Header.Set(apikey.DefaultHeader, key)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("k-orders"); got != 200 || principal.UserID != "orders-service" {
+		t.Fatalf("expected service principal, got %d %+v", got, principal)
+	}
+	if forwardedKey != "" {
+		t.Errorf("expected the API key to be removed before proxying, got %q", forwardedKey)
+	}
+	if got := status("k-wrong"); got != 401 {
+		t.Errorf("expected 401 for an unknown key, got %d", got)
+	}
+	if got := status(""); got != 401 {
+		t.Errorf("expected 401 without a key, got %d", got)
+	}
+}
+
+func TestHandler_PublicPathsSkipAuthn(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream:  "http://default.internal",
+		PublicPaths:      []string{"/health", "/docs/**"},
+		PrincipalHeaders: &ingressconfig.PrincipalHeaders{},
+		Routes:           []ingressconfig.Route{{PathPrefix: "/docs", Token: ingressconfig.TokenStrip}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	var userID, authorization string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		userID = c.Get(ingressconfig.DefaultUserIDHeader)
+		authorization = c.Get(fiber.HeaderAuthorization)
+		return nil
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(ingressconfig.DefaultUserIDHeader, "spoofed")
+		req.Header.Set("Authorization", "Bearer unvalidated")
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := send("/health"); got != 200 || userID != "" || authorization != "Bearer unvalidated" {
+		t.Errorf("expected anonymous relay on /health, got %d user=%q auth=%q", got, userID, authorization)
+	}
+	if got := send("/docs/index.html"); got != 200 || authorization != "" {
+		t.Errorf("expected the unvalidated token to be stripped on /docs, got %d auth=%q", got, authorization)
+	}
+	if got := send("/api"); got != 401 {
+		t.Errorf("expected other paths to require a valid token, got %d", got)
+	}
+}
+
+func TestHandler_PublicPathsRefuseTraversal(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		PublicPaths:     []string{"/docs/**"},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	var proxied []string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		proxied = append(proxied, url)
+		return nil
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(path string) int {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, path := range []string{"/docs/../admin/users", "/docs/%2e%2e/admin", "/docs/.%2E/admin", "/docs%2f..%2fadmin"} {
+		if got := send(path); got != fiber.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, got)
+		}
+	}
+	if len(proxied) != 0 {
+		t.Fatalf("expected nothing proxied, got %v", proxied)
+	}
+	// an encoded public path is public, and reaches the upstream as the path it was matched as
+	if got := send("/%64ocs/a%20b"); got != 200 || len(proxied) != 1 || proxied[0] != "http://default.internal/docs/a%20b" {
+		t.Errorf("expected the decoded public path to be proxied, got %d %v", got, proxied)
+	}
+	if got := send("/%61pi"); got != 401 {
+		t.Errorf("expected an encoded protected path to require a token, got %d", got)
+	}
+}
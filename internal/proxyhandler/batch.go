@@ -0,0 +1,151 @@
+package proxyhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/ratelimit"
+	"reverseProxy/internal/tracing"
+)
+
+// batchItem is one prospective request in a batch pre-authorization call
+type batchItem struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// batchDecision is the outcome for one item
+type batchDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// BatchHandler authenticates the caller once and reports which of the listed requests they would be
+// allowed to make, running the authorization checks for every item concurrently. The call spends one
+// request of the caller's rate limit, and an item whose route requires a step-up the token does not
+// meet is not allowed. The request is {"items": [{"id", "method", "path", "body"}]}; the response
+// maps each id to {"allow", "reason"}.
+func BatchHandler(c fiber.Ctx) (err error) {
+	start := time.Now()
+	ctx, span := tracing.StartServerSpan(c, "batch authz")
+	decision := "unauthenticated"
+	defer func() { observe(ctx, c, span, "batch authz request", start, decision, err) }()
+
+	if err := canonpath.Apply(c); err != nil {
+		decision = "bad-path"
+		return err
+	}
+	authnCtx, authnSpan := tracing.Tracer().Start(ctx, "authn.validate")
+	authnError, isAuthnError := authenticate(authnCtx, c)
+	tracing.End(authnSpan, authnError)
+	if isAuthnError {
+		return authnError
+	}
+	if err := selectTenant(c); err != nil {
+		decision = "wrong-tenant"
+		return err
+	}
+	principal, _ := c.Locals("Principal").(jwtauth.Principal)
+	if err := ratelimit.Check(c, principal); err != nil {
+		decision = "rate-limited"
+		return err
+	}
+	decision = "batch"
+
+	var batch struct {
+		Items []batchItem `json:"items"`
+	}
+	if err := json.Unmarshal(c.Body(), &batch); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid batch request: "+err.Error())
+	}
+	if err := validateBatch(batch.Items); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	base := buildRequestInfo(c)
+	limit := authorization.ConfigOrNil().BodyLimit()
+	decisions := make(map[string]batchDecision, len(batch.Items))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, item := range batch.Items {
+		info := base
+		info.Method = strings.ToUpper(item.Method)
+		// keys match the canonical path alone, as for single requests; the query stays in the full URL
+		rawPath, _, _ := strings.Cut(item.Path, "?")
+		info.Path, _ = canonpath.Canonical(rawPath)
+		info.FullURL = c.BaseURL() + item.Path
+		info.Body = nil
+		if limit >= 0 && len(item.Body) <= limit {
+			info.Body = item.Body
+		}
+		if stepUpChallenge(info.Host, info.Path, info.Claims) != "" {
+			mu.Lock()
+			decisions[item.ID] = batchDecision{Reason: errStepUpRequired}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := batchDecision{Allow: true}
+			if err := authorize(ctx, info, principal); err != nil {
+				d = batchDecision{Reason: err.Error()}
+				var fe *fiber.Error
+				if errors.As(err, &fe) {
+					d.Reason = fe.Message
+				}
+			}
+			mu.Lock()
+			decisions[item.ID] = d
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return c.JSON(fiber.Map{"decisions": decisions})
+}
+
+// isCanonical reports whether a raw item path reads the same to the sidecar and the upstream
+func isCanonical(rawPath string) bool {
+	_, err := canonpath.Canonical(rawPath)
+	return err == nil
+}
+
+// validateBatch checks the batch size and that every item has a unique id, a method and a canonical path
+func validateBatch(items []batchItem) error {
+	maxItems := ingressconfig.DefaultBatchMaxItems
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.BatchAuthz != nil {
+		maxItems = conf.BatchAuthz.ItemLimit()
+	}
+	if len(items) == 0 {
+		return errors.New("batch has no items")
+	}
+	if len(items) > maxItems {
+		return errors.New("batch exceeds " + strconv.Itoa(maxItems) + " items")
+	}
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if item.ID == "" || item.Method == "" || len(item.Path) == 0 || item.Path[0] != '/' {
+			return errors.New("item " + strconv.Itoa(i) + ": id, method and a path starting with '/' are required")
+		}
+		if rawPath, _, _ := strings.Cut(item.Path, "?"); !isCanonical(rawPath) {
+			return errors.New("item " + strconv.Itoa(i) + ": " + canonpath.ErrNotCanonical.Error())
+		}
+		if seen[item.ID] {
+			return errors.New("item " + strconv.Itoa(i) + ": duplicate id " + item.ID)
+		}
+		seen[item.ID] = true
+	}
+	return nil
+}
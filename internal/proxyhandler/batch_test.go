@@ -0,0 +1,151 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestBatchHandler(t *testing.T) {
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Request authorization.RequestInfo `json:"request"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		allow := payload.Request.Method == "GET" || string(payload.Request.Body) == `{"amount":1}`
+		_ = json.NewEncoder(w).Encode(map[string]any{"allow": allow, "reason": "no writes"})
+	}))
+	defer pdp.Close()
+
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{BatchAuthz: &ingressconfig.BatchAuthzConfig{Enabled: true, MaxItems: 3}})
+	authorization.SetConfigForTest(&authorization.Config{
+		Coarse: authorization.CoarseConfig{Enabled: true, ValidationURL: pdp.URL, ResourceMap: map[string]authorization.CoarseResource{"[/**]": {Resource: "/res"}}},
+	})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		authorization.SetConfigForTest(nil)
+	})
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-batch", &priv.PublicKey)
+	token := makeRSAToken(t, "kid-batch", priv, jwt.MapClaims{"user_id": "u1"})
+
+	app := fiber.New()
+	app.Post(ingressconfig.DefaultBatchAuthzPath, BatchHandler)
+	send := func(body, authorization string) *http.Response {
+		req := httptest.NewRequest("POST", ingressconfig.DefaultBatchAuthzPath, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if authorization != "" {
+			req.Header.Set(fiber.HeaderAuthorization, authorization)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := send(`{"items":[
+		{"id":"view","method":"get","path":"/orders/1"},
+		{"id":"edit","method":"PUT","path":"/orders/1"},
+		{"id":"pay","method":"POST","path":"/payments","body":{"amount":1}}]}`, "Bearer "+token)
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var out struct {
+		Decisions map[string]batchDecision `json:"decisions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]batchDecision{"view": {Allow: true}, "edit": {Reason: "no writes"}, "pay": {Allow: true}}
+	for id, d := range want {
+		if out.Decisions[id] != d {
+			t.Errorf("%s: expected %+v, got %+v", id, d, out.Decisions[id])
+		}
+	}
+
+	if resp := send(`{"items":[{"id":"a","method":"GET","path":"/a"}]}`, ""); resp.StatusCode != 401 {
+		t.Errorf("expected 401 without a token, got %d", resp.StatusCode)
+	}
+	tooMany := `{"items":[{"id":"a","method":"GET","path":"/a"},{"id":"b","method":"GET","path":"/b"},{"id":"c","method":"GET","path":"/c"},{"id":"d","method":"GET","path":"/d"}]}`
+	for _, body := range []string{tooMany, `{"items":[]}`, `{"items":[{"id":"a","method":"GET","path":"a"}]}`, `{"items":[{"id":"a","method":"GET","path":"/a"},{"id":"a","method":"GET","path":"/b"}]}`} {
+		if resp := send(body, "Bearer "+token); resp.StatusCode != 400 {
+			t.Errorf("expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestBatchHandler_StepUpAndRateLimit(t *testing.T) {
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"allow": true})
+	}))
+	defer pdp.Close()
+
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		BatchAuthz: &ingressconfig.BatchAuthzConfig{Enabled: true},
+		RateLimit:  &ingressconfig.RateLimit{Requests: 1, Window: time.Hour},
+		Routes:     []ingressconfig.Route{{PathPrefix: "/transfers", StepUp: &ingressconfig.StepUp{ACR: "gold"}}},
+	})
+	authorization.SetConfigForTest(&authorization.Config{
+		Coarse: authorization.CoarseConfig{Enabled: true, ValidationURL: pdp.URL, ResourceMap: map[string]authorization.CoarseResource{"[/**]": {Resource: "/res"}}},
+	})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		authorization.SetConfigForTest(nil)
+	})
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-batch-stepup", &priv.PublicKey)
+	token := makeRSAToken(t, "kid-batch-stepup", priv, jwt.MapClaims{"user_id": "u-batch-stepup", "acr": "silver"})
+
+	app := fiber.New()
+	app.Post(ingressconfig.DefaultBatchAuthzPath, BatchHandler)
+	send := func() *http.Response {
+		body := `{"items":[{"id":"view","method":"GET","path":"/orders/1"},{"id":"move","method":"POST","path":"/transfers?x=1"}]}`
+		req := httptest.NewRequest("POST", ingressconfig.DefaultBatchAuthzPath, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := send()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var out struct {
+		Decisions map[string]batchDecision `json:"decisions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Decisions["view"] != (batchDecision{Allow: true}) || out.Decisions["move"] != (batchDecision{Reason: errStepUpRequired}) {
+		t.Fatalf("expected the step-up route to be refused, got %+v", out.Decisions)
+	}
+
+	if resp := send(); resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("expected the second batch to spend the rate limit, got %d", resp.StatusCode)
+	}
+}
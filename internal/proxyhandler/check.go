@@ -0,0 +1,51 @@
+package proxyhandler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/tracing"
+)
+
+// Check authenticates and authorizes the request without proxying it, for external authorization
+// callers such as Envoy. An allowed request gets an empty 200 and its headers carry the principal
+// headers and the route's token mode, ready to be forwarded by the caller.
+func Check(c fiber.Ctx) (err error) {
+	start := time.Now()
+	ctx, span := tracing.StartServerSpan(c, "check "+c.Method())
+	decision := "unauthenticated"
+	defer func() { observe(ctx, c, span, "check request", start, decision, err) }()
+
+	principal, public, decision, steps, err := admit(ctx, c)
+	if err != nil {
+		return err
+	}
+	// the caller proxies the request, so the upstream response never passes through here
+	if err := unfulfillable(steps, "here"); err != nil {
+		decision = "denied"
+		return err
+	}
+	if err := applyTargetToken(ctx, c, checkTarget(c), principal, public); err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// checkTarget returns the token mode of the matched route; unlike resolveTarget it needs no
+// upstream, since the caller does the routing
+func checkTarget(c fiber.Ctx) ingressconfig.Target {
+	target := ingressconfig.Target{TokenMode: ingressconfig.TokenRelay}
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return target
+	}
+	if r, ok := conf.MatchRoute(c.Hostname(), c.Path()); ok {
+		if r.Token != "" {
+			target.TokenMode = r.Token
+		}
+		target.TokenAudience = r.TokenAudience
+	}
+	return target
+}
@@ -0,0 +1,25 @@
+package proxyhandler
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/cors"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// CORS answers preflights for the allowed origins without authenticating them, and adds CORS
+// headers to the other requests of those origins, proxied or refused
+func CORS(conf ingressconfig.CORSConfig) fiber.Handler {
+	maxAge := int(conf.MaxAge.Seconds())
+	if conf.MaxAge > 0 && maxAge == 0 {
+		maxAge = 1
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     conf.AllowOrigins,
+		AllowMethods:     conf.AllowMethods,
+		AllowHeaders:     conf.AllowHeaders,
+		ExposeHeaders:    conf.ExposeHeaders,
+		AllowCredentials: conf.AllowCredentials,
+		MaxAge:           maxAge,
+	})
+}
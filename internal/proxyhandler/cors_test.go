@@ -0,0 +1,72 @@
+package proxyhandler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestCORS(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New()
+	app.Use(CORS(ingressconfig.CORSConfig{
+		Enabled:          true,
+		AllowOrigins:     []string{"https://app.example.com"},
+		AllowMethods:     []string{"GET", "POST"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	app.All("/*", Handler)
+
+	// a preflight carries no token and is answered before authentication
+	req := httptest.NewRequest("OPTIONS", "/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("expected 204 for the preflight, got %d", resp.StatusCode)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Authorization",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := resp.Header.Get(header); got != want {
+			t.Errorf("%s: expected %q, got %q", header, want, got)
+		}
+	}
+
+	// other requests are still authenticated, and the refusal stays readable by the page
+	req = httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Fatalf("expected a 401 with CORS headers, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// other origins get no CORS headers
+	req = httptest.NewRequest("OPTIONS", "/orders", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	if resp, err = app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Fatalf("expected no Access-Control-Allow-Origin for another origin, got %q", got)
+	}
+}
@@ -0,0 +1,25 @@
+package proxyhandler
+
+import (
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// SecurityHeaders sets the configured security-headers on every ingress response once the rest of
+// the chain has run, so they override the upstream's and also cover responses the sidecar refuses
+func SecurityHeaders(c fiber.Ctx) error {
+	err := c.Next()
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return err
+	}
+	for name, value := range conf.SecurityHeaders {
+		if value == "" {
+			c.Response().Header.Del(name)
+		} else {
+			c.Set(name, value)
+		}
+	}
+	return err
+}
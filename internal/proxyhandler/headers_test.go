@@ -0,0 +1,52 @@
+package proxyhandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "ALLOWALL")
+		w.Header().Set("X-Powered-By", "legacy")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: upstream.URL,
+		PublicPaths:     []string{"/public/**"},
+		SecurityHeaders: map[string]string{
+			"Strict-Transport-Security": "max-age=31536000",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"X-Powered-By":              "",
+		},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New()
+	app.Use(SecurityHeaders)
+	app.All("/*", Handler)
+
+	for path, status := range map[string]int{"/public/page": fiber.StatusOK, "/private": fiber.StatusUnauthorized} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("%s: expected %d, got %d", path, status, resp.StatusCode)
+		}
+		if resp.Header.Get("X-Frame-Options") != "DENY" || resp.Header.Get("X-Content-Type-Options") != "nosniff" ||
+			resp.Header.Get("Strict-Transport-Security") != "max-age=31536000" {
+			t.Errorf("%s: expected the security headers, got %v", path, resp.Header)
+		}
+		if resp.Header.Get("X-Powered-By") != "" {
+			t.Errorf("%s: expected an empty value to remove the header", path)
+		}
+	}
+}
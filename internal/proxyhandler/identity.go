@@ -0,0 +1,99 @@
+package proxyhandler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/tokenexchange"
+	"reverseProxy/internal/tracing"
+)
+
+// applyPrincipalHeaders replaces any client-supplied identity headers with the authenticated principal.
+// For anonymous requests the headers are only removed.
+func applyPrincipalHeaders(c fiber.Ctx, principal jwtauth.Principal) error {
+	_, authenticated := c.Locals("Principal").(jwtauth.Principal)
+	if header, ok := assertion.Enabled(); ok {
+		c.Request().Header.Del(header)
+		if authenticated {
+			signed, err := assertion.Mint(principal)
+			if err != nil {
+				return fiber.NewError(fiber.StatusInternalServerError, "failed to sign identity assertion")
+			}
+			c.Request().Header.Set(header, signed)
+		}
+	}
+
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil || conf.PrincipalHeaders == nil {
+		return nil
+	}
+	h := *conf.PrincipalHeaders
+	headers := &c.Request().Header
+
+	setOrDelete := func(name, value string) {
+		headers.Del(name)
+		if value != "" {
+			headers.Set(name, value)
+		}
+	}
+	setOrDelete(h.UserIDHeader(), principal.UserID)
+	setOrDelete(h.UsernameHeader(), principal.Username)
+	setOrDelete(h.EmailHeader(), principal.Email)
+
+	if h.Claims != "" {
+		headers.Del(h.Claims)
+		if claims, ok := c.Locals("Claims").(jwt.MapClaims); ok {
+			if b, err := json.Marshal(claims); err == nil {
+				headers.Set(h.Claims, base64.StdEncoding.EncodeToString(b))
+			}
+		}
+	}
+	return nil
+}
+
+// applyTokenMode rewrites the Authorization header sent upstream according to the route's token mode
+func applyTokenMode(ctx context.Context, c fiber.Ctx, target ingressconfig.Target, principal jwtauth.Principal) error {
+	switch target.TokenMode {
+	case ingressconfig.TokenStrip:
+		c.Request().Header.Del(fiber.HeaderAuthorization)
+	case ingressconfig.TokenAssertion:
+		signed, err := assertion.Mint(principal)
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to sign identity assertion")
+		}
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+signed)
+	case ingressconfig.TokenExchange:
+		// only a validated token can be exchanged; callers authenticated otherwise have none
+		subjectToken, _ := c.Locals("Token").(string)
+		if subjectToken == "" {
+			return fiber.NewError(fiber.StatusUnauthorized, "Token exchange requires a bearer token")
+		}
+		ctx, span := tracing.Tracer().Start(ctx, "token.exchange")
+		exchanged, err := tokenexchange.Exchange(ctx, subjectToken, target.TokenAudience, tokenExpiry(c))
+		tracing.End(span, err)
+		if err != nil {
+			slog.WarnContext(ctx, "token exchange failed", slog.Any("error", err))
+			return fiber.NewError(fiber.StatusBadGateway, "Token exchange failed")
+		}
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+exchanged)
+	}
+	return nil
+}
+
+// tokenExpiry returns the exp of the validated token, or zero when it has none
+func tokenExpiry(c fiber.Ctx) time.Time {
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		return exp.Time
+	}
+	return time.Time{}
+}
@@ -0,0 +1,264 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/tokenexchange"
+)
+
+func TestHandler_PrincipalHeadersReplaceClientValues(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream:  "http://default.internal",
+		PrincipalHeaders: &ingressconfig.PrincipalHeaders{Claims: "X-User-Claims"},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	upstream := map[string]string{}
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		for _, h := range []string{"X-User-Id", "X-User-Name", "X-User-Email", "X-User-Claims"} {
+			upstream[h] = c.Get(h)
+		}
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-headers", &priv.PublicKey)
+	token := makeRSAToken(t, "kid-headers", priv, jwt.MapClaims{"user_id": "u1", "username": "alice"})
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-User-Id", "admin")
+	req.Header.Set("X-User-Email", "spoofed@example.com")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	if upstream["X-User-Id"] != "u1" || upstream["X-User-Name"] != "alice" {
+		t.Fatalf("expected principal headers, got %v", upstream)
+	}
+	if upstream["X-User-Email"] != "" {
+		t.Fatalf("client-supplied email header must be stripped, got %q", upstream["X-User-Email"])
+	}
+	raw, err := base64.StdEncoding.DecodeString(upstream["X-User-Claims"])
+	if err != nil {
+		t.Fatalf("claims header: %v", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(raw, &claims); err != nil || claims["username"] != "alice" {
+		t.Fatalf("unexpected claims %s (%v)", raw, err)
+	}
+}
+
+func TestHandler_IdentityAssertionHeader(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	if err := assertion.Configure(&assertion.Config{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = assertion.Configure(nil)
+	})
+
+	var forwarded string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		forwarded = c.Get(assertion.DefaultHeader)
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-assertion", &priv.PublicKey)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-assertion", priv, jwt.MapClaims{"user_id": "u9"}))
+	req.Header.Set(assertion.DefaultHeader, "forged")
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(forwarded, claims); err != nil {
+		t.Fatalf("expected a minted assertion, got %q: %v", forwarded, err)
+	}
+	if claims["sub"] != "u9" {
+		t.Fatalf("unexpected assertion claims %v", claims)
+	}
+}
+
+func TestHandler_RouteTokenModes(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes: []ingressconfig.Route{
+			{PathPrefix: "/strip", Token: ingressconfig.TokenStrip},
+			{PathPrefix: "/assert", Token: ingressconfig.TokenAssertion},
+		},
+	})
+	if err := assertion.Configure(&assertion.Config{Enabled: true, Header: "X-Identity"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = assertion.Configure(nil)
+	})
+
+	var forwarded string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		forwarded = c.Get(fiber.HeaderAuthorization)
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-modes", &priv.PublicKey)
+	bearer := "Bearer " + makeRSAToken(t, "kid-modes", priv, jwt.MapClaims{"user_id": "u5"})
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(path string) string {
+		forwarded = "unset"
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", bearer)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("%s: unexpected response %v %v", path, resp, err)
+		}
+		return forwarded
+	}
+
+	if got := send("/relay"); got != bearer {
+		t.Errorf("relay: expected original bearer, got %q", got)
+	}
+	if got := send("/strip"); got != "" {
+		t.Errorf("strip: expected no Authorization header, got %q", got)
+	}
+	got := send("/assert")
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(got[len("Bearer "):], claims); err != nil || claims["sub"] != "u5" || got == bearer {
+		t.Errorf("assertion: expected minted bearer, got %q (%v)", got, err)
+	}
+}
+
+func TestHandler_RouteTokenExchange(t *testing.T) {
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("audience") != "orders" || strings.HasPrefix(r.PostForm.Get("subject_token"), "Bearer ") {
+			http.Error(w, "bad audience", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "orders-token", "expires_in": 60})
+	}))
+	defer idp.Close()
+
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes:          []ingressconfig.Route{{PathPrefix: "/orders", Token: ingressconfig.TokenExchange, TokenAudience: "orders"}},
+	})
+	if err := tokenexchange.Configure(&tokenexchange.Config{Enabled: true, TokenEndpoint: idp.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = tokenexchange.Configure(nil)
+	})
+
+	var forwarded string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		forwarded = c.Get(fiber.HeaderAuthorization)
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-exchange", &priv.PublicKey)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/orders/1", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-exchange", priv, jwt.MapClaims{"user_id": "u6"}))
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("unexpected response %v %v", resp, err)
+	}
+	if forwarded != "Bearer orders-token" {
+		t.Errorf("expected the exchanged token upstream, got %q", forwarded)
+	}
+}
+
+func TestApplyTokenMode_ExchangesTheValidatedToken(t *testing.T) {
+	var subjects []string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		subjects = append(subjects, r.PostForm.Get("subject_token"))
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "orders-token", "expires_in": 60})
+	}))
+	defer idp.Close()
+	if err := tokenexchange.Configure(&tokenexchange.Config{Enabled: true, TokenEndpoint: idp.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tokenexchange.Configure(nil) })
+
+	target := ingressconfig.Target{TokenMode: ingressconfig.TokenExchange, TokenAudience: "orders"}
+	app := fiber.New()
+	app.All("/*", func(c fiber.Ctx) error {
+		// a DPoP-bound token validated by jwtAuthenticate; mTLS and API key callers store none
+		if token := c.Get("X-Validated"); token != "" {
+			c.Locals("Token", token)
+		}
+		if err := applyTokenMode(c.Context(), c, target, jwtauth.Principal{UserID: "u6"}); err != nil {
+			return err
+		}
+		return c.SendString(c.Get(fiber.HeaderAuthorization))
+	})
+	send := func(authorization, validated string) *http.Response {
+		req := httptest.NewRequest("GET", "/orders/1", nil)
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+		req.Header.Set("X-Validated", validated)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("DPoP bound-token", "bound-token"); resp.StatusCode != 200 || len(subjects) != 1 || subjects[0] != "bound-token" {
+		t.Fatalf("expected the token without its DPoP scheme as the subject, got %d %q", resp.StatusCode, subjects)
+	}
+	if resp := send("", ""); resp.StatusCode != fiber.StatusUnauthorized || len(subjects) != 1 {
+		t.Fatalf("expected the exchange to be refused without a validated token, got %d after %d exchanges", resp.StatusCode, len(subjects))
+	}
+}
@@ -0,0 +1,32 @@
+package proxyhandler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/tracing"
+)
+
+// Middleware runs the admission pipeline of Handler (authentication, rate limits, authorization and
+// obligations) in front of the handlers that follow it, for services embedding the sidecar in-process.
+// Response obligations are applied to whatever the next handlers write.
+func Middleware(c fiber.Ctx) (err error) {
+	start := time.Now()
+	ctx, span := tracing.StartServerSpan(c, "embedded "+c.Method())
+	decision := "unauthenticated"
+	defer func() { observe(ctx, c, span, "embedded request", start, decision, err) }()
+
+	principal, public, decision, steps, err := admit(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := applyTargetToken(ctx, c, checkTarget(c), principal, public); err != nil {
+		return err
+	}
+	c.SetContext(ctx)
+	if err := c.Next(); err != nil {
+		return err
+	}
+	return applyResponseObligations(ctx, c, steps)
+}
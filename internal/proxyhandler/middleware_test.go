@@ -0,0 +1,49 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestMiddleware_AdmitsBeforeNextHandler(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-embedded", &priv.PublicKey)
+	token := makeRSAToken(t, "kid-embedded", priv, jwt.MapClaims{"user_id": "u1", "username": "alice"})
+
+	reached := 0
+	app := fiber.New()
+	app.Use(Middleware)
+	app.Get("/orders", func(c fiber.Ctx) error {
+		reached++
+		p, _ := c.Locals("Principal").(jwtauth.Principal)
+		return c.SendString(p.UserID)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/orders", nil), fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized || reached != 0 {
+		t.Fatalf("expected 401 before the handler without a token, got %d (handler reached %d times)", resp.StatusCode, reached)
+	}
+
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || reached != 1 {
+		t.Fatalf("expected the handler to answer 200, got %d (handler reached %d times)", resp.StatusCode, reached)
+	}
+}
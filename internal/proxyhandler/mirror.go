@@ -0,0 +1,62 @@
+package proxyhandler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// mirrorClient sends mirrored requests; their responses are read and discarded
+var mirrorClient = &fasthttp.Client{
+	NoDefaultUserAgentHeader: true,
+	DisablePathNormalizing:   true,
+}
+
+// mirrorSlots caps the mirrored requests in flight, so a slow mirror cannot pile up goroutines;
+// requests beyond it are not mirrored
+var mirrorSlots = make(chan struct{}, 64)
+
+// mirror sends a copy of the admitted request to the target's mirror upstream in the background,
+// for the configured share of requests
+func mirror(ctx context.Context, c fiber.Ctx, target ingressconfig.Target) {
+	m := target.Mirror
+	if m == nil || rand.IntN(100) >= m.Percent {
+		return
+	}
+	select {
+	case mirrorSlots <- struct{}{}:
+	default:
+		metrics.IngressMirrored.WithLabelValues(target.Route, "dropped").Inc()
+		return
+	}
+	req := fasthttp.AcquireRequest()
+	c.Request().CopyTo(req)
+	url := strings.TrimSuffix(m.Upstream, "/") + canonpath.Escape(target.Path)
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		url += "?" + string(query)
+	}
+	req.SetRequestURI(url)
+	req.Header.Del(fiber.HeaderConnection)
+	// the mirror must not outlive nor be cancelled with the client request
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-mirrorSlots }()
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+		defer fasthttp.ReleaseRequest(req)
+		result := "sent"
+		if err := mirrorClient.DoTimeout(req, resp, m.TimeoutOrDefault()); err != nil {
+			result = "error"
+			slog.DebugContext(ctx, "mirrored request failed", slog.String("route", target.Route), slog.Any("error", err))
+		}
+		metrics.IngressMirrored.WithLabelValues(target.Route, result).Inc()
+	}()
+}
@@ -0,0 +1,58 @@
+package proxyhandler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestMirror_SendsCopyInBackground(t *testing.T) {
+	type seen struct{ path, body, auth string }
+	mirrored := make(chan seen, 4)
+	next := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mirrored <- seen{r.URL.RequestURI(), string(b), r.Header.Get("Authorization")}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer next.Close()
+
+	app := fiber.New()
+	app.Post("/*", func(c fiber.Ctx) error {
+		target := ingressconfig.Target{Route: "mirror", Path: "/v2/orders", Mirror: &ingressconfig.Mirror{Upstream: next.URL + "/", Percent: 100}}
+		mirror(context.Background(), c, target)
+		target.Mirror = &ingressconfig.Mirror{Upstream: next.URL, Percent: 0}
+		mirror(context.Background(), c, target)
+		return c.SendString("primary")
+	})
+	req := httptest.NewRequest("POST", "/orders?id=7", strings.NewReader(`{"qty":1}`))
+	req.Header.Set("Authorization", "Bearer t")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(resp.Body); string(b) != "primary" {
+		t.Fatalf("expected the primary response, got %q", b)
+	}
+
+	select {
+	case got := <-mirrored:
+		if got.path != "/v2/orders?id=7" || got.body != `{"qty":1}` || got.auth != "Bearer t" {
+			t.Fatalf("unexpected mirrored request %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the request to be mirrored")
+	}
+	select {
+	case got := <-mirrored:
+		t.Fatalf("expected percent 0 not to mirror, got %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
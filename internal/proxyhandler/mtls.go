@@ -0,0 +1,69 @@
+package proxyhandler
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// peerCertificate returns the client certificate verified during the TLS handshake, or nil.
+// It is a variable so tests can stub the TLS connection state.
+var peerCertificate = func(c fiber.Ctx) *x509.Certificate {
+	state := c.RequestCtx().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// certificateAuthenticate builds the principal from the verified client certificate
+func certificateAuthenticate(c fiber.Ctx) (error, bool) {
+	cert := peerCertificate(c)
+	if cert == nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing or unverified client certificate"), true
+	}
+	principal, claims := certificatePrincipal(cert)
+	c.Locals("Principal", principal)
+	c.Locals("Claims", claims)
+	return nil, false
+}
+
+// certificatePrincipal maps a client certificate to a principal. The user ID is the first URI SAN
+// (e.g. a SPIFFE ID), falling back to the subject common name; the email is the first email SAN.
+func certificatePrincipal(cert *x509.Certificate) (jwtauth.Principal, jwt.MapClaims) {
+	p := jwtauth.Principal{UserID: cert.Subject.CommonName, Username: cert.Subject.CommonName}
+	if len(cert.URIs) > 0 {
+		p.UserID = cert.URIs[0].String()
+	}
+	if len(cert.EmailAddresses) > 0 {
+		p.Email = cert.EmailAddresses[0]
+	}
+
+	uris := make([]string, len(cert.URIs))
+	for i, u := range cert.URIs {
+		uris[i] = u.String()
+	}
+	thumbprint := sha256.Sum256(cert.Raw)
+	claims := jwt.MapClaims{
+		"sub":      p.UserID,
+		"subject":  cert.Subject.String(),
+		"issuer":   cert.Issuer.String(),
+		"serial":   cert.SerialNumber.String(),
+		"x5t#S256": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}
+	if len(uris) > 0 {
+		claims["san_uri"] = uris
+	}
+	if len(cert.DNSNames) > 0 {
+		claims["san_dns"] = cert.DNSNames
+	}
+	if len(cert.EmailAddresses) > 0 {
+		claims["san_email"] = cert.EmailAddresses
+	}
+	return p, claims
+}
@@ -0,0 +1,77 @@
+package proxyhandler
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestHandler_ClientCertificateAuthn(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes: []ingressconfig.Route{
+			{PathPrefix: "/mtls", Authn: ingressconfig.AuthnMTLS},
+			{PathPrefix: "/either", Authn: ingressconfig.AuthnEither},
+		},
+	})
+	spiffe, _ := url.Parse("spiffe://example.org/ns/default/sa/orders")
+	var cert *x509.Certificate
+	origPeerCertificate := peerCertificate
+	peerCertificate = func(c fiber.Ctx) *x509.Certificate { return cert }
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		peerCertificate = origPeerCertificate
+	})
+
+	var principal jwtauth.Principal
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		principal, _ = c.Locals("Principal").(jwtauth.Principal)
+		return nil
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	status := func(path, authorization string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("/mtls", ""); got != 401 {
+		t.Errorf("expected 401 without a client certificate, got %d", got)
+	}
+
+	cert = &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "orders"},
+		SerialNumber:   big.NewInt(7),
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"orders@example.org"},
+	}
+	if got := status("/mtls", ""); got != 200 || principal.UserID != spiffe.String() || principal.Username != "orders" || principal.Email != "orders@example.org" {
+		t.Errorf("expected certificate principal, got %d %+v", got, principal)
+	}
+	if got := status("/either", ""); got != 200 {
+		t.Errorf("expected either to accept the certificate, got %d", got)
+	}
+	if got := status("/either", "Bearer not-a-token"); got != 401 {
+		t.Errorf("expected either to validate a presented bearer token, got %d", got)
+	}
+	if got := status("/jwt-only", ""); got != 401 {
+		t.Errorf("expected jwt routes to ignore the certificate, got %d", got)
+	}
+}
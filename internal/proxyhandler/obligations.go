@@ -0,0 +1,267 @@
+package proxyhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ohler55/ojg/jp"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/logging"
+)
+
+// ObligationHandler fulfils one obligation type. Request runs before the request is proxied and
+// Response on the upstream response; either may be nil.
+type ObligationHandler struct {
+	Request  func(c fiber.Ctx, params map[string]any) error
+	Response func(c fiber.Ctx, params map[string]any) error
+}
+
+// obligationHandlers is the registry of supported obligation types
+var obligationHandlers = map[string]ObligationHandler{
+	// {"type": "add-request-header", "params": {"name": "X-Data-Scope", "value": "eu"}}
+	"add-request-header": {Request: addRequestHeader},
+	// {"type": "add-response-header", "params": {"name": "Cache-Control", "value": "no-store"}}
+	"add-response-header": {Response: addResponseHeader},
+	// {"type": "mask-response-fields", "params": {"fields": ["$.ssn", "$..password"]}}
+	"mask-response-fields": {Response: maskResponseFields},
+	// {"type": "filter-response", "params": {"allow": ["id", "items.name"], "mask": ["$.items[*].cost"]}}, also
+	// what a fine-grain response_filter becomes
+	authorization.ObligationFilterResponse: {Response: filterResponse},
+}
+
+// RegisterObligationHandler adds or replaces the handler of an obligation type; call it before serving requests
+func RegisterObligationHandler(obligationType string, h ObligationHandler) {
+	obligationHandlers[obligationType] = h
+}
+
+// responseStep is a response-phase obligation deferred until the upstream has answered
+type responseStep struct {
+	obligation authorization.Obligation
+	apply      func(c fiber.Ctx, params map[string]any) error
+}
+
+// applyObligations fulfils the request phase of the collected obligations and returns the response
+// phase. An obligation that has no handler or fails denies the request; advice is best effort.
+func applyObligations(ctx context.Context, c fiber.Ctx, obligations []authorization.Obligation) ([]responseStep, error) {
+	var steps []responseStep
+	for _, o := range obligations {
+		h, ok := obligationHandlers[o.Type]
+		if !ok {
+			if o.Advice {
+				continue
+			}
+			return nil, fiber.NewError(fiber.StatusForbidden, "unsupported obligation "+o.Type)
+		}
+		if h.Request != nil {
+			if err := h.Request(c, o.Params); err != nil {
+				if o.Advice {
+					logObligationError(ctx, c, o, err)
+					continue
+				}
+				return nil, fiber.NewError(fiber.StatusForbidden, "obligation "+o.Type+" could not be fulfilled")
+			}
+		}
+		if h.Response != nil {
+			steps = append(steps, responseStep{obligation: o, apply: h.Response})
+		}
+	}
+	return steps, nil
+}
+
+// applyResponseObligations runs the response phase; the upstream response is withheld when an obligation fails
+func applyResponseObligations(ctx context.Context, c fiber.Ctx, steps []responseStep) error {
+	for _, step := range steps {
+		if err := step.apply(c, step.obligation.Params); err != nil {
+			logObligationError(ctx, c, step.obligation, err)
+			if step.obligation.Advice {
+				continue
+			}
+			c.Response().Reset()
+			return fiber.NewError(fiber.StatusBadGateway, "obligation "+step.obligation.Type+" could not be fulfilled")
+		}
+	}
+	return nil
+}
+
+func logObligationError(ctx context.Context, c fiber.Ctx, o authorization.Obligation, err error) {
+	slog.WarnContext(ctx, "obligation failed",
+		slog.String("request_id", logging.RequestIDFrom(c)),
+		slog.String("type", o.Type),
+		slog.Bool("advice", o.Advice),
+		slog.Any("error", err))
+}
+
+func addRequestHeader(c fiber.Ctx, params map[string]any) error {
+	name, value, err := headerParams(params)
+	if err != nil {
+		return err
+	}
+	c.Request().Header.Set(name, value)
+	return nil
+}
+
+func addResponseHeader(c fiber.Ctx, params map[string]any) error {
+	name, value, err := headerParams(params)
+	if err != nil {
+		return err
+	}
+	c.Set(name, value)
+	return nil
+}
+
+func headerParams(params map[string]any) (name, value string, err error) {
+	name, _ = params["name"].(string)
+	value, _ = params["value"].(string)
+	if name == "" {
+		return "", "", errors.New("params.name is required")
+	}
+	return name, value, nil
+}
+
+// maskResponseFields removes the JSONPaths in params.fields from a JSON response body
+func maskResponseFields(c fiber.Ctx, params map[string]any) error {
+	raw, _ := params["fields"].([]any)
+	if len(raw) == 0 {
+		return errors.New("params.fields is required")
+	}
+	exprs, err := parseMask(raw)
+	if err != nil {
+		return err
+	}
+	return rewriteJSONResponse(c, func(doc any) (any, error) { return removePaths(doc, exprs) })
+}
+
+// filterResponse keeps the dotted field paths in params.allow, then removes the JSONPaths in params.mask
+func filterResponse(c fiber.Ctx, params map[string]any) error {
+	allow, _ := params["allow"].([]any)
+	mask, _ := params["mask"].([]any)
+	if len(allow) == 0 && len(mask) == 0 {
+		return errors.New("params.allow or params.mask is required")
+	}
+	exprs, err := parseMask(mask)
+	if err != nil {
+		return err
+	}
+	var keep [][]string
+	for _, a := range allow {
+		field, _ := a.(string)
+		if field == "" {
+			return errors.New("params.allow entries must be field paths")
+		}
+		keep = append(keep, strings.Split(strings.TrimPrefix(field, "$."), "."))
+	}
+	return rewriteJSONResponse(c, func(doc any) (any, error) {
+		if len(keep) > 0 {
+			doc = keepFields(doc, keep)
+		}
+		return removePaths(doc, exprs)
+	})
+}
+
+// parseMask parses JSONPaths, accepting plain field names as $.<name>
+func parseMask(raw []any) ([]jp.Expr, error) {
+	exprs := make([]jp.Expr, 0, len(raw))
+	for _, f := range raw {
+		field, _ := f.(string)
+		if !strings.HasPrefix(field, "$") {
+			field = "$." + field
+		}
+		x, err := jp.ParseString(field)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		exprs = append(exprs, x)
+	}
+	return exprs, nil
+}
+
+// removePaths deletes every match of the expressions from doc
+func removePaths(doc any, exprs []jp.Expr) (any, error) {
+	for _, x := range exprs {
+		// remove each match through its normalized path, since wildcards and descent cannot be removed
+		// directly; last first, so earlier array indices stay valid
+		locations := x.Locate(doc, 0)
+		for i := len(locations) - 1; i >= 0; i-- {
+			var err error
+			if doc, err = locations[i].Remove(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return doc, nil
+}
+
+// keepFields returns doc with only the given field paths; arrays are filtered item by item
+func keepFields(doc any, paths [][]string) any {
+	switch v := doc.(type) {
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = keepFields(item, paths)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any)
+		for key, value := range v {
+			var rest [][]string
+			whole := false
+			for _, p := range paths {
+				if p[0] != key {
+					continue
+				}
+				if len(p) == 1 {
+					whole = true
+					break
+				}
+				rest = append(rest, p[1:])
+			}
+			switch {
+			case whole:
+				out[key] = value
+			case rest != nil:
+				if kept := keepFields(value, rest); kept != nil {
+					out[key] = kept
+				}
+			}
+		}
+		return out
+	default:
+		// a path continuing past a scalar keeps nothing of it
+		return nil
+	}
+}
+
+// rewriteJSONResponse replaces a JSON response body with the result of edit; an empty body is left
+// alone. A compressed body is decoded and sent back uncompressed.
+func rewriteJSONResponse(c fiber.Ctx, edit func(doc any) (any, error)) error {
+	if len(c.Response().Body()) == 0 {
+		return nil
+	}
+	if !isJSON(string(c.Response().Header.ContentType())) {
+		return errors.New("response is not JSON")
+	}
+	body, err := c.Response().BodyUncompressed()
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+	if doc, err = edit(doc); err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	c.Response().Header.Del(fiber.HeaderContentEncoding)
+	c.Response().SetBodyRaw(b)
+	return nil
+}
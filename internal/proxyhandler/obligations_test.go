@@ -0,0 +1,119 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestHandler_AppliesObligations(t *testing.T) {
+	var decision map[string]any
+	pdp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(decision)
+	}))
+	defer pdp.Close()
+
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://app.internal"})
+	authorization.SetConfigForTest(&authorization.Config{
+		Coarse: authorization.CoarseConfig{Enabled: true, ValidationURL: pdp.URL, ResourceMap: map[string]authorization.CoarseResource{"[/**]": {Resource: "/res"}}},
+	})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		authorization.SetConfigForTest(nil)
+	})
+
+	var scope string
+	proxied := false
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		proxied = true
+		scope = c.Get("X-Data-Scope")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.SendString(`{"name":"alice","ssn":"123","accounts":[{"id":"a1","password":"p"}]}`)
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-obl", &priv.PublicKey)
+	token := makeRSAToken(t, "kid-obl", priv, jwt.MapClaims{"user_id": "u1"})
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func() (*http.Response, string) {
+		req := httptest.NewRequest("GET", "/profile", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	decision = map[string]any{
+		"allow": true,
+		"obligations": []any{
+			map[string]any{"type": "add-request-header", "params": map[string]any{"name": "X-Data-Scope", "value": "eu"}},
+			map[string]any{"type": "add-response-header", "params": map[string]any{"name": "Cache-Control", "value": "no-store"}},
+			map[string]any{"type": "mask-response-fields", "params": map[string]any{"fields": []any{"ssn", "$..password"}}},
+		},
+		"advice": []any{map[string]any{"type": "unknown-advice"}},
+	}
+	resp, body := send()
+	if resp.StatusCode != 200 || scope != "eu" || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected obligations applied, got %d scope=%q cache-control=%q", resp.StatusCode, scope, resp.Header.Get("Cache-Control"))
+	}
+	if body != `{"accounts":[{"id":"a1"}],"name":"alice"}` {
+		t.Fatalf("expected masked body, got %s", body)
+	}
+
+	proxied = false
+	decision = map[string]any{"allow": true, "obligations": []any{map[string]any{"type": "encrypt-response"}}}
+	if resp, _ := send(); resp.StatusCode != fiber.StatusForbidden || proxied {
+		t.Fatalf("expected 403 without proxying for an unsupported obligation, got %d proxied=%v", resp.StatusCode, proxied)
+	}
+}
+
+func TestFilterResponse(t *testing.T) {
+	var params map[string]any
+	app := fiber.New()
+	app.Get("/", func(c fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if err := c.SendString(`{"id":1,"owner":{"name":"a","ssn":"x"},"items":[{"name":"n1","cost":3},{"name":"n2","cost":4}],"note":"n"}`); err != nil {
+			return err
+		}
+		return filterResponse(c, params)
+	})
+	run := func(p map[string]any) string {
+		params = p
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil), fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := run(map[string]any{"allow": []any{"id", "owner.name", "items.name", "note.text"}}); got != `{"id":1,"items":[{"name":"n1"},{"name":"n2"}],"owner":{"name":"a"}}` {
+		t.Errorf("unexpected allowlisted body %s", got)
+	}
+	if got := run(map[string]any{"mask": []any{"$.items[*].cost", "owner.ssn"}}); got != `{"id":1,"items":[{"name":"n1"},{"name":"n2"}],"note":"n","owner":{"name":"a"}}` {
+		t.Errorf("unexpected masked body %s", got)
+	}
+	if got := run(map[string]any{"allow": []any{"items"}, "mask": []any{"$..cost"}}); got != `{"items":[{"name":"n1"},{"name":"n2"}]}` {
+		t.Errorf("unexpected combined body %s", got)
+	}
+}
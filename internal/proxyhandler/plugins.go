@@ -0,0 +1,165 @@
+package proxyhandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/logging"
+	"reverseProxy/internal/plugins"
+)
+
+// pluginRequest is the plugins' view of the request, with path the upstream path
+func pluginRequest(c fiber.Ctx, path string) *plugins.Request {
+	header := http.Header{}
+	for k, v := range c.Request().Header.All() {
+		header.Add(string(k), string(v))
+	}
+	return &plugins.Request{
+		Method: c.Method(),
+		Host:   c.Hostname(),
+		Path:   path,
+		Query:  string(c.Request().URI().QueryString()),
+		Header: header,
+		Body:   c.Body(),
+	}
+}
+
+// pluginAuthenticate asks the plugin authenticators about the request; handled is false when
+// none recognises it, leaving it to the route's authentication mode
+func pluginAuthenticate(ctx context.Context, c fiber.Ctx) (err error, handled bool) {
+	authenticators := plugins.Authenticators()
+	if len(authenticators) == 0 {
+		return nil, false
+	}
+	req := pluginRequest(c, c.Path())
+	for _, a := range authenticators {
+		principal, err := a.Plugin.Authenticate(ctx, req)
+		if err != nil {
+			slog.InfoContext(ctx, "plugin refused credentials", slog.String("plugin", a.Name),
+				slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials"), true
+		}
+		if principal != nil {
+			c.Locals("Principal", *principal)
+			c.Locals("Claims", jwt.MapClaims{"sub": principal.UserID, "name": principal.Username})
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// pluginAuthorize asks the plugin authorizers once the built-in providers have allowed the request
+func pluginAuthorize(ctx context.Context, c fiber.Ctx, principal jwtauth.Principal) error {
+	authorizers := plugins.Authorizers()
+	if len(authorizers) == 0 {
+		return nil
+	}
+	req := pluginRequest(c, c.Path())
+	for _, a := range authorizers {
+		allow, reason, err := a.Plugin.Authorize(ctx, req, principal)
+		if err != nil {
+			slog.WarnContext(ctx, "plugin authorization error", slog.String("plugin", a.Name), slog.Any("error", err))
+		}
+		if denial := (authResult{stage: a.Name, allow: allow, reason: reason, err: err}).denial(); denial != nil {
+			return denial
+		}
+	}
+	return nil
+}
+
+// pluginFilterRequest runs the request filters and applies their changes, returning the upstream path
+func pluginFilterRequest(ctx context.Context, c fiber.Ctx, path string) (string, error) {
+	filters := plugins.RequestFilters()
+	if len(filters) == 0 {
+		return path, nil
+	}
+	req := pluginRequest(c, path)
+	for _, f := range filters {
+		if err := f.Plugin.FilterRequest(ctx, req); err != nil {
+			return path, pluginFailure(ctx, f.Name, err, fiber.StatusInternalServerError)
+		}
+	}
+	replaceHeaders(&c.Request().Header, req.Header)
+	if !bytes.Equal(req.Body, c.Body()) {
+		c.Request().SetBody(req.Body)
+	}
+	if req.Path == "" || req.Path[0] != '/' {
+		req.Path = "/" + req.Path
+	}
+	return req.Path, nil
+}
+
+// pluginFilterResponse runs the response filters on the upstream response and applies their changes
+func pluginFilterResponse(ctx context.Context, c fiber.Ctx, path string) error {
+	filters := plugins.ResponseFilters()
+	if len(filters) == 0 {
+		return nil
+	}
+	req := pluginRequest(c, path)
+	header := http.Header{}
+	for k, v := range c.Response().Header.All() {
+		header.Add(string(k), string(v))
+	}
+	body, err := c.Response().BodyUncompressed()
+	if err != nil {
+		return err
+	}
+	resp := &plugins.Response{Status: c.Response().StatusCode(), Header: header, Body: body}
+	for _, f := range filters {
+		if err := f.Plugin.FilterResponse(ctx, req, resp); err != nil {
+			c.Response().Reset()
+			return pluginFailure(ctx, f.Name, err, fiber.StatusBadGateway)
+		}
+	}
+	c.Response().Header.Del(fiber.HeaderContentEncoding)
+	replaceHeaders(&c.Response().Header, resp.Header)
+	c.Status(resp.Status)
+	c.Response().SetBody(resp.Body)
+	return nil
+}
+
+// headers is what fasthttp's request and response headers share
+type headers interface {
+	All() iter.Seq2[[]byte, []byte]
+	Del(key string)
+	Add(key, value string)
+}
+
+// replaceHeaders makes the headers equal to want, leaving the body framing to fasthttp
+func replaceHeaders(h headers, want http.Header) {
+	var names []string
+	for k := range h.All() {
+		names = append(names, string(k))
+	}
+	for _, name := range names {
+		if name != fiber.HeaderContentLength {
+			h.Del(name)
+		}
+	}
+	for name, values := range want {
+		if http.CanonicalHeaderKey(name) == fiber.HeaderContentLength {
+			continue
+		}
+		for _, v := range values {
+			h.Add(name, v)
+		}
+	}
+}
+
+// pluginFailure answers a filter's rejection with its status; other errors are logged and answered with status
+func pluginFailure(ctx context.Context, name string, err error, status int) error {
+	var reject *plugins.Reject
+	if errors.As(err, &reject) {
+		return fiber.NewError(reject.Status, reject.Message)
+	}
+	slog.WarnContext(ctx, "plugin filter failed", slog.String("plugin", name), slog.Any("error", err))
+	return fiber.NewError(status, "plugin "+name+" failed")
+}
@@ -0,0 +1,101 @@
+package proxyhandler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/plugins"
+)
+
+// acmeToken authenticates "Acme <user>" credentials and filters requests and responses
+type acmeToken struct{}
+
+func (acmeToken) Authenticate(_ context.Context, req *plugins.Request) (*jwtauth.Principal, error) {
+	user, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Acme ")
+	switch {
+	case !ok:
+		return nil, nil
+	case user == "":
+		return nil, errors.New("empty acme token")
+	}
+	return &jwtauth.Principal{UserID: user}, nil
+}
+
+func (acmeToken) FilterRequest(_ context.Context, req *plugins.Request) error {
+	if req.Header.Get("X-Block") != "" {
+		return &plugins.Reject{Status: fiber.StatusTeapot, Message: "blocked"}
+	}
+	req.Header.Del("X-Debug")
+	req.Path = "/filtered" + req.Path
+	return nil
+}
+
+func (acmeToken) FilterResponse(_ context.Context, _ *plugins.Request, resp *plugins.Response) error {
+	resp.Header.Set("X-Plugin", "acme")
+	resp.Body = []byte(strings.ToUpper(string(resp.Body)))
+	return nil
+}
+
+func TestPlugins(t *testing.T) {
+	if err := plugins.Register("acme", acmeToken{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(plugins.Reset)
+
+	app := fiber.New()
+	app.Get("/*", func(c fiber.Ctx) error {
+		if err, handled := pluginAuthenticate(context.Background(), c); handled {
+			if err != nil {
+				return err
+			}
+		} else {
+			return fiber.NewError(fiber.StatusUnauthorized, "not an acme token")
+		}
+		if p, _ := c.Locals("Principal").(jwtauth.Principal); p.UserID != "alice" {
+			t.Errorf("expected alice, got %+v", p)
+		}
+		path, err := pluginFilterRequest(context.Background(), c, c.Path())
+		if err != nil {
+			return err
+		}
+		if path != "/filtered/x" || c.Get("X-Debug") != "" {
+			t.Errorf("expected the filtered request, got %s debug=%q", path, c.Get("X-Debug"))
+		}
+		c.Set(fiber.HeaderContentType, "text/plain")
+		_ = c.SendString("upstream")
+		return pluginFilterResponse(context.Background(), c, path)
+	})
+	get := func(auth string, headers ...string) (int, string, string) {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Authorization", auth)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b), resp.Header.Get("X-Plugin")
+	}
+
+	if status, body, header := get("Acme alice", "X-Debug", "1"); status != 200 || body != "UPSTREAM" || header != "acme" {
+		t.Fatalf("expected the filtered response, got %d %q %q", status, body, header)
+	}
+	if status, _, _ := get("Bearer jwt"); status != 401 {
+		t.Fatalf("expected unrecognised credentials to fall through, got %d", status)
+	}
+	if status, _, _ := get("Acme "); status != 401 {
+		t.Fatalf("expected refused credentials to get 401, got %d", status)
+	}
+	if status, _, _ := get("Acme alice", "X-Block", "1"); status != fiber.StatusTeapot {
+		t.Fatalf("expected the filter's rejection, got %d", status)
+	}
+}
@@ -0,0 +1,113 @@
+package proxyhandler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/logging"
+)
+
+const mimeProblemJSON = "application/problem+json"
+
+// problem is an RFC 7807 problem details body, extended with a machine-readable code and the
+// request ID that correlates it with the sidecar's logs
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// denyError is a denial answered with a configured deny response; it unwraps to the *fiber.Error
+// carrying the response status and the denial reason
+type denyError struct {
+	err      *fiber.Error
+	check    string
+	response *authorization.DenyResponse
+}
+
+func (e *denyError) Error() string { return e.err.Error() }
+func (e *denyError) Unwrap() error { return e.err }
+
+// ErrorHandler writes the errors returned on the ingress listener: denials with a deny response
+// as configured, others in the configured error-responses format. Messages of errors that are not
+// *fiber.Error never reach the client, as they may carry internal details.
+func ErrorHandler(c fiber.Ctx, err error) error {
+	var de *denyError
+	if errors.As(err, &de) {
+		body, rerr := de.response.Render(authorization.DenyData{
+			Check: de.check, Reason: de.err.Message, RequestID: logging.RequestIDFrom(c), Method: c.Method(), Path: c.Path(),
+		})
+		if rerr == nil {
+			for name, value := range de.response.Headers {
+				c.Set(name, value)
+			}
+			c.Set(fiber.HeaderContentType, de.response.MediaType())
+			return c.Status(de.err.Code).Send(body)
+		}
+		slog.Warn("deny response template failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", rerr))
+	}
+	status, detail := fiber.StatusInternalServerError, ""
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status, detail = fe.Code, fe.Message
+	}
+	if detail == "" {
+		detail = http.StatusText(status)
+	}
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil || conf.ErrorResponses == nil || conf.ErrorResponses.Format != ingressconfig.ErrorFormatProblem {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.Status(status).SendString(detail)
+	}
+
+	code := problemCode(status)
+	p := problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.Path(),
+		Code:      code,
+		RequestID: logging.RequestIDFrom(c),
+	}
+	if base := conf.ErrorResponses.TypeBase; base != "" {
+		p.Type = base + code
+	}
+	return c.Status(status).JSON(p, mimeProblemJSON)
+}
+
+// problemCode names the class of failure, so clients can tell authentication, authorization and
+// upstream failures apart
+func problemCode(status int) string {
+	switch status {
+	case fiber.StatusUnauthorized:
+		return "unauthenticated"
+	case fiber.StatusForbidden:
+		return "access_denied"
+	case fiber.StatusNotFound:
+		return "not_found"
+	case fiber.StatusRequestEntityTooLarge:
+		return "payload_too_large"
+	case fiber.StatusTooManyRequests:
+		return "rate_limited"
+	case fiber.StatusBadGateway:
+		return "upstream_error"
+	case fiber.StatusServiceUnavailable:
+		return "unavailable"
+	case fiber.StatusGatewayTimeout:
+		return "upstream_timeout"
+	}
+	if status < 500 {
+		return "bad_request"
+	}
+	return "internal_error"
+}
@@ -0,0 +1,95 @@
+package proxyhandler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestErrorHandler_Problem(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		ErrorResponses: &ingressconfig.ErrorResponses{Format: ingressconfig.ErrorFormatProblem, TypeBase: "https://errors.example.com/"},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.All("/*", func(c fiber.Ctx) error {
+		if c.Path() == "/upstream" {
+			// nothing listens on port 1
+			return upstreamFailure(c.Context(), proxyUpstream(c, "http://127.0.0.1:1", 0))
+		}
+		return Handler(c)
+	})
+
+	for path, want := range map[string]problem{
+		"/orders":   {Type: "https://errors.example.com/unauthenticated", Status: 401, Code: "unauthenticated", Detail: "Missing or malformed token"},
+		"/upstream": {Type: "https://errors.example.com/upstream_error", Status: 502, Code: "upstream_error", Detail: "upstream unavailable"},
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-Request-ID", "req-1")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+			t.Fatalf("%s: expected application/problem+json, got %q", path, ct)
+		}
+		var got problem
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want.Status || got.Type != want.Type || got.Status != want.Status || got.Code != want.Code ||
+			got.Detail != want.Detail || got.RequestID != "req-1" || got.Instance != path || got.Title == "" {
+			t.Errorf("%s: unexpected problem %d %+v", path, resp.StatusCode, got)
+		}
+	}
+}
+
+func TestErrorHandler_Text(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/denied", func(fiber.Ctx) error { return fiber.NewError(fiber.StatusForbidden, "nope") })
+	app.Get("/internal", func(fiber.Ctx) error { return io.ErrUnexpectedEOF })
+
+	for path, want := range map[string]string{"/denied": "nope", "/internal": "Internal Server Error"} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != want || resp.Header.Get("Content-Type") != fiber.MIMETextPlainCharsetUTF8 {
+			t.Errorf("%s: expected the plain message %q, got %q (%s)", path, want, body, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestErrorHandler_DenyResponse(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		ErrorResponses: &ingressconfig.ErrorResponses{Format: ingressconfig.ErrorFormatProblem},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	deny := &authorization.DenyResponse{Status: fiber.StatusNotFound, ContentType: "text/plain", Body: "no such resource",
+		Headers: map[string]string{"Cache-Control": "no-store"}}
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/*", func(fiber.Ctx) error {
+		return authResult{stage: "coarse", reason: "coarse says no", deny: deny}.denial()
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/secret", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != fiber.StatusNotFound || string(body) != "no such resource" ||
+		resp.Header.Get("Content-Type") != "text/plain" || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the deny response instead of a problem, got %d %q %v", resp.StatusCode, body, resp.Header)
+	}
+}
@@ -1,140 +1,612 @@
 package proxyhandler
 
 import (
-    "encoding/base64"
-    "encoding/json"
-    "log"
-    "reverseProxy/internal/authorization"
-    "reverseProxy/internal/jwtauth"
-    "reverseProxy/internal/util"
-    "strings"
-
-    "github.com/gofiber/fiber/v3"
-    fiberproxy "github.com/gofiber/fiber/v3/middleware/proxy"
-    "github.com/golang-jwt/jwt/v5"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reverseProxy/internal/accesslog"
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/balancer"
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/logging"
+	"reverseProxy/internal/metrics"
+	"reverseProxy/internal/ratelimit"
+	"reverseProxy/internal/replay"
+	"reverseProxy/internal/revocation"
+	"reverseProxy/internal/tracing"
+	"reverseProxy/internal/transform"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	fiberproxy "github.com/gofiber/fiber/v3/middleware/proxy"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// doProxy is an indirection over proxy.Do to allow stubbing in tests
-var doProxy = func(c fiber.Ctx, url string) error { return fiberproxy.Do(c, url) }
+// upstreamClient streams response bodies instead of buffering them, so server-sent events and
+// long-lived chunked responses reach the client as the upstream writes them. Response obligations
+// that rewrite the body still read it whole.
+var upstreamClient = &fasthttp.Client{
+	NoDefaultUserAgentHeader: true,
+	DisablePathNormalizing:   true,
+	StreamResponseBody:       true,
+}
+
+// doProxy is an indirection over proxyUpstream to allow stubbing in tests
+var doProxy = proxyUpstream
+
+// proxyUpstream proxies the request with proxy.Do. A zero timeout means none; a timeout bounds the
+// wait for the response headers, not a streamed body.
+func proxyUpstream(c fiber.Ctx, url string, timeout time.Duration) error {
+	kept := middlewareHeaders(c)
+	var err error
+	if timeout > 0 {
+		err = fiberproxy.DoTimeout(c, url, timeout, upstreamClient)
+	} else {
+		err = fiberproxy.Do(c, url, upstreamClient)
+	}
+	restoreHeaders(c, kept)
+	return err
+}
+
+// restoreHeaders sets headers kept by middlewareHeaders back on the response
+func restoreHeaders(c fiber.Ctx, kept [][2]string) {
+	for _, h := range kept {
+		if h[0] == fiber.HeaderVary {
+			c.Response().Header.Add(h[0], h[1])
+		} else {
+			c.Response().Header.Set(h[0], h[1])
+		}
+	}
+}
+
+// middlewareHeaders returns the response headers set before proxying (CORS, rate limits), which
+// the upstream response replaces along with the rest of the response
+func middlewareHeaders(c fiber.Ctx) [][2]string {
+	var kept [][2]string
+	for k, v := range c.Response().Header.All() {
+		switch key := string(k); key {
+		case fiber.HeaderContentLength, fiber.HeaderContentType, fiber.HeaderContentEncoding, fiber.HeaderServer,
+			fiber.HeaderConnection, fiber.HeaderSetCookie, fiber.HeaderTrailer:
+		default:
+			kept = append(kept, [2]string{key, string(v)})
+		}
+	}
+	return kept
+}
+
+// upstreamFailure reports a failed upstream call as 504 when it timed out and 502 otherwise; the
+// transport error is logged rather than echoed to the client
+func upstreamFailure(ctx context.Context, err error) error {
+	var fe *fiber.Error
+	if err == nil || errors.As(err, &fe) {
+		return err
+	}
+	slog.WarnContext(ctx, "upstream request failed", slog.Any("error", err))
+	if errors.Is(err, fasthttp.ErrTimeout) {
+		return fiber.NewError(fiber.StatusGatewayTimeout, "upstream timed out")
+	}
+	return fiber.NewError(fiber.StatusBadGateway, "upstream unavailable")
+}
+
+// upstreamTimeout bounds the route timeout by the request context's deadline; fasthttp cannot
+// abandon a call in flight, so a request already cancelled is not proxied at all
+func upstreamTimeout(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	if ctx.Err() != nil {
+		return 0, fiber.ErrGatewayTimeout
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			timeout = max(remaining, time.Millisecond)
+		}
+	}
+	return timeout, nil
+}
+
+// Handler authenticates the caller (JWT or client certificate), sets principal, and proxies the request
+func Handler(c fiber.Ctx) (err error) {
+	start := time.Now()
+	ctx, span := tracing.StartServerSpan(c, "ingress "+c.Method())
+	decision := "unauthenticated"
+	defer func() { observe(ctx, c, span, "ingress request", start, decision, err) }()
+
+	var principal jwtauth.Principal
+	var public bool
+	var obligations []responseStep
+	principal, public, decision, obligations, err = admit(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	// Proxy the request to the upstream configured for this host and path
+	target, err := resolveTarget(c)
+	if err != nil {
+		return err
+	}
+	if err := applyTargetToken(ctx, c, target, principal, public); err != nil {
+		return err
+	}
+	if target.Split != nil {
+		// chosen once, so retries stay on the same version
+		target.Upstream = balancer.Split(target.Route, target.Split, principal.UserID)
+	}
+	scrubHeaders(c, target.RequestHeaders)
+	exchange := &transform.Exchange{Ctx: c, Path: target.Path, Principal: principal}
+	if err := transform.Request(exchange, target.Transforms...); err != nil {
+		return transformFailure(ctx, err, fiber.StatusInternalServerError)
+	}
+	if target.Path, err = pluginFilterRequest(ctx, c, exchange.Path); err != nil {
+		return err
+	}
+	upstreamCtx, upstreamSpan := tracing.Tracer().Start(ctx, "upstream.proxy", trace.WithSpanKind(trace.SpanKindClient))
+	tracing.InjectFiber(upstreamCtx, c)
+	if isWebSocket(c) {
+		// the sidecar never sees the tunnelled messages, so response obligations cannot be met
+		if err = unfulfillable(obligations, "on a WebSocket"); err != nil {
+			decision = "denied"
+		} else {
+			// an upgraded connection is never retried
+			target.Retry = nil
+			err = forward(ctx, c, target, upstreamSpan, func(url string, timeout time.Duration) error {
+				return tunnel(c, url, timeout)
+			})
+		}
+	} else {
+		mirror(upstreamCtx, c, target)
+		err = forward(ctx, c, target, upstreamSpan, func(url string, timeout time.Duration) error {
+			return upstreamFailure(ctx, doProxy(c, url, timeout))
+		})
+	}
+	if err == nil {
+		accesslog.SetUpstreamStatus(c, c.Response().StatusCode())
+	}
+	tracing.End(upstreamSpan, err)
+	if err != nil {
+		return err
+	}
+	if err := transform.Response(exchange, target.Transforms...); err != nil {
+		c.Response().Reset()
+		return transformFailure(ctx, err, fiber.StatusBadGateway)
+	}
+	if err := pluginFilterResponse(ctx, c, target.Path); err != nil {
+		return err
+	}
+	return applyResponseObligations(ctx, c, obligations)
+}
+
+// transformFailure reports a failed transform step: its own fiber error, else status with the
+// cause logged rather than echoed to the client
+func transformFailure(ctx context.Context, err error, status int) error {
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return err
+	}
+	slog.WarnContext(ctx, "transform failed", slog.Any("error", err))
+	return fiber.NewError(status, "transform could not be applied")
+}
 
-// Handler validates JWT, sets principal, and proxies the request
-func Handler(c fiber.Ctx) error {
-	// Extract the JWT token from the Authorization header
-	jwtError, isJwtError := jwtAuthenticate(c)
-	if isJwtError {
-		return jwtError
+// admit authenticates and authorizes the request, unless it matches a public path, spends the
+// client's rate limit, sets the principal headers and fulfils the request phase of the decision's
+// obligations, returning the response phase. decision is the outcome recorded in logs and the access log.
+func admit(ctx context.Context, c fiber.Ctx) (principal jwtauth.Principal, public bool, decision string, steps []responseStep, err error) {
+	// Every check below matches the decoded path, and a path the upstream could resolve elsewhere is refused
+	if err := canonpath.Apply(c); err != nil {
+		return principal, false, "bad-path", nil, err
 	}
 
-	// Run coarse and fine-grain authorization if configured
+	// Refuse oversized bodies before authentication, extraction or proxying reads them
+	if err := checkBodySize(c); err != nil {
+		return principal, false, "too-large", nil, err
+	}
+
+	// Public paths are proxied anonymously, without authentication or authorization
+	public = isPublic(c)
+	if public {
+		decision = "public"
+		if err := ratelimit.Check(c, principal); err != nil {
+			return principal, public, "rate-limited", nil, err
+		}
+	} else {
+		// Authenticate with the JWT from the Authorization header or the client certificate, per route
+		authnCtx, authnSpan := tracing.Tracer().Start(ctx, "authn.validate")
+		authnError, isAuthnError := authenticate(authnCtx, c)
+		tracing.End(authnSpan, authnError)
+		if isAuthnError {
+			return principal, public, "unauthenticated", nil, authnError
+		}
+		if err := checkStepUp(c); err != nil {
+			return principal, public, "step-up", nil, err
+		}
+		if err := selectTenant(c); err != nil {
+			return principal, public, "wrong-tenant", nil, err
+		}
+
+		// Spend the client's rate limit before asking the validation services
+		principal, _ = c.Locals("Principal").(jwtauth.Principal)
+		if err := ratelimit.Check(c, principal); err != nil {
+			return principal, public, "rate-limited", nil, err
+		}
+
+		// Run coarse and fine-grain authorization if configured, then any plugin authorizers
+		authzCtx := authorization.WithObligations(ctx)
+		if err := authorize(authzCtx, buildRequestInfo(c), principal); err != nil {
+			return principal, public, "denied", nil, err
+		}
+		if err := pluginAuthorize(authzCtx, c, principal); err != nil {
+			return principal, public, "denied", nil, err
+		}
+		if steps, err = applyObligations(ctx, c, authorization.Obligations(authzCtx)); err != nil {
+			return principal, public, "denied", nil, err
+		}
+		decision = "allowed"
+	}
+	return principal, public, decision, steps, applyPrincipalHeaders(c, principal)
+}
+
+// applyTargetToken applies the route's token mode; on public requests an unvalidated credential is
+// only passed through unchanged on relay routes
+func applyTargetToken(ctx context.Context, c fiber.Ctx, target ingressconfig.Target, principal jwtauth.Principal, public bool) error {
+	if !public {
+		return applyTokenMode(ctx, c, target, principal)
+	}
+	if target.TokenMode != ingressconfig.TokenRelay {
+		c.Request().Header.Del(fiber.HeaderAuthorization)
+	}
+	return nil
+}
+
+// observe logs the request and records its metrics and span attributes
+func observe(ctx context.Context, c fiber.Ctx, span trace.Span, msg string, start time.Time, decision string, err error) {
+	route := routeLabel(c)
+	status := metrics.StatusOf(c, err)
 	principal, _ := c.Locals("Principal").(jwtauth.Principal)
+	slog.InfoContext(ctx, msg,
+		slog.String("request_id", logging.RequestIDFrom(c)),
+		slog.String("method", c.Method()),
+		slog.String("path", c.Path()),
+		slog.String("route", route),
+		logging.Principal(principal),
+		slog.String("decision", decision),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+	)
+	accesslog.SetDecision(c, decision)
+	metrics.IngressRequests.WithLabelValues(route, strconv.Itoa(status)).Inc()
+	metrics.IngressLatency.WithLabelValues(route).Observe(metrics.Since(start))
+	span.SetAttributes(attribute.String("route", route), attribute.Int("http.response.status_code", status))
+	tracing.End(span, err)
+}
+
+// routeLabel names the matched ingress route for metrics
+func routeLabel(c fiber.Ctx) string {
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		if r, ok := conf.MatchRoute(c.Hostname(), c.Path()); ok {
+			return r.Key()
+		}
+	}
+	return "unmatched"
+}
+
+// isPublic reports whether the request matches the ingress public-paths
+func isPublic(c fiber.Ctx) bool {
+	conf := ingressconfig.ConfigOrNil()
+	return conf != nil && conf.IsPublic(c.Hostname(), c.Method(), c.Path())
+}
+
+// resolveTarget looks up the upstream for the request in the ingress routing table
+func resolveTarget(c fiber.Ctx) (ingressconfig.Target, error) {
+	if conf := ingressconfig.ConfigOrNil(); conf != nil {
+		if target, ok := conf.Resolve(c.Hostname(), c.Path()); ok {
+			return target, nil
+		}
+	}
+	return ingressconfig.Target{}, fiber.NewError(fiber.StatusBadGateway, "no upstream configured for "+c.Path())
+}
+
+// authResult is the outcome of a single authorization stage
+type authResult struct {
+	stage  string
+	allow  bool
+	reason string
+	err    error
+	// deny replaces the 403 of a denial
+	deny *authorization.DenyResponse
+}
+
+// denial converts a non-allowing result into the 403 (or configured deny response) returned to
+// the client, or nil when allowed
+func (r authResult) denial() error {
+	if r.err != nil {
+		// the error may name internal services, so the client only learns which stage failed
+		return fiber.NewError(fiber.StatusForbidden, r.stage+" authorization error")
+	}
+	if !r.allow {
+		reason := r.reason
+		if reason == "" {
+			reason = r.stage + " authorization denied"
+		}
+		if r.deny != nil {
+			return &denyError{err: fiber.NewError(r.deny.StatusCode(), reason), check: r.stage, response: r.deny}
+		}
+		return fiber.NewError(fiber.StatusForbidden, reason)
+	}
+	return nil
+}
+
+// authorize runs the authorization providers configured for the request (by default coarse,
+// fine-grain and local policy, concurrently, all of which must allow) and returns the 403 for a denial
+func authorize(ctx context.Context, reqInfo authorization.RequestInfo, principal jwtauth.Principal) error {
+	o := authorization.Authorize(ctx, reqInfo, principal)
+	if o.Err != nil {
+		slog.WarnContext(ctx, "authorization error", slog.String("check", o.Provider), slog.Any("error", o.Err))
+	}
+	return authResult{stage: o.Provider, allow: o.Allow, reason: o.Reason, err: o.Err, deny: o.DenyResponse}.denial()
+}
 
-	log.Printf("Authorization: %s", principal)
-
-	reqInfo := authorization.RequestInfo{
-		Method: c.Method(),
-		Path:   c.OriginalURL(),
-	}
-
- // Run coarse and fine-grain authorization concurrently and wait for both
- type authResult struct {
-     allow  bool
-     reason string
-     err    error
- }
-
- coarseCh := make(chan authResult, 1)
- fineCh := make(chan authResult, 1)
-
- go func() {
-     allow, reason, err := authorization.CheckCoarseAccess(reqInfo, principal)
-     coarseCh <- authResult{allow: allow, reason: reason, err: err}
- }()
-
- go func() {
-     allow, reason, err := authorization.CheckFineGrainAccess(reqInfo, principal)
-     fineCh <- authResult{allow: allow, reason: reason, err: err}
- }()
-
- coarseRes := <-coarseCh
- fineRes := <-fineCh
-
- // Validate both results before proxying
- if coarseRes.err != nil {
-     return fiber.NewError(fiber.StatusForbidden, "coarse authorization error: "+coarseRes.err.Error())
- }
- if !coarseRes.allow {
-     reason := coarseRes.reason
-     if reason == "" {
-         reason = "coarse authorization denied"
-     }
-     return fiber.NewError(fiber.StatusForbidden, reason)
- }
-
- if fineRes.err != nil {
-     return fiber.NewError(fiber.StatusForbidden, "fine-grain authorization error: "+fineRes.err.Error())
- }
- if !fineRes.allow {
-     reason := fineRes.reason
-     if reason == "" {
-         reason = "fine-grain authorization denied"
-     }
-     return fiber.NewError(fiber.StatusForbidden, reason)
- }
-
-	// Proxy the request to the real backend
-	target := "https://httpbin.org" + c.OriginalURL() // replace with your actual service
-	return doProxy(c, target)
-}
-
-func jwtAuthenticate(c fiber.Ctx) (error, bool) {
-	tokenString := c.Get("Authorization")
-	if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
+func jwtAuthenticate(ctx context.Context, c fiber.Ctx) (error, bool) {
+	authorization := c.Get("Authorization")
+	// Remove the "Bearer " prefix, or "DPoP " for sender-constrained tokens
+	tokenString, found := strings.CutPrefix(authorization, "Bearer ")
+	dpopScheme := false
+	if !found && jwtauth.DPoP() != nil {
+		tokenString, found = strings.CutPrefix(authorization, "DPoP ")
+		dpopScheme = found
+	}
+	if !found || tokenString == "" {
 		return fiber.NewError(fiber.StatusUnauthorized, "Missing or malformed token"), true
 	}
-	// Remove "Bearer " prefix
-	tokenString = tokenString[len("Bearer "):]
-
- // Parse the JWT header manually to extract the 'kid'
- parts := strings.Split(tokenString, ".")
- if len(parts) < 2 {
-     return fiber.NewError(fiber.StatusUnauthorized, "Malformed token"), true
- }
- headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
- if err != nil {
-     return fiber.NewError(fiber.StatusUnauthorized, "Error decoding token header"), true
- }
- var header map[string]interface{}
- if err := json.Unmarshal(headerBytes, &header); err != nil {
-     return fiber.NewError(fiber.StatusUnauthorized, "Error parsing token header"), true
- }
- kid, ok := header["kid"].(string)
- if !ok || kid == "" {
-     return fiber.NewError(fiber.StatusUnauthorized, "Missing key ID (kid) in JWT header"), true
- }
-
-	// Fetch the public key from the cache
-	publicKey, exists := jwtauth.GetPublicKey(kid)
+	if err, abort := authenticateToken(ctx, c, tokenString); abort {
+		return err, true
+	}
+	if err, abort := checkRevocation(ctx, c); abort {
+		return err, true
+	}
+	if err, abort := checkReplay(ctx, c); abort {
+		return err, true
+	}
+	if err, abort := checkDPoP(c, dpopScheme, tokenString); abort {
+		return err, true
+	}
+	if err, abort := enrichPrincipal(ctx, c, tokenString); abort {
+		return err, true
+	}
+	// the validated token, without its scheme, is the subject of a token exchange
+	c.Locals("Token", tokenString)
+	return nil, false
+}
+
+// enrichPrincipal replaces the principal with one built from the token and its userinfo claims when
+// authn.userinfo is enabled. Without userinfo.required a failed lookup keeps the token's principal.
+func enrichPrincipal(ctx context.Context, c fiber.Ctx, token string) (error, bool) {
+	conf := jwtauth.UserInfo()
+	if conf == nil {
+		return nil, false
+	}
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	principal, _ := c.Locals("Principal").(jwtauth.Principal)
+	principal, err := jwtauth.Enrich(ctx, token, claims, principal)
+	switch {
+	case errors.Is(err, jwtauth.ErrUserInfoSubject):
+		return fiber.NewError(fiber.StatusUnauthorized, "Userinfo does not match the token"), true
+	case err != nil && conf.Required:
+		slog.WarnContext(ctx, "userinfo lookup failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Userinfo unavailable"), true
+	case err != nil:
+		slog.WarnContext(ctx, "userinfo lookup failed; using the token's claims", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return nil, false
+	}
+	c.Locals("Principal", principal)
+	return nil, false
+}
+
+// checkRevocation rejects a validated token whose jti or subject has been revoked, including tokens
+// served from the token cache
+func checkRevocation(ctx context.Context, c fiber.Ctx) (error, bool) {
+	if !revocation.Enabled() {
+		return nil, false
+	}
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	err := revocation.Check(ctx, sub, jti)
+	switch {
+	case errors.Is(err, revocation.ErrRevoked):
+		return fiber.NewError(fiber.StatusUnauthorized, "Token revoked"), true
+	case err != nil:
+		slog.WarnContext(ctx, "revocation check failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Revocation check unavailable"), true
+	}
+	return nil, false
+}
+
+// checkReplay rejects a token presented before on routes with replay-protection. It runs after
+// validation, so only genuine tokens are remembered, and also for tokens served from the token cache.
+func checkReplay(ctx context.Context, c fiber.Ctx) (error, bool) {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil || !conf.ReplayProtected(c.Hostname(), c.Path()) {
+		return nil, false
+	}
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Token without jti cannot be replay-checked"), true
+	}
+	iss, _ := claims["iss"].(string)
+	var expires time.Time
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		expires = exp.Time
+	}
+	err := replay.Check(ctx, iss, jti, expires)
+	switch {
+	case errors.Is(err, replay.ErrReplayed):
+		return fiber.NewError(fiber.StatusUnauthorized, "Token replayed"), true
+	case err != nil:
+		slog.WarnContext(ctx, "replay check failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Replay check unavailable"), true
+	}
+	return nil, false
+}
+
+// authenticateToken validates a bearer token and stores the principal and claims in Locals
+func authenticateToken(ctx context.Context, c fiber.Ctx, tokenString string) (error, bool) {
+	encrypted := jwtauth.IsEncrypted(tokenString) && jwtauth.DecryptionEnabled()
+	// A token that is neither a compact JWS nor an encrypted one is opaque: ask the provider about it
+	// when introspection is enabled
+	if strings.Count(tokenString, ".") != 2 && !encrypted && jwtauth.IntrospectionEnabled() {
+		return introspectToken(ctx, c, tokenString)
+	}
+	if !encrypted && jwtauth.EncryptionRequired() {
+		return fiber.NewError(fiber.StatusUnauthorized, "Encrypted token required"), true
+	}
+
+	// Skip decoding and signature verification for a token validated recently
+	if principal, claims, ok := jwtauth.LookupToken(tokenString); ok {
+		c.Locals("Principal", principal)
+		c.Locals("Claims", claims)
+		return nil, false
+	}
+
+	// A nested JWT is decrypted here; the signed token inside is verified like any other, and the
+	// validation is cached under the token as presented
+	presented := tokenString
+	if encrypted {
+		inner, err := jwtauth.Decrypt(tokenString)
+		if err != nil {
+			slog.DebugContext(ctx, "token decryption failed", slog.Any("error", err))
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid encrypted token"), true
+		}
+		tokenString = inner
+	}
+
+	// Parse the JWT header manually to extract the 'kid'
+	parts := strings.Split(tokenString, ".")
+	if len(parts) < 2 {
+		return fiber.NewError(fiber.StatusUnauthorized, "Malformed token"), true
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Error decoding token header"), true
+	}
+	var header map[string]interface{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, "Error parsing token header"), true
+	}
+	// Unsigned tokens never verify; say so rather than report a missing key
+	if alg, _ := header["alg"].(string); strings.EqualFold(alg, "none") {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unsigned tokens are not accepted"), true
+	}
+	kid, ok := header["kid"].(string)
+	if !ok || kid == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing key ID (kid) in JWT header"), true
+	}
+
+	// Select the key set of the token's issuer; the iss claim is only trusted once the signature verifies
+	issuer, ok := jwtauth.ResolveIssuer(unverifiedIssuer(parts[1]))
+	if !ok {
+		return fiber.NewError(fiber.StatusUnauthorized, "Unknown token issuer"), true
+	}
+
+	// Fetch the public key from the cache, refetching the JWKS once if the key was rotated since the last refresh
+	publicKey, exists := issuer.Keys.Get(kid)
+	if !exists {
+		publicKey, exists = issuer.Keys.RefreshForKid(ctx, kid)
+	}
 	if !exists {
 		return fiber.NewError(fiber.StatusUnauthorized, "Invalid key ID (kid) or public key not found in cache"), true
 	}
 
- // Parse and validate the JWT token using the cached public key
- claims := jwt.MapClaims{}
- _, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-     // Ensure token signing method matches
-     if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-         return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
-     }
-     return publicKey, nil
- })
- if err != nil {
-     return fiber.NewError(fiber.StatusUnauthorized, "Invalid token"), true
- }
-	principal := jwtauth.Principal{
-		UserID:   util.GetClaimAsString(claims, "user_id"),
-		Username: util.GetClaimAsString(claims, "username"),
-		Email:    util.GetClaimAsString(claims, "email"),
+	// Parse and validate the JWT token using the cached public key
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Ensure the key suits the signing method and the alg its JWK declares; the allowlist itself is
+		// enforced by WithValidMethods
+		if !issuer.Keys.AcceptsAlg(kid, token.Method.Alg()) {
+			return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
+		}
+		return publicKey, nil
+	}, issuer.ParserOptions()...)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnauthorized, jwtauth.ErrorReason(err)), true
 	}
+	principal := jwtauth.PrincipalFromClaims(claims)
+	jwtauth.StoreToken(presented, principal, claims, issuer.Keys, kid, publicKey)
 	c.Locals("Principal", principal)
+	c.Locals("Claims", claims)
 	return nil, false
 }
+
+// checkDPoP enforces RFC 9449 proof-of-possession once the token itself is valid. A token bound
+// through cnf.jkt must come with the DPoP scheme and a proof signed by the bound key.
+func checkDPoP(c fiber.Ctx, dpopScheme bool, token string) (error, bool) {
+	conf := jwtauth.DPoP()
+	if conf == nil {
+		return nil, false
+	}
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	jkt := jwtauth.ConfirmationThumbprint(claims)
+	switch {
+	case jkt == "" && !dpopScheme:
+		if conf.Required {
+			return dpopError(c, "invalid_token", "DPoP-bound token required"), true
+		}
+		return nil, false
+	case jkt == "":
+		return dpopError(c, "invalid_token", "Token is not DPoP-bound"), true
+	case !dpopScheme:
+		return dpopError(c, "invalid_token", "DPoP-bound token presented as bearer"), true
+	}
+	proof := c.Get("DPoP")
+	if proof == "" {
+		return dpopError(c, "invalid_dpop_proof", "Missing DPoP proof"), true
+	}
+	htu := c.Scheme() + "://" + c.Host() + canonpath.Escape(c.Path())
+	if err := jwtauth.VerifyDPoP(proof, c.Method(), htu, token, jkt); err != nil {
+		slog.Debug("DPoP proof rejected", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return dpopError(c, "invalid_dpop_proof", "Invalid DPoP proof"), true
+	}
+	return nil, false
+}
+
+// dpopError advertises the DPoP scheme alongside a 401 (RFC 9449 section 7.1)
+func dpopError(c fiber.Ctx, code, reason string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="`+code+`", algs="`+strings.Join(jwtauth.AllowedAlgorithms(), " ")+`"`)
+	return fiber.NewError(fiber.StatusUnauthorized, reason)
+}
+
+// introspectToken authenticates an opaque token through the introspection endpoint
+func introspectToken(ctx context.Context, c fiber.Ctx, token string) (error, bool) {
+	principal, claims, err := jwtauth.Introspect(ctx, token)
+	if errors.Is(err, jwtauth.ErrTokenInactive) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Token is not active"), true
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "token introspection failed", slog.String("request_id", logging.RequestIDFrom(c)), slog.Any("error", err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Token introspection unavailable"), true
+	}
+	c.Locals("Principal", principal)
+	c.Locals("Claims", claims)
+	return nil, false
+}
+
+// unverifiedIssuer reads the iss claim from the encoded payload, returning "" when absent or malformed
+func unverifiedIssuer(payload string) string {
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return ""
+	}
+	return claims.Iss
+}
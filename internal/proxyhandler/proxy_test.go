@@ -1,16 +1,41 @@
 package proxyhandler
 
 import (
-    "crypto/rand"
-    "crypto/rsa"
-    "net/http/httptest"
-    "testing"
-    "time"
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
 
-    "github.com/gofiber/fiber/v3"
-    "github.com/golang-jwt/jwt/v5"
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 
-    "reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/replay"
+	"reverseProxy/internal/revocation"
 )
 
 func makeRSAToken(t *testing.T, kid string, priv *rsa.PrivateKey, claims jwt.MapClaims) string {
@@ -30,9 +55,15 @@ func makeRSAToken(t *testing.T, kid string, priv *rsa.PrivateKey, claims jwt.Map
 
 func TestHandler_SuccessAndPrincipal(t *testing.T) {
 	app := fiber.New()
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes:          []ingressconfig.Route{{PathPrefix: "/anything", Upstream: "http://anything.internal/", StripPrefix: true}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
 	// stub proxy to avoid network
 	called := false
-	doProxy = func(c fiber.Ctx, url string) error { called = true; return nil }
+	target := ""
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { called = true; target = url; return nil }
 
 	// prepare key and cache
 	priv, err := rsa.GenerateKey(rand.Reader, 1024)
@@ -51,7 +82,7 @@ func TestHandler_SuccessAndPrincipal(t *testing.T) {
 
 	app.All("/*", Handler)
 
-	req := httptest.NewRequest("GET", "/anything", nil)
+	req := httptest.NewRequest("GET", "/anything/items?page=2", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
 	if err != nil {
@@ -63,6 +94,38 @@ func TestHandler_SuccessAndPrincipal(t *testing.T) {
 	if !called {
 		t.Fatalf("expected proxy to be called")
 	}
+	if target != "http://anything.internal/items?page=2" {
+		t.Fatalf("expected route upstream to be used, got %q", target)
+	}
+}
+
+func TestHandler_NoUpstreamConfigured(t *testing.T) {
+	ingressconfig.SetConfigForTest(nil)
+	called := false
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { called = true; return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "kid-noupstream"
+	jwtauth.SetPublicKeyForTest(kid, &priv.PublicKey)
+	token := makeRSAToken(t, kid, priv, nil)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadGateway {
+		t.Fatalf("expected 502 without an upstream, got %d", resp.StatusCode)
+	}
+	if called {
+		t.Fatalf("proxy must not be called without an upstream")
+	}
 }
 
 func TestHandler_MissingAuthHeader(t *testing.T) {
@@ -77,7 +140,7 @@ func TestHandler_MissingAuthHeader(t *testing.T) {
 
 func TestHandler_InvalidSigningMethod(t *testing.T) {
 	app := fiber.New()
-	doProxy = func(c fiber.Ctx, url string) error { return nil }
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
 	// seed cache with any key under kid
 	priv, err := rsa.GenerateKey(rand.Reader, 1024)
 	if err != nil {
@@ -100,3 +163,776 @@ func TestHandler_InvalidSigningMethod(t *testing.T) {
 		t.Fatalf("expected 401 for invalid signing method, got %d", resp.StatusCode)
 	}
 }
+
+func TestHandler_RejectsUnsignedAndMismatchedAlg(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the provider pins the key to RS512
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "kid-rs512", "alg": "RS512", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+	if err := jwtauth.FetchPublicKeys(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(token string) (int, string) {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	sign := func(method jwt.SigningMethod) string {
+		tok := jwt.NewWithClaims(method, jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()})
+		tok.Header["kid"] = "kid-rs512"
+		s, err := tok.SignedString(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if code, _ := send(sign(jwt.SigningMethodRS512)); code != 200 {
+		t.Fatalf("expected the declared alg to be accepted, got %d", code)
+	}
+	if code, body := send(sign(jwt.SigningMethodRS256)); code != fiber.StatusUnauthorized || !strings.Contains(body, "Invalid signing method") {
+		t.Fatalf("expected an alg other than the declared one to be rejected, got %d %s", code, body)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"user_id": "u1"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body := send(unsigned); code != fiber.StatusUnauthorized || !strings.Contains(body, "Unsigned") {
+		t.Fatalf("expected alg none to be rejected, got %d %s", code, body)
+	}
+}
+
+func TestHandler_NestedJWT(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	signer, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-nested", &signer.PublicKey)
+	decrypter, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(decrypter)
+	keyFile := filepath.Join(t.TempDir(), "jwe.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := jwtauth.Configure(&jwtauth.Config{Decryption: &jwtauth.DecryptionConfig{
+		Keys: []jwtauth.DecryptionKey{{KeyFile: keyFile}}, Required: true,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	signed := makeRSAToken(t, "kid-nested", signer, jwt.MapClaims{"user_id": "u-nested"})
+	// RSA-OAEP-256 + A256GCM around the signed token
+	protected := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RSA-OAEP-256","enc":"A256GCM","cty":"JWT"}`))
+	cek := make([]byte, 32)
+	_, _ = rand.Read(cek)
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &decrypter.PublicKey, cek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	aead, _ := cipher.NewGCM(block)
+	iv := make([]byte, aead.NonceSize())
+	_, _ = rand.Read(iv)
+	sealed := aead.Seal(nil, iv, []byte(signed), []byte(protected))
+	enc := base64.RawURLEncoding.EncodeToString
+	encrypted := strings.Join([]string{protected, enc(encryptedKey), enc(iv), enc(sealed[:len(sealed)-16]), enc(sealed[len(sealed)-16:])}, ".")
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(token string) int {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	if code := send(encrypted); code != 200 {
+		t.Fatalf("expected the nested JWT to be accepted, got %d", code)
+	}
+	if code := send(signed); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected the bare signed token to be rejected when encryption is required, got %d", code)
+	}
+}
+
+func TestHandler_ReplayProtectedRoute(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Routes:          []ingressconfig.Route{{PathPrefix: "/pay", Upstream: "http://pay.internal", ReplayProtection: true}},
+	})
+	if err := replay.Configure(&replay.Config{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = replay.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-replay", &priv.PublicKey)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	token := makeRSAToken(t, "kid-replay", priv, jwt.MapClaims{"user_id": "u1", "jti": "once"})
+	if code := send("/pay/charge", token); code != 200 {
+		t.Fatalf("expected the first use to pass, got %d", code)
+	}
+	if code := send("/pay/charge", token); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected the replayed token to be rejected, got %d", code)
+	}
+	if code := send("/other", token); code != 200 {
+		t.Fatalf("expected routes without replay-protection to accept reuse, got %d", code)
+	}
+	// the route is matched on the path the upstream serves
+	if code := send("/other/../pay/charge", token); code != fiber.StatusBadRequest {
+		t.Fatalf("expected a dot segment to be refused, got %d", code)
+	}
+	if code := send("/%70ay/charge", token); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected an encoded path to be replay-protected, got %d", code)
+	}
+	if code := send("/pay/charge", makeRSAToken(t, "kid-replay", priv, jwt.MapClaims{"user_id": "u1"})); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected a token without jti to be rejected, got %d", code)
+	}
+}
+
+func TestHandler_RevokedToken(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	file := filepath.Join(t.TempDir(), "revoked.yaml")
+	if err := os.WriteFile(file, []byte("jtis: [stolen]\nsubjects: [mallory]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := revocation.Configure(&revocation.Config{Enabled: true, File: file}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = revocation.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-revoked", &priv.PublicKey)
+	app := fiber.New()
+	app.All("/*", Handler)
+	for _, tc := range []struct {
+		claims jwt.MapClaims
+		want   int
+	}{
+		{jwt.MapClaims{"sub": "alice", "jti": "fine"}, 200},
+		{jwt.MapClaims{"sub": "alice", "jti": "stolen"}, fiber.StatusUnauthorized},
+		{jwt.MapClaims{"sub": "mallory", "jti": "fresh"}, fiber.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-revoked", priv, tc.claims))
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("claims %v: expected %d, got %d", tc.claims, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandler_UserInfoEnrichesPrincipal(t *testing.T) {
+	var available atomic.Bool
+	available.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": "alice", "email": "alice@example.com"})
+	}))
+	defer srv.Close()
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	conf := &jwtauth.Config{UserInfo: &jwtauth.UserInfoConfig{Enabled: true, Endpoint: srv.URL}}
+	if err := jwtauth.Configure(conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	var email string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		p, _ := c.Locals("Principal").(jwtauth.Principal)
+		email = p.Email
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-userinfo", &priv.PublicKey)
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(sub string) int {
+		req := httptest.NewRequest("GET", "/x", nil)
+		req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-userinfo", priv, jwt.MapClaims{"sub": sub}))
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := send("alice"); got != 200 || email != "alice@example.com" {
+		t.Fatalf("expected the userinfo email in the principal, got %d %q", got, email)
+	}
+	if got := send("bob"); got != fiber.StatusUnauthorized {
+		t.Fatalf("expected userinfo about another subject to be rejected, got %d", got)
+	}
+
+	available.Store(false)
+	email = ""
+	if got := send("carol"); got != 200 || email != "" {
+		t.Fatalf("expected the token's principal when userinfo fails, got %d %q", got, email)
+	}
+	conf.UserInfo.Required = true
+	if got := send("dave"); got != fiber.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when required userinfo fails, got %d", got)
+	}
+}
+
+func TestHandler_DenyCancelsOtherCheck(t *testing.T) {
+	fineArrived := make(chan struct{})
+	coarse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// deny only once the fine-grain call is in flight
+		select {
+		case <-fineArrived:
+		case <-time.After(2 * time.Second):
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"allow": false, "reason": "coarse says no"})
+	}))
+	defer coarse.Close()
+
+	fineCancelled := make(chan struct{})
+	fine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices a client disconnect once the body has been consumed
+		_, _ = io.Copy(io.Discard, r.Body)
+		close(fineArrived)
+		select {
+		case <-r.Context().Done():
+			close(fineCancelled)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer fine.Close()
+
+	authorization.SetConfigForTest(&authorization.Config{
+		Coarse: authorization.CoarseConfig{Enabled: true, ValidationURL: coarse.URL, ResourceMap: map[string]authorization.CoarseResource{"[/**]": {Resource: "/res"}}},
+		FineGrain: authorization.FineGrainConfig{Enabled: true, ValidationURL: fine.URL, ResourceMap: map[string]authorization.FineRule{
+			"[/**]": {RulesetName: "rs"},
+		}},
+	})
+	t.Cleanup(func() { authorization.SetConfigForTest(nil) })
+
+	called := false
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { called = true; return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "kid3"
+	jwtauth.SetPublicKeyForTest(kid, &priv.PublicKey)
+	token := makeRSAToken(t, kid, priv, jwt.MapClaims{"user_id": "u3"})
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	start := time.Now()
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("handler waited for the slow check: %v", elapsed)
+	}
+	if called {
+		t.Fatalf("proxy must not be called on deny")
+	}
+	select {
+	case <-fineCancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected in-flight fine-grain call to be cancelled")
+	}
+}
+
+func TestHandler_QueryStringDoesNotSkipFineGrain(t *testing.T) {
+	var checked atomic.Int32
+	fine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"allow": false, "reason": "not your account"})
+	}))
+	defer fine.Close()
+
+	authorization.SetConfigForTest(&authorization.Config{
+		FineGrain: authorization.FineGrainConfig{Enabled: true, ValidationURL: fine.URL, ResourceMap: map[string]authorization.FineRule{
+			"[/api/accounts/{id}/transfers:POST]": {RulesetName: "transfers"},
+		}},
+	})
+	t.Cleanup(func() { authorization.SetConfigForTest(nil) })
+
+	called := false
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { called = true; return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "kid-query"
+	jwtauth.SetPublicKeyForTest(kid, &priv.PublicKey)
+	token := makeRSAToken(t, kid, priv, jwt.MapClaims{"user_id": "u3"})
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("POST", "/api/accounts/1/transfers?x=1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden || checked.Load() != 1 {
+		t.Fatalf("expected the fine-grain rule to match despite the query, got %d after %d checks", resp.StatusCode, checked.Load())
+	}
+	if called {
+		t.Fatalf("proxy must not be called on deny")
+	}
+}
+
+func TestHandler_PropagatesTraceContextUpstream(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://app.internal"})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	forwarded := ""
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		forwarded = c.Get("traceparent")
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := "kid-trace"
+	jwtauth.SetPublicKeyForTest(kid, &priv.PublicKey)
+	token := makeRSAToken(t, kid, priv, nil)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/traced", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, err := app.Test(req, fiber.TestConfig{Timeout: -1}); err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if !strings.Contains(forwarded, "4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Fatalf("expected upstream traceparent to continue the incoming trace, got %q", forwarded)
+	}
+}
+
+func TestHandler_RotatedKidTriggersJWKSRefresh(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the provider rotates in a new key after the startup fetch
+	var rotated atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rotated.Load() {
+			writeJWKS(w, "kid-rotated", &priv.PublicKey)
+			return
+		}
+		writeJWKS(w, "", nil)
+	}))
+	defer srv.Close()
+	if err := jwtauth.FetchPublicKeys(srv.URL); err != nil {
+		t.Fatalf("FetchPublicKeys: %v", err)
+	}
+	rotated.Store(true)
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	req := httptest.NewRequest("GET", "/anything", nil)
+	req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-rotated", priv, nil))
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200 after on-demand JWKS refresh, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_ECKeyAndAlgorithmAllowlist(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-ec", &priv.PublicKey)
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"user_id": "u-ec", "exp": time.Now().Add(time.Hour).Unix()})
+	tok.Header["kid"] = "kid-ec"
+	token, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func() int {
+		req := httptest.NewRequest("GET", "/anything", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := send(); code != 200 {
+		t.Fatalf("expected ES256 token to be accepted, got %d", code)
+	}
+	if err := jwtauth.Configure(&jwtauth.Config{Algorithms: []string{"RS256"}}); err != nil {
+		t.Fatal(err)
+	}
+	if code := send(); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected ES256 token to be rejected by an RS256-only allowlist, got %d", code)
+	}
+}
+
+// writeJWKS serves a JWKS holding a single RSA key, or no keys when pub is nil
+func writeJWKS(w http.ResponseWriter, kid string, pub *rsa.PublicKey) {
+	keys := []map[string]string{}
+	if pub != nil {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+}
+
+func TestHandler_SelectsKeySetByIssuer(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	newIDP := func(kid string) (*rsa.PrivateKey, *httptest.Server) {
+		priv, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJWKS(w, kid, &priv.PublicKey)
+		}))
+		t.Cleanup(srv.Close)
+		return priv, srv
+	}
+	privA, idpA := newIDP("shared-kid")
+	privB, idpB := newIDP("shared-kid")
+	if err := jwtauth.Configure(&jwtauth.Config{Issuers: []jwtauth.IssuerConfig{
+		{Issuer: "https://a.example", JWKSURL: idpA.URL},
+		{Issuer: "https://b.example", JWKSURL: idpB.URL, Audiences: []string{"orders"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(token string) int {
+		req := httptest.NewRequest("GET", "/anything", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		name   string
+		priv   *rsa.PrivateKey
+		claims jwt.MapClaims
+		want   int
+	}{
+		{"issuer a", privA, jwt.MapClaims{"iss": "https://a.example"}, 200},
+		{"issuer b with audience", privB, jwt.MapClaims{"iss": "https://b.example", "aud": []string{"orders"}}, 200},
+		{"issuer b wrong audience", privB, jwt.MapClaims{"iss": "https://b.example", "aud": "billing"}, fiber.StatusUnauthorized},
+		{"b's key claiming issuer a", privB, jwt.MapClaims{"iss": "https://a.example"}, fiber.StatusUnauthorized},
+		{"unknown issuer", privA, jwt.MapClaims{"iss": "https://evil.example"}, fiber.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if got := send(makeRSAToken(t, "shared-kid", tc.priv, tc.claims)); got != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestHandler_OpaqueTokenUsesIntrospection(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	var principal jwtauth.Principal
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		principal, _ = c.Locals("Principal").(jwtauth.Principal)
+		return nil
+	}
+
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_ = json.NewEncoder(w).Encode(map[string]any{"active": r.PostForm.Get("token") == "opaque-ok", "sub": "u-opaque"})
+	}))
+	defer idp.Close()
+	if err := jwtauth.Configure(&jwtauth.Config{Introspection: &jwtauth.IntrospectionConfig{Enabled: true, Endpoint: idp.URL}}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(token string) int {
+		req := httptest.NewRequest("GET", "/anything", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := send("opaque-ok"); code != 200 {
+		t.Fatalf("expected active opaque token to be accepted, got %d", code)
+	}
+	if principal.UserID != "u-opaque" {
+		t.Fatalf("expected principal from introspection, got %+v", principal)
+	}
+	if code := send("opaque-revoked"); code != fiber.StatusUnauthorized {
+		t.Fatalf("expected inactive opaque token to be rejected, got %d", code)
+	}
+}
+
+func TestHandler_DPoPBoundToken(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{DefaultUpstream: "http://default.internal"})
+	if err := jwtauth.Configure(&jwtauth.Config{DPoP: &jwtauth.DPoPConfig{Enabled: true}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		_ = jwtauth.Configure(nil)
+	})
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-dpop", &priv.PublicKey)
+	proofKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	x, y := enc(proofKey.X.FillBytes(make([]byte, 32))), enc(proofKey.Y.FillBytes(make([]byte, 32)))
+	sum := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"` + x + `","y":"` + y + `"}`))
+	token := makeRSAToken(t, "kid-dpop", priv, jwt.MapClaims{"user_id": "u7", "cnf": map[string]any{"jkt": enc(sum[:])}})
+
+	proof := func(jti string) string {
+		ath := sha256.Sum256([]byte(token))
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+			"htm": "GET", "htu": "http://example.com/orders", "jti": jti, "iat": time.Now().Unix(), "ath": enc(ath[:]),
+		})
+		tok.Header["typ"] = "dpop+jwt"
+		tok.Header["jwk"] = map[string]any{"kty": "EC", "crv": "P-256", "x": x, "y": y}
+		s, err := tok.SignedString(proofKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(scheme, dpop string) *http.Response {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		req.Header.Set("Authorization", scheme+" "+token)
+		if dpop != "" {
+			req.Header.Set("DPoP", dpop)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("DPoP", proof("a")); resp.StatusCode != 200 {
+		t.Fatalf("expected a valid proof to pass, got %d", resp.StatusCode)
+	}
+	if resp := send("Bearer", ""); resp.StatusCode != 401 || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "DPoP ") {
+		t.Errorf("expected a bound token presented as bearer to be rejected with a DPoP challenge, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	if resp := send("DPoP", ""); resp.StatusCode != 401 {
+		t.Errorf("expected a missing proof to be rejected, got %d", resp.StatusCode)
+	}
+	if resp := send("DPoP", proof("a")); resp.StatusCode != 401 {
+		t.Errorf("expected a replayed proof to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestUpstreamTimeout(t *testing.T) {
+	if got, err := upstreamTimeout(context.Background(), 2*time.Second); err != nil || got != 2*time.Second {
+		t.Fatalf("expected the route timeout without a deadline, got %v, %v", got, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if got, err := upstreamTimeout(ctx, 0); err != nil || got <= 0 || got > 500*time.Millisecond {
+		t.Fatalf("expected the request deadline to bound the call, got %v, %v", got, err)
+	}
+	if got, err := upstreamTimeout(ctx, 100*time.Millisecond); err != nil || got != 100*time.Millisecond {
+		t.Fatalf("expected the shorter route timeout, got %v, %v", got, err)
+	}
+	cancel()
+	if _, err := upstreamTimeout(ctx, 0); err == nil {
+		t.Fatalf("expected a cancelled request not to be proxied")
+	}
+}
+
+func TestDoProxy_StreamsEvents(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: one\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = w.Write([]byte("data: two\n\n"))
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	app.Get("/*", func(c fiber.Ctx) error { return proxyUpstream(c, upstream.URL+"/events", time.Second) })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	// release the upstream first: shutdown waits for the stream to end
+	defer func() { close(release); _ = app.Shutdown() }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the first event arrives while the upstream is still holding the second
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "data: one\n" {
+		t.Fatalf("expected the first event before the stream ends, got %q %v", line, err)
+	}
+}
+
+func TestDoProxy_KeepsMiddlewareHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	app := fiber.New()
+	app.Get("/*", func(c fiber.Ctx) error {
+		c.Set("RateLimit-Remaining", "4")
+		c.Set("Access-Control-Allow-Origin", "https://app.example.com")
+		c.Vary("Origin")
+		return proxyUpstream(c, upstream.URL, 0)
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("RateLimit-Remaining"); got != "4" {
+		t.Fatalf("expected headers set before proxying to survive, got %v", resp.Header)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Fatalf("expected the sidecar's header to override the upstream's, got %q", got)
+	}
+	if got := resp.Header.Values("Vary"); len(got) != 2 || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected Vary to be merged and the upstream content type kept, got %v", resp.Header)
+	}
+}
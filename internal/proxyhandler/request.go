@@ -0,0 +1,191 @@
+package proxyhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/apikey"
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+)
+
+// credentialHeaders are never forwarded to validation services
+var credentialHeaders = []string{fiber.HeaderAuthorization, fiber.HeaderProxyAuthorization, fiber.HeaderCookie, "DPoP"}
+
+// isCredentialHeader reports whether a header carries credentials, going case-insensitively since
+// fasthttp normalizes names (DPoP arrives as Dpop)
+func isCredentialHeader(name string) bool {
+	for _, h := range credentialHeaders {
+		if strings.EqualFold(name, h) {
+			return true
+		}
+	}
+	header, ok := apikey.Header()
+	return ok && strings.EqualFold(name, header)
+}
+
+// buildRequestInfo describes the request for coarse and fine-grain checks: method, path without the
+// query (resource-map keys match it as routes do), full URL, headers without credentials, and the
+// body when it is within the configured size cap. JSON bodies are forwarded as is and form bodies as a JSON object of their fields; XML bodies are kept for
+// XPath selectors only; other content types are left out. Fiber buffers the body, so reading it here leaves it intact for the upstream.
+func buildRequestInfo(c fiber.Ctx) authorization.RequestInfo {
+	info := authorization.RequestInfo{
+		Method:  c.Method(),
+		Host:    c.Hostname(),
+		Path:    c.Path(),
+		FullURL: c.BaseURL() + c.OriginalURL(),
+		Headers: make(map[string]string),
+	}
+	for name, values := range c.GetReqHeaders() {
+		if !isCredentialHeader(name) {
+			info.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	if claims, ok := c.Locals("Claims").(jwt.MapClaims); ok {
+		info.Claims = claims
+	}
+	info.Tenant, _ = c.Locals("Tenant").(string)
+
+	limit := authorization.ConfigOrNil().BodyLimit()
+	body := c.Body()
+	if limit < 0 || len(body) == 0 || len(body) > limit {
+		return info
+	}
+	contentType := c.Get(fiber.HeaderContentType)
+	if isJSON(contentType) {
+		if json.Valid(body) {
+			// copy: fasthttp reuses the request buffer once the handler returns
+			info.Body = append(json.RawMessage(nil), body...)
+		}
+		return info
+	}
+	if isXML(contentType) {
+		info.XMLBody = append([]byte(nil), body...)
+		return info
+	}
+	info.Body = formBody(contentType, body)
+	return info
+}
+
+// checkBodySize refuses with 413 a request body over the matched route's max-body-bytes, going by
+// Content-Length when the client declares one
+func checkBodySize(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return nil
+	}
+	route, _ := conf.MatchRoute(c.Hostname(), c.Path())
+	size := max(c.Request().Header.ContentLength(), len(c.Request().Body()))
+	if size > conf.BodyLimit(route) {
+		return fiber.ErrRequestEntityTooLarge
+	}
+	return nil
+}
+
+// isXML reports whether a Content-Type is application/xml, text/xml or a +xml subtype (e.g. SOAP 1.2)
+func isXML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == fiber.MIMEApplicationXML || mediaType == fiber.MIMETextXML || strings.HasSuffix(mediaType, "+xml")
+}
+
+// formBody converts an application/x-www-form-urlencoded or multipart/form-data body to a JSON
+// object, so rules select fields as $.name. A field is a string, or an array when repeated; a file
+// part is described as {"filename", "content_type", "size"} without its content. Any other or
+// malformed body gives nil.
+func formBody(contentType string, body []byte) json.RawMessage {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	var fields map[string][]any
+	switch mediaType {
+	case fiber.MIMEApplicationForm:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		fields = make(map[string][]any, len(values))
+		for name, vs := range values {
+			for _, v := range vs {
+				fields[name] = append(fields[name], v)
+			}
+		}
+	case fiber.MIMEMultipartForm:
+		if fields, err = multipartFields(body, params["boundary"]); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	doc := make(map[string]any, len(fields))
+	for name, vs := range fields {
+		if len(vs) == 1 {
+			doc[name] = vs[0]
+		} else {
+			doc[name] = vs
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func multipartFields(body []byte, boundary string) (map[string][]any, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart body without boundary")
+	}
+	fields := map[string][]any{}
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if filename := part.FileName(); filename != "" {
+			size, err := io.Copy(io.Discard, part)
+			if err != nil {
+				return nil, err
+			}
+			fields[name] = append(fields[name], map[string]any{
+				"filename": filename, "content_type": part.Header.Get(fiber.HeaderContentType), "size": size,
+			})
+			continue
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = append(fields[name], string(value))
+	}
+}
+
+// isJSON reports whether a Content-Type is application/json or a +json subtype
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == fiber.MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,126 @@
+package proxyhandler
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestBuildRequestInfo(t *testing.T) {
+	authorization.SetConfigForTest(&authorization.Config{MaxBodyBytes: 32})
+	t.Cleanup(func() { authorization.SetConfigForTest(nil) })
+
+	var info authorization.RequestInfo
+	app := fiber.New()
+	app.All("/*", func(c fiber.Ctx) error {
+		info = buildRequestInfo(c)
+		return nil
+	})
+	send := func(contentType, body string) {
+		req := httptest.NewRequest("POST", "/orders?expand=items", strings.NewReader(body))
+		req.Host = "api.example.com"
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("DPoP", "proof")
+		req.Header.Set("X-Tenant", "acme")
+		if _, err := app.Test(req, fiber.TestConfig{Timeout: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send("application/json; charset=utf-8", `{"amount":12.50}`)
+	if info.Method != "POST" || info.Host != "api.example.com" || info.Path != "/orders" || info.FullURL != "http://api.example.com/orders?expand=items" {
+		t.Errorf("unexpected request line %+v", info)
+	}
+	if info.Headers["X-Tenant"] != "acme" || info.Headers["Authorization"] != "" || info.Headers["Cookie"] != "" || info.Headers["Dpop"] != "" {
+		t.Errorf("expected headers without credentials, got %v", info.Headers)
+	}
+	if string(info.Body) != `{"amount":12.50}` {
+		t.Errorf("expected JSON body to be forwarded, got %s", info.Body)
+	}
+
+	send("application/json", `{"note":"longer than the thirty-two byte cap"}`)
+	if info.Body != nil {
+		t.Errorf("expected body over the cap to be omitted, got %s", info.Body)
+	}
+	send("text/plain", `{"a":1}`)
+	if info.Body != nil {
+		t.Errorf("expected non-JSON content type to be omitted, got %s", info.Body)
+	}
+	send("application/json", `{"a":`)
+	if info.Body != nil {
+		t.Errorf("expected malformed JSON to be omitted, got %s", info.Body)
+	}
+
+	send("application/x-www-form-urlencoded", "amount=5&tag=a&tag=b")
+	if string(info.Body) != `{"amount":"5","tag":["a","b"]}` {
+		t.Errorf("expected form fields as JSON, got %s", info.Body)
+	}
+	send("text/xml", "<a><b>1</b></a>")
+	if info.Body != nil || string(info.XMLBody) != "<a><b>1</b></a>" {
+		t.Errorf("expected an XML body kept for XPath only, got %s %s", info.Body, info.XMLBody)
+	}
+	send("application/octet-stream", "\x00\x01binary")
+	if info.Body != nil {
+		t.Errorf("expected a binary body to be omitted, got %s", info.Body)
+	}
+}
+
+func TestFormBody_Multipart(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	_ = w.WriteField("account", "a1")
+	fw, _ := w.CreateFormFile("statement", "march.pdf")
+	_, _ = fw.Write([]byte("%PDF-1.7"))
+	_ = w.Close()
+
+	body := formBody(w.FormDataContentType(), buf.Bytes())
+	want := `{"account":"a1","statement":{"content_type":"application/octet-stream","filename":"march.pdf","size":8}}`
+	if string(body) != want {
+		t.Fatalf("expected %s, got %s", want, body)
+	}
+	if formBody("multipart/form-data", buf.Bytes()) != nil {
+		t.Fatalf("expected nil without a boundary")
+	}
+}
+
+func TestHandler_RejectsOversizedBody(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		MaxBodyBytes: 64,
+		Routes:       []ingressconfig.Route{{PathPrefix: "/upload", MaxBodyBytes: 8}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	app := fiber.New()
+	app.All("/*", Handler)
+	status := func(path, body string) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("POST", path, strings.NewReader(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// refused before authentication, which would answer 401 for the missing token
+	if got := status("/upload", strings.Repeat("x", 9)); got != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the route cap, got %d", got)
+	}
+	if got := status("/upload", "small"); got != fiber.StatusUnauthorized {
+		t.Fatalf("expected a body under the cap to reach authentication, got %d", got)
+	}
+	if got := status("/orders", strings.Repeat("x", 65)); got != fiber.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the global cap, got %d", got)
+	}
+	if got := status("/orders", strings.Repeat("x", 64)); got != fiber.StatusUnauthorized {
+		t.Fatalf("expected a body at the global cap to reach authentication, got %d", got)
+	}
+}
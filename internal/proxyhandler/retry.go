@@ -0,0 +1,130 @@
+package proxyhandler
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"reverseProxy/internal/balancer"
+	"reverseProxy/internal/canonpath"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/metrics"
+)
+
+// budgets keeps the retry budget of each route key, surviving config reloads
+var budgets sync.Map
+
+// retryBudget counts a route's requests and retries over a fixed window
+type retryBudget struct {
+	mu       sync.Mutex
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// forward sends the request to the target, picking a balanced endpoint for every attempt and
+// retrying failed attempts under the target's retry policy. send makes one attempt and returns
+// its error, leaving the upstream response on c.
+func forward(ctx context.Context, c fiber.Ctx, target ingressconfig.Target, span trace.Span, send func(url string, timeout time.Duration) error) error {
+	policy := target.Retry
+	if policy != nil && !policy.AllowsMethod(c.Method()) {
+		policy = nil
+	}
+	var kept [][2]string
+	if policy != nil {
+		kept = middlewareHeaders(c)
+		budgetFor(target.Route).request(policy.Budget)
+	}
+	backoff := time.Duration(0)
+	if policy != nil {
+		backoff = policy.Backoff
+	}
+	for attempt := 0; ; attempt++ {
+		upstream := target.Upstream
+		var lease *balancer.Lease
+		if len(target.Endpoints) > 0 {
+			lease = balancer.Pick(target.Route, target.Endpoints, target.Balancing)
+			upstream = lease.URL
+		}
+		span.SetAttributes(attribute.String("upstream", upstream))
+		url := upstream + canonpath.Escape(target.Path)
+		if query := c.Request().URI().QueryString(); len(query) > 0 {
+			url += "?" + string(query)
+		}
+		routeTimeout := target.Timeout
+		if policy != nil {
+			routeTimeout = policy.TryTimeout(routeTimeout)
+		}
+		timeout, err := upstreamTimeout(ctx, routeTimeout)
+		if err == nil {
+			err = send(url, timeout)
+		}
+		status := metrics.StatusOf(c, err)
+		if lease != nil {
+			lease.Done(balancer.Failed(status))
+		}
+		if policy == nil || attempt >= policy.RetriesOrDefault() || !policy.RetriesStatus(status) || ctx.Err() != nil {
+			return err
+		}
+		if !budgetFor(target.Route).spend(policy.Budget) {
+			metrics.UpstreamRetries.WithLabelValues(target.Route, "budget_exhausted").Inc()
+			return err
+		}
+		metrics.UpstreamRetries.WithLabelValues(target.Route, "retried").Inc()
+		slog.DebugContext(ctx, "retrying upstream request", slog.String("upstream", upstream), slog.Int("status", status), slog.Int("attempt", attempt+1))
+
+		// drop the failed response, closing a streamed body, before the next attempt
+		c.Response().Reset()
+		restoreHeaders(c, kept)
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// request counts a request that may be retried towards the budget
+func (b *retryBudget) request(conf *ingressconfig.RetryBudget) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(conf)
+	b.requests++
+}
+
+// spend takes a retry from the budget, reporting false when it is exhausted
+func (b *retryBudget) spend(conf *ingressconfig.RetryBudget) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.roll(conf)
+	percent, minRetries, _ := conf.Limits()
+	if b.retries >= minRetries+b.requests*percent/100 {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// roll starts a new window once the current one has passed
+func (b *retryBudget) roll(conf *ingressconfig.RetryBudget) {
+	_, _, window := conf.Limits()
+	if t := time.Now(); t.Sub(b.start) >= window {
+		b.start, b.requests, b.retries = t, 0, 0
+	}
+}
+
+func budgetFor(route string) *retryBudget {
+	if b, ok := budgets.Load(route); ok {
+		return b.(*retryBudget)
+	}
+	b, _ := budgets.LoadOrStore(route, &retryBudget{})
+	return b.(*retryBudget)
+}
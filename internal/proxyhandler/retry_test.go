@@ -0,0 +1,101 @@
+package proxyhandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestForward_RetriesOnAnotherEndpoint(t *testing.T) {
+	var failing, healthy atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthy.Add(1)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer up.Close()
+
+	target := ingressconfig.Target{
+		Route:     "retry-endpoints",
+		Endpoints: []ingressconfig.Endpoint{{URL: down.URL}, {URL: up.URL}},
+		Path:      "/x",
+		Retry:     &ingressconfig.RetryPolicy{PerTryTimeout: time.Second},
+	}
+	app := fiber.New()
+	app.All("/*", func(c fiber.Ctx) error {
+		c.Set("RateLimit-Remaining", "4")
+		return forward(c.Context(), c, target, noop.Span{}, func(url string, timeout time.Duration) error {
+			if c.Method() == fiber.MethodGet && timeout != time.Second {
+				t.Errorf("expected the per-try timeout, got %v", timeout)
+			}
+			return proxyUpstream(c, url, timeout)
+		})
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || failing.Load() != 1 || healthy.Load() != 1 {
+		t.Fatalf("expected one failed attempt then success, got %d after %d/%d", resp.StatusCode, failing.Load(), healthy.Load())
+	}
+	if resp.Header.Get("RateLimit-Remaining") != "4" {
+		t.Fatalf("expected headers set before proxying to survive the retry, got %v", resp.Header)
+	}
+
+	// POST is not idempotent, so its failure reaches the client; round-robin sends it to the failing endpoint
+	resp, err = app.Test(httptest.NewRequest("POST", "/x", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || failing.Load() != 2 || healthy.Load() != 1 {
+		t.Fatalf("expected POST not to be retried, got %d after %d/%d", resp.StatusCode, failing.Load(), healthy.Load())
+	}
+}
+
+func TestForward_StopsAfterRetries(t *testing.T) {
+	var attempts int
+	target := ingressconfig.Target{Route: "retry-count", Upstream: "http://app", Path: "/", Retry: &ingressconfig.RetryPolicy{Retries: 3}}
+	app := fiber.New()
+	app.Get("/", func(c fiber.Ctx) error {
+		return forward(c.Context(), c, target, noop.Span{}, func(string, time.Duration) error {
+			attempts++
+			return fiber.NewError(fiber.StatusBadGateway, "upstream unavailable")
+		})
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadGateway || attempts != 4 {
+		t.Fatalf("expected 4 attempts ending in 502, got %d attempts and %d", attempts, resp.StatusCode)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	conf := &ingressconfig.RetryBudget{Percent: 50, MinRetries: 1, Window: time.Hour}
+	b := &retryBudget{}
+	for range 4 {
+		b.request(conf)
+	}
+	// 1 + 50% of 4 requests
+	for i := range 3 {
+		if !b.spend(conf) {
+			t.Fatalf("expected retry %d within the budget", i+1)
+		}
+	}
+	if b.spend(conf) {
+		t.Fatalf("expected the budget to be exhausted")
+	}
+}
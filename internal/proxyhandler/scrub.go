@@ -0,0 +1,66 @@
+package proxyhandler
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/assertion"
+	"reverseProxy/internal/ingressconfig"
+)
+
+// hopByHop are the connection-specific headers of RFC 9110 section 7.6.1; Transfer-Encoding is
+// left to fasthttp, which frames the forwarded body itself
+var hopByHop = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Proxy-Authorization", "TE", "Trailer", "Upgrade"}
+
+// scrubHeaders removes the client request headers the policy does not forward. Headers the
+// sidecar manages and the body's framing headers are kept, so it runs after the principal headers
+// and the token mode are applied.
+func scrubHeaders(c fiber.Ctx, policy *ingressconfig.HeaderPolicy) {
+	if policy == nil {
+		return
+	}
+	headers := &c.Request().Header
+	keep := managedHeaders()
+	var drop []string
+	if policy.StripHopByHop && !isWebSocket(c) {
+		for _, name := range strings.Split(string(headers.Peek(fiber.HeaderConnection)), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				drop = append(drop, name)
+			}
+		}
+		drop = append(drop, hopByHop...)
+	}
+	for k := range headers.All() {
+		name := string(k)
+		if !keep[strings.ToLower(name)] && !policy.Forwards(name) {
+			drop = append(drop, name)
+		}
+	}
+	for _, name := range drop {
+		if !keep[strings.ToLower(name)] {
+			headers.Del(name)
+		}
+	}
+}
+
+// managedHeaders returns the lower-cased names of the headers scrubbing never removes
+func managedHeaders() map[string]bool {
+	keep := map[string]bool{}
+	for _, name := range []string{fiber.HeaderHost, fiber.HeaderContentType, fiber.HeaderContentLength,
+		fiber.HeaderAuthorization, fiber.HeaderXRequestID} {
+		keep[strings.ToLower(name)] = true
+	}
+	if header, ok := assertion.Enabled(); ok {
+		keep[strings.ToLower(header)] = true
+	}
+	if conf := ingressconfig.ConfigOrNil(); conf != nil && conf.PrincipalHeaders != nil {
+		h := conf.PrincipalHeaders
+		for _, name := range []string{h.UserIDHeader(), h.UsernameHeader(), h.EmailHeader(), h.Claims} {
+			if name != "" {
+				keep[strings.ToLower(name)] = true
+			}
+		}
+	}
+	return keep
+}
@@ -0,0 +1,65 @@
+package proxyhandler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// scrubbed returns the request headers left after scrubbing under policy
+func scrubbed(t *testing.T, policy *ingressconfig.HeaderPolicy, headers map[string]string) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	app := fiber.New()
+	app.Post("/", func(c fiber.Ctx) error {
+		scrubHeaders(c, policy)
+		for k, v := range c.Request().Header.All() {
+			got[string(k)] = string(v)
+		}
+		return nil
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader("{}"))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestScrubHeaders_Strip(t *testing.T) {
+	got := scrubbed(t, &ingressconfig.HeaderPolicy{StripHopByHop: true, Strip: []string{"Cookie", "X-Internal-*"}}, map[string]string{
+		"Cookie": "session=1", "X-Internal-Route": "blue", "X-Trace-Hint": "a", "Connection": "X-Trace-Hint",
+		"Keep-Alive": "timeout=5", "Accept": "application/json", "Authorization": "Bearer t",
+	})
+	for _, name := range []string{"Cookie", "X-Internal-Route", "X-Trace-Hint", "Connection", "Keep-Alive"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("expected %s to be stripped, got %v", name, got)
+		}
+	}
+	if got["Accept"] != "application/json" || got["Authorization"] != "Bearer t" {
+		t.Fatalf("expected other headers forwarded, got %v", got)
+	}
+}
+
+func TestScrubHeaders_Allowlist(t *testing.T) {
+	got := scrubbed(t, &ingressconfig.HeaderPolicy{Allow: []string{"Accept", "X-Tenant-*"}}, map[string]string{
+		"Accept": "application/json", "X-Tenant-Id": "acme", "User-Agent": "curl", "X-Debug": "1",
+		"Content-Type": "application/json", "X-Request-Id": "r1",
+	})
+	for _, name := range []string{"User-Agent", "X-Debug"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("expected %s not to be forwarded, got %v", name, got)
+		}
+	}
+	for _, name := range []string{"Accept", "X-Tenant-Id", "Content-Type", "X-Request-Id"} {
+		if got[name] == "" {
+			t.Errorf("expected %s to be forwarded, got %v", name, got)
+		}
+	}
+}
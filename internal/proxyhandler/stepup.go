@@ -0,0 +1,63 @@
+package proxyhandler
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// checkStepUp rejects a token that does not meet the step-up requirement of the matched route with
+// an RFC 9470 challenge, so the client can re-authenticate with the acr_values it names
+func checkStepUp(c fiber.Ctx) error {
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	challenge := stepUpChallenge(c.Hostname(), c.Path(), claims)
+	if challenge == "" {
+		return nil
+	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	return fiber.NewError(fiber.StatusUnauthorized, errStepUpRequired)
+}
+
+// errStepUpRequired is the message of a step-up refusal
+const errStepUpRequired = "Step-up authentication required"
+
+// stepUpChallenge returns the WWW-Authenticate challenge for a token whose claims do not meet the
+// step-up requirement of the route matching host and path, or "" when they do
+func stepUpChallenge(host, path string, claims jwt.MapClaims) string {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return ""
+	}
+	stepUp := conf.StepUp(host, path)
+	if stepUp == nil {
+		return ""
+	}
+	acr, _ := claims["acr"].(string)
+	if stepUp.Satisfies(conf, acr, amrClaim(claims)) {
+		return ""
+	}
+	challenge := `Bearer error="insufficient_user_authentication", error_description="A stronger authentication is required"`
+	if stepUp.ACR != "" {
+		challenge += `, acr_values="` + strings.Join(conf.AcceptableACRs(stepUp.ACR), " ") + `"`
+	}
+	return challenge
+}
+
+// amrClaim returns the authentication methods of the amr claim
+func amrClaim(claims jwt.MapClaims) []string {
+	var methods []string
+	switch v := claims["amr"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(string); ok {
+				methods = append(methods, m)
+			}
+		}
+	case string:
+		methods = strings.Fields(v)
+	}
+	return methods
+}
@@ -0,0 +1,61 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestHandler_StepUpChallenge(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		ACRLevels:       []string{"silver", "gold", "platinum"},
+		Routes:          []ingressconfig.Route{{PathPrefix: "/transfers", StepUp: &ingressconfig.StepUp{ACR: "gold", AMR: []string{"mfa"}}}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error { return nil }
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-stepup", &priv.PublicKey)
+	app := fiber.New()
+	app.All("/*", Handler)
+	send := func(path string, claims jwt.MapClaims) (int, string) {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-stepup", priv, claims))
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderWWWAuthenticate)
+	}
+
+	status, challenge := send("/transfers", jwt.MapClaims{"sub": "alice", "acr": "silver", "amr": []string{"pwd"}})
+	want := `Bearer error="insufficient_user_authentication", error_description="A stronger authentication is required", acr_values="gold platinum"`
+	if status != fiber.StatusUnauthorized || challenge != want {
+		t.Fatalf("expected a step-up challenge, got %d %q", status, challenge)
+	}
+	if status, _ := send("/transfers", jwt.MapClaims{"sub": "alice", "acr": "platinum", "amr": []string{"pwd", "mfa"}}); status != 200 {
+		t.Fatalf("expected a stronger acr with mfa to pass, got %d", status)
+	}
+	if status, challenge := send("/accounts", jwt.MapClaims{"sub": "alice", "acr": "silver"}); status != 200 || challenge != "" {
+		t.Fatalf("expected routes without step-up to pass, got %d %q", status, challenge)
+	}
+	// the route is matched on the path the upstream serves
+	if status, _ := send("/accounts/../transfers", jwt.MapClaims{"sub": "alice", "acr": "silver"}); status != fiber.StatusBadRequest {
+		t.Fatalf("expected a dot segment to be refused, got %d", status)
+	}
+	if status, challenge := send("/%74ransfers", jwt.MapClaims{"sub": "alice", "acr": "silver"}); status != fiber.StatusUnauthorized || challenge != want {
+		t.Fatalf("expected an encoded path to get the step-up challenge, got %d %q", status, challenge)
+	}
+}
@@ -0,0 +1,42 @@
+package proxyhandler
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+// selectTenant resolves the tenant of an authenticated request: the one its host or path selects,
+// else the one its token claims. A token claiming another tenant than the request's, or issued by
+// an issuer the tenant does not accept, is rejected. The tenant is stored in Locals and the principal.
+func selectTenant(c fiber.Ctx) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil || conf.Tenancy == nil {
+		return nil
+	}
+	principal, _ := c.Locals("Principal").(jwtauth.Principal)
+	tenant := conf.TenantFor(c.Hostname(), c.Path())
+	switch {
+	case tenant != nil && principal.TenantID != "" && principal.TenantID != tenant.ID:
+		return fiber.NewError(fiber.StatusForbidden, "Token belongs to another tenant")
+	case tenant == nil:
+		tenant = conf.Tenant(principal.TenantID)
+	}
+	if tenant == nil {
+		if conf.Tenancy.Required {
+			return fiber.NewError(fiber.StatusForbidden, "No tenant for this request")
+		}
+		return nil
+	}
+	claims, _ := c.Locals("Claims").(jwt.MapClaims)
+	iss, _ := claims["iss"].(string)
+	if !tenant.AcceptsIssuer(iss) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Token issuer not accepted for this tenant")
+	}
+	principal.TenantID = tenant.ID
+	c.Locals("Principal", principal)
+	c.Locals("Tenant", tenant.ID)
+	return nil
+}
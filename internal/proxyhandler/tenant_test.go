@@ -0,0 +1,66 @@
+package proxyhandler
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestHandler_SelectsTenant(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		DefaultUpstream: "http://default.internal",
+		Tenancy: &ingressconfig.Tenancy{Required: true, Tenants: []ingressconfig.Tenant{
+			{ID: "acme", Hosts: []string{"acme.example.com"}},
+			{ID: "globex", PathPrefix: "/globex"},
+			{ID: "initech", Issuers: []string{"https://idp.initech"}},
+		}},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	var tenant, requestTenant string
+	doProxy = func(c fiber.Ctx, url string, timeout time.Duration) error {
+		p, _ := c.Locals("Principal").(jwtauth.Principal)
+		tenant, requestTenant = p.TenantID, buildRequestInfo(c).Tenant
+		return nil
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtauth.SetPublicKeyForTest("kid-tenant", &priv.PublicKey)
+	app := fiber.New()
+	app.All("/*", Handler)
+	for _, tc := range []struct {
+		name, host, path string
+		claims           jwt.MapClaims
+		status           int
+		tenant           string
+	}{
+		{"by host", "acme.example.com", "/orders", jwt.MapClaims{"sub": "a"}, 200, "acme"},
+		{"by path", "api.example.com", "/globex/orders", jwt.MapClaims{"sub": "a", "tenant_id": "globex"}, 200, "globex"},
+		{"by claim", "api.example.com", "/orders", jwt.MapClaims{"sub": "a", "iss": "https://idp.initech", "tid": "initech"}, 200, "initech"},
+		{"other tenant's token", "acme.example.com", "/orders", jwt.MapClaims{"sub": "a", "tenant_id": "globex"}, fiber.StatusForbidden, ""},
+		{"issuer not accepted", "api.example.com", "/orders", jwt.MapClaims{"sub": "a", "iss": "https://idp.acme", "tid": "initech"}, fiber.StatusUnauthorized, ""},
+		{"no tenant", "api.example.com", "/orders", jwt.MapClaims{"sub": "a"}, fiber.StatusForbidden, ""},
+	} {
+		tenant, requestTenant = "", ""
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Host = tc.host
+		req.Header.Set("Authorization", "Bearer "+makeRSAToken(t, "kid-tenant", priv, tc.claims))
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status || tenant != tc.tenant || requestTenant != tc.tenant {
+			t.Errorf("%s: expected %d with tenant %q, got %d with %q/%q", tc.name, tc.status, tc.tenant, resp.StatusCode, tenant, requestTenant)
+		}
+	}
+}
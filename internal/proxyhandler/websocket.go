@@ -0,0 +1,153 @@
+package proxyhandler
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+)
+
+// handshakeTimeout bounds the upstream WebSocket handshake when the route sets no timeout
+const handshakeTimeout = 10 * time.Second
+
+// maxRejectBody caps the upstream body relayed when it refuses an upgrade
+const maxRejectBody = 64 << 10
+
+// isWebSocket reports whether the request asks to upgrade to the WebSocket protocol
+func isWebSocket(c fiber.Ctx) bool {
+	if !strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") {
+		return false
+	}
+	for _, token := range strings.Split(c.Get(fiber.HeaderConnection), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// unfulfillable denies when a response obligation must be fulfilled on a response that never
+// passes through the sidecar: a tunnelled connection, or a request proxied by an external caller
+func unfulfillable(steps []responseStep, where string) error {
+	for _, step := range steps {
+		if !step.obligation.Advice {
+			return fiber.NewError(fiber.StatusForbidden, "obligation "+step.obligation.Type+" cannot be fulfilled "+where)
+		}
+	}
+	return nil
+}
+
+// tunnel sends the upgrade request, as the pipeline left it, to the upstream. Once the upstream
+// switches protocols the client connection is handed over to a byte tunnel that lasts as long as
+// either side keeps it open; any other answer is returned to the client as a regular response.
+// A variable so tests can stub it.
+var tunnel = func(c fiber.Ctx, target string, timeout time.Duration) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, "invalid upstream")
+	}
+	if timeout <= 0 {
+		timeout = handshakeTimeout
+	}
+	upstream, err := dialUpstream(u, timeout)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadGateway, "upstream unavailable")
+	}
+	_ = upstream.SetDeadline(time.Now().Add(timeout))
+
+	var req fasthttp.Request
+	c.Request().CopyTo(&req)
+	req.SetRequestURI(u.RequestURI())
+	req.Header.SetHost(u.Host)
+	w := bufio.NewWriter(upstream)
+	br := bufio.NewReader(upstream)
+	var resp *http.Response
+	if err = req.Write(w); err == nil {
+		if err = w.Flush(); err == nil {
+			resp, err = http.ReadResponse(br, nil)
+		}
+	}
+	if err != nil {
+		upstream.Close()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return fiber.ErrGatewayTimeout
+		}
+		return fiber.NewError(fiber.StatusBadGateway, "upstream unavailable")
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer upstream.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRejectBody))
+		for name, values := range resp.Header {
+			for _, v := range values {
+				c.Response().Header.Add(name, v)
+			}
+		}
+		c.Response().Header.Del(fiber.HeaderContentLength)
+		return c.Status(resp.StatusCode).Send(body)
+	}
+
+	_ = upstream.SetDeadline(time.Time{})
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.RequestCtx().HijackSetNoResponse(true)
+	c.RequestCtx().Hijack(func(client net.Conn) {
+		defer upstream.Close()
+		_ = client.SetDeadline(time.Time{})
+		if err := resp.Write(client); err != nil {
+			return
+		}
+		// br holds whatever the upstream sent right after its handshake
+		pipe(client, upstream, br)
+	})
+	return nil
+}
+
+// pipe copies both directions until either side closes, then closes both
+func pipe(client, upstream net.Conn, fromUpstream io.Reader) {
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			_ = client.Close()
+			_ = upstream.Close()
+		})
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(upstream, client)
+		closeBoth()
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(client, fromUpstream)
+		closeBoth()
+	}()
+	wg.Wait()
+}
+
+// dialUpstream connects to the upstream of a ws(s) or http(s) URL
+func dialUpstream(u *url.URL, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	addr := u.Host
+	if u.Port() == "" {
+		if secure {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	if secure {
+		return tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+	}
+	return dialer.Dial("tcp", addr)
+}
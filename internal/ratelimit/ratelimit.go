@@ -0,0 +1,127 @@
+// Package ratelimit limits how many requests each client sends through the ingress, per route,
+// with token buckets keyed by the authenticated user ID or, without one, the client IP.
+package ratelimit
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/ipfilter"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/metrics"
+)
+
+// globalRoute keys the buckets of the global rate-limit
+const globalRoute = "*"
+
+// bucket holds the requests a client may still send, refilled continuously up to the limit
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// window is how long the bucket takes to refill completely
+	window time.Duration
+}
+
+// buckets keeps one bucket per route and client, surviving config reloads
+var buckets sync.Map
+
+// sweepInterval is how often buckets are checked for being idle
+const sweepInterval = time.Second
+
+var (
+	sweepMu sync.Mutex
+	// sweptAt is when idle buckets were last dropped
+	sweptAt time.Time
+)
+
+// now is an indirection over the clock to allow deterministic tests
+var now = time.Now
+
+// Check spends one request of the client's budget on the matched route, or the global rate-limit
+// when the route sets none. It sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset
+// headers and, when the budget is spent, returns 429 with Retry-After.
+func Check(c fiber.Ctx, p jwtauth.Principal) error {
+	conf := ingressconfig.ConfigOrNil()
+	if conf == nil {
+		return nil
+	}
+	limit, route := conf.RateLimit, globalRoute
+	if r, ok := conf.MatchRoute(c.Hostname(), c.Path()); ok && r.RateLimit != nil {
+		limit, route = r.RateLimit, r.Key()
+	}
+	if limit == nil {
+		return nil
+	}
+	client := "ip:" + ipfilter.ClientIP(c)
+	if p.UserID != "" {
+		client = "user:" + p.UserID
+	}
+	window := limit.WindowOrDefault()
+	t := now()
+	sweep(t)
+
+	allowed, remaining, reset := take(route+"\x00"+client, limit.Requests, window, t)
+	c.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	c.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+	if !allowed {
+		metrics.IngressRateLimited.WithLabelValues(route).Inc()
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds(reset)))
+		return fiber.NewError(fiber.StatusTooManyRequests, "rate limit exceeded")
+	}
+	return nil
+}
+
+// take spends a token from the client's bucket. It returns whether one was available, how many
+// remain, and how long until the next one (when refused) or until the bucket is full.
+func take(key string, limit int, window time.Duration, t time.Time) (bool, int, time.Duration) {
+	v, ok := buckets.Load(key)
+	if !ok {
+		v, _ = buckets.LoadOrStore(key, &bucket{tokens: float64(limit), last: t, window: window})
+	}
+	b := v.(*bucket)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	perToken := window / time.Duration(limit)
+	b.tokens = math.Min(float64(limit), b.tokens+float64(t.Sub(b.last))/float64(perToken))
+	b.last, b.window = t, window
+	if b.tokens < 1 {
+		return false, 0, time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	b.tokens--
+	return true, int(b.tokens), time.Duration((float64(limit) - b.tokens) * float64(perToken))
+}
+
+// sweep drops buckets idle long enough to have refilled, which a new bucket would start as,
+// at most once per sweepInterval
+func sweep(t time.Time) {
+	sweepMu.Lock()
+	if t.Sub(sweptAt) < sweepInterval {
+		sweepMu.Unlock()
+		return
+	}
+	sweptAt = t
+	sweepMu.Unlock()
+	buckets.Range(func(k, v any) bool {
+		b := v.(*bucket)
+		b.mu.Lock()
+		idle := t.Sub(b.last) > b.window
+		b.mu.Unlock()
+		if idle {
+			buckets.Delete(k)
+		}
+		return true
+	})
+}
+
+// seconds rounds a duration up to whole seconds, as the headers require
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
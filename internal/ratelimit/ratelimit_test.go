@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+)
+
+func TestCheck(t *testing.T) {
+	ingressconfig.SetConfigForTest(&ingressconfig.IngressConfig{
+		RateLimit: &ingressconfig.RateLimit{Requests: 100},
+		Routes: []ingressconfig.Route{
+			{Name: "orders", PathPrefix: "/orders", RateLimit: &ingressconfig.RateLimit{Requests: 2, Window: time.Minute}},
+		},
+	})
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	clock := time.Unix(1_700_000_000, 0)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+
+	app := fiber.New()
+	app.All("/*", func(c fiber.Ctx) error {
+		if err := Check(c, jwtauth.Principal{UserID: c.Get("X-User")}); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	send := func(path, user string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-User", user)
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		rec.Code = resp.StatusCode
+		for k, v := range resp.Header {
+			rec.Header()[k] = v
+		}
+		return rec
+	}
+
+	if r := send("/orders/1", "alice"); r.Code != 200 || r.Header().Get("RateLimit-Remaining") != "1" || r.Header().Get("RateLimit-Limit") != "2" {
+		t.Fatalf("expected the first request allowed with 1 remaining, got %d %v", r.Code, r.Header())
+	}
+	send("/orders/1", "alice")
+	r := send("/orders/1", "alice")
+	if r.Code != fiber.StatusTooManyRequests || r.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected 429 retrying after the 30s a request takes to refill, got %d %v", r.Code, r.Header())
+	}
+
+	// other clients and routes have budgets of their own; anonymous clients are keyed by IP
+	if r := send("/orders/1", "bob"); r.Code != 200 {
+		t.Fatalf("expected another user to be allowed, got %d", r.Code)
+	}
+	if r := send("/reports", "alice"); r.Code != 200 || r.Header().Get("RateLimit-Limit") != "100" {
+		t.Fatalf("expected the global limit on other routes, got %d %v", r.Code, r.Header())
+	}
+	send("/orders/1", "")
+	send("/orders/1", "")
+	if r := send("/orders/1", ""); r.Code != fiber.StatusTooManyRequests {
+		t.Fatalf("expected the client IP to be limited, got %d", r.Code)
+	}
+
+	// the bucket refills over the window
+	clock = clock.Add(30 * time.Second)
+	if r := send("/orders/1", "alice"); r.Code != 200 {
+		t.Fatalf("expected a request to be allowed once refilled, got %d", r.Code)
+	}
+}
@@ -0,0 +1,81 @@
+// Package redisstore connects the subsystems that can share state between sidecar replicas, such as
+// replay protection, to Redis.
+package redisstore
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"reverseProxy/internal/configwatch"
+)
+
+// Config locates a Redis server
+type Config struct {
+	// Addr is host:port of the server
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// PasswordFile reads the password from a file instead, such as a mounted Secret
+	PasswordFile string `yaml:"password-file"`
+	DB           int    `yaml:"db"`
+	// TLS connects with TLS, verifying the server against the system roots
+	TLS bool `yaml:"tls"`
+	// KeyPrefix namespaces the keys written (default "sidecar:")
+	KeyPrefix string `yaml:"key-prefix"`
+	// Timeout bounds each command (default DefaultTimeout)
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultKeyPrefix namespaces keys when the config sets no key-prefix
+const DefaultKeyPrefix = "sidecar:"
+
+// DefaultTimeout bounds each command when the config sets no timeout
+const DefaultTimeout = time.Second
+
+// Prefix returns the configured key prefix or DefaultKeyPrefix
+func (c *Config) Prefix() string {
+	if c.KeyPrefix != "" {
+		return c.KeyPrefix
+	}
+	return DefaultKeyPrefix
+}
+
+// CommandTimeout returns the configured timeout or DefaultTimeout
+func (c *Config) CommandTimeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultTimeout
+}
+
+// NewClient validates c and returns a client for it. Connections are made lazily, so an unreachable
+// server is reported by the first command rather than here.
+func NewClient(c *Config) (*redis.Client, error) {
+	if c == nil || c.Addr == "" {
+		return nil, errors.New("redis: addr is required")
+	}
+	if c.Timeout < 0 {
+		return nil, errors.New("redis: timeout must not be negative")
+	}
+	password, err := configwatch.ResolveSecret(c.Password, c.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("redis: password: %w", err)
+	}
+	opts := &redis.Options{
+		Addr:         c.Addr,
+		Username:     c.Username,
+		Password:     password,
+		DB:           c.DB,
+		DialTimeout:  c.CommandTimeout(),
+		ReadTimeout:  c.CommandTimeout(),
+		WriteTimeout: c.CommandTimeout(),
+	}
+	if c.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(opts), nil
+}
@@ -0,0 +1,189 @@
+// Package replay detects reuse of one-time tokens: it remembers token jtis (and DPoP proof jtis)
+// until they expire and reports a jti presented again, in memory or in Redis shared by replicas.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"reverseProxy/internal/redisstore"
+)
+
+// Config enables replay protection for routes with replay-protection: true
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Store keeps the seen jtis: memory (default) or redis, which replicas share
+	Store string             `yaml:"store"`
+	Redis *redisstore.Config `yaml:"redis"`
+	// MaxEntries bounds the memory store (default DefaultMaxEntries); when it is full of live
+	// jtis, new ones are refused rather than old ones forgotten
+	MaxEntries int `yaml:"max-entries"`
+	// DefaultTTL is how long the jti of a token without exp is remembered (default DefaultTTL)
+	DefaultTTL time.Duration `yaml:"default-ttl"`
+}
+
+// Stores for Config.Store
+const (
+	StoreMemory = "memory"
+	StoreRedis  = "redis"
+)
+
+// Defaults used when the config leaves them unset
+const (
+	DefaultMaxEntries = 100000
+	DefaultTTL        = time.Hour
+)
+
+var (
+	// ErrReplayed reports a jti seen before
+	ErrReplayed = errors.New("token replayed")
+	// ErrFull reports a memory store full of live jtis
+	ErrFull = errors.New("replay cache full")
+)
+
+// store remembers keys until they expire
+type store interface {
+	// remember records key until expires, returning ErrReplayed when it is already recorded
+	remember(ctx context.Context, key string, expires time.Time) error
+}
+
+type installed struct {
+	conf  Config
+	store store
+}
+
+var current atomic.Pointer[installed]
+
+// Configure validates and installs the replay protection config; nil or disabled turns it off.
+// The memory store is kept across reloads that leave the store settings unchanged.
+func Configure(c *Config) error {
+	if c == nil || !c.Enabled {
+		current.Store(nil)
+		return nil
+	}
+	if c.MaxEntries < 0 || c.DefaultTTL < 0 {
+		return errors.New("replay-protection: max-entries and default-ttl must not be negative")
+	}
+	var s store
+	switch c.Store {
+	case "", StoreMemory:
+		maxEntries := c.MaxEntries
+		if maxEntries == 0 {
+			maxEntries = DefaultMaxEntries
+		}
+		if prev := current.Load(); prev != nil {
+			if mem, ok := prev.store.(*memoryStore); ok && mem.max == maxEntries {
+				s = mem
+			}
+		}
+		if s == nil {
+			s = newMemoryStore(maxEntries)
+		}
+	case StoreRedis:
+		client, err := redisstore.NewClient(c.Redis)
+		if err != nil {
+			return fmt.Errorf("replay-protection: %w", err)
+		}
+		s = &redisStore{client: client, prefix: c.Redis.Prefix() + "jti:", timeout: c.Redis.CommandTimeout()}
+	default:
+		return fmt.Errorf("replay-protection: unknown store %q", c.Store)
+	}
+	current.Store(&installed{conf: *c, store: s})
+	return nil
+}
+
+// Enabled reports whether replay protection is configured
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Check records the jti of a token from issuer until exp, or for the default TTL when the token has
+// no exp, returning ErrReplayed when the token was presented before. Other errors mean the store
+// could not be consulted.
+func Check(ctx context.Context, issuer, jti string, exp time.Time) error {
+	in := current.Load()
+	if in == nil {
+		return errors.New("replay protection is not enabled")
+	}
+	if exp.IsZero() {
+		ttl := in.conf.DefaultTTL
+		if ttl == 0 {
+			ttl = DefaultTTL
+		}
+		exp = time.Now().Add(ttl)
+	}
+	return in.store.remember(ctx, "token:"+issuer+"|"+jti, exp)
+}
+
+// CheckProof records a DPoP proof jti until expires, returning ErrReplayed when it was used before
+func CheckProof(ctx context.Context, jti string, expires time.Time) error {
+	in := current.Load()
+	if in == nil {
+		return errors.New("replay protection is not enabled")
+	}
+	return in.store.remember(ctx, "dpop:"+jti, expires)
+}
+
+// memoryStore keeps the jtis of this replica
+type memoryStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	max  int
+}
+
+func newMemoryStore(max int) *memoryStore {
+	return &memoryStore{seen: make(map[string]time.Time), max: max}
+}
+
+func (m *memoryStore) remember(_ context.Context, key string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if until, ok := m.seen[key]; ok && now.Before(until) {
+		return ErrReplayed
+	}
+	if len(m.seen) >= m.max {
+		for k, until := range m.seen {
+			if !now.Before(until) {
+				delete(m.seen, k)
+			}
+		}
+		if len(m.seen) >= m.max {
+			// fail closed rather than forget jtis that are still live
+			return ErrFull
+		}
+	}
+	m.seen[key] = expires
+	return nil
+}
+
+// redisStore shares the jtis between replicas with SET NX and an expiry
+type redisStore struct {
+	client  *redis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+func (r *redisStore) remember(ctx context.Context, key string, expires time.Time) error {
+	ttl := time.Until(expires)
+	if ttl <= 0 {
+		// already expired: validation rejects the token anyway, and nothing needs remembering
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	ok, err := r.client.SetNX(ctx, r.prefix+key, 1, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("replay store: %w", err)
+	}
+	if !ok {
+		return ErrReplayed
+	}
+	return nil
+}
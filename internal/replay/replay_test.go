@@ -0,0 +1,89 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"reverseProxy/internal/redisstore"
+)
+
+func TestCheck_Memory(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, MaxEntries: 2}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exp := time.Now().Add(time.Minute)
+
+	if err := Check(ctx, "https://idp", "a", exp); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := Check(ctx, "https://idp", "a", exp); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("expected a replay, got %v", err)
+	}
+	if err := Check(ctx, "https://other", "a", exp); err != nil {
+		t.Fatalf("expected jtis to be scoped by issuer, got %v", err)
+	}
+	if err := Check(ctx, "https://idp", "b", exp); !errors.Is(err, ErrFull) {
+		t.Fatalf("expected a full cache to refuse new jtis, got %v", err)
+	}
+
+	// an expired entry makes room and may be used again
+	if err := Configure(&Config{Enabled: true, MaxEntries: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, "https://idp", "c", time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, "https://idp", "d", exp); err != nil {
+		t.Fatalf("expected the expired jti to be pruned, got %v", err)
+	}
+}
+
+func TestCheck_Redis(t *testing.T) {
+	srv := miniredis.RunT(t)
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, Store: StoreRedis, Redis: &redisstore.Config{Addr: srv.Addr()}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	exp := time.Now().Add(time.Minute)
+
+	if err := Check(ctx, "https://idp", "a", exp); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := Check(ctx, "https://idp", "a", exp); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("expected a replay, got %v", err)
+	}
+	if ttl := srv.TTL("sidecar:jti:token:https://idp|a"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected the jti to expire with the token, got ttl %v", ttl)
+	}
+	if err := CheckProof(ctx, "a", exp); err != nil {
+		t.Fatalf("expected proof jtis apart from token jtis, got %v", err)
+	}
+
+	srv.Close()
+	if err := Check(ctx, "https://idp", "b", exp); err == nil || errors.Is(err, ErrReplayed) {
+		t.Fatalf("expected an unreachable store to be reported, got %v", err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	for name, c := range map[string]*Config{
+		"unknown store":      {Enabled: true, Store: "etcd"},
+		"redis without addr": {Enabled: true, Store: StoreRedis},
+		"negative ttl":       {Enabled: true, DefaultTTL: -time.Second},
+	} {
+		if err := Configure(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := Configure(&Config{Enabled: false, Store: "etcd"}); err != nil || Enabled() {
+		t.Fatalf("expected a disabled config to turn replay protection off, got %v", err)
+	}
+}
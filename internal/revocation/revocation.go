@@ -0,0 +1,307 @@
+// Package revocation cuts off compromised tokens before they expire: validated tokens are checked
+// against a denylist of revoked jtis and subjects, read from a file, polled from an HTTP endpoint
+// or looked up in Redis sets.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/redisstore"
+)
+
+// Config enables the denylist check of every validated token
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// File is a YAML or JSON denylist ({jtis: [...], subjects: [...]}), re-read every refresh-interval
+	File string `yaml:"file"`
+	// URL serves a denylist in the same format, polled every refresh-interval
+	URL string `yaml:"url"`
+	// RefreshInterval is how often File and URL are re-read (default DefaultRefreshInterval)
+	RefreshInterval time.Duration `yaml:"refresh-interval"`
+	// Redis looks each token up in the sets <key-prefix>revoked:jtis and <key-prefix>revoked:subjects
+	Redis *redisstore.Config `yaml:"redis"`
+}
+
+// List is the denylist document read from File and URL
+type List struct {
+	JTIs     []string `yaml:"jtis" json:"jtis"`
+	Subjects []string `yaml:"subjects" json:"subjects"`
+}
+
+// DefaultRefreshInterval applies when the config sets no refresh-interval
+const DefaultRefreshInterval = time.Minute
+
+// ErrRevoked reports a token on the denylist
+var ErrRevoked = errors.New("token revoked")
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// denylist is the merged content of the file and URL lists
+type denylist struct {
+	jtis     map[string]struct{}
+	subjects map[string]struct{}
+}
+
+type installed struct {
+	conf  Config
+	redis *redis.Client
+
+	mu sync.Mutex
+	// file and remote are the last lists read successfully; merged is published for lookups
+	file, remote List
+	merged       atomic.Pointer[denylist]
+	lastRefresh  time.Time
+	lastErr      error
+}
+
+var current atomic.Pointer[installed]
+
+// Configure validates and installs the revocation config; nil or disabled turns the check off.
+// The file is read at once, so a missing or malformed denylist fails the load. The list last
+// fetched from an unchanged URL is kept until the next poll; a URL changed by a reload is fetched
+// in the background.
+func Configure(c *Config) error {
+	if c == nil || !c.Enabled {
+		current.Store(nil)
+		return nil
+	}
+	if c.File == "" && c.URL == "" && c.Redis == nil {
+		return errors.New("revocation: one of file, url or redis is required")
+	}
+	if c.RefreshInterval < 0 {
+		return errors.New("revocation: refresh-interval must not be negative")
+	}
+	in := &installed{conf: *c}
+	if c.Redis != nil {
+		client, err := redisstore.NewClient(c.Redis)
+		if err != nil {
+			return fmt.Errorf("revocation: %w", err)
+		}
+		in.redis = client
+	}
+	if c.File != "" {
+		list, err := readFile(c.File)
+		if err != nil {
+			return fmt.Errorf("revocation: %w", err)
+		}
+		in.file = list
+	}
+	prev := current.Load()
+	urlKept := prev != nil && prev.conf.URL == c.URL
+	if urlKept {
+		prev.mu.Lock()
+		in.remote = prev.remote
+		prev.mu.Unlock()
+	}
+	in.publish()
+	current.Store(in)
+	if prev != nil && c.URL != "" && !urlKept {
+		// a reload's new URL is fetched now rather than at the next poll; at startup Run fetches first
+		go func() {
+			if err := in.refresh(context.Background()); err != nil {
+				slog.Warn("error fetching revocation list", slog.Any("error", err))
+			}
+		}()
+	}
+	return nil
+}
+
+// Enabled reports whether tokens are checked against a denylist
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Check returns ErrRevoked when the token's jti or subject is on the denylist. Other errors mean
+// the Redis sets could not be consulted.
+func Check(ctx context.Context, subject, jti string) error {
+	in := current.Load()
+	if in == nil {
+		return nil
+	}
+	if d := in.merged.Load(); d != nil {
+		if _, ok := d.jtis[jti]; ok && jti != "" {
+			return ErrRevoked
+		}
+		if _, ok := d.subjects[subject]; ok && subject != "" {
+			return ErrRevoked
+		}
+	}
+	if in.redis == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, in.conf.Redis.CommandTimeout())
+	defer cancel()
+	prefix := in.conf.Redis.Prefix() + "revoked:"
+	pipe := in.redis.Pipeline()
+	jtiRevoked := pipe.SIsMember(ctx, prefix+"jtis", jti)
+	subjectRevoked := pipe.SIsMember(ctx, prefix+"subjects", subject)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("revocation store: %w", err)
+	}
+	if (jti != "" && jtiRevoked.Val()) || (subject != "" && subjectRevoked.Val()) {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// Status describes the installed denylist for the admin API
+type Status struct {
+	JTIs        int        `json:"jtis"`
+	Subjects    int        `json:"subjects"`
+	Redis       bool       `json:"redis"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// CurrentStatus returns the denylist status, and false when revocation is off
+func CurrentStatus() (Status, bool) {
+	in := current.Load()
+	if in == nil {
+		return Status{}, false
+	}
+	st := Status{Redis: in.redis != nil}
+	if d := in.merged.Load(); d != nil {
+		st.JTIs, st.Subjects = len(d.jtis), len(d.subjects)
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if !in.lastRefresh.IsZero() {
+		t := in.lastRefresh
+		st.LastRefresh = &t
+	}
+	if in.lastErr != nil {
+		st.LastError = in.lastErr.Error()
+	}
+	return st, true
+}
+
+// Run re-reads the denylist file and polls the URL every refresh-interval until ctx is done.
+// A failed read keeps the last list read successfully.
+func Run(ctx context.Context) {
+	for {
+		interval := DefaultRefreshInterval
+		if in := current.Load(); in != nil {
+			if err := in.refresh(ctx); err != nil {
+				slog.Warn("error refreshing revocation list", slog.Any("error", err))
+			}
+			if in.conf.RefreshInterval > 0 {
+				interval = in.conf.RefreshInterval
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Refresh re-reads the denylist file and URL at once
+func Refresh(ctx context.Context) error {
+	in := current.Load()
+	if in == nil {
+		return nil
+	}
+	return in.refresh(ctx)
+}
+
+func (in *installed) refresh(ctx context.Context) error {
+	var errs []error
+	var file, remote *List
+	if in.conf.File != "" {
+		if list, err := readFile(in.conf.File); err != nil {
+			errs = append(errs, err)
+		} else {
+			file = &list
+		}
+	}
+	if in.conf.URL != "" {
+		if list, err := fetch(ctx, in.conf.URL); err != nil {
+			errs = append(errs, err)
+		} else {
+			remote = &list
+		}
+	}
+	err := errors.Join(errs...)
+
+	in.mu.Lock()
+	if file != nil {
+		in.file = *file
+	}
+	if remote != nil {
+		in.remote = *remote
+	}
+	in.lastRefresh = time.Now()
+	in.lastErr = err
+	in.mu.Unlock()
+	in.publish()
+	return err
+}
+
+// publish merges the file and URL lists into the set used by Check
+func (in *installed) publish() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	d := &denylist{jtis: map[string]struct{}{}, subjects: map[string]struct{}{}}
+	for _, list := range []List{in.file, in.remote} {
+		for _, jti := range list.JTIs {
+			d.jtis[jti] = struct{}{}
+		}
+		for _, sub := range list.Subjects {
+			d.subjects[sub] = struct{}{}
+		}
+	}
+	in.merged.Store(d)
+}
+
+func readFile(path string) (List, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return List{}, err
+	}
+	return parse(path, b)
+}
+
+func fetch(ctx context.Context, url string) (List, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return List{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return List{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return List{}, fmt.Errorf("%s answered %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxListBytes))
+	if err != nil {
+		return List{}, err
+	}
+	return parse(url, b)
+}
+
+// maxListBytes bounds a denylist fetched from the URL
+const maxListBytes = 16 << 20
+
+// parse reads a denylist; JSON documents are valid YAML
+func parse(source string, b []byte) (List, error) {
+	var list List
+	if err := yaml.Unmarshal(b, &list); err != nil {
+		return List{}, fmt.Errorf("%s: %w", source, err)
+	}
+	return list, nil
+}
@@ -0,0 +1,111 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"reverseProxy/internal/redisstore"
+)
+
+func TestCheck_FileAndURL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "revoked.yaml")
+	if err := os.WriteFile(file, []byte("jtis: [jti-file]\nsubjects: [mallory]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var remote atomic.Value
+	remote.Store(`{"jtis": ["jti-url"]}`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := remote.Load().(string)
+		if body == "" {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, File: file, URL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		sub, jti string
+		revoked  bool
+	}{
+		{"alice", "jti-file", true},
+		{"alice", "jti-url", true},
+		{"mallory", "other", true},
+		{"alice", "other", false},
+		{"", "", false},
+	} {
+		if err := Check(ctx, tc.sub, tc.jti); errors.Is(err, ErrRevoked) != tc.revoked {
+			t.Errorf("Check(%q, %q) = %v, want revoked %v", tc.sub, tc.jti, err, tc.revoked)
+		}
+	}
+
+	// a failed poll keeps the last list; a successful one replaces it
+	remote.Store("")
+	if err := Refresh(ctx); err == nil {
+		t.Fatal("expected the failed poll to be reported")
+	}
+	if err := Check(ctx, "alice", "jti-url"); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected the last list to be kept, got %v", err)
+	}
+	remote.Store(`{"jtis": []}`)
+	if err := Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, "alice", "jti-url"); err != nil {
+		t.Fatalf("expected the jti to be reinstated, got %v", err)
+	}
+	if st, ok := CurrentStatus(); !ok || st.JTIs != 1 || st.Subjects != 1 || st.LastRefresh == nil {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestCheck_Redis(t *testing.T) {
+	srv := miniredis.RunT(t)
+	t.Cleanup(func() { _ = Configure(nil) })
+	if err := Configure(&Config{Enabled: true, Redis: &redisstore.Config{Addr: srv.Addr(), KeyPrefix: "test:"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.SAdd("test:revoked:subjects", "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := Check(ctx, "mallory", "j1"); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected the subject to be revoked, got %v", err)
+	}
+	if err := Check(ctx, "alice", "j1"); err != nil {
+		t.Fatalf("expected alice to pass, got %v", err)
+	}
+	srv.Close()
+	if err := Check(ctx, "alice", "j1"); err == nil || errors.Is(err, ErrRevoked) {
+		t.Fatalf("expected an unreachable store to be reported, got %v", err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { _ = Configure(nil) })
+	for name, c := range map[string]*Config{
+		"no source":    {Enabled: true},
+		"missing file": {Enabled: true, File: "/nonexistent/revoked.yaml"},
+		"bad redis":    {Enabled: true, Redis: &redisstore.Config{}},
+	} {
+		if err := Configure(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
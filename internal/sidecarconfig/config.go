@@ -0,0 +1,122 @@
+// Package sidecarconfig loads the unified configuration file, which carries the ingress,
+// authorization and egress configurations as sections of one versioned document. The file is
+// checked strictly before anything is loaded: unknown keys, wrong types, a missing version or
+// ingress section are all reported at once, each with its line.
+package sidecarconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/envsubst"
+	"reverseProxy/internal/ingressconfig"
+)
+
+// CurrentVersion is the version of the unified file layout this build reads
+const CurrentVersion = 1
+
+// Sections of the unified file
+const (
+	SectionIngress       = "ingress"
+	SectionAuthorization = "authorization"
+	SectionEgress        = "egress"
+)
+
+// schema is the layout of the unified file; sections use the same keys as the separate files
+type schema struct {
+	// Version is required and must be CurrentVersion
+	Version       int                         `yaml:"version"`
+	Ingress       ingressconfig.IngressConfig `yaml:"ingress"`
+	Authorization authorization.Config        `yaml:"authorization"`
+	Egress        egressconfig.EgressConfig   `yaml:"egress"`
+}
+
+// sectionOrder is the order sections load in, with the function loading each
+var sectionOrder = []struct {
+	name string
+	load func(*yaml.Node) error
+}{
+	{SectionIngress, ingressconfig.LoadNode},
+	{SectionAuthorization, authorization.LoadNode},
+	{SectionEgress, egressconfig.LoadNode},
+}
+
+// Load reads the unified file at path and loads the named sections, or every section present when
+// none are named. Nothing is loaded when the file fails its checks; otherwise each section loads on
+// its own, a section that fails keeping its previous config active.
+func Load(path string, sections ...string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	nodes, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range sectionOrder {
+		n, ok := nodes[s.name]
+		if !ok || (len(sections) > 0 && !slices.Contains(sections, s.name)) {
+			continue
+		}
+		if err := s.load(n); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Parse expands environment placeholders in the unified file data and checks it against the
+// schema, returning the node of each section present
+func Parse(data []byte) (map[string]*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("the config file must be a mapping with version and ingress, authorization and egress sections")
+	}
+	if err := envsubst.ExpandNode(&doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	errs := checkKeys(root, reflect.TypeFor[schema](), "")
+	var s schema
+	if err := root.Decode(&s); err != nil {
+		var te *yaml.TypeError
+		if errors.As(err, &te) {
+			for _, msg := range te.Errors {
+				errs = append(errs, errors.New(msg))
+			}
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	nodes := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		nodes[root.Content[i].Value] = root.Content[i+1]
+	}
+	if _, ok := nodes["version"]; !ok {
+		errs = append(errs, fmt.Errorf("version: required; set version: %d", CurrentVersion))
+	} else if s.Version != CurrentVersion {
+		errs = append(errs, fmt.Errorf("line %d: version: unsupported version %d, this build reads version %d",
+			nodes["version"].Line, s.Version, CurrentVersion))
+	}
+	delete(nodes, "version")
+	if _, ok := nodes[SectionIngress]; !ok {
+		errs = append(errs, fmt.Errorf("%s: required section missing; it takes the keys of ingress-config.yaml", SectionIngress))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nodes, nil
+}
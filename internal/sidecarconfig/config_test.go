@@ -0,0 +1,96 @@
+package sidecarconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/ingressconfig"
+)
+
+const validFile = `version: 1
+ingress:
+  default-upstream: http://app:8080
+  authn:
+    issuers:
+      - issuer: https://idp.test
+        jwks-url: https://idp.test/keys
+authorization:
+  coarse-check:
+    enabled: true
+    validation-url: http://authz/coarse
+    resource-map:
+      "[/orders/*:GET]": orders-read
+egress:
+  multi-oauth-client-config:
+    ping:
+      tokenUrl: https://ping.test/token
+      clientId: ping-client
+      clientSecret: ${PING_SECRET:-dev-secret}
+`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sidecar.yaml")
+	if err := os.WriteFile(path, []byte(validFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ingressconfig.SetConfigForTest(nil)
+		authorization.SetConfigForTest(nil)
+	})
+
+	if err := Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if conf := ingressconfig.ConfigOrNil(); conf == nil || conf.DefaultUpstream != "http://app:8080" {
+		t.Fatalf("expected the ingress section to be loaded, got %+v", conf)
+	}
+	if conf := authorization.ConfigOrNil(); conf == nil || conf.Coarse.ValidationURL != "http://authz/coarse" {
+		t.Fatalf("expected the authorization section to be loaded, got %+v", conf)
+	}
+	if ping, err := egressconfig.GetOAuthConfig("ping"); err != nil || ping.ClientSecret != "dev-secret" {
+		t.Fatalf("expected the egress section to be loaded with its placeholder expanded, got %+v, %v", ping, err)
+	}
+}
+
+func TestParse_ReportsEveryProblem(t *testing.T) {
+	data := `version: 2
+ingress:
+  max-in-flight: lots
+  default-upstreams: http://app
+authorization:
+  coarse-check:
+    client-secrte: x
+egress:
+  multi-oauth-client-config:
+    ping:
+      tokenURL: https://ping.test/token
+extra: true
+`
+	_, err := Parse([]byte(data))
+	if err == nil {
+		t.Fatal("expected the file to be rejected")
+	}
+	for _, want := range []string{
+		`line 1: version: unsupported version 2`,
+		`line 3: cannot unmarshal !!str`,
+		`line 4: unknown key "default-upstreams" in ingress; did you mean "default-upstream"?`,
+		`line 7: unknown key "client-secrte" in authorization.coarse-check; did you mean "client-secret"?`,
+		`line 11: unknown key "tokenURL" in egress.multi-oauth-client-config.ping; did you mean "tokenUrl"?`,
+		`line 12: unknown key "extra" at the top level`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestParse_RequiresVersionAndIngress(t *testing.T) {
+	_, err := Parse([]byte("authorization: {}\n"))
+	if err == nil || !strings.Contains(err.Error(), "version: required") || !strings.Contains(err.Error(), "ingress: required section missing") {
+		t.Fatalf("expected missing version and ingress to be reported, got %v", err)
+	}
+}
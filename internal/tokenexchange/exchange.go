@@ -0,0 +1,214 @@
+package tokenexchange
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/tracing"
+)
+
+// Config enables RFC 8693 token exchange of the validated client token for a backend-audience token
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// TokenEndpoint is the exchange URL; when empty the token_endpoint discovered for Issuer is used
+	TokenEndpoint string `yaml:"token-endpoint"`
+	Issuer        string `yaml:"issuer"`
+	ClientID      string `yaml:"client-id"`
+	ClientSecret  string `yaml:"client-secret"`
+	// ClientAuthMethod is client_secret_basic (default) or client_secret_post
+	ClientAuthMethod string `yaml:"client-auth-method"`
+	// Audience is requested when a route does not set token-audience
+	Audience string `yaml:"audience"`
+	Scope    string `yaml:"scope"`
+}
+
+// RFC 8693 grant and token type identifiers
+const (
+	grantType       = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+const (
+	// defaultExpiresIn is assumed when the response omits expires_in
+	defaultExpiresIn = time.Minute
+	// expiryMargin drops cached tokens shortly before they expire upstream
+	expiryMargin = 5 * time.Second
+	maxEntries   = 10000
+)
+
+var current atomic.Pointer[Config]
+
+var client = &http.Client{Timeout: 5 * time.Second}
+
+type entry struct {
+	token   string
+	expires time.Time
+}
+
+var cacheMu sync.Mutex
+var cache = make(map[[sha256.Size]byte]entry)
+
+// Configure installs the exchange config and drops previously exchanged tokens; nil disables exchange
+func Configure(conf *Config) error {
+	if conf != nil && conf.Enabled {
+		if conf.TokenEndpoint == "" && conf.Issuer == "" {
+			return errors.New("token-exchange: token-endpoint or issuer is required")
+		}
+		switch conf.ClientAuthMethod {
+		case "", "client_secret_basic", "client_secret_post":
+		default:
+			return fmt.Errorf("token-exchange: unsupported client auth method: %s", conf.ClientAuthMethod)
+		}
+	} else {
+		conf = nil
+	}
+	current.Store(conf)
+	cacheMu.Lock()
+	cache = make(map[[sha256.Size]byte]entry)
+	cacheMu.Unlock()
+	return nil
+}
+
+// Enabled reports whether token exchange is configured
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// Exchange trades subjectToken for a token scoped to audience (the configured audience when empty).
+// Results are cached per subject token and audience until shortly before they expire, and never
+// beyond notAfter, the subject token's own expiry (zero when unknown), so an exchanged token is only
+// reused for the token, and so the issuer, user and tenant, it was issued for.
+func Exchange(ctx context.Context, subjectToken, audience string, notAfter time.Time) (string, error) {
+	conf := current.Load()
+	if conf == nil {
+		return "", errors.New("token exchange is not enabled")
+	}
+	if subjectToken == "" {
+		return "", errors.New("token exchange requires a subject token")
+	}
+	if audience == "" {
+		audience = conf.Audience
+	}
+
+	key := sha256.Sum256([]byte(subjectToken + "\x00" + audience))
+	if token, ok := cached(key); ok {
+		return token, nil
+	}
+
+	endpoint := conf.TokenEndpoint
+	if endpoint == "" {
+		if is, ok := jwtauth.ResolveIssuer(conf.Issuer); ok {
+			if md := is.Metadata(); md != nil {
+				endpoint = md.TokenEndpoint
+			}
+		}
+	}
+	if endpoint == "" {
+		return "", errors.New("no token exchange endpoint configured or discovered")
+	}
+
+	token, expiresIn, err := postExchange(ctx, *conf, endpoint, subjectToken, audience)
+	if err != nil {
+		return "", err
+	}
+	if expiresIn <= 0 {
+		expiresIn = defaultExpiresIn
+	}
+	expires := time.Now().Add(expiresIn - expiryMargin)
+	if !notAfter.IsZero() && notAfter.Before(expires) {
+		expires = notAfter
+	}
+	store(key, entry{token: token, expires: expires})
+	return token, nil
+}
+
+type exchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func postExchange(ctx context.Context, conf Config, endpoint, subjectToken, audience string) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type":           {grantType},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {accessTokenType},
+		"requested_token_type": {accessTokenType},
+	}
+	if audience != "" {
+		form.Set("audience", audience)
+	}
+	if conf.Scope != "" {
+		form.Set("scope", conf.Scope)
+	}
+	if conf.ClientAuthMethod == "client_secret_post" {
+		form.Set("client_id", conf.ClientID)
+		form.Set("client_secret", conf.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if conf.ClientAuthMethod != "client_secret_post" && conf.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+	tracing.InjectHTTP(ctx, req.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token exchange endpoint returned %s", resp.Status)
+	}
+	var body exchangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", 0, fmt.Errorf("decoding token exchange response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return "", 0, errors.New("token exchange response has no access_token")
+	}
+	return body.AccessToken, time.Duration(body.ExpiresIn) * time.Second, nil
+}
+
+func cached(key [sha256.Size]byte) (string, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	e, ok := cache[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expires) {
+		delete(cache, key)
+		return "", false
+	}
+	return e.token, true
+}
+
+func store(key [sha256.Size]byte, e entry) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if len(cache) >= maxEntries {
+		now := time.Now()
+		for k, old := range cache {
+			if now.After(old.expires) {
+				delete(cache, k)
+			}
+		}
+	}
+	if len(cache) < maxEntries {
+		cache[key] = e
+	}
+}
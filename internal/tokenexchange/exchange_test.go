@@ -0,0 +1,125 @@
+package tokenexchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExchangeCachesBySubjectTokenAndAudience(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.PostForm.Get("grant_type") != grantType || r.PostForm.Get("subject_token") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if id, secret, _ := r.BasicAuth(); id != "sidecar" || secret != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "exchanged-for-" + r.PostForm.Get("audience"),
+			"expires_in":   300,
+		})
+	}))
+	defer srv.Close()
+
+	if err := Configure(&Config{Enabled: true, TokenEndpoint: srv.URL, ClientID: "sidecar", ClientSecret: "s3cret", Audience: "default-api"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	ctx := context.Background()
+	got, err := Exchange(ctx, "subject-token", "", time.Time{})
+	if err != nil || got != "exchanged-for-default-api" {
+		t.Fatalf("expected default audience token, got %q %v", got, err)
+	}
+	if got, _ := Exchange(ctx, "subject-token", "", time.Time{}); got != "exchanged-for-default-api" || calls.Load() != 1 {
+		t.Errorf("expected cached token for the same subject token, got %q after %d calls", got, calls.Load())
+	}
+	if got, _ := Exchange(ctx, "subject-token", "orders", time.Time{}); got != "exchanged-for-orders" || calls.Load() != 2 {
+		t.Errorf("expected a new exchange for another audience, got %q after %d calls", got, calls.Load())
+	}
+}
+
+func TestExchangeNeverSharesTokensBetweenPrincipals(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "for-" + r.PostForm.Get("subject_token"), "expires_in": 300})
+	}))
+	defer srv.Close()
+	if err := Configure(&Config{Enabled: true, TokenEndpoint: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	// standard OIDC tokens carry sub, not user_id, so nothing but the token tells the callers apart
+	ctx := context.Background()
+	alice, _ := Exchange(ctx, "alice-token", "orders", time.Time{})
+	bob, _ := Exchange(ctx, "bob-token", "orders", time.Time{})
+	if alice != "for-alice-token" || bob != "for-bob-token" {
+		t.Fatalf("expected each principal to get its own token, got %q and %q", alice, bob)
+	}
+	if _, err := Exchange(ctx, "", "orders", time.Time{}); err == nil {
+		t.Errorf("expected an error without a subject token")
+	}
+}
+
+func TestExchangeCacheEndsWithSubjectToken(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "exchanged", "expires_in": 3600})
+	}))
+	defer srv.Close()
+	if err := Configure(&Config{Enabled: true, TokenEndpoint: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+
+	ctx := context.Background()
+	expired := time.Now().Add(-time.Second)
+	_, _ = Exchange(ctx, "expiring-token", "orders", expired)
+	_, _ = Exchange(ctx, "expiring-token", "orders", expired)
+	if calls.Load() != 2 {
+		t.Fatalf("expected no reuse past the subject token's expiry, got %d calls", calls.Load())
+	}
+}
+
+func TestExchangeErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	if _, err := Exchange(context.Background(), "t", "", time.Time{}); err == nil {
+		t.Errorf("expected an error while exchange is disabled")
+	}
+	if err := Configure(&Config{Enabled: true, TokenEndpoint: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = Configure(nil) })
+	if _, err := Exchange(context.Background(), "t", "api", time.Time{}); err == nil {
+		t.Errorf("expected an error when the endpoint rejects the exchange")
+	}
+}
+
+func TestConfigureValidates(t *testing.T) {
+	if err := Configure(&Config{Enabled: true}); err == nil {
+		t.Errorf("expected an error without token-endpoint or issuer")
+	}
+	if err := Configure(&Config{Enabled: true, TokenEndpoint: "http://idp", ClientAuthMethod: "private_key_jwt"}); err == nil {
+		t.Errorf("expected an error for an unsupported client auth method")
+	}
+	if err := Configure(&Config{Enabled: false}); err != nil || Enabled() {
+		t.Errorf("expected a disabled config to turn exchange off, got %v", err)
+	}
+}
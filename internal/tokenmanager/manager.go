@@ -1,11 +1,14 @@
 package tokenmanager
 
 import (
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/metrics"
 	"reverseProxy/internal/oauthclient"
 )
 
@@ -14,6 +17,20 @@ type TokenManager struct {
 	mu      sync.Mutex
 	stopCh  map[string]chan struct{}
 	running bool
+	// inflight collapses concurrent background refreshes for the same IDP type
+	inflight singleflight.Group
+	// interval is the refresh interval of the running routines, reused by Reload
+	interval time.Duration
+	// status records the outcome of the latest refresh per IDP type
+	statusMu sync.Mutex
+	status   map[string]IDPStatus
+}
+
+// IDPStatus describes the latest token refresh attempt for an IDP type
+type IDPStatus struct {
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
 }
 
 var instance *TokenManager
@@ -24,6 +41,7 @@ func GetInstance() *TokenManager {
 	once.Do(func() {
 		instance = &TokenManager{
 			stopCh: make(map[string]chan struct{}),
+			status: make(map[string]IDPStatus),
 		}
 	})
 	return instance
@@ -39,6 +57,7 @@ func (tm *TokenManager) StartTokenRefresh(refreshInterval time.Duration) error {
 	}
 
 	tm.running = true
+	tm.interval = refreshInterval
 
 	// Get all configured IDP types
 	idpTypes := egressconfig.GetAllIDPTypes()
@@ -48,7 +67,7 @@ func (tm *TokenManager) StartTokenRefresh(refreshInterval time.Duration) error {
 	}
 
 	// Also handle "noIdp" case - no token fetching needed
-	log.Println("Token refresh started for all configured IDP types")
+	slog.Info("token refresh started", slog.Int("idp_types", len(idpTypes)))
 	return nil
 }
 
@@ -61,7 +80,7 @@ func (tm *TokenManager) startRefreshForIDP(idpType string, interval time.Duratio
 		// Fetch token immediately on startup
 		err := tm.refreshTokenForIDP(idpType)
 		if err != nil {
-			log.Printf("Failed to fetch initial token for IDP type '%s': %v", idpType, err)
+			slog.Warn("failed to fetch initial token", slog.String("idp_type", idpType), slog.Any("error", err))
 		}
 
 		// Then refresh periodically
@@ -73,10 +92,10 @@ func (tm *TokenManager) startRefreshForIDP(idpType string, interval time.Duratio
 			case <-ticker.C:
 				err := tm.refreshTokenForIDP(idpType)
 				if err != nil {
-					log.Printf("Failed to refresh token for IDP type '%s': %v", idpType, err)
+					slog.Warn("failed to refresh token", slog.String("idp_type", idpType), slog.Any("error", err))
 				}
 			case <-stopCh:
-				log.Printf("Stopped token refresh for IDP type '%s'", idpType)
+				slog.Info("stopped token refresh", slog.String("idp_type", idpType))
 				return
 			}
 		}
@@ -85,17 +104,77 @@ func (tm *TokenManager) startRefreshForIDP(idpType string, interval time.Duratio
 
 // refreshTokenForIDP refreshes the token for a specific IDP type
 func (tm *TokenManager) refreshTokenForIDP(idpType string) error {
-	client, err := oauthclient.NewOAuthClient(idpType)
+	err := tm.fetchAndStore(idpType)
+	tm.recordAttempt(idpType, err)
 	if err != nil {
 		return err
 	}
 
-	if err := client.RefreshToken(); err != nil {
+	slog.Info("refreshed token", slog.String("idp_type", idpType))
+	return nil
+}
+
+func (tm *TokenManager) fetchAndStore(idpType string) error {
+	client, err := oauthclient.NewOAuthClient(idpType)
+	if err != nil {
 		return err
 	}
+	return client.RefreshToken()
+}
 
-	log.Printf("Successfully refreshed token for IDP type '%s'", idpType)
-	return nil
+func (tm *TokenManager) recordAttempt(idpType string, err error) {
+	tm.statusMu.Lock()
+	defer tm.statusMu.Unlock()
+	st := tm.status[idpType]
+	st.LastAttempt = time.Now()
+	if err != nil {
+		st.LastError = err.Error()
+		metrics.TokenRefreshFailures.WithLabelValues(idpType).Inc()
+	} else {
+		st.LastSuccess = st.LastAttempt
+		st.LastError = ""
+	}
+	tm.status[idpType] = st
+}
+
+// Status returns whether refresh routines are running and the latest refresh outcome per IDP type
+func (tm *TokenManager) Status() (bool, map[string]IDPStatus) {
+	tm.mu.Lock()
+	running := tm.running
+	tm.mu.Unlock()
+
+	tm.statusMu.Lock()
+	defer tm.statusMu.Unlock()
+	out := make(map[string]IDPStatus, len(tm.status))
+	for idpType, st := range tm.status {
+		out[idpType] = st
+	}
+	return running, out
+}
+
+// Reload restarts the refresh routines so IDP types added or removed by a config reload
+// take effect. It is a no-op when refresh was never started.
+func (tm *TokenManager) Reload() error {
+	tm.mu.Lock()
+	running, interval := tm.running, tm.interval
+	tm.mu.Unlock()
+	if !running {
+		return nil
+	}
+	tm.StopTokenRefresh()
+	return tm.StartTokenRefresh(interval)
+}
+
+// RefreshAsync refreshes the token for an IDP type in the background without blocking the caller.
+// Calls made while a refresh for the same IDP type is already in flight are ignored.
+func (tm *TokenManager) RefreshAsync(idpType string) {
+	tm.inflight.DoChan(idpType, func() (interface{}, error) {
+		err := tm.refreshTokenForIDP(idpType)
+		if err != nil {
+			slog.Warn("failed to refresh token in background", slog.String("idp_type", idpType), slog.Any("error", err))
+		}
+		return nil, err
+	})
 }
 
 // StopTokenRefresh stops all token refresh routines
@@ -105,7 +184,7 @@ func (tm *TokenManager) StopTokenRefresh() {
 
 	for idpType, stopCh := range tm.stopCh {
 		close(stopCh)
-		log.Printf("Stopping token refresh for IDP type '%s'", idpType)
+		slog.Info("stopping token refresh", slog.String("idp_type", idpType))
 	}
 
 	tm.stopCh = make(map[string]chan struct{})
@@ -1,9 +1,17 @@
 package tokenmanager
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"reverseProxy/internal/egressconfig"
+	"reverseProxy/internal/tokenstorage"
 )
 
 func TestTokenManagerSingleton(t *testing.T) {
@@ -35,3 +43,69 @@ func TestStartTokenRefreshWithEmptyConfig(t *testing.T) {
 	// Stop the refresh
 	mgr.StopTokenRefresh()
 }
+
+func TestRefreshAsyncCollapsesConcurrentRefreshes(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"fresh","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer tokenSrv.Close()
+
+	configPath := filepath.Join(t.TempDir(), "egress-config.yaml")
+	configContent := "multi-oauth-client-config:\n  swr-idp:\n    tokenUrl: " + tokenSrv.URL + "\n    clientId: c\n    clientSecret: s\n"
+	if err := os.WriteFile(configPath, []byte(configContent), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := egressconfig.Load(configPath); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	instance = nil
+	once = sync.Once{}
+	mgr := GetInstance()
+
+	for i := 0; i < 20; i++ {
+		mgr.RefreshAsync("swr-idp")
+	}
+	close(release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !tokenstorage.GetInstance().TokenExists("swr-idp") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("Expected a single token request, got %d", got)
+	}
+	token, err := tokenstorage.GetInstance().GetToken("swr-idp")
+	if err != nil || token != "fresh" {
+		t.Errorf("Expected refreshed token 'fresh', got '%s' (%v)", token, err)
+	}
+	_ = tokenstorage.GetInstance().ClearToken("swr-idp")
+}
+
+func TestStatusAndReload(t *testing.T) {
+	instance = nil
+	once = sync.Once{}
+	mgr := GetInstance()
+
+	if running, _ := mgr.Status(); running {
+		t.Error("Expected refresh not to be running before start")
+	}
+	if err := mgr.Reload(); err != nil {
+		t.Errorf("Reload before start should be a no-op, got: %v", err)
+	}
+	if err := mgr.StartTokenRefresh(time.Minute); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer mgr.StopTokenRefresh()
+	if err := mgr.Reload(); err != nil {
+		t.Errorf("Unexpected reload error: %v", err)
+	}
+	if running, _ := mgr.Status(); !running {
+		t.Error("Expected refresh to be running after reload")
+	}
+}
@@ -72,6 +72,15 @@ func (ts *TokenStorage) GetToken(idpType string) (string, error) {
 	return string(data), nil
 }
 
+// ExpiresAt returns the expiry of the in-memory token for a given IDP type.
+// The boolean is false when no token is held in memory (e.g. only a file copy exists).
+func (ts *TokenStorage) ExpiresAt(idpType string) (time.Time, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	entry, exists := ts.tokens[idpType]
+	return entry.expiresAt, exists
+}
+
 // TokenExists checks if a token exists and is not expired
 func (ts *TokenStorage) TokenExists(idpType string) bool {
 	ts.mu.RLock()
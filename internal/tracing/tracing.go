@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies spans created by the sidecar
+const instrumentationName = "reverseProxy"
+
+// Init configures the global tracer provider and propagators from the standard OTEL_* environment:
+// OTEL_TRACES_EXPORTER (otlp or none, default none), OTEL_EXPORTER_OTLP_PROTOCOL (grpc or
+// http/protobuf), OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_PROPAGATORS (tracecontext, baggage, b3, b3multi).
+// The returned function flushes and shuts the exporter down.
+func Init(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagators(os.Getenv("OTEL_PROPAGATORS")))
+
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter == "" || exporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	} else if exporter != "otlp" {
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", exporter)
+	}
+
+	exp, err := newExporter(ctx, os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName())))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, protocol string) (*otlptrace.Exporter, error) {
+	switch protocol {
+	case "grpc":
+		return otlptracegrpc.New(ctx)
+	case "", "http/protobuf":
+		return otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q", protocol)
+	}
+}
+
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return "authn-sidecar"
+}
+
+// propagators builds the composite propagator; the default is W3C tracecontext plus baggage
+func propagators(spec string) propagation.TextMapPropagator {
+	if spec == "" {
+		spec = "tracecontext,baggage"
+	}
+	var list []propagation.TextMapPropagator
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			list = append(list, propagation.TraceContext{})
+		case "baggage":
+			list = append(list, propagation.Baggage{})
+		case "b3":
+			list = append(list, b3.New())
+		case "b3multi":
+			list = append(list, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(list...)
+}
+
+// Tracer returns the sidecar tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// StartServerSpan starts a server span for an incoming request, continuing any trace context it carries.
+// The span context derives from the request context, so deadlines and cancellation set by earlier
+// middleware reach authorization and upstream calls.
+func StartServerSpan(c fiber.Ctx, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Context(), headerCarrier{&c.Request().Header})
+	return Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// InjectFiber writes the trace context into the request headers that the fiber proxy forwards upstream
+func InjectFiber(ctx context.Context, c fiber.Ctx) {
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&c.Request().Header})
+}
+
+// InjectHTTP writes the trace context into outgoing net/http request headers
+func InjectHTTP(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// End records err (if any) on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// headerCarrier adapts fasthttp request headers to propagation.TextMapCarrier
+type headerCarrier struct {
+	h *fasthttp.RequestHeader
+}
+
+func (hc headerCarrier) Get(key string) string { return string(hc.h.Peek(key)) }
+
+func (hc headerCarrier) Set(key, value string) { hc.h.Set(key, value) }
+
+func (hc headerCarrier) Keys() []string {
+	var keys []string
+	for k := range hc.h.All() {
+		keys = append(keys, string(k))
+	}
+	return keys
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const sampleTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestPropagatorsFromSpec(t *testing.T) {
+	fields := propagators("tracecontext,b3").Fields()
+	want := map[string]bool{"traceparent": false, "b3": false}
+	for _, f := range fields {
+		if _, ok := want[f]; ok {
+			want[f] = true
+		}
+	}
+	for f, seen := range want {
+		if !seen {
+			t.Errorf("expected propagator field %q in %v", f, fields)
+		}
+	}
+	if got := propagators("").Fields(); len(got) == 0 {
+		t.Errorf("expected default propagators")
+	}
+}
+
+func TestServerSpanContinuesIncomingTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+	c.Request().Header.Set("traceparent", sampleTraceparent)
+
+	ctx, span := StartServerSpan(c, "test")
+	defer span.End()
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected incoming trace id, got %s", got)
+	}
+
+	h := http.Header{}
+	InjectHTTP(ctx, h)
+	if h.Get("traceparent") == "" {
+		t.Fatalf("expected traceparent to be injected")
+	}
+}
+
+func TestServerSpanDerivesFromRequestContext(t *testing.T) {
+	app := fiber.New()
+	c := app.AcquireCtx(&fasthttp.RequestCtx{})
+	defer app.ReleaseCtx(c)
+	parent, cancel := context.WithCancel(context.Background())
+	c.SetContext(parent)
+
+	ctx, span := StartServerSpan(c, "test")
+	defer span.End()
+	cancel()
+	if ctx.Err() == nil {
+		t.Fatalf("expected cancelling the request context to cancel the span context")
+	}
+}
+
+func TestInitWithoutExporterIsNoop(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	shutdown, err := Init(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected shutdown error: %v", err)
+	}
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "zipkin")
+	if _, err := Init(context.Background()); err == nil {
+		t.Fatalf("expected error for unsupported exporter")
+	}
+}
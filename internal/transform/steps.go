@@ -0,0 +1,137 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ohler55/ojg/jp"
+)
+
+func init() {
+	// {type: set-request-header, params: {name: X-Api-Version, value: "2"}}
+	Register("set-request-header", headerStep(func(x *Exchange, name, value string) { x.Ctx.Request().Header.Set(name, value) }, true))
+	// {type: remove-request-header, params: {name: X-Debug}}
+	Register("remove-request-header", headerStep(func(x *Exchange, name, _ string) { x.Ctx.Request().Header.Del(name) }, true))
+	// {type: set-response-header, params: {name: Cache-Control, value: no-store}}
+	Register("set-response-header", headerStep(func(x *Exchange, name, value string) { x.Ctx.Set(name, value) }, false))
+	// {type: remove-response-header, params: {name: X-Powered-By}}
+	Register("remove-response-header", headerStep(func(x *Exchange, name, _ string) { x.Ctx.Response().Header.Del(name) }, false))
+	// {type: rewrite-path, params: {pattern: "^/v1/(.*)$", replacement: "/v2/$1"}}
+	Register("rewrite-path", rewritePath)
+	// {type: set-body-field, params: {path: "$.meta.user", value: "{{ .Principal.UserID }}"}}
+	Register("set-body-field", setBodyField)
+}
+
+// headerStep builds a step that edits a header in the request or response phase
+func headerStep(apply func(x *Exchange, name, value string), request bool) Factory {
+	return func(params map[string]any) (Step, error) {
+		name, _ := params["name"].(string)
+		if name == "" {
+			return Step{}, errors.New("params.name is required")
+		}
+		value, err := parseValue(params["value"])
+		if err != nil {
+			return Step{}, err
+		}
+		run := func(x *Exchange) error {
+			v, err := value(x)
+			if err != nil || v == nil {
+				apply(x, name, "")
+				return err
+			}
+			apply(x, name, fmt.Sprint(v))
+			return nil
+		}
+		if request {
+			return Step{Request: run}, nil
+		}
+		return Step{Response: run}, nil
+	}
+}
+
+func rewritePath(params map[string]any) (Step, error) {
+	pattern, _ := params["pattern"].(string)
+	replacement, _ := params["replacement"].(string)
+	if pattern == "" {
+		return Step{}, errors.New("params.pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Step{}, fmt.Errorf("params.pattern: %w", err)
+	}
+	return Step{Request: func(x *Exchange) error {
+		path := re.ReplaceAllString(x.Path, replacement)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		x.Path = path
+		return nil
+	}}, nil
+}
+
+// setBodyField sets a field of a JSON request body; requests without a body are left alone
+func setBodyField(params map[string]any) (Step, error) {
+	path, _ := params["path"].(string)
+	if path == "" {
+		return Step{}, errors.New("params.path is required")
+	}
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	expr, err := jp.ParseString(path)
+	if err != nil {
+		return Step{}, fmt.Errorf("params.path: %w", err)
+	}
+	value, err := parseValue(params["value"])
+	if err != nil {
+		return Step{}, err
+	}
+	return Step{Request: func(x *Exchange) error {
+		req := x.Ctx.Request()
+		if len(req.Body()) == 0 {
+			return nil
+		}
+		var doc any
+		if err := json.Unmarshal(req.Body(), &doc); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "request body is not JSON")
+		}
+		v, err := value(x)
+		if err != nil {
+			return err
+		}
+		if err := expr.Set(doc, v); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "request body cannot take field "+path)
+		}
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		req.SetBodyRaw(b)
+		return nil
+	}}, nil
+}
+
+// parseValue returns the value of a step: a string containing {{ is a template rendered per
+// request, anything else is used as is
+func parseValue(raw any) (func(x *Exchange) (any, error), error) {
+	s, ok := raw.(string)
+	if !ok || !strings.Contains(s, "{{") {
+		return func(*Exchange) (any, error) { return raw, nil }, nil
+	}
+	tmpl, err := template.New("value").Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("params.value: %w", err)
+	}
+	return func(x *Exchange) (any, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, x); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	}, nil
+}
@@ -0,0 +1,135 @@
+// Package transform runs the request and response transformation steps declared in
+// ingress-config.yaml (set a header, rewrite the path, template a JSON body field), so common
+// gateway tweaks need no change to the proxy handler. Further step types are added with Register.
+package transform
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+// Spec declares one step of a chain
+type Spec struct {
+	Type   string         `yaml:"type"`
+	Params map[string]any `yaml:"params"`
+}
+
+// Step is a compiled transformation. Request runs before the request is proxied and Response on
+// the upstream response; either may be nil.
+type Step struct {
+	Request  func(x *Exchange) error
+	Response func(x *Exchange) error
+}
+
+// Factory compiles the params of a step type, rejecting invalid ones at config load
+type Factory func(params map[string]any) (Step, error)
+
+// Exchange is the request a chain transforms; its exported fields and methods are also the data
+// of value templates, as in {{ .Principal.UserID }} or {{ .Header "X-Tenant" }}
+type Exchange struct {
+	Ctx fiber.Ctx
+	// Path is the upstream path, which steps may rewrite
+	Path      string
+	Principal jwtauth.Principal
+}
+
+// Method returns the request method
+func (x *Exchange) Method() string { return x.Ctx.Method() }
+
+// Header returns a request header
+func (x *Exchange) Header(name string) string { return x.Ctx.Get(name) }
+
+// Query returns a query parameter
+func (x *Exchange) Query(name string) string { return x.Ctx.Query(name) }
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+)
+
+// Register adds or replaces a step type; call it before the ingress config is loaded
+func Register(stepType string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[stepType] = f
+}
+
+// Chain is a compiled list of steps, run in order. It unmarshals from a YAML list of specs,
+// compiling each one, and marshals back to the specs.
+type Chain struct {
+	specs []Spec
+	steps []Step
+}
+
+// Compile builds a chain from specs
+func Compile(specs []Spec) (Chain, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c := Chain{specs: specs, steps: make([]Step, 0, len(specs))}
+	for i, s := range specs {
+		f, ok := factories[s.Type]
+		if !ok {
+			return Chain{}, fmt.Errorf("transforms %d: unknown type %q", i, s.Type)
+		}
+		step, err := f(s.Params)
+		if err != nil {
+			return Chain{}, fmt.Errorf("transforms %d (%s): %w", i, s.Type, err)
+		}
+		c.steps = append(c.steps, step)
+	}
+	return c, nil
+}
+
+// UnmarshalYAML compiles the chain, rejecting unknown types and invalid params at load time
+func (c *Chain) UnmarshalYAML(unmarshal func(any) error) error {
+	var specs []Spec
+	if err := unmarshal(&specs); err != nil {
+		return err
+	}
+	compiled, err := Compile(specs)
+	if err != nil {
+		return err
+	}
+	*c = compiled
+	return nil
+}
+
+// MarshalYAML renders the chain as the specs it was compiled from
+func (c Chain) MarshalYAML() (any, error) { return c.specs, nil }
+
+// Empty reports whether the chain has no steps
+func (c Chain) Empty() bool { return len(c.steps) == 0 }
+
+// Request runs the request phase of the chains in order
+func Request(x *Exchange, chains ...Chain) error {
+	for _, c := range chains {
+		for _, s := range c.steps {
+			if s.Request == nil {
+				continue
+			}
+			if err := s.Request(x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Response runs the response phase of the chains in order
+func Response(x *Exchange, chains ...Chain) error {
+	for _, c := range chains {
+		for _, s := range c.steps {
+			if s.Response == nil {
+				continue
+			}
+			if err := s.Response(x); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
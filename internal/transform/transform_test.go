@@ -0,0 +1,96 @@
+package transform
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"gopkg.in/yaml.v3"
+
+	"reverseProxy/internal/jwtauth"
+)
+
+const chainYAML = `
+- type: set-request-header
+  params: {name: X-Caller, value: "{{ .Principal.UserID }}/{{ .Header \"X-Tenant\" }}"}
+- type: remove-request-header
+  params: {name: X-Debug}
+- type: rewrite-path
+  params: {pattern: "^/v1/(.*)$", replacement: "/v2/$1"}
+- type: set-body-field
+  params: {path: "$.meta.source", value: "{{ .Method }}"}
+- type: set-body-field
+  params: {path: count, value: 3}
+- type: set-response-header
+  params: {name: Cache-Control, value: no-store}
+`
+
+func TestChain(t *testing.T) {
+	var chain Chain
+	if err := yaml.Unmarshal([]byte(chainYAML), &chain); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/*", func(c fiber.Ctx) error {
+		x := &Exchange{Ctx: c, Path: "/v1/orders", Principal: jwtauth.Principal{UserID: "u1"}}
+		if err := Request(x, chain); err != nil {
+			return err
+		}
+		if x.Path != "/v2/orders" {
+			t.Errorf("expected the path rewritten, got %s", x.Path)
+		}
+		if got := c.Get("X-Caller"); got != "u1/acme" {
+			t.Errorf("expected the templated header, got %q", got)
+		}
+		if c.Get("X-Debug") != "" {
+			t.Errorf("expected X-Debug removed")
+		}
+		body := string(c.Request().Body())
+		if err := Response(x, chain); err != nil {
+			return err
+		}
+		return c.SendString(body)
+	})
+	req := httptest.NewRequest("POST", "/v1/orders", strings.NewReader(`{"meta":{"id":1}}`))
+	req.Header.Set("X-Tenant", "acme")
+	req.Header.Set("X-Debug", "1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if string(b) != `{"count":3,"meta":{"id":1,"source":"POST"}}` {
+		t.Fatalf("unexpected body %s", b)
+	}
+	if resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected the response header, got %v", resp.Header)
+	}
+
+	out, err := yaml.Marshal(chain)
+	if err != nil || !strings.Contains(string(out), "rewrite-path") {
+		t.Fatalf("expected the chain to marshal back to its specs, got %s %v", out, err)
+	}
+}
+
+func TestCompileRejectsInvalidSteps(t *testing.T) {
+	for _, specs := range [][]Spec{
+		{{Type: "unknown"}},
+		{{Type: "set-request-header"}},
+		{{Type: "rewrite-path", Params: map[string]any{"pattern": "("}}},
+		{{Type: "set-body-field", Params: map[string]any{"path": "$.a", "value": "{{ .Nope"}}},
+	} {
+		if _, err := Compile(specs); err == nil {
+			t.Errorf("expected %+v to be rejected", specs)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-noop", func(map[string]any) (Step, error) { return Step{}, nil })
+	if _, err := Compile([]Spec{{Type: "test-noop"}}); err != nil {
+		t.Fatalf("expected a registered type to compile: %v", err)
+	}
+}
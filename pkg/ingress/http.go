@@ -0,0 +1,132 @@
+package ingress
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"go.opentelemetry.io/otel/trace"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+// principalKey is the context key of the principal handed to net/http handlers
+type principalKey struct{}
+
+// requestKey is the fiber local holding the original net/http request
+type requestKey struct{}
+
+// NewHTTPMiddleware is NewAuthMiddleware for net/http services (stdlib, chi, gin through its
+// net/http wrapping): the returned middleware runs the same pipeline and, once a request is admitted,
+// calls next with the principal headers and token mode applied and the principal in the request
+// context. Request bodies are read up to the route's body cap before admission, and client
+// certificates are not seen, so mTLS routes cannot authenticate through it.
+func NewHTTPMiddleware(ctx context.Context, cfg Config) (func(http.Handler) http.Handler, error) {
+	mw, err := NewAuthMiddleware(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Use(mw)
+		app.Use(func(c fiber.Ctx) error {
+			orig, _ := c.Locals(requestKey{}).(*http.Request)
+			// Keep the caller's context, carrying the middleware's span and the principal into it
+			reqCtx := trace.ContextWithSpan(orig.Context(), trace.SpanFromContext(c.Context()))
+			if principal, ok := PrincipalFrom(c); ok {
+				reqCtx = context.WithValue(reqCtx, principalKey{}, principal)
+			}
+			fasthttpadaptor.NewFastHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(reqCtx))
+			}))(c.RequestCtx())
+			return nil
+		})
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fctx, err := toFastHTTP(r)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			fctx.SetUserValue(requestKey{}, r)
+			app.Handler()(fctx)
+			writeResponse(w, &fctx.Response)
+		})
+	}, nil
+}
+
+// PrincipalFromContext returns the principal NewHTTPMiddleware authenticated, and false on public paths
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// toFastHTTP copies r into a request context the Fiber pipeline can run on. The body is read up to
+// one byte past the route's cap, so oversized requests are still refused as too large.
+func toFastHTTP(r *http.Request) (*fasthttp.RequestCtx, error) {
+	var req fasthttp.Request
+	req.Header.SetMethod(r.Method)
+	req.SetRequestURI(r.URL.RequestURI())
+	req.SetHost(r.Host)
+	for name, values := range r.Header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if r.Body != nil {
+		hostname := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			hostname = h
+		}
+		conf := ingressconfig.ConfigOrNil()
+		route, _ := conf.MatchRoute(hostname, r.URL.Path)
+		body, err := io.ReadAll(io.LimitReader(r.Body, int64(conf.BodyLimit(route))+1))
+		if err != nil {
+			return nil, err
+		}
+		req.SetBody(body)
+	}
+
+	var remote net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		remote = addr
+	}
+	fctx := new(fasthttp.RequestCtx)
+	fctx.Init(&req, remote, nil)
+	return fctx, nil
+}
+
+// writeResponse copies the pipeline's response to w, streaming bodies the next handler flushed
+func writeResponse(w http.ResponseWriter, resp *fasthttp.Response) {
+	for name, value := range resp.Header.All() {
+		w.Header().Add(string(name), string(value))
+	}
+	stream := resp.BodyStream()
+	if stream != nil {
+		w.Header().Del(fiber.HeaderContentLength)
+	}
+	w.WriteHeader(resp.StatusCode())
+	if stream == nil {
+		_, _ = w.Write(resp.Body())
+		return
+	}
+	defer func() { _ = resp.CloseBodyStream() }()
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
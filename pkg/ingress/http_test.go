@@ -0,0 +1,56 @@
+package ingress
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestNewHTTPMiddleware(t *testing.T) {
+	path, signed := testIssuer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mw, err := NewHTTPMiddleware(ctx, Config{IngressConfig: path})
+	if err != nil {
+		t.Fatalf("NewHTTPMiddleware: %v", err)
+	}
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(ctxKey{}) != "caller" {
+			t.Error("expected the caller's request context to reach the handler")
+		}
+		body, _ := io.ReadAll(r.Body)
+		p, ok := PrincipalFromContext(r.Context())
+		if !ok {
+			_, _ = io.WriteString(w, "anonymous:"+string(body))
+			return
+		}
+		_, _ = io.WriteString(w, p.Username+":"+string(body))
+	}))
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+		body        string
+	}{
+		{"/orders", signed, http.StatusOK, "alice:payload"},
+		{"/orders", "", http.StatusUnauthorized, ""},
+		{"/health", "", http.StatusOK, "anonymous:payload"},
+	} {
+		req := httptest.NewRequest("POST", tc.path, strings.NewReader("payload"))
+		req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "caller"))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.status || (tc.body != "" && rec.Body.String() != tc.body) {
+			t.Fatalf("%s: expected %d %q, got %d %q", tc.path, tc.status, tc.body, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Package ingress embeds the sidecar's ingress authentication and authorization pipeline in a Go
+// service built on Fiber, so the service enforces the same ingress-config.yaml and authorization.yaml
+// in-process instead of behind the proxy.
+package ingress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+
+	"reverseProxy/internal/authorization"
+	"reverseProxy/internal/ingressconfig"
+	"reverseProxy/internal/jwtauth"
+	"reverseProxy/internal/plugins"
+	"reverseProxy/internal/proxyhandler"
+	"reverseProxy/internal/revocation"
+)
+
+// Principal is the authenticated caller of a request
+type Principal = jwtauth.Principal
+
+// Config locates the sidecar configuration files the middleware enforces
+type Config struct {
+	// IngressConfig is the ingress-config.yaml path (default ingress-config.yaml). authn.issuers is
+	// required; routes contribute their authn, public paths, rate limits and body caps, while
+	// upstreams, retries and other proxying options are ignored.
+	IngressConfig string
+	// Authorization is the authorization.yaml path; empty runs without external authorization
+	Authorization string
+}
+
+// NewAuthMiddleware loads cfg and returns a Fiber middleware that authenticates, rate-limits and
+// authorizes each request before handing it to the next handler. Issuer keys are refreshed in the
+// background until ctx is done. The configuration is process-wide, as in the sidecar: a second call
+// replaces the first's.
+func NewAuthMiddleware(ctx context.Context, cfg Config) (fiber.Handler, error) {
+	if err := ingressconfig.Load(cfg.IngressConfig); err != nil {
+		return nil, fmt.Errorf("ingress config: %w", err)
+	}
+	if !jwtauth.IssuersConfigured() {
+		return nil, errors.New("no token issuers configured: set authn.issuers in the ingress config")
+	}
+	if err := jwtauth.Discover(); err != nil {
+		return nil, fmt.Errorf("discovering token issuers: %w", err)
+	}
+	if err := jwtauth.FetchIssuerKeys(); err != nil {
+		return nil, fmt.Errorf("fetching public keys: %w", err)
+	}
+	if err := plugins.Load(ctx, ingressconfig.ConfigOrNil().Plugins); err != nil {
+		return nil, fmt.Errorf("loading plugins: %w", err)
+	}
+	if cfg.Authorization != "" {
+		if err := authorization.Load(cfg.Authorization); err != nil {
+			return nil, fmt.Errorf("authorization config: %w", err)
+		}
+	}
+	go jwtauth.RunRefresh(ctx)
+	go revocation.Run(ctx)
+	return proxyhandler.Middleware, nil
+}
+
+// PrincipalFrom returns the principal the middleware authenticated, and false on public paths
+func PrincipalFrom(c fiber.Ctx) (Principal, bool) {
+	p, ok := c.Locals("Principal").(Principal)
+	return p, ok
+}
+
+// ErrorHandler writes refusals as the sidecar does: deny responses as configured in authorization.yaml,
+// other errors in the configured error-responses format. Set it as the app's fiber.Config.ErrorHandler.
+func ErrorHandler(c fiber.Ctx, err error) error {
+	return proxyhandler.ErrorHandler(c, err)
+}
@@ -0,0 +1,111 @@
+package ingress
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/golang-jwt/jwt/v5"
+
+	"reverseProxy/internal/ingressconfig"
+)
+
+func TestNewAuthMiddleware(t *testing.T) {
+	path, signed := testIssuer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mw, err := NewAuthMiddleware(ctx, Config{IngressConfig: path})
+	if err != nil {
+		t.Fatalf("NewAuthMiddleware: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(mw)
+	app.Get("/*", func(c fiber.Ctx) error {
+		p, ok := PrincipalFrom(c)
+		if !ok {
+			return c.SendString("anonymous")
+		}
+		return c.SendString(p.Username)
+	})
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+		body        string
+	}{
+		{"/orders", signed, fiber.StatusOK, "alice"},
+		{"/orders", "", fiber.StatusUnauthorized, ""},
+		{"/health", "", fiber.StatusOK, "anonymous"},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := app.Test(req, fiber.TestConfig{Timeout: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status || (tc.body != "" && string(body) != tc.body) {
+			t.Fatalf("%s: expected %d %q, got %d %q", tc.path, tc.status, tc.body, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestNewAuthMiddleware_RequiresIssuers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ingress-config.yaml")
+	if err := os.WriteFile(path, []byte("default-upstream: http://app\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+	if _, err := NewAuthMiddleware(context.Background(), Config{IngressConfig: path}); err == nil {
+		t.Fatal("expected an error without authn.issuers")
+	}
+}
+
+// testIssuer serves a JWKS, writes an ingress config trusting it with /health public, and returns
+// the config path and a token for alice signed with its key
+func testIssuer(t *testing.T) (string, string) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(jwks.Close)
+
+	path := filepath.Join(t.TempDir(), "ingress-config.yaml")
+	conf := "public-paths: [/health]\nauthn:\n  issuers:\n    - issuer: https://idp.test\n      jwks-url: " + jwks.URL + "\n"
+	if err := os.WriteFile(path, []byte(conf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ingressconfig.SetConfigForTest(nil) })
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": "https://idp.test", "username": "alice", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	tok.Header["kid"] = "k1"
+	signed, err := tok.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, signed
+}